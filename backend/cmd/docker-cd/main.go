@@ -15,8 +15,10 @@ import (
 	"github.com/lucasreiners/docker-cd/internal/events"
 	gitval "github.com/lucasreiners/docker-cd/internal/git"
 	handler "github.com/lucasreiners/docker-cd/internal/http"
+	"github.com/lucasreiners/docker-cd/internal/persist"
 	"github.com/lucasreiners/docker-cd/internal/reconcile"
 	"github.com/lucasreiners/docker-cd/internal/refresh"
+	"github.com/lucasreiners/docker-cd/internal/registry"
 )
 
 func main() {
@@ -55,8 +57,20 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	gitAuth := gitval.NewCredentials(cfg)
+
+	// Optional on-disk clone cache shared by validation, the tree lister and the reader
+	// The deploy dir is only checked up front when the cache makes it cheap.
+	var repoCache *gitval.RepoCache
+	var pathCheckers []gitval.PathChecker
+	if cfg.GitCacheDir != "" {
+		repoCache = gitval.NewRepoCache(cfg.GitCacheDir)
+		pathCheckers = append(pathCheckers, &gitval.GoGitPathChecker{Cache: repoCache})
+		logger.Info("using git clone cache", "dir", cfg.GitCacheDir)
+	}
+
 	lister := &gitval.GoGitRemoteLister{}
-	result := gitval.Validate(ctx, lister, cfg.GitRepoURL, cfg.GitAccessToken, cfg.GitRevision, cfg.GitDeployDir)
+	result := gitval.Validate(ctx, lister, cfg.GitRepoURL, gitAuth, cfg.GitRevision, cfg.GitDeployDir, pathCheckers...)
 	if !result.Success {
 		logger.Error("repository validation failed", "error", result.Error)
 		os.Exit(1)
@@ -67,8 +81,8 @@ func main() {
 
 	// Count folders in the deploy directory (or repo root)
 	deployPath := cfg.GitDeployDir
-	treeLister := &gitval.GoGitTreeLister{}
-	dirCount, err := treeLister.CountDirs(ctx, cfg.GitRepoURL, cfg.GitAccessToken, cfg.GitRevision, deployPath)
+	treeLister := &gitval.GoGitTreeLister{Cache: repoCache}
+	dirCount, err := treeLister.CountDirs(ctx, cfg.GitRepoURL, gitAuth, cfg.GitRevision, deployPath)
 	if err != nil {
 		logger.Warn("could not count folders in deploy dir", "error", err)
 	} else {
@@ -83,9 +97,31 @@ func main() {
 
 	// Initialize desired-state refresh pipeline
 	store := desiredstate.NewStore()
+
+	// Restore the last desired state, so stacks keep their status across
+	// restarts instead of showing missing until the first refresh completes
+	var db *persist.DB
+	if cfg.DataDir != "" {
+		db, err = persist.Open(cfg.DataDir, cfg.HistoryLimit)
+		if err != nil {
+			logger.Error("data dir setup failed", "dir", cfg.DataDir, "error", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+		if snap, err := db.LoadSnapshot(); err != nil {
+			logger.Warn("could not restore desired state, starting empty", "error", err)
+		} else if snap != nil {
+			store.Set(snap)
+			logger.Info("restored desired state", "revision", snap.Revision, "stacks", len(snap.Stacks))
+		}
+	}
 	broadcaster := desiredstate.NewBroadcaster()
 	queue := refresh.NewQueue()
-	composeReader := &gitval.GoGitComposeReader{}
+	composeReader := &gitval.GoGitComposeReader{
+		Cache:            repoCache,
+		ComposeFileNames: cfg.StackComposeFiles,
+		Ignore:           cfg.StackIgnore,
+	}
 	refreshSvc := refresh.NewService(cfg, store, queue, composeReader)
 	refreshSvc.SetBroadcaster(broadcaster)
 
@@ -96,24 +132,69 @@ func main() {
 	// Initialize reconciler
 	policy := reconcile.ReconciliationPolicy{
 		Enabled:        cfg.ReconcileEnabled,
+		DryRun:         cfg.ReconcileDryRun,
 		RemoveEnabled:  cfg.ReconcileRemoveEnabled,
 		DriftPolicy:    cfg.DriftPolicy,
-		MaxConcurrency: 1,
+		MaxConcurrency: cfg.ReconcileMaxConcurrency,
+		HealthTimeout:  cfg.SyncHealthTimeout,
+		PullPolicy:     cfg.PullPolicy,
+		RetryBaseDelay: cfg.RetryBackoffBase,
+		RetryMaxDelay:  cfg.RetryBackoffMax,
+		SyncWindows:    cfg.SyncWindows,
+
+		RemovalGracePeriod:    cfg.RemovalGracePeriod,
+		RemovalGraceRefreshes: cfg.RemovalGraceRefreshes,
+		RemovalMaxPercent:     cfg.RemovalMaxPercent,
+	}
+	dockerClient, err := docker.NewEngine(cfg.DockerClient, runner, cfg.DockerSocket)
+	if err != nil {
+		logger.Error("docker client setup failed", "error", err)
+		os.Exit(1)
 	}
-	dockerClient := docker.NewClient(runner, cfg.DockerSocket)
+	logger.Info("using docker client", "kind", cfg.DockerClient)
 	composeRunner := reconcile.NewDockerComposeRunner(runner, cfg.DockerSocket)
+	owner := reconcile.Owner{
+		InstanceID:     cfg.InstanceID,
+		DeployDir:      cfg.GitDeployDir,
+		ProjectPrefix:  cfg.StackProjectPrefix,
+		AdoptUnlabeled: cfg.AdoptUnlabeledStacks,
+	}
 	inspector := reconcile.NewDockerContainerInspector(dockerClient)
+	inspector.Owner = owner
 	ackStore := reconcile.NewAckStore()
+	if db != nil {
+		if err := ackStore.SetPersister(db); err != nil {
+			logger.Warn("could not restore acknowledgements", "error", err)
+		}
+	}
 
 	// Initialize drift detector and state manager
-	driftDetector := reconcile.NewDriftDetector(cfg.GitDeployDir, logger)
+	driftDetector := reconcile.NewDriftDetector(owner, logger)
 	stateManager := reconcile.NewStateManager(store, composeRunner, eventBus, logger)
 
 	reconciler := reconcile.NewReconciler(store, policy, composeRunner, inspector, ackStore, cfg.GitDeployDir, driftDetector, stateManager)
+	reconciler.SetOwner(owner)
+	if db != nil {
+		reconciler.SetHistory(db)
+		if err := reconciler.SetSuspensionPersister(db); err != nil {
+			logger.Warn("could not restore stack suspensions", "error", err)
+		}
+		if err := reconciler.SetRemovalPersister(db); err != nil {
+			logger.Warn("could not restore pending removals", "error", err)
+		}
+	} else {
+		reconciler.SetHistory(reconcile.NewMemoryHistory(cfg.HistoryLimit))
+	}
+	reconciler.SetBroadcaster(broadcaster)
+	reconciler.SetStackLoader(gitval.NewStackLoader(cfg.GitRepoURL, gitAuth, repoCache, cfg.GitDeployDir, cfg.StackComposeFiles))
+	if cfg.StackWorkDir != "" {
+		reconciler.SetWorkspace(gitval.NewWorkspace(cfg.StackWorkDir, cfg.GitRepoURL, gitAuth, repoCache, cfg.GitDeployDir))
+		logger.Info("checking out stacks into work dir", "dir", cfg.StackWorkDir)
+	}
 
 	// Wire reconciler into refresh pipeline
-	refreshSvc.SetReconcileFunc(func(ctx context.Context) {
-		runs := reconciler.Reconcile(ctx)
+	refreshSvc.SetReconcileFunc(func(ctx context.Context, source refresh.TriggerSource) {
+		runs := reconciler.Reconcile(reconcile.WithTrigger(ctx, string(source)))
 		for _, run := range runs {
 			logger.Info("reconcile completed",
 				"stack", run.StackPath,
@@ -125,9 +206,34 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	// Persist desired state changes from refreshes and reconciles
+	var storeSaved <-chan struct{}
+	if db != nil {
+		storeSaved = db.SyncStore(ctx, store, func(err error) {
+			logger.Warn("could not persist desired state", "error", err)
+		})
+	}
+
 	// Start background refresh loop
 	go refreshSvc.Start(ctx)
 
+	// Retry failed stacks on their own backoff schedule, between refreshes
+	go reconciler.RunRetries(ctx)
+
+	// Sync stacks deferred by their sync windows when the windows open
+	go reconciler.RunSyncWindows(ctx)
+
+	// Check stacks for drift as soon as Docker reports changes to their containers
+	if cfg.ReconcileEnabled && cfg.DockerEventsEnabled {
+		go reconcile.NewRuntimeWatcher(dockerClient, reconciler).Run(ctx)
+	}
+
+	// Redeploy opted-in stacks when their image tags point to new digests
+	if cfg.ReconcileEnabled && cfg.ImageCheckInterval > 0 {
+		resolver := registry.NewClient(cfg.RegistryInsecure)
+		go reconcile.NewImageWatcher(resolver, dockerClient, reconciler, cfg.ImageCheckInterval).Run(ctx)
+	}
+
 	router := handler.NewRouter(runner, cfg, refreshSvc, store, ackStore, reconciler, broadcaster)
 
 	addr := fmt.Sprintf(":%d", cfg.Port)
@@ -153,6 +259,11 @@ func main() {
 		// TODO: Implement graceful shutdown for services
 		_ = shutdownCtx
 
+		// Let the final desired state save finish before the deferred db.Close
+		if storeSaved != nil {
+			<-storeSaved
+		}
+
 		logger.Info("shutdown complete")
 	case err := <-errChan:
 		logger.Error("server error", "error", err)
@@ -162,25 +273,19 @@ func main() {
 
 // setupEventHandlers subscribes event handlers that forward domain events to the SSE broadcaster.
 func setupEventHandlers(eventBus *events.EventBus, broadcaster *desiredstate.Broadcaster, store *desiredstate.Store) {
+	// publishStack broadcasts the current record of a stack, if it is listed.
+	publishStack := func(path string) {
+		if stack, ok := store.GetStack(path); ok {
+			broadcaster.PublishStackUpsert(stack)
+		}
+	}
+
 	// Forward all stack update events to SSE broadcaster
 	eventBus.Subscribe(events.EventTypeStackStatusChanged, func(ctx context.Context, event events.Event) error {
 		if broadcaster == nil {
 			return nil
 		}
-
-		e := event.(*events.StackStatusChangedEvent)
-		snap := store.Get()
-		if snap == nil {
-			return nil
-		}
-
-		// Find the updated stack record and broadcast it
-		for _, stack := range snap.Stacks {
-			if stack.Path == e.StackPath {
-				broadcaster.PublishStackUpsert(stack)
-				break
-			}
-		}
+		publishStack(event.(*events.StackStatusChangedEvent).StackPath)
 		return nil
 	})
 
@@ -188,40 +293,37 @@ func setupEventHandlers(eventBus *events.EventBus, broadcaster *desiredstate.Bro
 		if broadcaster == nil {
 			return nil
 		}
+		publishStack(event.(*events.StackSyncedEvent).StackPath)
+		return nil
+	})
 
-		e := event.(*events.StackSyncedEvent)
-		snap := store.Get()
-		if snap == nil {
+	eventBus.Subscribe(events.EventTypeContainersUpdated, func(ctx context.Context, event events.Event) error {
+		if broadcaster == nil {
 			return nil
 		}
-
-		// Find the synced stack record and broadcast it
-		for _, stack := range snap.Stacks {
-			if stack.Path == e.StackPath {
-				broadcaster.PublishStackUpsert(stack)
-				break
-			}
-		}
+		publishStack(event.(*events.ContainersUpdatedEvent).StackPath)
 		return nil
 	})
 
-	eventBus.Subscribe(events.EventTypeContainersUpdated, func(ctx context.Context, event events.Event) error {
+	eventBus.Subscribe(events.EventTypeStackRolledBack, func(ctx context.Context, event events.Event) error {
 		if broadcaster == nil {
 			return nil
 		}
+		publishStack(event.(*events.StackRolledBackEvent).StackPath)
+		return nil
+	})
 
-		e := event.(*events.ContainersUpdatedEvent)
-		snap := store.Get()
-		if snap == nil {
+	// A stack that is no longer pending removal is either gone or listed
+	// again as restored in Git.
+	eventBus.Subscribe(events.EventTypeStackRemoved, func(ctx context.Context, event events.Event) error {
+		if broadcaster == nil {
 			return nil
 		}
-
-		// Find the updated stack record and broadcast it
-		for _, stack := range snap.Stacks {
-			if stack.Path == e.StackPath {
-				broadcaster.PublishStackUpsert(stack)
-				break
-			}
+		e := event.(*events.StackRemovedEvent)
+		if stack, ok := store.GetStack(e.StackPath); ok {
+			broadcaster.PublishStackUpsert(stack)
+		} else {
+			broadcaster.PublishStackDelete(e.StackPath)
 		}
 		return nil
 	})
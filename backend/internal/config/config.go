@@ -4,9 +4,14 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/syncwindow"
 )
 
 // DriftPolicy constants define how to handle configuration drift.
@@ -15,11 +20,72 @@ const (
 	DriftPolicyFlag   = "flag"   // Flag drift but don't auto-revert
 )
 
+// DockerClient constants select the Docker engine client.
+const (
+	DockerClientCLI = "cli" // exec the docker binary
+	DockerClientAPI = "api" // talk to the Engine API over the socket
+)
+
+// DefaultComposeFileNames are the compose file names that mark a stack
+// directory, in order of preference.
+var DefaultComposeFileNames = []string{"docker-compose.yml", "docker-compose.yaml", "compose.yaml", "compose.yml"}
+
+// DefaultReconcileMaxConcurrency is the number of stacks synced in parallel
+// when RECONCILE_MAX_CONCURRENCY is not set.
+const DefaultReconcileMaxConcurrency = 4
+
+// DefaultRetryBackoffBase and DefaultRetryBackoffMax bound the backoff between
+// retries of a failed sync when RETRY_BACKOFF_BASE / RETRY_BACKOFF_MAX are not set.
+const (
+	DefaultRetryBackoffBase = 10 * time.Second
+	DefaultRetryBackoffMax  = 10 * time.Minute
+)
+
+// DefaultRemovalGraceRefreshes and DefaultRemovalMaxPercent hold back the
+// removal of stacks deleted from Git when REMOVAL_GRACE_REFRESHES /
+// REMOVAL_MAX_PERCENT are not set: a deletion must be seen by a second
+// refresh, and removals stop while more than half of the stacks would go.
+const (
+	DefaultRemovalGraceRefreshes = 2
+	DefaultRemovalMaxPercent     = 50
+)
+
+// DefaultImageCheckInterval is how often registries are checked for newer
+// images of opted-in stacks when IMAGE_CHECK_INTERVAL is not set.
+const DefaultImageCheckInterval = time.Hour
+
+// DefaultHistoryLimit is the number of sync runs kept per stack when
+// HISTORY_LIMIT is not set.
+const DefaultHistoryLimit = 50
+
+// instanceIDPattern and projectPrefixPattern restrict INSTANCE_ID and
+// STACK_PROJECT_PREFIX to characters valid in compose project names.
+var (
+	instanceIDPattern    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+	projectPrefixPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+)
+
+// DefaultStackIgnore skips hidden directories such as .github during discovery.
+var DefaultStackIgnore = []string{".*"}
+
 // Config holds runtime configuration for the Docker-CD service.
 type Config struct {
 	Port         int
 	ProjectName  string
 	DockerSocket string
+	// DockerClient selects how docker-cd talks to the engine for listing,
+	// inspecting, events and container actions: "cli" or "api".
+	DockerClient string
+
+	// InstanceID tells apart docker-cd instances sharing a Docker host and is
+	// stamped on every deployed container. StackProjectPrefix prefixes the
+	// compose project names; it defaults to the lowercased InstanceID.
+	InstanceID         string
+	StackProjectPrefix string
+	// AdoptUnlabeledStacks adopts running stacks without owner labels whose
+	// compose project name matches, e.g. when upgrading from a version that
+	// did not stamp them.
+	AdoptUnlabeledStacks bool
 
 	// Git repository settings
 	GitRepoURL     string
@@ -27,14 +93,62 @@ type Config struct {
 	GitRevision    string
 	GitDeployDir   string
 
+	// SSH deploy-key settings (used when GitRepoURL is an SSH remote)
+	GitSSHKey           string // PEM-encoded private key
+	GitSSHKeyFile       string // path to a PEM-encoded private key
+	GitSSHKeyPassphrase string
+	GitSSHKnownHosts    string // path to a known_hosts file
+
+	// GitCacheDir holds a bare clone that is fetched incrementally.
+	// Empty means every refresh performs a shallow in-memory clone.
+	// Defaults to <StackWorkDir>/.git-cache when StackWorkDir is set.
+	GitCacheDir string
+
+	// DataDir holds the database with the last desired state, drift
+	// acknowledgements and sync history. Empty keeps state in memory only.
+	DataDir string
+	// HistoryLimit is the number of sync runs kept per stack.
+	HistoryLimit int
+
+	// StackWorkDir is where stack directories are checked out for compose.
+	// Empty means only the compose file is written to a temp directory.
+	StackWorkDir string
+
+	// Stack discovery settings
+	StackComposeFiles []string // compose file names marking a stack directory, in preference order
+	StackIgnore       []string // glob patterns (path.Match) for directories skipped during discovery
+
 	// Refresh settings
 	WebhookSecret       string
 	RefreshPollInterval time.Duration
 
 	// Reconcile settings
-	ReconcileEnabled       bool
-	ReconcileRemoveEnabled bool
-	DriftPolicy            string // "revert" or "flag"
+	ReconcileEnabled        bool
+	ReconcileDryRun         bool // log the plan instead of executing it
+	DockerEventsEnabled     bool // check stacks for drift on docker container events
+	ReconcileRemoveEnabled  bool
+	DriftPolicy             string // "revert" or "flag"
+	ReconcileMaxConcurrency int    // maximum number of stacks synced in parallel
+	// PullPolicy is always, missing or never: how images are pulled before compose up.
+	PullPolicy string
+	// SyncHealthTimeout enables the health gate with rollback when positive.
+	SyncHealthTimeout time.Duration
+	// RetryBackoffBase and RetryBackoffMax bound the exponential backoff
+	// between retries of a failed sync.
+	RetryBackoffBase time.Duration
+	RetryBackoffMax  time.Duration
+	// SyncWindows restrict when drifted stacks are synced; empty allows any time.
+	SyncWindows []syncwindow.Window
+	// RemovalGracePeriod and RemovalGraceRefreshes hold back the removal of
+	// stacks deleted from Git; RemovalMaxPercent refuses removals while more
+	// than that percentage of the running stacks would be removed.
+	RemovalGracePeriod    time.Duration
+	RemovalGraceRefreshes int
+	RemovalMaxPercent     int
+
+	// Image update settings
+	ImageCheckInterval time.Duration // zero disables registry digest checks
+	RegistryInsecure   []string      // registry hosts reached over plain HTTP
 }
 
 // Load reads configuration from environment variables, falling back to defaults.
@@ -57,10 +171,63 @@ func Load() (Config, []string) {
 		dockerSocket = v
 	}
 
+	dockerClient := DockerClientCLI
+	var dockerClientErr string
+	if v := os.Getenv("DOCKER_CLIENT"); v != "" {
+		v = strings.ToLower(v)
+		if v == DockerClientCLI || v == DockerClientAPI {
+			dockerClient = v
+		} else {
+			dockerClientErr = fmt.Sprintf("DOCKER_CLIENT must be %q or %q, got %q", DockerClientCLI, DockerClientAPI, v)
+		}
+	}
+
+	instanceID := os.Getenv("INSTANCE_ID")
+	var instanceIDErr string
+	if instanceID != "" && !instanceIDPattern.MatchString(instanceID) {
+		instanceIDErr = fmt.Sprintf("INSTANCE_ID must contain only letters, digits, '-' and '_', got %q", instanceID)
+	}
+
+	stackProjectPrefix := strings.ToLower(instanceID)
+	var stackProjectPrefixErr string
+	if v, ok := os.LookupEnv("STACK_PROJECT_PREFIX"); ok {
+		if v != "" && !projectPrefixPattern.MatchString(v) {
+			stackProjectPrefixErr = fmt.Sprintf("STACK_PROJECT_PREFIX must contain only lowercase letters, digits, '-' and '_', got %q", v)
+		} else {
+			stackProjectPrefix = v
+		}
+	}
+
+	adoptUnlabeledStacks := false
+	if v := os.Getenv("ADOPT_UNLABELED_STACKS"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			adoptUnlabeledStacks = b
+		}
+	}
+
 	gitRepoURL := os.Getenv("GIT_REPO_URL")
 	gitAccessToken := os.Getenv("GIT_ACCESS_TOKEN")
 	gitRevision := os.Getenv("GIT_REVISION")
 	gitDeployDir := os.Getenv("GIT_DEPLOY_DIR")
+	gitSSHKey := os.Getenv("GIT_SSH_KEY")
+	gitSSHKeyFile := os.Getenv("GIT_SSH_KEY_FILE")
+	gitSSHKeyPassphrase := os.Getenv("GIT_SSH_KEY_PASSPHRASE")
+	gitSSHKnownHosts := os.Getenv("GIT_SSH_KNOWN_HOSTS")
+	gitCacheDir := os.Getenv("GIT_CACHE_DIR")
+	stackWorkDir := os.Getenv("STACK_WORK_DIR")
+	if gitCacheDir == "" && stackWorkDir != "" {
+		gitCacheDir = filepath.Join(stackWorkDir, ".git-cache")
+	}
+
+	stackComposeFiles := DefaultComposeFileNames
+	if v := os.Getenv("STACK_COMPOSE_FILES"); v != "" {
+		stackComposeFiles = splitList(v)
+	}
+
+	stackIgnore := DefaultStackIgnore
+	if v, ok := os.LookupEnv("STACK_IGNORE"); ok {
+		stackIgnore = splitList(v)
+	}
 
 	webhookSecret := os.Getenv("WEBHOOK_SECRET")
 
@@ -79,6 +246,20 @@ func Load() (Config, []string) {
 		}
 	}
 
+	reconcileDryRun := false
+	if v := os.Getenv("RECONCILE_DRY_RUN"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			reconcileDryRun = b
+		}
+	}
+
+	dockerEventsEnabled := true
+	if v := os.Getenv("DOCKER_EVENTS_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			dockerEventsEnabled = b
+		}
+	}
+
 	reconcileRemoveEnabled := false
 	if v := os.Getenv("RECONCILE_REMOVE_ENABLED"); v != "" {
 		if b, err := strconv.ParseBool(v); err == nil {
@@ -86,6 +267,120 @@ func Load() (Config, []string) {
 		}
 	}
 
+	reconcileMaxConcurrency := DefaultReconcileMaxConcurrency
+	var maxConcurrencyErr string
+	if v := os.Getenv("RECONCILE_MAX_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			maxConcurrencyErr = fmt.Sprintf("RECONCILE_MAX_CONCURRENCY must be a positive integer, got %q", v)
+		} else {
+			reconcileMaxConcurrency = n
+		}
+	}
+
+	pullPolicy := "missing"
+	var pullPolicyErr string
+	if v := os.Getenv("PULL_POLICY"); v != "" {
+		v = strings.ToLower(v)
+		switch v {
+		case "always", "missing", "never":
+			pullPolicy = v
+		default:
+			pullPolicyErr = fmt.Sprintf("PULL_POLICY must be always, missing or never, got %q", v)
+		}
+	}
+
+	var syncHealthTimeout time.Duration
+	if v := os.Getenv("SYNC_HEALTH_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d > 0 {
+			syncHealthTimeout = d
+		}
+	}
+
+	retryBackoffBase := DefaultRetryBackoffBase
+	if v := os.Getenv("RETRY_BACKOFF_BASE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d > 0 {
+			retryBackoffBase = d
+		}
+	}
+
+	retryBackoffMax := DefaultRetryBackoffMax
+	if v := os.Getenv("RETRY_BACKOFF_MAX"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d > 0 {
+			retryBackoffMax = d
+		}
+	}
+
+	var syncWindows []syncwindow.Window
+	var syncWindowsErr string
+	if v := os.Getenv("SYNC_WINDOWS"); v != "" {
+		windows, err := syncwindow.ParseList(v)
+		if err != nil {
+			syncWindowsErr = fmt.Sprintf("SYNC_WINDOWS: %v", err)
+		} else {
+			syncWindows = windows
+		}
+	}
+
+	var removalGracePeriod time.Duration
+	var removalGracePeriodErr string
+	if v := os.Getenv("REMOVAL_GRACE_PERIOD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			removalGracePeriodErr = fmt.Sprintf("REMOVAL_GRACE_PERIOD must be a duration, e.g. 10m, got %q", v)
+		} else {
+			removalGracePeriod = d
+		}
+	}
+
+	removalGraceRefreshes := DefaultRemovalGraceRefreshes
+	var removalGraceRefreshesErr string
+	if v := os.Getenv("REMOVAL_GRACE_REFRESHES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			removalGraceRefreshesErr = fmt.Sprintf("REMOVAL_GRACE_REFRESHES must be a non-negative integer, got %q", v)
+		} else {
+			removalGraceRefreshes = n
+		}
+	}
+
+	removalMaxPercent := DefaultRemovalMaxPercent
+	var removalMaxPercentErr string
+	if v := os.Getenv("REMOVAL_MAX_PERCENT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 100 {
+			removalMaxPercentErr = fmt.Sprintf("REMOVAL_MAX_PERCENT must be an integer from 0 to 100, got %q", v)
+		} else {
+			removalMaxPercent = n
+		}
+	}
+
+	dataDir := os.Getenv("DATA_DIR")
+
+	historyLimit := DefaultHistoryLimit
+	var historyLimitErr string
+	if v := os.Getenv("HISTORY_LIMIT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			historyLimitErr = fmt.Sprintf("HISTORY_LIMIT must be a positive integer, got %q", v)
+		} else {
+			historyLimit = n
+		}
+	}
+
+	imageCheckInterval := DefaultImageCheckInterval
+	if v := os.Getenv("IMAGE_CHECK_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d >= 0 {
+			imageCheckInterval = d
+		}
+	}
+
+	registryInsecure := splitList(os.Getenv("REGISTRY_INSECURE"))
+
 	driftPolicy := DriftPolicyRevert
 	if v := os.Getenv("DRIFT_POLICY"); v != "" {
 		v = strings.ToLower(v)
@@ -95,35 +390,98 @@ func Load() (Config, []string) {
 	}
 
 	cfg := Config{
-		Port:                   port,
-		ProjectName:            projectName,
-		DockerSocket:           dockerSocket,
-		GitRepoURL:             gitRepoURL,
-		GitAccessToken:         gitAccessToken,
-		GitRevision:            gitRevision,
-		GitDeployDir:           gitDeployDir,
-		WebhookSecret:          webhookSecret,
-		RefreshPollInterval:    refreshPollInterval,
-		ReconcileEnabled:       reconcileEnabled,
-		ReconcileRemoveEnabled: reconcileRemoveEnabled,
-		DriftPolicy:            driftPolicy,
+		Port:                    port,
+		ProjectName:             projectName,
+		DockerSocket:            dockerSocket,
+		DockerClient:            dockerClient,
+		InstanceID:              instanceID,
+		StackProjectPrefix:      stackProjectPrefix,
+		AdoptUnlabeledStacks:    adoptUnlabeledStacks,
+		GitRepoURL:              gitRepoURL,
+		GitAccessToken:          gitAccessToken,
+		GitRevision:             gitRevision,
+		GitDeployDir:            gitDeployDir,
+		GitSSHKey:               gitSSHKey,
+		GitSSHKeyFile:           gitSSHKeyFile,
+		GitSSHKeyPassphrase:     gitSSHKeyPassphrase,
+		GitSSHKnownHosts:        gitSSHKnownHosts,
+		GitCacheDir:             gitCacheDir,
+		DataDir:                 dataDir,
+		HistoryLimit:            historyLimit,
+		StackWorkDir:            stackWorkDir,
+		StackComposeFiles:       stackComposeFiles,
+		StackIgnore:             stackIgnore,
+		WebhookSecret:           webhookSecret,
+		RefreshPollInterval:     refreshPollInterval,
+		ReconcileEnabled:        reconcileEnabled,
+		ReconcileDryRun:         reconcileDryRun,
+		DockerEventsEnabled:     dockerEventsEnabled,
+		ReconcileRemoveEnabled:  reconcileRemoveEnabled,
+		DriftPolicy:             driftPolicy,
+		ReconcileMaxConcurrency: reconcileMaxConcurrency,
+		PullPolicy:              pullPolicy,
+		SyncHealthTimeout:       syncHealthTimeout,
+		RetryBackoffBase:        retryBackoffBase,
+		RetryBackoffMax:         retryBackoffMax,
+		SyncWindows:             syncWindows,
+		RemovalGracePeriod:      removalGracePeriod,
+		RemovalGraceRefreshes:   removalGraceRefreshes,
+		RemovalMaxPercent:       removalMaxPercent,
+		ImageCheckInterval:      imageCheckInterval,
+		RegistryInsecure:        registryInsecure,
 	}
 
 	var errs []string
 	if cfg.GitRepoURL == "" {
 		errs = append(errs, "GIT_REPO_URL is required")
-	} else {
-		u, err := url.Parse(cfg.GitRepoURL)
-		if err != nil || !strings.EqualFold(u.Scheme, "https") {
-			errs = append(errs, fmt.Sprintf("GIT_REPO_URL must be an HTTPS URL, got %q", cfg.GitRepoURL))
-		}
+	} else if !isHTTPSURL(cfg.GitRepoURL) && !IsSSHURL(cfg.GitRepoURL) {
+		errs = append(errs, fmt.Sprintf("GIT_REPO_URL must be an HTTPS or SSH URL, got %q", cfg.GitRepoURL))
 	}
-	if cfg.GitAccessToken == "" {
+	if IsSSHURL(cfg.GitRepoURL) {
+		if cfg.GitSSHKey == "" && cfg.GitSSHKeyFile == "" {
+			errs = append(errs, "GIT_SSH_KEY or GIT_SSH_KEY_FILE is required for SSH repositories")
+		}
+	} else if cfg.GitAccessToken == "" {
 		errs = append(errs, "GIT_ACCESS_TOKEN is required")
 	}
 	if cfg.GitRevision == "" {
 		errs = append(errs, "GIT_REVISION is required")
 	}
+	if maxConcurrencyErr != "" {
+		errs = append(errs, maxConcurrencyErr)
+	}
+	if dockerClientErr != "" {
+		errs = append(errs, dockerClientErr)
+	}
+	if instanceIDErr != "" {
+		errs = append(errs, instanceIDErr)
+	}
+	if stackProjectPrefixErr != "" {
+		errs = append(errs, stackProjectPrefixErr)
+	}
+	if pullPolicyErr != "" {
+		errs = append(errs, pullPolicyErr)
+	}
+	if historyLimitErr != "" {
+		errs = append(errs, historyLimitErr)
+	}
+	if syncWindowsErr != "" {
+		errs = append(errs, syncWindowsErr)
+	}
+	if removalGracePeriodErr != "" {
+		errs = append(errs, removalGracePeriodErr)
+	}
+	if removalGraceRefreshesErr != "" {
+		errs = append(errs, removalGraceRefreshesErr)
+	}
+	if removalMaxPercentErr != "" {
+		errs = append(errs, removalMaxPercentErr)
+	}
+	for _, pattern := range cfg.StackIgnore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("STACK_IGNORE contains an invalid glob %q", pattern))
+		}
+	}
 
 	return cfg, errs
 }
@@ -142,15 +500,46 @@ func (c *Config) Validate() error {
 	}
 
 	// Validate Git URL is parseable (in case Load was bypassed)
-	if c.GitRepoURL != "" {
+	if c.GitRepoURL != "" && !IsSSHURL(c.GitRepoURL) {
 		u, err := url.Parse(c.GitRepoURL)
 		if err != nil {
 			return fmt.Errorf("invalid GIT_REPO_URL: %w", err)
 		}
 		if !strings.EqualFold(u.Scheme, "https") {
-			return fmt.Errorf("GIT_REPO_URL must use HTTPS scheme, got %q", u.Scheme)
+			return fmt.Errorf("GIT_REPO_URL must use HTTPS or SSH scheme, got %q", u.Scheme)
 		}
 	}
 
 	return nil
 }
+
+// IsSSHURL reports whether a repository URL is an SSH remote, either
+// ssh://[user@]host/path or the scp-like form user@host:path.
+func IsSSHURL(repoURL string) bool {
+	if strings.HasPrefix(strings.ToLower(repoURL), "ssh://") {
+		return true
+	}
+	if strings.Contains(repoURL, "://") {
+		return false
+	}
+	at := strings.Index(repoURL, "@")
+	colon := strings.Index(repoURL, ":")
+	return at > 0 && colon > at+1 && colon < len(repoURL)-1
+}
+
+// splitList splits a comma-separated value, trimming blanks and dropping empty
+// items. The result is never nil, so an explicitly empty setting stays empty.
+func splitList(v string) []string {
+	items := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func isHTTPSURL(repoURL string) bool {
+	u, err := url.Parse(repoURL)
+	return err == nil && strings.EqualFold(u.Scheme, "https") && u.Host != ""
+}
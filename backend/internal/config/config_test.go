@@ -91,7 +91,7 @@ func TestLoad_MissingGitRepoURL(t *testing.T) {
 }
 
 func TestLoad_NonHTTPSRepoURL(t *testing.T) {
-	t.Setenv("GIT_REPO_URL", "git@github.com:org/repo.git")
+	t.Setenv("GIT_REPO_URL", "http://github.com/org/repo.git")
 	t.Setenv("GIT_ACCESS_TOKEN", "tok")
 	t.Setenv("GIT_REVISION", "main")
 
@@ -99,7 +99,7 @@ func TestLoad_NonHTTPSRepoURL(t *testing.T) {
 
 	found := false
 	for _, e := range errs {
-		if strings.Contains(e, "must be an HTTPS URL") {
+		if strings.Contains(e, "must be an HTTPS or SSH URL") {
 			found = true
 		}
 	}
@@ -108,6 +108,47 @@ func TestLoad_NonHTTPSRepoURL(t *testing.T) {
 	}
 }
 
+func TestLoad_SSHRepoURL_WithKeyFile(t *testing.T) {
+	for _, repoURL := range []string{"git@github.com:org/repo.git", "ssh://git@gitea.internal:2222/org/repo.git"} {
+		t.Run(repoURL, func(t *testing.T) {
+			t.Setenv("GIT_REPO_URL", repoURL)
+			t.Setenv("GIT_SSH_KEY_FILE", "/run/secrets/deploy_key")
+			t.Setenv("GIT_SSH_KNOWN_HOSTS", "/run/secrets/known_hosts")
+			t.Setenv("GIT_REVISION", "main")
+			os.Unsetenv("GIT_ACCESS_TOKEN")
+
+			cfg, errs := config.Load()
+
+			if len(errs) != 0 {
+				t.Fatalf("expected no errors, got %v", errs)
+			}
+			if cfg.GitSSHKeyFile != "/run/secrets/deploy_key" {
+				t.Errorf("expected key file, got %q", cfg.GitSSHKeyFile)
+			}
+			if cfg.GitSSHKnownHosts != "/run/secrets/known_hosts" {
+				t.Errorf("expected known_hosts file, got %q", cfg.GitSSHKnownHosts)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("expected SSH URL to pass Validate, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoad_SSHRepoURL_MissingKey(t *testing.T) {
+	t.Setenv("GIT_REPO_URL", "git@github.com:org/repo.git")
+	t.Setenv("GIT_REVISION", "main")
+	os.Unsetenv("GIT_SSH_KEY")
+	os.Unsetenv("GIT_SSH_KEY_FILE")
+	os.Unsetenv("GIT_ACCESS_TOKEN")
+
+	_, errs := config.Load()
+
+	if len(errs) != 1 || !strings.Contains(errs[0], "GIT_SSH_KEY or GIT_SSH_KEY_FILE is required") {
+		t.Errorf("expected missing SSH key error only, got %v", errs)
+	}
+}
+
 func TestLoad_MissingAllGitFields(t *testing.T) {
 	os.Unsetenv("GIT_REPO_URL")
 	os.Unsetenv("GIT_ACCESS_TOKEN")
@@ -343,3 +384,247 @@ func TestLoad_DriftPolicyInvalid(t *testing.T) {
 		t.Errorf("expected drift policy revert for invalid value, got %q", cfg.DriftPolicy)
 	}
 }
+
+func TestLoad_StackDiscoveryDefaults(t *testing.T) {
+	t.Setenv("GIT_REPO_URL", "https://github.com/example/repo.git")
+	t.Setenv("GIT_ACCESS_TOKEN", "tok")
+	t.Setenv("GIT_REVISION", "main")
+	os.Unsetenv("STACK_COMPOSE_FILES")
+	os.Unsetenv("STACK_IGNORE")
+
+	cfg, errs := config.Load()
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if strings.Join(cfg.StackComposeFiles, ",") != "docker-compose.yml,docker-compose.yaml,compose.yaml,compose.yml" {
+		t.Errorf("unexpected default compose files %v", cfg.StackComposeFiles)
+	}
+	if strings.Join(cfg.StackIgnore, ",") != ".*" {
+		t.Errorf("unexpected default ignore list %v", cfg.StackIgnore)
+	}
+}
+
+func TestLoad_StackDiscoveryOverrides(t *testing.T) {
+	t.Setenv("GIT_REPO_URL", "https://github.com/example/repo.git")
+	t.Setenv("GIT_ACCESS_TOKEN", "tok")
+	t.Setenv("GIT_REVISION", "main")
+	t.Setenv("STACK_COMPOSE_FILES", "compose.yaml, stack.yml")
+	t.Setenv("STACK_IGNORE", "")
+
+	cfg, errs := config.Load()
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if strings.Join(cfg.StackComposeFiles, ",") != "compose.yaml,stack.yml" {
+		t.Errorf("unexpected compose files %v", cfg.StackComposeFiles)
+	}
+	if cfg.StackIgnore == nil || len(cfg.StackIgnore) != 0 {
+		t.Errorf("expected explicitly empty ignore list, got %#v", cfg.StackIgnore)
+	}
+}
+
+func TestLoad_StackIgnoreInvalidGlob(t *testing.T) {
+	t.Setenv("GIT_REPO_URL", "https://github.com/example/repo.git")
+	t.Setenv("GIT_ACCESS_TOKEN", "tok")
+	t.Setenv("GIT_REVISION", "main")
+	t.Setenv("STACK_IGNORE", "docs,[")
+
+	_, errs := config.Load()
+	if len(errs) != 1 || !strings.Contains(errs[0], "STACK_IGNORE") {
+		t.Errorf("expected STACK_IGNORE error, got %v", errs)
+	}
+}
+
+func TestLoad_ReconcileMaxConcurrency(t *testing.T) {
+	t.Setenv("GIT_REPO_URL", "https://github.com/example/repo.git")
+	t.Setenv("GIT_ACCESS_TOKEN", "tok")
+	t.Setenv("GIT_REVISION", "main")
+	os.Unsetenv("RECONCILE_MAX_CONCURRENCY")
+
+	cfg, errs := config.Load()
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if cfg.ReconcileMaxConcurrency != config.DefaultReconcileMaxConcurrency {
+		t.Errorf("expected default concurrency, got %d", cfg.ReconcileMaxConcurrency)
+	}
+
+	t.Setenv("RECONCILE_MAX_CONCURRENCY", "8")
+	if cfg, _ = config.Load(); cfg.ReconcileMaxConcurrency != 8 {
+		t.Errorf("expected concurrency 8, got %d", cfg.ReconcileMaxConcurrency)
+	}
+
+	t.Setenv("RECONCILE_MAX_CONCURRENCY", "0")
+	if _, errs = config.Load(); len(errs) != 1 || !strings.Contains(errs[0], "RECONCILE_MAX_CONCURRENCY") {
+		t.Errorf("expected RECONCILE_MAX_CONCURRENCY error, got %v", errs)
+	}
+}
+
+func TestLoad_DockerClient(t *testing.T) {
+	t.Setenv("GIT_REPO_URL", "https://github.com/example/repo.git")
+	t.Setenv("GIT_ACCESS_TOKEN", "tok")
+	t.Setenv("GIT_REVISION", "main")
+	os.Unsetenv("DOCKER_CLIENT")
+
+	cfg, errs := config.Load()
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if cfg.DockerClient != config.DockerClientCLI {
+		t.Errorf("expected default docker client cli, got %q", cfg.DockerClient)
+	}
+
+	t.Setenv("DOCKER_CLIENT", "API")
+	if cfg, _ = config.Load(); cfg.DockerClient != config.DockerClientAPI {
+		t.Errorf("expected docker client api, got %q", cfg.DockerClient)
+	}
+
+	t.Setenv("DOCKER_CLIENT", "grpc")
+	if _, errs = config.Load(); len(errs) != 1 || !strings.Contains(errs[0], "DOCKER_CLIENT") {
+		t.Errorf("expected DOCKER_CLIENT error, got %v", errs)
+	}
+}
+
+func TestLoad_PullPolicy(t *testing.T) {
+	t.Setenv("GIT_REPO_URL", "https://github.com/example/repo.git")
+	t.Setenv("GIT_ACCESS_TOKEN", "tok")
+	t.Setenv("GIT_REVISION", "main")
+	os.Unsetenv("PULL_POLICY")
+
+	cfg, errs := config.Load()
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if cfg.PullPolicy != "missing" {
+		t.Errorf("expected default pull policy missing, got %q", cfg.PullPolicy)
+	}
+
+	t.Setenv("PULL_POLICY", "always")
+	if cfg, _ = config.Load(); cfg.PullPolicy != "always" {
+		t.Errorf("expected pull policy always, got %q", cfg.PullPolicy)
+	}
+
+	t.Setenv("PULL_POLICY", "sometimes")
+	if _, errs = config.Load(); len(errs) != 1 || !strings.Contains(errs[0], "PULL_POLICY") {
+		t.Errorf("expected PULL_POLICY error, got %v", errs)
+	}
+}
+
+func TestLoad_Persistence(t *testing.T) {
+	t.Setenv("GIT_REPO_URL", "https://github.com/example/repo.git")
+	t.Setenv("GIT_ACCESS_TOKEN", "tok")
+	t.Setenv("GIT_REVISION", "main")
+	os.Unsetenv("DATA_DIR")
+	os.Unsetenv("HISTORY_LIMIT")
+
+	cfg, errs := config.Load()
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if cfg.DataDir != "" || cfg.HistoryLimit != config.DefaultHistoryLimit {
+		t.Errorf("expected in-memory state with default history limit, got %q/%d", cfg.DataDir, cfg.HistoryLimit)
+	}
+
+	t.Setenv("DATA_DIR", "/var/lib/docker-cd")
+	t.Setenv("HISTORY_LIMIT", "10")
+	if cfg, _ = config.Load(); cfg.DataDir != "/var/lib/docker-cd" || cfg.HistoryLimit != 10 {
+		t.Errorf("unexpected persistence config %q/%d", cfg.DataDir, cfg.HistoryLimit)
+	}
+
+	t.Setenv("HISTORY_LIMIT", "0")
+	if _, errs = config.Load(); len(errs) != 1 || !strings.Contains(errs[0], "HISTORY_LIMIT") {
+		t.Errorf("expected HISTORY_LIMIT error, got %v", errs)
+	}
+}
+
+func TestLoad_SyncWindows(t *testing.T) {
+	t.Setenv("GIT_REPO_URL", "https://github.com/example/repo.git")
+	t.Setenv("GIT_ACCESS_TOKEN", "tok")
+	t.Setenv("GIT_REVISION", "main")
+	t.Setenv("SYNC_WINDOWS", "allow 0 2 * * * 3h Europe/Berlin; deny 0 0 24 12 * 24h")
+
+	cfg, errs := config.Load()
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if len(cfg.SyncWindows) != 2 || cfg.SyncWindows[0].Kind != "allow" || cfg.SyncWindows[1].Schedule != "0 0 24 12 *" {
+		t.Errorf("unexpected sync windows %+v", cfg.SyncWindows)
+	}
+
+	t.Setenv("SYNC_WINDOWS", "allow 0 2 * * *")
+	if _, errs = config.Load(); len(errs) != 1 || !strings.Contains(errs[0], "SYNC_WINDOWS") {
+		t.Errorf("expected SYNC_WINDOWS error, got %v", errs)
+	}
+}
+
+func TestLoad_RemovalSafety(t *testing.T) {
+	t.Setenv("GIT_REPO_URL", "https://github.com/example/repo.git")
+	t.Setenv("GIT_ACCESS_TOKEN", "tok")
+	t.Setenv("GIT_REVISION", "main")
+	t.Setenv("REMOVAL_GRACE_PERIOD", "15m")
+	t.Setenv("REMOVAL_GRACE_REFRESHES", "3")
+	t.Setenv("REMOVAL_MAX_PERCENT", "50")
+
+	cfg, errs := config.Load()
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if cfg.RemovalGracePeriod != 15*time.Minute || cfg.RemovalGraceRefreshes != 3 || cfg.RemovalMaxPercent != 50 {
+		t.Errorf("unexpected removal config %s/%d/%d", cfg.RemovalGracePeriod, cfg.RemovalGraceRefreshes, cfg.RemovalMaxPercent)
+	}
+
+	t.Setenv("REMOVAL_GRACE_PERIOD", "")
+	t.Setenv("REMOVAL_GRACE_REFRESHES", "")
+	t.Setenv("REMOVAL_MAX_PERCENT", "")
+	cfg, _ = config.Load()
+	if cfg.RemovalGracePeriod != 0 || cfg.RemovalGraceRefreshes != config.DefaultRemovalGraceRefreshes || cfg.RemovalMaxPercent != config.DefaultRemovalMaxPercent {
+		t.Errorf("expected default removal config, got %s/%d/%d", cfg.RemovalGracePeriod, cfg.RemovalGraceRefreshes, cfg.RemovalMaxPercent)
+	}
+	t.Setenv("REMOVAL_GRACE_REFRESHES", "0")
+	t.Setenv("REMOVAL_MAX_PERCENT", "0")
+	if cfg, _ = config.Load(); cfg.RemovalGraceRefreshes != 0 || cfg.RemovalMaxPercent != 0 {
+		t.Errorf("expected 0 to disable the removal checks, got %d/%d", cfg.RemovalGraceRefreshes, cfg.RemovalMaxPercent)
+	}
+
+	t.Setenv("REMOVAL_MAX_PERCENT", "150")
+	if _, errs = config.Load(); len(errs) != 1 || !strings.Contains(errs[0], "REMOVAL_MAX_PERCENT") {
+		t.Errorf("expected REMOVAL_MAX_PERCENT error, got %v", errs)
+	}
+}
+
+func TestLoad_Instance(t *testing.T) {
+	t.Setenv("GIT_REPO_URL", "https://github.com/example/repo.git")
+	t.Setenv("GIT_ACCESS_TOKEN", "tok")
+	t.Setenv("GIT_REVISION", "main")
+	t.Setenv("INSTANCE_ID", "Blue")
+
+	cfg, errs := config.Load()
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if cfg.InstanceID != "Blue" || cfg.StackProjectPrefix != "blue" {
+		t.Errorf("expected prefix to default to the lowercased instance ID, got %q/%q", cfg.InstanceID, cfg.StackProjectPrefix)
+	}
+	if cfg.AdoptUnlabeledStacks {
+		t.Error("expected unlabeled stacks not to be adopted by default")
+	}
+	t.Setenv("ADOPT_UNLABELED_STACKS", "true")
+	if cfg, _ = config.Load(); !cfg.AdoptUnlabeledStacks {
+		t.Error("expected ADOPT_UNLABELED_STACKS=true to adopt unlabeled stacks")
+	}
+
+	t.Setenv("STACK_PROJECT_PREFIX", "")
+	if cfg, _ = config.Load(); cfg.StackProjectPrefix != "" {
+		t.Errorf("expected an empty prefix to disable prefixing, got %q", cfg.StackProjectPrefix)
+	}
+
+	t.Setenv("STACK_PROJECT_PREFIX", "Prod")
+	if _, errs = config.Load(); len(errs) != 1 || !strings.Contains(errs[0], "STACK_PROJECT_PREFIX") {
+		t.Errorf("expected STACK_PROJECT_PREFIX error, got %v", errs)
+	}
+	t.Setenv("STACK_PROJECT_PREFIX", "prod")
+	t.Setenv("INSTANCE_ID", "blue/1")
+	if _, errs = config.Load(); len(errs) != 1 || !strings.Contains(errs[0], "INSTANCE_ID") {
+		t.Errorf("expected INSTANCE_ID error, got %v", errs)
+	}
+}
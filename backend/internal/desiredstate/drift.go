@@ -0,0 +1,44 @@
+package desiredstate
+
+import "fmt"
+
+// DriftKind classifies how a stack's containers diverge from its desired configuration.
+type DriftKind string
+
+const (
+	DriftComposeHash       DriftKind = "compose_hash"       // the stack's files changed since it was deployed
+	DriftServiceMissing    DriftKind = "service_missing"    // a desired service has no containers
+	DriftServiceUnexpected DriftKind = "service_unexpected" // containers of a service not in the desired config
+	DriftImage             DriftKind = "image"
+	DriftState             DriftKind = "state"
+	DriftReplicas          DriftKind = "replicas"
+	DriftEnv               DriftKind = "env"
+	DriftPorts             DriftKind = "ports"
+)
+
+// DriftReason describes one divergence between a stack's running containers
+// and its rendered desired configuration.
+type DriftReason struct {
+	Kind      DriftKind `json:"kind"`
+	Service   string    `json:"service"`
+	Container string    `json:"container,omitempty"`
+	Expected  string    `json:"expected,omitempty"`
+	Actual    string    `json:"actual,omitempty"`
+}
+
+// String returns a one-line description, e.g. "web: image expected nginx:2, got nginx:1".
+func (d DriftReason) String() string {
+	subject := d.Service
+	if d.Container != "" {
+		subject = d.Container
+	}
+	switch d.Kind {
+	case DriftServiceMissing:
+		return fmt.Sprintf("%s: service has no containers", d.Service)
+	case DriftServiceUnexpected:
+		return fmt.Sprintf("%s: service is not in the desired configuration", d.Service)
+	case DriftComposeHash:
+		return fmt.Sprintf("compose files changed: expected hash %s, got %s", d.Expected, d.Actual)
+	}
+	return fmt.Sprintf("%s: %s expected %s, got %s", subject, d.Kind, d.Expected, d.Actual)
+}
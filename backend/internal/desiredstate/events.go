@@ -15,6 +15,7 @@ const (
 	EventStackUpsert   EventType = "stack.upsert"
 	EventStackDelete   EventType = "stack.delete"
 	EventRefreshStatus EventType = "refresh.status"
+	EventStackHistory  EventType = "stack.history"
 )
 
 // SSEEvent represents a single event to be sent over the SSE stream.
@@ -122,6 +123,23 @@ func (b *Broadcaster) PublishStackUpsert(stack StackRecord) {
 	b.Publish(EventStackUpsert, upsertPayload{Record: stack})
 }
 
+// PublishStackDelete sends the path of a stack that is no longer listed.
+func (b *Broadcaster) PublishStackDelete(path string) {
+	type deletePayload struct {
+		Path string `json:"path"`
+	}
+	b.Publish(EventStackDelete, deletePayload{Path: path})
+}
+
+// PublishStackHistory sends a reconciliation run recorded in a stack's history.
+func (b *Broadcaster) PublishStackHistory(stackPath string, run any) {
+	type historyPayload struct {
+		StackPath string `json:"stackPath"`
+		Run       any    `json:"run"`
+	}
+	b.Publish(EventStackHistory, historyPayload{StackPath: stackPath, Run: run})
+}
+
 // PublishRefreshStatus sends a refresh status update.
 func (b *Broadcaster) PublishRefreshStatus(snap *Snapshot) {
 	b.Publish(EventRefreshStatus, snap)
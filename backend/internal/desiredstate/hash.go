@@ -2,11 +2,27 @@ package desiredstate
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 )
 
-// ComposeHash computes a deterministic SHA-256 hash of compose file contents.
-func ComposeHash(content []byte) string {
-	h := sha256.Sum256(content)
-	return hex.EncodeToString(h[:])
+// ComposeHash computes a deterministic SHA-256 hash of a stack's files.
+// Pass the compose files in order, followed by any env files. A single file
+// hashes to the plain SHA-256 of its content, so single-file stacks keep the
+// hash recorded in their container labels.
+func ComposeHash(contents ...[]byte) string {
+	if len(contents) == 1 {
+		h := sha256.Sum256(contents[0])
+		return hex.EncodeToString(h[:])
+	}
+
+	// Length-prefix each file so moving bytes between files changes the hash.
+	h := sha256.New()
+	var size [8]byte
+	for _, c := range contents {
+		binary.BigEndian.PutUint64(size[:], uint64(len(c)))
+		h.Write(size[:])
+		h.Write(c)
+	}
+	return hex.EncodeToString(h.Sum(nil))
 }
@@ -0,0 +1,191 @@
+package desiredstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/syncwindow"
+	"gopkg.in/yaml.v3"
+)
+
+// SettingsFile is the name of the optional per-stack settings file.
+const SettingsFile = ".docker-cd.yaml"
+
+// Pull policies accepted in SettingsFile, passed to docker compose up --pull.
+const (
+	PullPolicyAlways  = "always"
+	PullPolicyMissing = "missing"
+	PullPolicyNever   = "never"
+)
+
+// Image update levels accepted in SettingsFile. A level allows image updates
+// for tags that float at most that far: digest only picks up rebuilds of a
+// full version tag (1.27.3), patch also follows minor tags (1.27), minor
+// follows major tags (1) and major follows any tag (latest, stable).
+const (
+	ImageUpdateDigest = "digest"
+	ImageUpdatePatch  = "patch"
+	ImageUpdateMinor  = "minor"
+	ImageUpdateMajor  = "major"
+)
+
+// StackSettings holds per-stack overrides read from SettingsFile.
+// Unset fields fall back to the global configuration.
+type StackSettings struct {
+	DriftPolicy string   `yaml:"drift_policy" json:"driftPolicy,omitempty"`
+	Remove      *bool    `yaml:"remove" json:"remove,omitempty"`
+	Profiles    []string `yaml:"profiles" json:"profiles,omitempty"`
+	SyncTimeout Duration `yaml:"sync_timeout" json:"syncTimeout,omitempty"`
+	// HealthTimeout enables the health gate: after compose up, wait this long
+	// for all containers to be running and healthy, or roll back.
+	HealthTimeout Duration `yaml:"health_timeout" json:"healthTimeout,omitempty"`
+	PullPolicy    string   `yaml:"pull_policy" json:"pullPolicy,omitempty"`
+	// ImageUpdates opts the stack into registry digest tracking, allowing
+	// updates up to the given level (see ImageUpdateDigest).
+	ImageUpdates string `yaml:"image_updates" json:"imageUpdates,omitempty"`
+	Suspended    bool   `yaml:"suspended" json:"suspended,omitempty"`
+	// DependsOn lists the paths of stacks (relative to the deploy dir) that
+	// must be deployed before this one.
+	DependsOn []string `yaml:"depends_on" json:"dependsOn,omitempty"`
+	// SyncWindows replace the global sync windows for this stack.
+	SyncWindows []syncwindow.Window `yaml:"sync_windows" json:"syncWindows,omitempty"`
+}
+
+// ParseStackSettings decodes and validates a settings file. Unknown keys are rejected
+// so typos do not silently fall back to the global defaults.
+func ParseStackSettings(data []byte) (*StackSettings, error) {
+	var s StackSettings
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&s); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse %s: %w", SettingsFile, err)
+	}
+
+	switch s.DriftPolicy {
+	case "", "revert", "flag":
+	default:
+		return nil, fmt.Errorf("%s: invalid drift_policy %q (must be revert or flag)", SettingsFile, s.DriftPolicy)
+	}
+	switch s.PullPolicy {
+	case "", PullPolicyAlways, PullPolicyMissing, PullPolicyNever:
+	default:
+		return nil, fmt.Errorf("%s: invalid pull_policy %q (must be always, missing or never)", SettingsFile, s.PullPolicy)
+	}
+	switch s.ImageUpdates {
+	case "", ImageUpdateDigest, ImageUpdatePatch, ImageUpdateMinor, ImageUpdateMajor:
+	default:
+		return nil, fmt.Errorf("%s: invalid image_updates %q (must be digest, patch, minor or major)", SettingsFile, s.ImageUpdates)
+	}
+	if s.SyncTimeout < 0 {
+		return nil, fmt.Errorf("%s: sync_timeout must not be negative", SettingsFile)
+	}
+	if s.HealthTimeout < 0 {
+		return nil, fmt.Errorf("%s: health_timeout must not be negative", SettingsFile)
+	}
+	for _, w := range s.SyncWindows {
+		if err := w.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: invalid sync_windows entry: %w", SettingsFile, err)
+		}
+	}
+	for i, dep := range s.DependsOn {
+		clean := path.Clean(strings.Trim(dep, "/"))
+		if dep == "" || strings.HasPrefix(dep, "/") || clean == "." || strings.HasPrefix(clean, "..") {
+			return nil, fmt.Errorf("%s: invalid depends_on entry %q (must be a stack path relative to the deploy dir)", SettingsFile, dep)
+		}
+		s.DependsOn[i] = clean
+	}
+	return &s, nil
+}
+
+// StackPolicy is the effective reconcile policy of a stack: the global
+// configuration with the stack's settings applied.
+type StackPolicy struct {
+	DriftPolicy   string   `json:"driftPolicy"`
+	RemoveEnabled bool     `json:"removeEnabled"`
+	Profiles      []string `json:"profiles,omitempty"`
+	SyncTimeout   Duration `json:"syncTimeout,omitempty"`
+	HealthTimeout Duration `json:"healthTimeout,omitempty"`
+	PullPolicy    string   `json:"pullPolicy,omitempty"`
+	ImageUpdates  string   `json:"imageUpdates,omitempty"`
+	Suspended     bool     `json:"suspended"`
+
+	SyncWindows []syncwindow.Window `json:"syncWindows,omitempty"`
+}
+
+// Apply returns base with every field set in s overriding it. A nil s returns base.
+func (s *StackSettings) Apply(base StackPolicy) StackPolicy {
+	if s == nil {
+		return base
+	}
+	if s.DriftPolicy != "" {
+		base.DriftPolicy = s.DriftPolicy
+	}
+	if s.Remove != nil {
+		base.RemoveEnabled = *s.Remove
+	}
+	if len(s.Profiles) > 0 {
+		base.Profiles = s.Profiles
+	}
+	if s.SyncTimeout > 0 {
+		base.SyncTimeout = s.SyncTimeout
+	}
+	if s.HealthTimeout > 0 {
+		base.HealthTimeout = s.HealthTimeout
+	}
+	if s.PullPolicy != "" {
+		base.PullPolicy = s.PullPolicy
+	}
+	if s.ImageUpdates != "" {
+		base.ImageUpdates = s.ImageUpdates
+	}
+	if s.Suspended {
+		base.Suspended = true
+	}
+	if len(s.SyncWindows) > 0 {
+		base.SyncWindows = s.SyncWindows
+	}
+	return base
+}
+
+// Duration is a time.Duration written as a Go duration string ("90s", "5m")
+// in both YAML and JSON.
+type Duration time.Duration
+
+// UnmarshalYAML parses a duration string.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
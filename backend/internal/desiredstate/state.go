@@ -1,6 +1,7 @@
 package desiredstate
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
@@ -24,6 +25,21 @@ const (
 	StackSyncSynced   StackSyncStatus = "synced"
 	StackSyncDeleting StackSyncStatus = "deleting"
 	StackSyncFailed   StackSyncStatus = "failed"
+	// StackSyncPullFailed means the images could not be pulled; the running
+	// containers were left untouched.
+	StackSyncPullFailed StackSyncStatus = "pull_failed"
+	// StackSyncPinned means an operator rolled the stack back to an earlier
+	// revision; it is not synced until unpinned or changed in Git.
+	StackSyncPinned StackSyncStatus = "pinned"
+	// StackSyncSuspended means reconciliation of the stack is suspended; drift
+	// is still reported but neither reverted nor removed.
+	StackSyncSuspended StackSyncStatus = "suspended"
+	// StackSyncPendingWindow means the stack has drifted but is deferred
+	// until its next sync window.
+	StackSyncPendingWindow StackSyncStatus = "pending_window"
+	// StackSyncPendingRemoval means the stack was deleted from Git and is
+	// removed once its grace period has passed or the removal is confirmed.
+	StackSyncPendingRemoval StackSyncStatus = "pending_removal"
 )
 
 // ContainerInfo describes a single container within a stack.
@@ -35,6 +51,8 @@ type ContainerInfo struct {
 	Health  string `json:"health"` // healthy, unhealthy, starting, none
 	Image   string `json:"image"`
 	Ports   string `json:"ports,omitempty"`
+	// ExitCode is the exit code of an exited container.
+	ExitCode int `json:"exitCode,omitempty"`
 }
 
 // StackRecord represents a stack discovered in the repository.
@@ -45,6 +63,19 @@ type StackRecord struct {
 	Status      StackSyncStatus `json:"status"`
 	Content     []byte          `json:"-"` // raw compose file content, not exposed via API
 
+	// Multi-file stacks: compose files in the order passed to compose (ComposeFile
+	// first) and env files, relative to the stack directory. Files holds their content.
+	ComposeFiles []string          `json:"composeFiles,omitempty"`
+	EnvFiles     []string          `json:"envFiles,omitempty"`
+	Files        map[string][]byte `json:"-"`
+
+	// Settings are the overrides from the stack's SettingsFile, nil if it has none.
+	// Policy is the effective policy after applying them to the global configuration.
+	Settings *StackSettings `json:"-"`
+	Policy   StackPolicy    `json:"policy"`
+	// DependsOn lists the stacks deployed before this one, from Settings.
+	DependsOn []string `json:"dependsOn,omitempty"`
+
 	// Container summary
 	ContainersRunning int `json:"containersRunning"`
 	ContainersTotal   int `json:"containersTotal"`
@@ -57,6 +88,70 @@ type StackRecord struct {
 	LastSyncAt          string `json:"lastSyncAt,omitempty"`
 	LastSyncStatus      string `json:"lastSyncStatus,omitempty"`
 	LastSyncError       string `json:"lastSyncError,omitempty"`
+
+	// Health-gate rollback (populated when a sync failed its health check).
+	// FailedComposeHash is not deployed again until the desired hash changes.
+	FailedComposeHash string `json:"failedComposeHash,omitempty"`
+	RolledBackTo      string `json:"rolledBackTo,omitempty"`
+	RolledBackAt      string `json:"rolledBackAt,omitempty"`
+
+	// Manual rollback: the stack runs PinnedRevision and is left alone by the
+	// reconciler until it is unpinned or its files change in Git.
+	PinnedRevision string `json:"pinnedRevision,omitempty"`
+	PinnedAt       string `json:"pinnedAt,omitempty"`
+
+	// Suspension is set while an operator has suspended the stack.
+	Suspension *Suspension `json:"suspension,omitempty"`
+
+	// NextWindowAt is when a stack pending its sync window may be synced
+	// (RFC3339), empty if no window opens within a year.
+	NextWindowAt string `json:"nextWindowAt,omitempty"`
+
+	// Drift lists how the running containers diverge from the desired
+	// configuration, as found by the last reconcile.
+	Drift []DriftReason `json:"drift,omitempty"`
+
+	// Retry backoff (populated while syncs of the current hash keep failing).
+	SyncAttempts int    `json:"syncAttempts,omitempty"`
+	NextRetryAt  string `json:"nextRetryAt,omitempty"`
+}
+
+// Suspension records who suspended a stack's reconciliation, why, and until
+// when. Times are RFC3339; an empty ExpiresAt never expires.
+type Suspension struct {
+	By        string `json:"by,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	At        string `json:"at"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+}
+
+// Expired reports whether the suspension has expired at now.
+func (s Suspension) Expired(now time.Time) bool {
+	if s.ExpiresAt == "" {
+		return false
+	}
+	expires, err := time.Parse(time.RFC3339, s.ExpiresAt)
+	return err == nil && !now.Before(expires)
+}
+
+// AllComposeFiles returns the stack's compose files in order, falling back to
+// ComposeFile for single-file stacks.
+func (r StackRecord) AllComposeFiles() []string {
+	if len(r.ComposeFiles) > 0 {
+		return r.ComposeFiles
+	}
+	return []string{r.ComposeFile}
+}
+
+// FileContent returns the content of one of the stack's files.
+func (r StackRecord) FileContent(name string) []byte {
+	if content, ok := r.Files[name]; ok {
+		return content
+	}
+	if name == r.ComposeFile {
+		return r.Content
+	}
+	return nil
 }
 
 // Snapshot represents the latest desired state loaded from Git.
@@ -75,11 +170,16 @@ type Snapshot struct {
 type Store struct {
 	mu       sync.RWMutex
 	snapshot *Snapshot
+	// removals are the stacks deleted from Git that keep running because
+	// their removal is held back. They are listed with the stacks but are
+	// not part of the desired state.
+	removals map[string]StackRecord
+	onChange func()
 }
 
 // NewStore creates an empty Store.
 func NewStore() *Store {
-	return &Store{}
+	return &Store{removals: make(map[string]StackRecord)}
 }
 
 // Get returns a copy of the current snapshot, or nil if no snapshot exists.
@@ -101,22 +201,138 @@ func (s *Store) Get() *Snapshot {
 	return &cp
 }
 
+// OnChange registers fn to be called after every change to the snapshot,
+// e.g. to persist it. fn is called without the store lock held and must not block.
+func (s *Store) OnChange(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = fn
+}
+
+// changed calls the OnChange callback, if any. It must be called without the lock held.
+func (s *Store) changed() {
+	s.mu.RLock()
+	fn := s.onChange
+	s.mu.RUnlock()
+	if fn != nil {
+		fn()
+	}
+}
+
 // Set replaces the current snapshot.
 func (s *Store) Set(snap *Snapshot) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	s.snapshot = snap
+	s.mu.Unlock()
+	s.changed()
+}
+
+// Replace replaces the current snapshot with the one build returns for the
+// current stacks, under the store lock, so updates to stacks made while the
+// new snapshot is built are never lost. build must not modify or retain prev,
+// nor call the store.
+func (s *Store) Replace(build func(prev []StackRecord) *Snapshot) {
+	s.mu.Lock()
+	var prev []StackRecord
+	if s.snapshot != nil {
+		prev = s.snapshot.Stacks
+	}
+	s.snapshot = build(prev)
+	s.mu.Unlock()
+	s.changed()
+}
+
+// UpdateStack applies fn to the stack at path under the store lock, so
+// concurrent updates to different stacks (or a refresh replacing the snapshot)
+// are never lost. It returns a copy of the updated record and false if the
+// stack does not exist.
+func (s *Store) UpdateStack(path string, fn func(*StackRecord)) (StackRecord, bool) {
+	record, found := s.updateStack(path, fn)
+	if found {
+		s.changed()
+	}
+	return record, found
+}
+
+func (s *Store) updateStack(path string, fn func(*StackRecord)) (StackRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshot != nil {
+		for i := range s.snapshot.Stacks {
+			if s.snapshot.Stacks[i].Path == path {
+				fn(&s.snapshot.Stacks[i])
+				return s.snapshot.Stacks[i], true
+			}
+		}
+	}
+	if rec, ok := s.removals[path]; ok {
+		fn(&rec)
+		s.removals[path] = rec
+		return rec, true
+	}
+	return StackRecord{}, false
+}
+
+// SetRemoval adds or replaces the record of a stack pending removal.
+func (s *Store) SetRemoval(rec StackRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.removals == nil {
+		s.removals = make(map[string]StackRecord)
+	}
+	s.removals[rec.Path] = rec
+}
+
+// DeleteRemoval drops the record of a stack pending removal. It reports
+// whether there was one.
+func (s *Store) DeleteRemoval(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.removals[path]
+	delete(s.removals, path)
+	return ok
+}
+
+// GetStack returns a copy of the record of the stack at path, a desired
+// stack or one pending removal, and false if there is none.
+func (s *Store) GetStack(path string) (StackRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.snapshot != nil {
+		for _, st := range s.snapshot.Stacks {
+			if st.Path == path {
+				return copyRecord(st), true
+			}
+		}
+	}
+	rec, ok := s.removals[path]
+	return copyRecord(rec), ok
 }
 
 // UpdateStatus updates the refresh status and optionally the error message.
 func (s *Store) UpdateStatus(status RefreshStatus, refreshErr string) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	if s.snapshot == nil {
 		s.snapshot = &Snapshot{}
 	}
 	s.snapshot.RefreshStatus = status
 	s.snapshot.RefreshError = refreshErr
+	s.mu.Unlock()
+	s.changed()
+}
+
+// MarkRefreshed records a completed refresh that found no new revision,
+// keeping the current revision and stacks.
+func (s *Store) MarkRefreshed(refreshedAt time.Time) {
+	s.mu.Lock()
+	if s.snapshot == nil {
+		s.snapshot = &Snapshot{}
+	}
+	s.snapshot.RefreshedAt = refreshedAt
+	s.snapshot.RefreshStatus = RefreshStatusCompleted
+	s.snapshot.RefreshError = ""
+	s.mu.Unlock()
+	s.changed()
 }
 
 // GetStacks returns a copy of the current stacks, or nil if no snapshot exists.
@@ -128,15 +344,44 @@ func (s *Store) GetStacks() []StackRecord {
 	}
 	stacks := make([]StackRecord, len(s.snapshot.Stacks))
 	for i, st := range s.snapshot.Stacks {
-		stacks[i] = st
-		if st.Content != nil {
-			stacks[i].Content = make([]byte, len(st.Content))
-			copy(stacks[i].Content, st.Content)
-		}
+		stacks[i] = copyRecord(st)
 	}
 	return stacks
 }
 
+// GetAllStacks returns a copy of the current stacks followed by the stacks
+// pending removal, sorted by path, as listed to clients. It returns nil if
+// there are neither.
+func (s *Store) GetAllStacks() []StackRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var stacks []StackRecord
+	desired := make(map[string]bool)
+	if s.snapshot != nil {
+		stacks = make([]StackRecord, len(s.snapshot.Stacks))
+		for i, st := range s.snapshot.Stacks {
+			stacks[i] = copyRecord(st)
+			desired[st.Path] = true
+		}
+	}
+	var removals []StackRecord
+	for path, rec := range s.removals {
+		// A stack restored in Git is listed once, as desired.
+		if !desired[path] {
+			removals = append(removals, copyRecord(rec))
+		}
+	}
+	sort.Slice(removals, func(i, j int) bool { return removals[i].Path < removals[j].Path })
+	return append(stacks, removals...)
+}
+
+func copyRecord(st StackRecord) StackRecord {
+	if st.Content != nil {
+		st.Content = append([]byte(nil), st.Content...)
+	}
+	return st
+}
+
 // GetRefreshStatus returns the refresh status fields (without stacks).
 func (s *Store) GetRefreshStatus() *Snapshot {
 	s.mu.RLock()
@@ -1,6 +1,7 @@
 package desiredstate_test
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -63,6 +64,33 @@ func TestStore_GetReturnsCopy(t *testing.T) {
 	}
 }
 
+func TestStore_ReplaceKeepsConcurrentUpdates(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: []desiredstate.StackRecord{{Path: "app"}}})
+
+	const updates = 200
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < updates; i++ {
+			store.UpdateStack("app", func(st *desiredstate.StackRecord) { st.SyncAttempts++ })
+		}
+	}()
+	for i := 0; i < updates; i++ {
+		store.Replace(func(prev []desiredstate.StackRecord) *desiredstate.Snapshot {
+			stacks := append([]desiredstate.StackRecord(nil), prev...)
+			return &desiredstate.Snapshot{Revision: "rev2", Stacks: stacks}
+		})
+	}
+	wg.Wait()
+
+	got := store.Get()
+	if got.Revision != "rev2" || len(got.Stacks) != 1 || got.Stacks[0].SyncAttempts != updates {
+		t.Errorf("expected all %d updates kept across replaces, got %+v", updates, got)
+	}
+}
+
 func TestStore_UpdateStatus(t *testing.T) {
 	store := desiredstate.NewStore()
 	store.UpdateStatus(desiredstate.RefreshStatusRefreshing, "")
@@ -83,6 +111,33 @@ func TestStore_UpdateStatus(t *testing.T) {
 	}
 }
 
+func TestStore_MarkRefreshed_KeepsRevisionAndStacks(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{
+		Revision:      "abc123",
+		RefreshStatus: desiredstate.RefreshStatusRefreshing,
+		RefreshError:  "stale",
+		Stacks:        []desiredstate.StackRecord{{Path: "app1"}},
+	})
+
+	now := time.Now()
+	store.MarkRefreshed(now)
+
+	snap := store.Get()
+	if snap.RefreshStatus != desiredstate.RefreshStatusCompleted {
+		t.Errorf("expected completed, got %q", snap.RefreshStatus)
+	}
+	if snap.RefreshError != "" {
+		t.Errorf("expected error cleared, got %q", snap.RefreshError)
+	}
+	if !snap.RefreshedAt.Equal(now) {
+		t.Errorf("expected refreshedAt %v, got %v", now, snap.RefreshedAt)
+	}
+	if snap.Revision != "abc123" || len(snap.Stacks) != 1 {
+		t.Errorf("expected revision and stacks preserved, got %q / %d", snap.Revision, len(snap.Stacks))
+	}
+}
+
 func TestStore_GetStacks_Nil(t *testing.T) {
 	store := desiredstate.NewStore()
 	if stacks := store.GetStacks(); stacks != nil {
@@ -105,6 +160,38 @@ func TestStore_GetStacks_ReturnsCopy(t *testing.T) {
 	}
 }
 
+func TestStore_Removals(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeHash: "h1", Status: desiredstate.StackSyncSynced},
+	}})
+	store.SetRemoval(desiredstate.StackRecord{Path: "old", Status: desiredstate.StackSyncPendingRemoval})
+	// A stack restored in Git is listed once, as desired.
+	store.SetRemoval(desiredstate.StackRecord{Path: "app", Status: desiredstate.StackSyncPendingRemoval})
+
+	stacks := store.GetAllStacks()
+	if len(stacks) != 2 || stacks[0].Path != "app" || stacks[0].Status != desiredstate.StackSyncSynced || stacks[1].Path != "old" {
+		t.Fatalf("unexpected stacks %+v", stacks)
+	}
+	if len(store.GetStacks()) != 1 {
+		t.Errorf("expected removals left out of the desired stacks")
+	}
+
+	if _, found := store.UpdateStack("old", func(st *desiredstate.StackRecord) { st.Status = desiredstate.StackSyncDeleting }); !found {
+		t.Fatal("expected removal record to be updated")
+	}
+	if st, ok := store.GetStack("old"); !ok || st.Status != desiredstate.StackSyncDeleting {
+		t.Errorf("expected deleting removal record, got %+v, %v", st, ok)
+	}
+
+	if !store.DeleteRemoval("old") || store.DeleteRemoval("old") {
+		t.Error("expected removal record deleted once")
+	}
+	if _, ok := store.GetStack("old"); ok {
+		t.Error("expected deleted removal record gone")
+	}
+}
+
 func TestStore_GetRefreshStatus_Nil(t *testing.T) {
 	store := desiredstate.NewStore()
 	if status := store.GetRefreshStatus(); status != nil {
@@ -206,3 +293,104 @@ func TestComposeHash_Deterministic(t *testing.T) {
 		t.Error("different content should produce different hashes")
 	}
 }
+
+func TestComposeHash_SingleFileUnchanged(t *testing.T) {
+	// Single-file stacks must keep the plain SHA-256 recorded in existing labels.
+	got := desiredstate.ComposeHash([]byte("services: {}\n"))
+	want := "fa6ccea1ca4e3a031d9e99f25cc05db803aa9bac642c000ddab14f6d9da54b52"
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestComposeHash_MultiFile(t *testing.T) {
+	base := []byte("services:\n  web:\n    image: nginx\n")
+	prod := []byte("services:\n  web:\n    restart: always\n")
+	env := []byte("TAG=1\n")
+
+	hash := desiredstate.ComposeHash(base, prod, env)
+	if hash == desiredstate.ComposeHash(base) {
+		t.Error("adding files should change the hash")
+	}
+	if hash == desiredstate.ComposeHash(prod, base, env) {
+		t.Error("file order should change the hash")
+	}
+	if hash == desiredstate.ComposeHash(base, prod, []byte("TAG=2\n")) {
+		t.Error("env file changes should change the hash")
+	}
+	if desiredstate.ComposeHash([]byte("ab"), []byte("c")) == desiredstate.ComposeHash([]byte("a"), []byte("bc")) {
+		t.Error("moving bytes between files should change the hash")
+	}
+}
+
+func TestParseStackSettings(t *testing.T) {
+	s, err := desiredstate.ParseStackSettings([]byte("remove: false\npull_policy: always\nimage_updates: patch\nsuspended: true\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Remove == nil || *s.Remove || s.PullPolicy != "always" || s.ImageUpdates != "patch" || !s.Suspended {
+		t.Errorf("unexpected settings %+v", s)
+	}
+
+	if s, err := desiredstate.ParseStackSettings(nil); err != nil || s == nil {
+		t.Errorf("expected empty file to parse, got %v", err)
+	}
+
+	for _, bad := range []string{"drift_policy: ignore\n", "pull_policy: sometimes\n", "image_updates: always\n", "sync_timeout: soon\n", "unknown: 1\n"} {
+		if _, err := desiredstate.ParseStackSettings([]byte(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestStackSettings_Apply(t *testing.T) {
+	base := desiredstate.StackPolicy{DriftPolicy: "revert", RemoveEnabled: true}
+
+	var none *desiredstate.StackSettings
+	if got := none.Apply(base); got.DriftPolicy != "revert" || !got.RemoveEnabled {
+		t.Errorf("nil settings must return base, got %+v", got)
+	}
+
+	keep := false
+	got := (&desiredstate.StackSettings{DriftPolicy: "flag", Remove: &keep, Profiles: []string{"debug"}}).Apply(base)
+	if got.DriftPolicy != "flag" || got.RemoveEnabled || len(got.Profiles) != 1 {
+		t.Errorf("settings not applied, got %+v", got)
+	}
+}
+
+func TestParseStackSettings_DependsOn(t *testing.T) {
+	s, err := desiredstate.ParseStackSettings([]byte("depends_on: [infra/postgres/, traefik]\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s.DependsOn) != 2 || s.DependsOn[0] != "infra/postgres" || s.DependsOn[1] != "traefik" {
+		t.Errorf("unexpected depends_on %v", s.DependsOn)
+	}
+	for _, bad := range []string{"depends_on: [../other]\n", "depends_on: [/abs]\n", "depends_on: ['']\n"} {
+		if _, err := desiredstate.ParseStackSettings([]byte(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseStackSettings_SyncWindows(t *testing.T) {
+	s, err := desiredstate.ParseStackSettings([]byte("sync_windows:\n  - kind: allow\n    schedule: \"0 2 * * *\"\n    duration: 3h\n    timezone: Europe/Berlin\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s.SyncWindows) != 1 || s.SyncWindows[0].Schedule != "0 2 * * *" || s.SyncWindows[0].TimeZone != "Europe/Berlin" {
+		t.Errorf("unexpected sync_windows %+v", s.SyncWindows)
+	}
+	if got := s.Apply(desiredstate.StackPolicy{}); len(got.SyncWindows) != 1 {
+		t.Errorf("expected stack windows to apply, got %+v", got.SyncWindows)
+	}
+	for _, bad := range []string{
+		"sync_windows:\n  - kind: maybe\n    schedule: \"0 2 * * *\"\n    duration: 3h\n",
+		"sync_windows:\n  - kind: allow\n    schedule: \"0 2 * *\"\n    duration: 3h\n",
+		"sync_windows:\n  - kind: allow\n    schedule: \"0 2 * * *\"\n",
+	} {
+		if _, err := desiredstate.ParseStackSettings([]byte(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
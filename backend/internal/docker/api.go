@@ -0,0 +1,221 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// apiVersion is the Engine API version requested by APIClient (Docker 20.10+).
+const apiVersion = "v1.41"
+
+// defaultDockerHost is used when neither the socket nor DOCKER_HOST is set.
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// APIClient talks to the Docker Engine API over a unix socket or TCP,
+// without spawning docker CLI processes.
+type APIClient struct {
+	http *http.Client
+	// base is the URL prefix of API requests, e.g. http://docker/v1.41.
+	base string
+}
+
+// NewAPIClient creates an Engine API client. socket is interpreted like
+// HostArgs: a unix socket path, a unix:// or tcp:// URL, or empty to use
+// DOCKER_HOST (falling back to the default unix socket). TLS is not supported.
+func NewAPIClient(socket string) (*APIClient, error) {
+	host := socket
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = defaultDockerHost
+	}
+	if strings.HasPrefix(host, "/") {
+		host = "unix://" + host
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", host, err)
+	}
+
+	transport := &http.Transport{}
+	var base string
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		base = "http://docker/" + apiVersion
+	case "tcp":
+		base = "http://" + u.Host + "/" + apiVersion
+	default:
+		return nil, fmt.Errorf("unsupported docker host %q: want a unix socket or tcp:// URL", host)
+	}
+
+	return &APIClient{http: &http.Client{Transport: transport}, base: base}, nil
+}
+
+// ContainerCount returns the number of currently running containers.
+func (c *APIClient) ContainerCount(ctx context.Context) (Status, error) {
+	var containers []struct {
+		ID string `json:"Id"`
+	}
+	if err := c.getJSON(ctx, "/containers/json", nil, &containers); err != nil {
+		return Status{}, err
+	}
+	return Status{RunningContainers: len(containers), RetrievedAt: time.Now()}, nil
+}
+
+// ListContainersWithLabel lists containers, including stopped ones, that have
+// the given label key set, with the labels and runtime details of each.
+func (c *APIClient) ListContainersWithLabel(ctx context.Context, labelKey string) ([]ContainerLabels, error) {
+	query := url.Values{}
+	query.Set("all", "1")
+	query.Set("filters", encodeFilters(map[string][]string{"label": {labelKey}}))
+
+	var containers []struct {
+		ID string `json:"Id"`
+	}
+	if err := c.getJSON(ctx, "/containers/json", query, &containers); err != nil {
+		return nil, err
+	}
+	if len(containers) == 0 {
+		return nil, nil
+	}
+
+	result := make([]ContainerLabels, 0, len(containers))
+	for _, ct := range containers {
+		info, err := c.InspectContainer(ctx, ct.ID)
+		if err != nil {
+			// The container may have been removed since it was listed.
+			continue
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+// InspectContainer returns the labels and runtime details of a container.
+func (c *APIClient) InspectContainer(ctx context.Context, id string) (ContainerLabels, error) {
+	var raw json.RawMessage
+	if err := c.getJSON(ctx, "/containers/"+url.PathEscape(id)+"/json", nil, &raw); err != nil {
+		return ContainerLabels{}, err
+	}
+	return parseContainerInspect(raw)
+}
+
+// StreamEvents follows container events for containers that have the given
+// label key set, limited to actions. See Client.StreamEvents.
+func (c *APIClient) StreamEvents(ctx context.Context, labelKey string, actions []string, fn func(ContainerEvent)) error {
+	filters := map[string][]string{"type": {"container"}, "label": {labelKey}}
+	if len(actions) > 0 {
+		filters["event"] = actions
+	}
+	query := url.Values{}
+	query.Set("filters", encodeFilters(filters))
+
+	resp, err := c.do(ctx, http.MethodGet, "/events", query)
+	if err != nil {
+		return fmt.Errorf("docker events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg eventMessage
+		if err := dec.Decode(&msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == io.EOF {
+				return fmt.Errorf("docker events: stream closed")
+			}
+			return fmt.Errorf("docker events: %w", err)
+		}
+		fn(msg.containerEvent())
+	}
+}
+
+// ImageRepoDigests returns the registry digests of a local image.
+func (c *APIClient) ImageRepoDigests(ctx context.Context, image string) ([]string, error) {
+	var info struct {
+		RepoDigests []string `json:"RepoDigests"`
+	}
+	if err := c.getJSON(ctx, "/images/"+url.PathEscape(image)+"/json", nil, &info); err != nil {
+		return nil, err
+	}
+	return info.RepoDigests, nil
+}
+
+// ContainerAction runs a container action: start, stop, restart or kill.
+func (c *APIClient) ContainerAction(ctx context.Context, id, action string) error {
+	if err := checkContainerAction(action); err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/"+action, nil)
+	if err != nil {
+		return fmt.Errorf("docker %s: %w", action, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// getJSON performs a GET request and decodes the JSON response into v.
+func (c *APIClient) getJSON(ctx context.Context, path string, query url.Values, v any) error {
+	resp, err := c.do(ctx, http.MethodGet, path, query)
+	if err != nil {
+		return fmt.Errorf("docker API %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("docker API %s: decode response: %w", path, err)
+	}
+	return nil
+}
+
+// do sends a request and returns the response for 2xx and 304 (not modified,
+// e.g. starting a running container). Other responses become errors carrying
+// the daemon's message.
+func (c *APIClient) do(ctx context.Context, method, path string, query url.Values) (*http.Response, error) {
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(body, &apiErr) != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	return nil, fmt.Errorf("%s (HTTP %d)", apiErr.Message, resp.StatusCode)
+}
+
+// encodeFilters encodes Engine API filters, e.g. {"label":["key"]}.
+func encodeFilters(filters map[string][]string) string {
+	data, _ := json.Marshal(filters)
+	return string(data)
+}
@@ -0,0 +1,164 @@
+package docker_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lucasreiners/docker-cd/internal/docker"
+)
+
+// fakeEngine serves the Engine API endpoints used by APIClient.
+func fakeEngine(t *testing.T) *http.ServeMux {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1.41/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("all") != "1" {
+			fmt.Fprint(w, `[{"Id":"run1"},{"Id":"run2"}]`)
+			return
+		}
+		var filters map[string][]string
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil || filters["label"][0] != "com.docker-cd.stack.path" {
+			http.Error(w, `{"message":"bad filters"}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `[{"Id":"abc123"},{"Id":"gone"}]`)
+	})
+	mux.HandleFunc("GET /v1.41/containers/abc123/json", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"Id":"abc123","Name":"/app-web-1","Image":"sha256:img","Config":{"Image":"nginx:2","Env":["A=1"],"Labels":{"com.docker-cd.stack.path":"app"}},`+
+			`"State":{"Status":"running"},"HostConfig":{"RestartPolicy":{"Name":"always"},"PortBindings":{"80/tcp":[{"HostPort":"8080"}]}}}`)
+	})
+	mux.HandleFunc("GET /v1.41/images/sha256:img/json", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"Id":"sha256:img","RepoDigests":["nginx@sha256:1111"]}`)
+	})
+	mux.HandleFunc("GET /v1.41/containers/gone/json", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message":"No such container: gone"}`)
+	})
+	mux.HandleFunc("POST /v1.41/containers/abc123/restart", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /v1.41/containers/abc123/start", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	})
+	mux.HandleFunc("GET /v1.41/events", func(w http.ResponseWriter, r *http.Request) {
+		var filters map[string][]string
+		_ = json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+		if strings.Join(filters["event"], ",") != "die,destroy" || filters["type"][0] != "container" {
+			http.Error(w, `{"message":"bad filters"}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"Type":"container","Action":"die","Actor":{"ID":"abc123","Attributes":{"name":"app-web-1","com.docker-cd.stack.path":"app"}},"timeNano":1}`)
+		fmt.Fprint(w, `{"Type":"container","Action":"destroy","Actor":{"ID":"abc123","Attributes":{"name":"app-web-1","com.docker-cd.stack.path":"app"}},"timeNano":2}`)
+	})
+	return mux
+}
+
+// unixEngine serves the fake engine on a unix socket and returns its path.
+func unixEngine(t *testing.T) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(fakeEngine(t))
+	srv.Listener = l
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return socket
+}
+
+func TestAPIClient_UnixSocket(t *testing.T) {
+	client, err := docker.NewAPIClient(unixEngine(t))
+	if err != nil {
+		t.Fatalf("NewAPIClient: %v", err)
+	}
+	ctx := context.Background()
+
+	status, err := client.ContainerCount(ctx)
+	if err != nil || status.RunningContainers != 2 {
+		t.Errorf("expected 2 running containers, got %d (%v)", status.RunningContainers, err)
+	}
+
+	containers, err := client.ListContainersWithLabel(ctx, "com.docker-cd.stack.path")
+	if err != nil {
+		t.Fatalf("ListContainersWithLabel: %v", err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("expected removed containers to be skipped, got %d", len(containers))
+	}
+	c := containers[0]
+	if c.ContainerName != "app-web-1" || c.Labels["com.docker-cd.stack.path"] != "app" || c.Image != "nginx:2" || c.ImageID != "sha256:img" ||
+		c.RestartPolicy != "always" || strings.Join(c.Ports, ",") != "8080:80/tcp" {
+		t.Errorf("unexpected container %+v", c)
+	}
+
+	if digests, err := client.ImageRepoDigests(ctx, c.ImageID); err != nil || len(digests) != 1 || digests[0] != "nginx@sha256:1111" {
+		t.Errorf("unexpected repo digests %v (%v)", digests, err)
+	}
+
+	if _, err := client.InspectContainer(ctx, "gone"); err == nil || !strings.Contains(err.Error(), "No such container") {
+		t.Errorf("expected daemon error message, got %v", err)
+	}
+
+	if err := client.ContainerAction(ctx, "abc123", "restart"); err != nil {
+		t.Errorf("restart: %v", err)
+	}
+	if err := client.ContainerAction(ctx, "abc123", "start"); err != nil {
+		t.Errorf("start of a running container: %v", err)
+	}
+	if err := client.ContainerAction(ctx, "abc123", "rm"); err == nil {
+		t.Error("expected unsupported action to fail")
+	}
+
+	var events []docker.ContainerEvent
+	err = client.StreamEvents(ctx, "com.docker-cd.stack.path", []string{"die", "destroy"}, func(ev docker.ContainerEvent) {
+		events = append(events, ev)
+	})
+	if err == nil || !strings.Contains(err.Error(), "stream closed") {
+		t.Errorf("expected stream closed error, got %v", err)
+	}
+	if len(events) != 2 || events[0].Action != "die" || events[1].Labels["com.docker-cd.stack.path"] != "app" {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
+
+func TestAPIClient_TCP(t *testing.T) {
+	srv := httptest.NewServer(fakeEngine(t))
+	defer srv.Close()
+
+	client, err := docker.NewAPIClient("tcp://" + strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("NewAPIClient: %v", err)
+	}
+	status, err := client.ContainerCount(context.Background())
+	if err != nil || status.RunningContainers != 2 {
+		t.Errorf("expected 2 running containers, got %d (%v)", status.RunningContainers, err)
+	}
+}
+
+func TestNewEngine(t *testing.T) {
+	if e, err := docker.NewEngine("", &stubRunner{}, ""); err != nil {
+		t.Errorf("default engine: %v", err)
+	} else if _, ok := e.(*docker.Client); !ok {
+		t.Errorf("expected the CLI client by default, got %T", e)
+	}
+	if e, err := docker.NewEngine(docker.EngineAPI, nil, "unix:///var/run/docker.sock"); err != nil {
+		t.Errorf("api engine: %v", err)
+	} else if _, ok := e.(*docker.APIClient); !ok {
+		t.Errorf("expected the API client, got %T", e)
+	}
+	if _, err := docker.NewEngine("grpc", nil, ""); err == nil {
+		t.Error("expected unknown client kind to fail")
+	}
+	if _, err := docker.NewAPIClient("ssh://host"); err == nil {
+		t.Error("expected unsupported scheme to fail")
+	}
+}
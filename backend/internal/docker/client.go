@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -59,21 +60,35 @@ func (c *Client) ContainerCount(ctx context.Context) (Status, error) {
 	}, nil
 }
 
-// ContainerLabels represents a running container's labels.
+// ContainerLabels represents a container's labels and the runtime details
+// used for drift detection.
 type ContainerLabels struct {
 	ContainerID   string
 	ContainerName string
 	Labels        map[string]string
+
+	// Image is the image reference the container was created from (e.g. nginx:1.27).
+	Image string
+	// ImageID is the ID of the local image the container runs (sha256:...).
+	ImageID string
+	// State is the container state, e.g. running, exited or restarting.
+	State    string
+	ExitCode int
+	// RestartPolicy is the container's restart policy name, e.g. always or no.
+	RestartPolicy string
+	Env           []string
+	// Ports lists the published ports as "hostPort:containerPort/protocol".
+	Ports []string
 }
 
-// ListContainersWithLabel lists running containers that have the given label key set.
-// Returns container ID, name, and all labels for each matching container.
+// ListContainersWithLabel lists containers, including stopped ones, that have
+// the given label key set. Returns container ID, name, labels and runtime details for each.
 // Uses a two-step approach: docker ps to get container IDs, then docker inspect
 // for reliable JSON label parsing (avoids issues with comma-separated label output).
 func (c *Client) ListContainersWithLabel(ctx context.Context, labelKey string) ([]ContainerLabels, error) {
 	// Step 1: Get container IDs with the label filter
 	args := append(HostArgs(c.Socket),
-		"ps", "-q", "--no-trunc",
+		"ps", "-a", "-q", "--no-trunc",
 		"--filter", "label="+labelKey,
 	)
 	out, err := c.Runner.Run(ctx, "docker", args...)
@@ -108,23 +123,113 @@ func (c *Client) ListContainersWithLabel(ctx context.Context, labelKey string) (
 			continue
 		}
 
-		var info struct {
-			ID     string `json:"Id"`
-			Name   string `json:"Name"`
-			Config struct {
-				Labels map[string]string `json:"Labels"`
-			} `json:"Config"`
-		}
-		if err := json.Unmarshal([]byte(line), &info); err != nil {
+		info, err := parseContainerInspect([]byte(line))
+		if err != nil {
 			continue // skip unparseable entries
 		}
-
-		name := strings.TrimPrefix(info.Name, "/")
-		result = append(result, ContainerLabels{
-			ContainerID:   info.ID,
-			ContainerName: name,
-			Labels:        info.Config.Labels,
-		})
+		result = append(result, info)
 	}
 	return result, nil
 }
+
+// InspectContainer returns the labels and runtime details of a container.
+func (c *Client) InspectContainer(ctx context.Context, id string) (ContainerLabels, error) {
+	args := append(HostArgs(c.Socket), "inspect", "--format", "{{json .}}", id)
+	out, err := c.Runner.Run(ctx, "docker", args...)
+	if err != nil {
+		return ContainerLabels{}, fmt.Errorf("docker inspect error: %s: %w", strings.TrimSpace(string(out)), err)
+	}
+	return parseContainerInspect(out)
+}
+
+// ContainerAction runs a container action: start, stop, restart or kill.
+func (c *Client) ContainerAction(ctx context.Context, id, action string) error {
+	if err := checkContainerAction(action); err != nil {
+		return err
+	}
+	args := append(HostArgs(c.Socket), action, id)
+	out, err := c.Runner.Run(ctx, "docker", args...)
+	if err != nil {
+		return fmt.Errorf("docker %s error: %s: %w", action, strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// ImageRepoDigests returns the registry digests of a local image
+// (e.g. nginx@sha256:...). Images that were built locally have none.
+func (c *Client) ImageRepoDigests(ctx context.Context, image string) ([]string, error) {
+	args := append(HostArgs(c.Socket), "image", "inspect", "--format", "{{json .RepoDigests}}", image)
+	out, err := c.Runner.Run(ctx, "docker", args...)
+	if err != nil {
+		return nil, fmt.Errorf("docker image inspect error: %s: %w", strings.TrimSpace(string(out)), err)
+	}
+	var digests []string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(out))), &digests); err != nil {
+		return nil, fmt.Errorf("parse image digests: %w", err)
+	}
+	return digests, nil
+}
+
+// containerInspect is the subset of docker inspect / GET /containers/{id}/json
+// output used by docker-cd.
+type containerInspect struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Image  string `json:"Image"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Env    []string          `json:"Env"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	State struct {
+		Status   string `json:"Status"`
+		ExitCode int    `json:"ExitCode"`
+	} `json:"State"`
+	HostConfig struct {
+		RestartPolicy struct {
+			Name string `json:"Name"`
+		} `json:"RestartPolicy"`
+		PortBindings map[string][]struct {
+			HostPort string `json:"HostPort"`
+		} `json:"PortBindings"`
+	} `json:"HostConfig"`
+}
+
+// parseContainerInspect converts one container's inspect JSON to ContainerLabels.
+func parseContainerInspect(data []byte) (ContainerLabels, error) {
+	var info containerInspect
+	if err := json.Unmarshal(data, &info); err != nil {
+		return ContainerLabels{}, err
+	}
+
+	var ports []string
+	for port, bindings := range info.HostConfig.PortBindings {
+		for _, b := range bindings {
+			if b.HostPort != "" {
+				ports = append(ports, b.HostPort+":"+port)
+			}
+		}
+	}
+	sort.Strings(ports)
+	return ContainerLabels{
+		ContainerID:   info.ID,
+		ContainerName: strings.TrimPrefix(info.Name, "/"),
+		Labels:        info.Config.Labels,
+		Image:         info.Config.Image,
+		ImageID:       info.Image,
+		State:         info.State.Status,
+		ExitCode:      info.State.ExitCode,
+		RestartPolicy: info.HostConfig.RestartPolicy.Name,
+		Env:           info.Config.Env,
+		Ports:         ports,
+	}, nil
+}
+
+// checkContainerAction rejects actions other than start, stop, restart and kill.
+func checkContainerAction(action string) error {
+	switch action {
+	case "start", "stop", "restart", "kill":
+		return nil
+	}
+	return fmt.Errorf("unsupported container action %q", action)
+}
@@ -3,6 +3,7 @@ package docker_test
 import (
 	"context"
 	"fmt"
+	"io"
 	"strings"
 	"testing"
 
@@ -175,3 +176,74 @@ func TestListContainersWithLabel_CLIError(t *testing.T) {
 		t.Errorf("expected docker CLI error, got %q", err.Error())
 	}
 }
+
+func TestListContainersWithLabel_RuntimeDetails(t *testing.T) {
+	inspectOutput := `{"Id":"abc123","Name":"/app-web-1","Config":{"Image":"nginx:2","Env":["MODE=prod"],"Labels":{"com.docker-cd.stack.path":"app"}},` +
+		`"State":{"Status":"exited","ExitCode":137},"HostConfig":{"RestartPolicy":{"Name":"always"},"PortBindings":{"80/tcp":[{"HostIp":"","HostPort":"8080"}],"443/tcp":[{"HostPort":"8443"}]}}}` + "\n"
+	runner := &multiStubRunner{outputs: [][]byte{[]byte("abc123\n"), []byte(inspectOutput)}}
+	client := docker.NewClient(runner, "/var/run/docker.sock")
+
+	containers, err := client.ListContainersWithLabel(context.Background(), "com.docker-cd.stack.path")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("expected 1 container, got %d", len(containers))
+	}
+	c := containers[0]
+	if c.Image != "nginx:2" || c.State != "exited" || c.ExitCode != 137 || c.RestartPolicy != "always" {
+		t.Errorf("unexpected runtime details %+v", c)
+	}
+	if strings.Join(c.Env, ",") != "MODE=prod" {
+		t.Errorf("unexpected env %v", c.Env)
+	}
+	if strings.Join(c.Ports, ",") != "8080:80/tcp,8443:443/tcp" {
+		t.Errorf("unexpected ports %v", c.Ports)
+	}
+}
+
+// streamStubRunner streams the given output.
+type streamStubRunner struct {
+	stubRunner
+	stream string
+	args   []string
+}
+
+func (s *streamStubRunner) Stream(_ context.Context, _ string, args ...string) (io.ReadCloser, error) {
+	s.args = args
+	return io.NopCloser(strings.NewReader(s.stream)), nil
+}
+
+func TestStreamEvents(t *testing.T) {
+	runner := &streamStubRunner{stream: `{"Type":"container","Action":"die","Actor":{"ID":"abc123","Attributes":{"name":"app-web-1","exitCode":"137","com.docker-cd.stack.path":"app"}},"timeNano":1700000000000000000}` + "\n" +
+		"not json\n" +
+		`{"Type":"container","Action":"destroy","Actor":{"ID":"abc123","Attributes":{"name":"app-web-1","com.docker-cd.stack.path":"app"}},"timeNano":1700000001000000000}` + "\n"}
+	client := docker.NewClient(runner, "/var/run/docker.sock")
+
+	var got []docker.ContainerEvent
+	err := client.StreamEvents(context.Background(), "com.docker-cd.stack.path", []string{"die", "destroy"}, func(ev docker.ContainerEvent) {
+		got = append(got, ev)
+	})
+	if err == nil || !strings.Contains(err.Error(), "stream closed") {
+		t.Errorf("expected stream closed error, got %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(got))
+	}
+	if got[0].Action != "die" || got[0].ContainerName != "app-web-1" || got[0].Labels["com.docker-cd.stack.path"] != "app" {
+		t.Errorf("unexpected event %+v", got[0])
+	}
+	args := strings.Join(runner.args, " ")
+	for _, want := range []string{"events", "--filter type=container", "--filter label=com.docker-cd.stack.path", "--filter event=die", "--filter event=destroy"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("expected %q in args %q", want, args)
+		}
+	}
+}
+
+func TestStreamEvents_RunnerWithoutStreaming(t *testing.T) {
+	client := docker.NewClient(&stubRunner{}, "")
+	if err := client.StreamEvents(context.Background(), "l", nil, func(docker.ContainerEvent) {}); err == nil {
+		t.Error("expected an error for a runner without streaming support")
+	}
+}
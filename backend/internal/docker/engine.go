@@ -0,0 +1,48 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+)
+
+// Engine client implementations, selected with DOCKER_CLIENT.
+const (
+	EngineCLI = "cli"
+	EngineAPI = "api"
+)
+
+// Engine is the subset of the Docker engine used by docker-cd: container
+// listing, inspection, events, actions and image digests. Compose operations always use the CLI.
+type Engine interface {
+	// ContainerCount returns the number of currently running containers.
+	ContainerCount(ctx context.Context) (Status, error)
+	// ListContainersWithLabel lists containers, including stopped ones, that
+	// have the given label key set.
+	ListContainersWithLabel(ctx context.Context, labelKey string) ([]ContainerLabels, error)
+	// InspectContainer returns the labels and runtime details of a container.
+	InspectContainer(ctx context.Context, id string) (ContainerLabels, error)
+	// StreamEvents follows container events, see Client.StreamEvents.
+	StreamEvents(ctx context.Context, labelKey string, actions []string, fn func(ContainerEvent)) error
+	// ContainerAction runs a container action: start, stop, restart or kill.
+	ContainerAction(ctx context.Context, id, action string) error
+	// ImageRepoDigests returns the registry digests of a local image.
+	ImageRepoDigests(ctx context.Context, image string) ([]string, error)
+}
+
+var (
+	_ Engine = (*Client)(nil)
+	_ Engine = (*APIClient)(nil)
+)
+
+// NewEngine returns the Engine implementation named by kind: EngineCLI (or
+// empty) execs the docker binary through runner, EngineAPI talks to the
+// Engine API directly. socket follows the same rules as HostArgs.
+func NewEngine(kind string, runner CommandRunner, socket string) (Engine, error) {
+	switch kind {
+	case "", EngineCLI:
+		return NewClient(runner, socket), nil
+	case EngineAPI:
+		return NewAPIClient(socket)
+	}
+	return nil, fmt.Errorf("unknown docker client %q (want %q or %q)", kind, EngineCLI, EngineAPI)
+}
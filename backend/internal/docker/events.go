@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ContainerEvent is a container event reported by docker events.
+type ContainerEvent struct {
+	Action        string
+	ContainerID   string
+	ContainerName string
+	// Labels holds the container's labels; docker events reports them as
+	// actor attributes alongside name and exitCode.
+	Labels map[string]string
+	Time   time.Time
+}
+
+// eventMessage is an event as reported by docker events and GET /events.
+type eventMessage struct {
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+func (m eventMessage) containerEvent() ContainerEvent {
+	return ContainerEvent{
+		Action:        m.Action,
+		ContainerID:   m.Actor.ID,
+		ContainerName: m.Actor.Attributes["name"],
+		Labels:        m.Actor.Attributes,
+		Time:          time.Unix(0, m.TimeNano),
+	}
+}
+
+// StreamEvents follows docker events for containers that have the given label
+// key set, limited to the given actions (e.g. die, stop, destroy), and calls
+// fn for each event. It blocks until the stream ends and always returns a
+// non-nil error: ctx.Err() after cancellation, otherwise why the stream ended.
+// The Client's Runner must implement StreamRunner.
+func (c *Client) StreamEvents(ctx context.Context, labelKey string, actions []string, fn func(ContainerEvent)) error {
+	streamer, ok := c.Runner.(StreamRunner)
+	if !ok {
+		return errors.New("docker events: command runner does not support streaming")
+	}
+
+	args := append(HostArgs(c.Socket),
+		"events", "--format", "{{json .}}",
+		"--filter", "type=container",
+		"--filter", "label="+labelKey,
+	)
+	for _, action := range actions {
+		args = append(args, "--filter", "event="+action)
+	}
+
+	stream, err := streamer.Stream(ctx, "docker", args...)
+	if err != nil {
+		return fmt.Errorf("docker events: %w", err)
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var msg eventMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			continue // skip unparseable entries
+		}
+		fn(msg.containerEvent())
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("docker events: %w", err)
+	}
+	return errors.New("docker events: stream closed")
+}
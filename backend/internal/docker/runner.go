@@ -2,6 +2,7 @@ package docker
 
 import (
 	"context"
+	"io"
 	"os/exec"
 )
 
@@ -11,10 +12,41 @@ type CommandRunner interface {
 	Run(ctx context.Context, name string, args ...string) ([]byte, error)
 }
 
-// ExecRunner implements CommandRunner using os/exec.
+// StreamRunner runs long-lived commands whose output is consumed while they run.
+type StreamRunner interface {
+	// Stream starts a command and returns its stdout. Closing the reader
+	// waits for the command to exit; cancel ctx to stop it.
+	Stream(ctx context.Context, name string, args ...string) (io.ReadCloser, error)
+}
+
+// ExecRunner implements CommandRunner and StreamRunner using os/exec.
 type ExecRunner struct{}
 
 // Run executes the given command and returns combined stdout/stderr output.
 func (r *ExecRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
 	return exec.CommandContext(ctx, name, args...).CombinedOutput()
 }
+
+// Stream starts the given command and returns its stdout.
+func (r *ExecRunner) Stream(ctx context.Context, name string, args ...string) (io.ReadCloser, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandStream{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+// commandStream is a command's stdout that reaps the command on Close.
+type commandStream struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (s *commandStream) Close() error {
+	s.ReadCloser.Close()
+	return s.cmd.Wait()
+}
@@ -12,6 +12,7 @@ const (
 	EventTypeStackRemoved       = "stack.removed"
 	EventTypeContainersUpdated  = "stack.containers.updated"
 	EventTypeDriftDetected      = "stack.drift.detected"
+	EventTypeStackRolledBack    = "stack.rolled_back"
 )
 
 // baseEvent provides common event fields.
@@ -160,3 +161,36 @@ func NewDriftDetectedEvent(stackPath, reason string, needSync bool) *DriftDetect
 		NeedSync:  needSync,
 	}
 }
+
+// StackRolledBackEvent is published when a sync failed its health check and
+// the stack was redeployed at its last known good revision.
+type StackRolledBackEvent struct {
+	baseEvent
+	StackPath         string
+	FailedRevision    string
+	FailedComposeHash string
+	RollbackRevision  string
+	Reason            string
+}
+
+// NewStackRolledBackEvent creates a stack rolled back event.
+func NewStackRolledBackEvent(stackPath, failedRevision, failedComposeHash, rollbackRevision, reason string) *StackRolledBackEvent {
+	return &StackRolledBackEvent{
+		baseEvent: baseEvent{
+			eventType:  EventTypeStackRolledBack,
+			occurredAt: time.Now().UTC(),
+			metadata: map[string]any{
+				"stack_path":          stackPath,
+				"failed_revision":     failedRevision,
+				"failed_compose_hash": failedComposeHash,
+				"rollback_revision":   rollbackRevision,
+				"reason":              reason,
+			},
+		},
+		StackPath:         stackPath,
+		FailedRevision:    failedRevision,
+		FailedComposeHash: failedComposeHash,
+		RollbackRevision:  rollbackRevision,
+		Reason:            reason,
+	}
+}
@@ -0,0 +1,94 @@
+package git
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/lucasreiners/docker-cd/internal/config"
+)
+
+// AuthProvider resolves the transport credentials used to reach a Git remote.
+// It is shared by all go-git backed readers so HTTPS and SSH remotes are
+// authenticated the same way everywhere.
+type AuthProvider interface {
+	AuthMethod(repoURL string) (transport.AuthMethod, error)
+}
+
+// Credentials is the default AuthProvider.
+// HTTPS remotes authenticate with Token; SSH remotes use a private key
+// (inline or from a file), an optional passphrase and a known_hosts check.
+type Credentials struct {
+	Token string
+
+	SSHKey           []byte
+	SSHKeyFile       string
+	SSHKeyPassphrase string
+	// SSHKnownHostsFile is the known_hosts file used to verify the remote host key.
+	// When empty, SSH_KNOWN_HOSTS or the default ~/.ssh/known_hosts locations are used.
+	SSHKnownHostsFile string
+}
+
+// NewCredentials builds Credentials from the runtime configuration.
+func NewCredentials(cfg config.Config) Credentials {
+	return Credentials{
+		Token:             cfg.GitAccessToken,
+		SSHKey:            []byte(cfg.GitSSHKey),
+		SSHKeyFile:        cfg.GitSSHKeyFile,
+		SSHKeyPassphrase:  cfg.GitSSHKeyPassphrase,
+		SSHKnownHostsFile: cfg.GitSSHKnownHosts,
+	}
+}
+
+// AuthMethod returns the go-git auth method matching the protocol of repoURL.
+func (c Credentials) AuthMethod(repoURL string) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository URL: %w", err)
+	}
+
+	switch ep.Protocol {
+	case "https":
+		return &http.BasicAuth{
+			Username: "x-access-token",
+			Password: c.Token,
+		}, nil
+	case "ssh":
+		return c.sshAuth(ep.User)
+	default:
+		return nil, fmt.Errorf("unsupported repository protocol %q", ep.Protocol)
+	}
+}
+
+func (c Credentials) sshAuth(user string) (transport.AuthMethod, error) {
+	if user == "" {
+		user = "git"
+	}
+
+	var keys *ssh.PublicKeys
+	var err error
+	switch {
+	case len(c.SSHKey) > 0:
+		keys, err = ssh.NewPublicKeys(user, c.SSHKey, c.SSHKeyPassphrase)
+	case c.SSHKeyFile != "":
+		keys, err = ssh.NewPublicKeysFromFile(user, c.SSHKeyFile, c.SSHKeyPassphrase)
+	default:
+		return nil, fmt.Errorf("no SSH private key configured")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH private key: %w", err)
+	}
+
+	var files []string
+	if c.SSHKnownHostsFile != "" {
+		files = append(files, c.SSHKnownHostsFile)
+	}
+	callback, err := ssh.NewKnownHostsCallback(files...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts: %w", err)
+	}
+	keys.HostKeyCallback = callback
+
+	return keys, nil
+}
@@ -0,0 +1,127 @@
+package git_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/lucasreiners/docker-cd/internal/git"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// writeTestKey generates an OpenSSH ed25519 private key and an empty
+// known_hosts file, returning both paths.
+func writeTestKey(t *testing.T) (string, string) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	block, err := gossh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	knownHosts := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(knownHosts, nil, 0600); err != nil {
+		t.Fatalf("write known_hosts: %v", err)
+	}
+	return keyFile, knownHosts
+}
+
+func TestCredentials_HTTPSUsesToken(t *testing.T) {
+	creds := git.Credentials{Token: "secret"}
+
+	method, err := creds.AuthMethod("https://github.com/org/repo.git")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	basic, ok := method.(*http.BasicAuth)
+	if !ok {
+		t.Fatalf("expected *http.BasicAuth, got %T", method)
+	}
+	if basic.Password != "secret" {
+		t.Errorf("expected token as password, got %q", basic.Password)
+	}
+}
+
+func TestCredentials_SSHUsesKeyFile(t *testing.T) {
+	keyFile, knownHosts := writeTestKey(t)
+	creds := git.Credentials{SSHKeyFile: keyFile, SSHKnownHostsFile: knownHosts}
+
+	method, err := creds.AuthMethod("ssh://deploy@gitea.internal:2222/org/repo.git")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keys, ok := method.(*ssh.PublicKeys)
+	if !ok {
+		t.Fatalf("expected *ssh.PublicKeys, got %T", method)
+	}
+	if keys.User != "deploy" {
+		t.Errorf("expected user from URL, got %q", keys.User)
+	}
+	if keys.HostKeyCallback == nil {
+		t.Error("expected a known_hosts host key callback")
+	}
+}
+
+func TestCredentials_SSHURLWithoutUserDefaultsToGit(t *testing.T) {
+	keyFile, knownHosts := writeTestKey(t)
+	pemBytes, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatalf("read key: %v", err)
+	}
+	creds := git.Credentials{SSHKey: pemBytes, SSHKnownHostsFile: knownHosts}
+
+	method, err := creds.AuthMethod("ssh://gitea.internal/org/repo.git")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if keys := method.(*ssh.PublicKeys); keys.User != "git" {
+		t.Errorf("expected default user git, got %q", keys.User)
+	}
+}
+
+func TestCredentials_SSHWithoutKey(t *testing.T) {
+	creds := git.Credentials{Token: "tok"}
+
+	if _, err := creds.AuthMethod("git@github.com:org/repo.git"); err == nil {
+		t.Fatal("expected error when no SSH key is configured")
+	}
+}
+
+func TestValidate_SSHRemote(t *testing.T) {
+	keyFile, knownHosts := writeTestKey(t)
+	lister := &stubLister{refs: []*plumbing.Reference{makeRef("refs/heads/main")}}
+	creds := git.Credentials{SSHKeyFile: keyFile, SSHKnownHostsFile: knownHosts}
+
+	result := git.Validate(context.Background(), lister, "git@gitea.internal:org/repo.git", creds, "main", "")
+
+	if !result.Success {
+		t.Fatalf("expected success for SSH remote, got error: %v", result.Error)
+	}
+}
+
+func TestValidate_SSHRemoteMissingKey(t *testing.T) {
+	lister := &stubLister{refs: []*plumbing.Reference{makeRef("refs/heads/main")}}
+
+	result := git.Validate(context.Background(), lister, "git@gitea.internal:org/repo.git", git.Credentials{}, "main", "")
+
+	if result.Success {
+		t.Fatal("expected failure when SSH key is missing")
+	}
+	if result.Error.Type != git.ErrMissingConfig {
+		t.Errorf("expected ErrMissingConfig, got %d", result.Error.Type)
+	}
+}
@@ -0,0 +1,211 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// RepoCache keeps a bare clone of the repository on disk and updates it with
+// incremental fetches, so repeated reads only transfer new objects.
+// It is safe for concurrent use; fetches are serialised.
+type RepoCache struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewRepoCache creates a cache rooted at dir. The directory is created on first use.
+func NewRepoCache(dir string) *RepoCache {
+	return &RepoCache{dir: dir}
+}
+
+// Dir returns the directory holding the bare repository.
+func (c *RepoCache) Dir() string {
+	return c.dir
+}
+
+// Fetch brings the cached repository up to date with rev and returns the
+// commit it points to. Nothing is fetched when the commit is already cached.
+func (c *RepoCache) Fetch(ctx context.Context, repoURL string, auth AuthProvider, rev Revision) (*object.Commit, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	method, err := authMethod(auth, repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := c.open(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if commit, err := commitFor(repo, rev.Hash); err == nil {
+		return commit, nil
+	}
+
+	err = repo.FetchContext(ctx, &gogit.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   refSpecsFor(rev),
+		Auth:       method,
+		Force:      true,
+	})
+	if err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return nil, fmt.Errorf("fetch failed: %w", err)
+	}
+
+	commit, err := commitFor(repo, rev.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %q: %w", rev.Short(), err)
+	}
+	return commit, nil
+}
+
+// refSpecsFor returns the refspecs needed to fetch rev. Commit SHAs cannot be
+// requested directly from every server, so all branches and tags are fetched.
+func refSpecsFor(rev Revision) []config.RefSpec {
+	switch rev.Type {
+	case RefTypeBranch:
+		local := plumbing.NewRemoteReferenceName("origin", rev.Name.Short())
+		return []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", rev.Name, local))}
+	case RefTypeTag:
+		return []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", rev.Name, rev.Name))}
+	default:
+		return []config.RefSpec{
+			"+refs/heads/*:refs/remotes/origin/*",
+			"+refs/tags/*:refs/tags/*",
+		}
+	}
+}
+
+// commitFor returns the commit for hash, peeling annotated tag objects.
+func commitFor(repo *gogit.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	if commit, err := repo.CommitObject(hash); err == nil {
+		return commit, nil
+	}
+	tag, err := repo.TagObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("object %s not found", hash)
+	}
+	return tag.Commit()
+}
+
+// open returns the bare repository in the cache directory, initialising it
+// if needed and pointing the origin remote at repoURL.
+func (c *RepoCache) open(repoURL string) (*gogit.Repository, error) {
+	repo, err := gogit.PlainOpen(c.dir)
+	if errors.Is(err, gogit.ErrRepositoryNotExists) {
+		if err := os.MkdirAll(c.dir, 0o755); err != nil {
+			return nil, fmt.Errorf("create cache dir: %w", err)
+		}
+		repo, err = gogit.PlainInit(c.dir, true)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open cache repository: %w", err)
+	}
+
+	remote, err := repo.Remote("origin")
+	if err == nil && len(remote.Config().URLs) > 0 && remote.Config().URLs[0] == repoURL {
+		return repo, nil
+	}
+	if err == nil {
+		// The configured URL changed; re-point the remote but keep the objects.
+		if err := repo.DeleteRemote("origin"); err != nil {
+			return nil, fmt.Errorf("reset cache remote: %w", err)
+		}
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{repoURL}}); err != nil {
+		return nil, fmt.Errorf("configure cache remote: %w", err)
+	}
+	return repo, nil
+}
+
+// resolveRemote resolves revision against the remote refs (git ls-remote).
+// Commit SHAs need no lookup.
+func resolveRemote(ctx context.Context, repoURL string, auth AuthProvider, revision string) (Revision, error) {
+	if shaPattern.MatchString(revision) {
+		return Revision{Hash: plumbing.NewHash(revision), Type: RefTypeCommit}, nil
+	}
+	refs, err := (&GoGitRemoteLister{}).ListRefs(ctx, repoURL, auth)
+	if err != nil {
+		return Revision{}, fmt.Errorf("failed to list remote refs: %w", err)
+	}
+	return ResolveRevision(refs, revision)
+}
+
+// resolveCommit resolves revision and returns its commit. It fetches through
+// cache when one is configured and otherwise clones into memory.
+func resolveCommit(ctx context.Context, cache *RepoCache, repoURL string, auth AuthProvider, revision string) (*object.Commit, Revision, error) {
+	rev, err := resolveRemote(ctx, repoURL, auth, revision)
+	if err != nil {
+		return nil, Revision{}, err
+	}
+	commit, err := loadCommit(ctx, cache, repoURL, auth, rev)
+	if err != nil {
+		return nil, Revision{}, err
+	}
+	return commit, rev, nil
+}
+
+// loadCommit retrieves the commit for an already resolved revision. Branches
+// and tags are cloned shallowly; commit SHAs need the full history.
+func loadCommit(ctx context.Context, cache *RepoCache, repoURL string, auth AuthProvider, rev Revision) (*object.Commit, error) {
+	if cache != nil {
+		return cache.Fetch(ctx, repoURL, auth, rev)
+	}
+
+	method, err := authMethod(auth, repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &gogit.CloneOptions{
+		URL:        repoURL,
+		Auth:       method,
+		NoCheckout: true,
+	}
+	if rev.Type != RefTypeCommit {
+		opts.ReferenceName = rev.Name
+		opts.SingleBranch = true
+		opts.Depth = 1
+	}
+
+	repo, err := gogit.CloneContext(ctx, memory.NewStorage(), nil, opts)
+	if err != nil {
+		return nil, fmt.Errorf("clone failed: %w", err)
+	}
+
+	hash := rev.Hash
+	if rev.Type != RefTypeCommit {
+		// Use what was actually cloned; the ref may have moved since ls-remote.
+		ref, err := repo.Reference(rev.Name, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %q: %w", rev.Short(), err)
+		}
+		hash = ref.Hash()
+	}
+
+	commit, err := commitFor(repo, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit: %w", err)
+	}
+	return commit, nil
+}
+
+// authMethod resolves auth for repoURL, allowing a nil provider for
+// unauthenticated (e.g. local) remotes.
+func authMethod(auth AuthProvider, repoURL string) (transport.AuthMethod, error) {
+	if auth == nil {
+		return nil, nil
+	}
+	return auth.AuthMethod(repoURL)
+}
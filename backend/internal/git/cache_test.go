@@ -0,0 +1,250 @@
+package git_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/lucasreiners/docker-cd/internal/git"
+)
+
+// sourceRepo is a local non-bare repository used as a fetch remote.
+type sourceRepo struct {
+	t    *testing.T
+	dir  string
+	repo *gogit.Repository
+}
+
+func newSourceRepo(t *testing.T) *sourceRepo {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := gogit.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("init source repo: %v", err)
+	}
+	return &sourceRepo{t: t, dir: dir, repo: repo}
+}
+
+// commit writes files (path -> content) and commits them on master.
+func (s *sourceRepo) commit(msg string, files map[string]string) string {
+	s.t.Helper()
+	wt, err := s.repo.Worktree()
+	if err != nil {
+		s.t.Fatalf("worktree: %v", err)
+	}
+	for name, content := range files {
+		full := filepath.Join(s.dir, name)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			s.t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			s.t.Fatalf("write file: %v", err)
+		}
+		if _, err := wt.Add(name); err != nil {
+			s.t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	hash, err := wt.Commit(msg, &gogit.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		s.t.Fatalf("commit: %v", err)
+	}
+	return hash.String()
+}
+
+// tag creates an annotated tag on HEAD.
+func (s *sourceRepo) tag(name string) {
+	s.t.Helper()
+	head, err := s.repo.Head()
+	if err != nil {
+		s.t.Fatalf("head: %v", err)
+	}
+	_, err = s.repo.CreateTag(name, head.Hash(), &gogit.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		Message: name,
+	})
+	if err != nil {
+		s.t.Fatalf("tag %s: %v", name, err)
+	}
+}
+
+func TestGoGitComposeReader_Cache_ReadsAndDetectsUnchanged(t *testing.T) {
+	src := newSourceRepo(t)
+	first := src.commit("add api", map[string]string{
+		"stacks/api/docker-compose.yml": "services: {}\n",
+	})
+
+	cache := git.NewRepoCache(filepath.Join(t.TempDir(), "cache"))
+	reader := &git.GoGitComposeReader{Cache: cache}
+	ctx := context.Background()
+
+	result, err := reader.ReadComposeFiles(ctx, src.dir, nil, "master", "stacks", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Commit != first {
+		t.Errorf("expected commit %s, got %s", first, result.Commit)
+	}
+	if result.CommitMessage != "add api" {
+		t.Errorf("expected commit message %q, got %q", "add api", result.CommitMessage)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].StackPath != "api" {
+		t.Fatalf("expected single api entry, got %+v", result.Entries)
+	}
+
+	if _, err := os.Stat(filepath.Join(cache.Dir(), "HEAD")); err != nil {
+		t.Errorf("expected bare repository in cache dir: %v", err)
+	}
+
+	result, err = reader.ReadComposeFiles(ctx, src.dir, nil, "master", "stacks", first)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Unchanged {
+		t.Error("expected unchanged result for known revision")
+	}
+	if result.Entries != nil {
+		t.Errorf("expected no entries for unchanged result, got %d", len(result.Entries))
+	}
+}
+
+func TestGoGitComposeReader_Cache_FetchesNewCommits(t *testing.T) {
+	src := newSourceRepo(t)
+	first := src.commit("add api", map[string]string{
+		"stacks/api/docker-compose.yml": "services: {}\n",
+	})
+
+	reader := &git.GoGitComposeReader{Cache: git.NewRepoCache(t.TempDir())}
+	ctx := context.Background()
+
+	if _, err := reader.ReadComposeFiles(ctx, src.dir, nil, "master", "stacks", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	second := src.commit("add web", map[string]string{
+		"stacks/web/compose.yaml":        "services: {}\n",
+		"stacks/web/docker-compose.yaml": "services: {}\n",
+	})
+
+	result, err := reader.ReadComposeFiles(ctx, src.dir, nil, "master", "stacks", first)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Unchanged {
+		t.Fatal("expected new revision to be detected")
+	}
+	if result.Commit != second {
+		t.Errorf("expected commit %s, got %s", second, result.Commit)
+	}
+	if len(result.Entries) != 2 {
+		t.Fatalf("expected 2 entries after fetch, got %d", len(result.Entries))
+	}
+}
+
+func TestGoGitPathChecker_Cache(t *testing.T) {
+	src := newSourceRepo(t)
+	src.commit("init", map[string]string{
+		"stacks/api/docker-compose.yml": "services: {}\n",
+	})
+
+	checker := &git.GoGitPathChecker{Cache: git.NewRepoCache(t.TempDir())}
+	ctx := context.Background()
+
+	exists, err := checker.PathExists(ctx, src.dir, nil, "master", "stacks")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !exists {
+		t.Error("expected stacks to exist")
+	}
+
+	exists, err = checker.PathExists(ctx, src.dir, nil, "master", "missing")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exists {
+		t.Error("expected missing path to not exist")
+	}
+}
+
+func TestGoGitComposeReader_Revisions(t *testing.T) {
+	src := newSourceRepo(t)
+	first := src.commit("v1", map[string]string{
+		"stacks/api/docker-compose.yml": "services: {}\n",
+	})
+	src.tag("v1.0.0")
+	second := src.commit("v2", map[string]string{
+		"stacks/web/docker-compose.yml": "services: {}\n",
+	})
+	src.tag("v2.0.0")
+	head := src.commit("unreleased", map[string]string{
+		"stacks/db/docker-compose.yml": "services: {}\n",
+	})
+
+	tests := []struct {
+		revision    string
+		wantCommit  string
+		wantRef     string
+		wantRefType string
+		wantEntries int
+	}{
+		{"master", head, "master", git.RefTypeBranch, 3},
+		{"v1.0.0", first, "v1.0.0", git.RefTypeTag, 1},
+		{"v*", second, "v2.0.0", git.RefTypeTag, 2},
+		{first, first, first, git.RefTypeCommit, 1},
+	}
+
+	for _, cached := range []bool{false, true} {
+		for _, tt := range tests {
+			name := tt.revision
+			if cached {
+				name += "/cached"
+			}
+			t.Run(name, func(t *testing.T) {
+				reader := &git.GoGitComposeReader{}
+				if cached {
+					reader.Cache = git.NewRepoCache(t.TempDir())
+				}
+				result, err := reader.ReadComposeFiles(context.Background(), src.dir, nil, tt.revision, "stacks", "")
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if result.Commit != tt.wantCommit {
+					t.Errorf("expected commit %s, got %s", tt.wantCommit, result.Commit)
+				}
+				if result.Ref != tt.wantRef || result.RefType != tt.wantRefType {
+					t.Errorf("expected %s %s, got %s %s", tt.wantRefType, tt.wantRef, result.RefType, result.Ref)
+				}
+				if len(result.Entries) != tt.wantEntries {
+					t.Errorf("expected %d entries, got %d", tt.wantEntries, len(result.Entries))
+				}
+			})
+		}
+	}
+}
+
+func TestGoGitComposeReader_UnchangedSkipsFetch(t *testing.T) {
+	src := newSourceRepo(t)
+	first := src.commit("init", map[string]string{
+		"stacks/api/docker-compose.yml": "services: {}\n",
+	})
+
+	cache := git.NewRepoCache(filepath.Join(t.TempDir(), "cache"))
+	reader := &git.GoGitComposeReader{Cache: cache}
+
+	result, err := reader.ReadComposeFiles(context.Background(), src.dir, nil, "master", "stacks", first)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Unchanged || result.RefType != git.RefTypeBranch {
+		t.Errorf("expected unchanged branch result, got %+v", result)
+	}
+	if _, err := os.Stat(cache.Dir()); !os.IsNotExist(err) {
+		t.Errorf("expected no cache to be created for an unchanged revision, stat err: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/lucasreiners/docker-cd/internal/config"
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+)
+
+// StackLoader reads a single stack at an arbitrary revision, e.g. to redeploy
+// the last known good revision of a stack after a failed sync.
+type StackLoader struct {
+	RepoURL   string
+	Auth      AuthProvider
+	Cache     *RepoCache
+	DeployDir string
+	// ComposeFileNames lists the accepted compose file names. Empty means
+	// config.DefaultComposeFileNames.
+	ComposeFileNames []string
+}
+
+// NewStackLoader creates a StackLoader. cache may be nil, in which case every
+// load clones the repository in memory.
+func NewStackLoader(repoURL string, auth AuthProvider, cache *RepoCache, deployDir string, composeFileNames []string) *StackLoader {
+	return &StackLoader{
+		RepoURL:          repoURL,
+		Auth:             auth,
+		Cache:            cache,
+		DeployDir:        strings.Trim(deployDir, "/"),
+		ComposeFileNames: composeFileNames,
+	}
+}
+
+// LoadStack returns the desired-state record of the stack at stackPath as of
+// revision (a branch, tag or commit SHA).
+func (l *StackLoader) LoadStack(ctx context.Context, revision, stackPath string) (desiredstate.StackRecord, error) {
+	commit, rev, err := resolveCommit(ctx, l.Cache, l.RepoURL, l.Auth, revision)
+	if err != nil {
+		return desiredstate.StackRecord{}, err
+	}
+	root, err := commit.Tree()
+	if err != nil {
+		return desiredstate.StackRecord{}, fmt.Errorf("failed to get tree: %w", err)
+	}
+
+	tree, err := root.Tree(path.Join(l.DeployDir, stackPath))
+	if err != nil {
+		return desiredstate.StackRecord{}, fmt.Errorf("stack %q not found at %s: %w", stackPath, rev.Short(), err)
+	}
+
+	names := l.ComposeFileNames
+	if len(names) == 0 {
+		names = config.DefaultComposeFileNames
+	}
+	stack, found, err := readStack(root, tree, l.DeployDir, stackPath, names)
+	if err != nil {
+		return desiredstate.StackRecord{}, err
+	}
+	if !found {
+		return desiredstate.StackRecord{}, fmt.Errorf("no compose file for stack %q at %s", stackPath, rev.Short())
+	}
+	return stack.Record(), nil
+}
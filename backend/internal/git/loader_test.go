@@ -0,0 +1,41 @@
+package git_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/git"
+)
+
+func TestStackLoader_LoadStackAtRevision(t *testing.T) {
+	src := newSourceRepo(t)
+	first := src.commit("v1", map[string]string{
+		"stacks/api/docker-compose.yml": "services:\n  api:\n    image: api:1\n",
+		"stacks/api/.docker-cd.yaml":    "profiles: [web]\n",
+	})
+	src.commit("v2", map[string]string{
+		"stacks/api/docker-compose.yml": "services:\n  api:\n    image: api:2\n",
+	})
+
+	loader := git.NewStackLoader(src.dir, nil, git.NewRepoCache(t.TempDir()), "stacks", nil)
+	rec, err := loader.LoadStack(context.Background(), first, "api")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(rec.Content) != "services:\n  api:\n    image: api:1\n" {
+		t.Errorf("expected content at first revision, got %q", rec.Content)
+	}
+	want := desiredstate.ComposeHash([]byte("services:\n  api:\n    image: api:1\n"), []byte("profiles: [web]\n"))
+	if rec.ComposeHash != want {
+		t.Errorf("expected hash %s, got %s", want, rec.ComposeHash)
+	}
+	if rec.Settings == nil || len(rec.Settings.Profiles) != 1 {
+		t.Errorf("expected settings to be loaded, got %+v", rec.Settings)
+	}
+
+	if _, err := loader.LoadStack(context.Background(), first, "missing"); err == nil {
+		t.Error("expected error for missing stack")
+	}
+}
@@ -2,72 +2,149 @@ package git
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"path"
 	"strings"
 
-	gogit "github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
-	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/lucasreiners/docker-cd/internal/config"
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
 )
 
 // ComposeEntry represents a compose file found in the repository.
 type ComposeEntry struct {
 	// StackPath is the directory containing the compose file (relative to deploy dir).
 	StackPath string
-	// ComposeFile is the filename (docker-compose.yml or docker-compose.yaml).
+	// ComposeFile is the filename (e.g. docker-compose.yml or compose.yaml).
 	ComposeFile string
 	// Content is the raw compose file content.
 	Content []byte
+	// ComposeFiles lists every compose file in the order passed to compose,
+	// starting with ComposeFile. Paths are relative to the stack directory.
+	ComposeFiles []string
+	// EnvFiles lists the env files used for interpolation, relative to the stack directory.
+	EnvFiles []string
+	// Files holds the content of every compose and env file, keyed by relative path.
+	Files map[string][]byte
+	// Settings are parsed from the stack's desiredstate.SettingsFile, nil if absent.
+	Settings *desiredstate.StackSettings
+	// SettingsContent is the raw settings file, included in the hash so a
+	// change to e.g. profiles triggers a sync.
+	SettingsContent []byte
+}
+
+// HashContents returns the compose file contents in order followed by the env
+// file contents and the settings file, as input for desiredstate.ComposeHash.
+func (e ComposeEntry) HashContents() [][]byte {
+	var contents [][]byte
+	if len(e.ComposeFiles) == 0 {
+		contents = [][]byte{e.Content}
+	} else {
+		contents = make([][]byte, 0, len(e.ComposeFiles)+len(e.EnvFiles)+1)
+		for _, name := range e.ComposeFiles {
+			contents = append(contents, e.Files[name])
+		}
+		for _, name := range e.EnvFiles {
+			contents = append(contents, e.Files[name])
+		}
+	}
+	if e.SettingsContent != nil {
+		contents = append(contents, e.SettingsContent)
+	}
+	return contents
+}
+
+// Record converts the entry into a desired-state stack record with its hash,
+// files and settings. Sync status and policy are left for the caller.
+func (e ComposeEntry) Record() desiredstate.StackRecord {
+	rec := desiredstate.StackRecord{
+		Path:         e.StackPath,
+		ComposeFile:  e.ComposeFile,
+		ComposeHash:  desiredstate.ComposeHash(e.HashContents()...),
+		Content:      e.Content,
+		ComposeFiles: e.ComposeFiles,
+		EnvFiles:     e.EnvFiles,
+		Files:        e.Files,
+		Settings:     e.Settings,
+	}
+	if e.Settings != nil {
+		rec.DependsOn = e.Settings.DependsOn
+	}
+	return rec
+}
+
+// ReadResult is the outcome of a ReadComposeFiles call.
+type ReadResult struct {
+	Entries       []ComposeEntry
+	Commit        string
+	CommitMessage string
+	// Ref is the resolved branch or tag name, or the commit SHA.
+	Ref string
+	// RefType is one of RefTypeBranch, RefTypeTag or RefTypeCommit.
+	RefType string
+	// Unchanged is true when Commit equals the knownRevision passed to
+	// ReadComposeFiles. The tree is not walked and Entries is nil.
+	Unchanged bool
 }
 
 // ComposeReader reads compose files from a Git repository.
 type ComposeReader interface {
-	// ReadComposeFiles clones the repo (shallow, in-memory) and returns all compose entries
-	// found under the given deploy directory.
-	// Returns entries, commit hash, commit message, and error.
-	ReadComposeFiles(ctx context.Context, repoURL, token, revision, deployDir string) ([]ComposeEntry, string, string, error)
+	// ReadComposeFiles fetches the revision and returns all compose entries
+	// found under the given deploy directory. If the resolved commit equals
+	// knownRevision the tree walk is skipped and the result is marked Unchanged.
+	ReadComposeFiles(ctx context.Context, repoURL string, auth AuthProvider, revision, deployDir, knownRevision string) (ReadResult, error)
 }
 
 // GoGitComposeReader implements ComposeReader using go-git.
-type GoGitComposeReader struct{}
-
-// ReadComposeFiles performs a shallow clone and scans for docker-compose.yml/yaml files
-// in immediate subdirectories of the deploy directory.
-// Returns the list of compose entries, resolved commit hash, commit message, and error.
-func (g *GoGitComposeReader) ReadComposeFiles(ctx context.Context, repoURL, token, revision, deployDir string) ([]ComposeEntry, string, string, error) {
-	repo, err := gogit.CloneContext(ctx, memory.NewStorage(), nil, &gogit.CloneOptions{
-		URL: repoURL,
-		Auth: &http.BasicAuth{
-			Username: "x-access-token",
-			Password: token,
-		},
-		ReferenceName: plumbing.NewBranchReferenceName(revision),
-		SingleBranch:  true,
-		Depth:         1,
-	})
-	if err != nil {
-		return nil, "", "", fmt.Errorf("shallow clone failed: %w", err)
-	}
+// When Cache is set, the repository is fetched incrementally into the on-disk
+// cache; otherwise every read performs a shallow in-memory clone.
+//
+// Stacks are discovered recursively: a directory containing one of
+// ComposeFileNames is a stack and is not descended into further.
+// Directories whose name or relative path matches an Ignore glob are skipped.
+type GoGitComposeReader struct {
+	Cache *RepoCache
+	// ComposeFileNames lists the accepted compose file names in order of
+	// preference. Empty means config.DefaultComposeFileNames.
+	ComposeFileNames []string
+	// Ignore holds path.Match globs. Nil means config.DefaultStackIgnore.
+	Ignore []string
+}
 
-	ref, err := repo.Head()
+// ReadComposeFiles resolves the revision (branch, tag, commit SHA or semver
+// constraint), fetches it and discovers stacks below the deploy directory.
+func (g *GoGitComposeReader) ReadComposeFiles(ctx context.Context, repoURL string, auth AuthProvider, revision, deployDir, knownRevision string) (ReadResult, error) {
+	rev, err := resolveRemote(ctx, repoURL, auth, revision)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to get HEAD: %w", err)
+		return ReadResult{}, err
 	}
 
-	commitHash := ref.Hash().String()
+	// The advertised hash already tells us nothing changed; skip the fetch.
+	if knownRevision != "" && rev.Hash.String() == knownRevision {
+		return ReadResult{Commit: knownRevision, Ref: rev.Short(), RefType: rev.Type, Unchanged: true}, nil
+	}
 
-	commit, err := repo.CommitObject(ref.Hash())
+	commit, err := loadCommit(ctx, g.Cache, repoURL, auth, rev)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to get commit: %w", err)
+		return ReadResult{}, err
 	}
 
-	commitMessage := strings.TrimSpace(commit.Message)
+	result := ReadResult{
+		Commit:        commit.Hash.String(),
+		CommitMessage: strings.TrimSpace(commit.Message),
+		Ref:           rev.Short(),
+		RefType:       rev.Type,
+	}
+	if knownRevision != "" && result.Commit == knownRevision {
+		result.Unchanged = true
+		return result, nil
+	}
 
 	rootTree, err := commit.Tree()
 	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to get tree: %w", err)
+		return ReadResult{}, fmt.Errorf("failed to get tree: %w", err)
 	}
 
 	// Navigate to deploy directory if specified
@@ -76,44 +153,123 @@ func (g *GoGitComposeReader) ReadComposeFiles(ctx context.Context, repoURL, toke
 		deployDir = strings.Trim(deployDir, "/")
 		tree, err = rootTree.Tree(deployDir)
 		if err != nil {
-			return nil, "", "", fmt.Errorf("deploy dir %q not found: %w", deployDir, err)
+			return ReadResult{}, fmt.Errorf("deploy dir %q not found: %w", deployDir, err)
 		}
 	}
 
-	var entries []ComposeEntry
+	names := g.ComposeFileNames
+	if len(names) == 0 {
+		names = config.DefaultComposeFileNames
+	}
+	ignore := g.Ignore
+	if ignore == nil {
+		ignore = config.DefaultStackIgnore
+	}
 
-	// Iterate immediate subdirectories
+	result.Entries, err = discoverStacks(rootTree, tree, deployDir, "", names, ignore)
+	if err != nil {
+		return ReadResult{}, err
+	}
+	return result, nil
+}
+
+// discoverStacks walks the subdirectories of tree and returns one entry per
+// stack directory, with StackPath relative to the deploy directory.
+// root is the repository root tree, used to resolve files outside the stack.
+// An invalid settings file fails discovery: skipping the stack would make it
+// look deleted and could get it removed.
+func discoverStacks(root, tree *object.Tree, deployDir, prefix string, names, ignore []string) ([]ComposeEntry, error) {
+	var entries []ComposeEntry
 	for _, entry := range tree.Entries {
 		if entry.Mode.IsFile() {
 			continue
 		}
 
+		rel := path.Join(prefix, entry.Name)
+		if isIgnored(rel, ignore) {
+			continue
+		}
+
 		subtree, err := tree.Tree(entry.Name)
 		if err != nil {
 			continue
 		}
 
-		composeFile, content, err := findComposeFile(subtree)
-		if err != nil || composeFile == "" {
+		stack, found, err := readStack(root, subtree, deployDir, rel, names)
+		var filesErr *stackFilesError
+		if errors.As(err, &filesErr) {
+			log.Printf("[warn] skipping stack %s: %v", rel, filesErr.err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			nested, err := discoverStacks(root, subtree, deployDir, rel, names, ignore)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, nested...)
 			continue
 		}
+		entries = append(entries, stack)
+	}
+	return entries, nil
+}
 
-		entries = append(entries, ComposeEntry{
-			StackPath:   entry.Name,
-			ComposeFile: composeFile,
-			Content:     content,
-		})
+// stackFilesError reports compose or env files listed by a stack that cannot
+// be loaded. Discovery skips such stacks.
+type stackFilesError struct {
+	err error
+}
+
+func (e *stackFilesError) Error() string { return e.err.Error() }
+
+// readStack reads the stack in tree, if tree contains one of names. found is
+// false for directories that are not stacks.
+func readStack(root, tree *object.Tree, deployDir, rel string, names []string) (stack ComposeEntry, found bool, err error) {
+	composeFile, content, err := findComposeFile(tree, names)
+	if err != nil || composeFile == "" {
+		return ComposeEntry{}, false, nil
 	}
 
-	return entries, commitHash, commitMessage, nil
+	stack = ComposeEntry{
+		StackPath:   rel,
+		ComposeFile: composeFile,
+		Content:     content,
+	}
+	if err := loadStackFiles(root, path.Join(deployDir, rel), tree, &stack); err != nil {
+		return ComposeEntry{}, true, &stackFilesError{err: err}
+	}
+	if content, err := readTreeFile(tree, desiredstate.SettingsFile); err == nil {
+		settings, err := desiredstate.ParseStackSettings(content)
+		if err != nil {
+			return ComposeEntry{}, true, fmt.Errorf("stack %s: %w", rel, err)
+		}
+		stack.Settings = settings
+		stack.SettingsContent = content
+	}
+	return stack, true, nil
 }
 
-// findComposeFile looks for docker-compose.yml or docker-compose.yaml in a tree.
-// Prefers docker-compose.yml when both exist.
-func findComposeFile(tree *object.Tree) (string, []byte, error) {
-	candidates := []string{"docker-compose.yml", "docker-compose.yaml"}
+// isIgnored reports whether a directory matches an ignore glob, either by its
+// own name or by its path relative to the deploy directory.
+func isIgnored(rel string, ignore []string) bool {
+	name := path.Base(rel)
+	for _, pattern := range ignore {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
 
-	for _, name := range candidates {
+// findComposeFile returns the first of names present in tree.
+func findComposeFile(tree *object.Tree, names []string) (string, []byte, error) {
+	for _, name := range names {
 		file, err := tree.File(name)
 		if err != nil {
 			continue
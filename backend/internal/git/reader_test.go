@@ -2,7 +2,9 @@ package git_test
 
 import (
 	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/lucasreiners/docker-cd/internal/git"
 )
@@ -14,8 +16,8 @@ type stubComposeReader struct {
 	err           error
 }
 
-func (s *stubComposeReader) ReadComposeFiles(_ context.Context, _, _, _, _ string) ([]git.ComposeEntry, string, string, error) {
-	return s.entries, s.commit, s.commitMessage, s.err
+func (s *stubComposeReader) ReadComposeFiles(_ context.Context, _ string, _ git.AuthProvider, _, _, _ string) (git.ReadResult, error) {
+	return git.ReadResult{Entries: s.entries, Commit: s.commit, CommitMessage: s.commitMessage}, s.err
 }
 
 func TestStubComposeReader_ReturnsEntries(t *testing.T) {
@@ -26,7 +28,8 @@ func TestStubComposeReader_ReturnsEntries(t *testing.T) {
 		},
 		commit: "abc123def456",
 	}
-	entries, commit, _, err := reader.ReadComposeFiles(context.Background(), "", "", "", "")
+	result, err := reader.ReadComposeFiles(context.Background(), "", nil, "", "", "")
+	entries, commit := result.Entries, result.Commit
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -43,7 +46,7 @@ func TestStubComposeReader_ReturnsEntries(t *testing.T) {
 
 func TestStubComposeReader_ReturnsError(t *testing.T) {
 	reader := &stubComposeReader{err: context.DeadlineExceeded}
-	_, _, _, err := reader.ReadComposeFiles(context.Background(), "", "", "", "")
+	_, err := reader.ReadComposeFiles(context.Background(), "", nil, "", "", "")
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -51,7 +54,8 @@ func TestStubComposeReader_ReturnsError(t *testing.T) {
 
 func TestStubComposeReader_EmptyRepo(t *testing.T) {
 	reader := &stubComposeReader{entries: nil, commit: "abc123"}
-	entries, commit, _, err := reader.ReadComposeFiles(context.Background(), "", "", "", "")
+	result, err := reader.ReadComposeFiles(context.Background(), "", nil, "", "", "")
+	entries, commit := result.Entries, result.Commit
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -62,3 +66,165 @@ func TestStubComposeReader_EmptyRepo(t *testing.T) {
 		t.Errorf("expected nil entries for empty repo, got %v", entries)
 	}
 }
+
+func TestGoGitComposeReader_RecursiveDiscovery(t *testing.T) {
+	src := newSourceRepo(t)
+	src.commit("layout", map[string]string{
+		"stacks/api/docker-compose.yml":                "services: {}\n",
+		"stacks/api/nested/docker-compose.yml":         "services: {}\n",
+		"stacks/infra/monitoring/grafana/compose.yaml": "services: {}\n",
+		"stacks/infra/monitoring/README.md":            "docs\n",
+		"stacks/infra/proxy/compose.yml":               "services: {}\n",
+		"stacks/.github/workflows/docker-compose.yml":  "services: {}\n",
+		"stacks/docs/example/docker-compose.yml":       "services: {}\n",
+		"stacks/web/compose.yaml":                      "services: {}\n",
+		"stacks/web/docker-compose.yaml":               "services: {}\n",
+		"stacks/empty/README.md":                       "nothing here\n",
+	})
+
+	reader := &git.GoGitComposeReader{Ignore: []string{".*", "docs"}}
+	result, err := reader.ReadComposeFiles(context.Background(), src.dir, nil, "master", "stacks", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, e := range result.Entries {
+		got[e.StackPath] = e.ComposeFile
+	}
+	want := map[string]string{
+		"api":                      "docker-compose.yml",
+		"infra/monitoring/grafana": "compose.yaml",
+		"infra/proxy":              "compose.yml",
+		"web":                      "docker-compose.yaml",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected stacks %v, got %v", want, got)
+	}
+	for stackPath, file := range want {
+		if got[stackPath] != file {
+			t.Errorf("stack %s: expected %s, got %q", stackPath, file, got[stackPath])
+		}
+	}
+}
+
+func TestGoGitComposeReader_CustomComposeFileNames(t *testing.T) {
+	src := newSourceRepo(t)
+	src.commit("layout", map[string]string{
+		"api/stack.yml":          "services: {}\n",
+		"web/docker-compose.yml": "services: {}\n",
+		"infra/path/stack.yml":   "services: {}\n",
+	})
+
+	reader := &git.GoGitComposeReader{ComposeFileNames: []string{"stack.yml"}, Ignore: []string{"infra/*"}}
+	result, err := reader.ReadComposeFiles(context.Background(), src.dir, nil, "master", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].StackPath != "api" {
+		t.Errorf("expected only api stack, got %+v", result.Entries)
+	}
+}
+
+func TestGoGitComposeReader_MultiFileStack(t *testing.T) {
+	src := newSourceRepo(t)
+	src.commit("layout", map[string]string{
+		"stacks/base.yml":                    "services:\n  db:\n    image: postgres\n",
+		"stacks/api/docker-compose.yml":      "services:\n  api:\n    image: api\n",
+		"stacks/api/docker-compose.prod.yml": "services:\n  api:\n    restart: always\n",
+		"stacks/api/.env":                    "# layering\nCOMPOSE_FILE=docker-compose.yml:docker-compose.prod.yml:../base.yml\nCOMPOSE_ENV_FILES=.env,prod.env\n",
+		"stacks/api/prod.env":                "TAG=1\n",
+		"stacks/web/compose.yaml":            "services: {}\n",
+		"stacks/web/.env":                    "TAG=2\n",
+		"stacks/broken/docker-compose.yml":   "services: {}\n",
+		"stacks/broken/.env":                 "COMPOSE_FILE=docker-compose.yml;missing.yml\nCOMPOSE_PATH_SEPARATOR=;\n",
+	})
+
+	reader := &git.GoGitComposeReader{}
+	result, err := reader.ReadComposeFiles(context.Background(), src.dir, nil, "master", "stacks", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stacks := make(map[string]git.ComposeEntry)
+	for _, e := range result.Entries {
+		stacks[e.StackPath] = e
+	}
+	if _, ok := stacks["broken"]; ok {
+		t.Error("expected stack with a missing compose file to be skipped")
+	}
+
+	api, ok := stacks["api"]
+	if !ok {
+		t.Fatal("expected api stack")
+	}
+	if got := strings.Join(api.ComposeFiles, ","); got != "docker-compose.yml,docker-compose.prod.yml,../base.yml" {
+		t.Errorf("unexpected compose files %s", got)
+	}
+	if got := strings.Join(api.EnvFiles, ","); got != ".env,prod.env" {
+		t.Errorf("unexpected env files %s", got)
+	}
+	if string(api.Files["../base.yml"]) != "services:\n  db:\n    image: postgres\n" {
+		t.Errorf("expected base.yml content, got %q", api.Files["../base.yml"])
+	}
+	if len(api.HashContents()) != 5 {
+		t.Errorf("expected 5 hash inputs, got %d", len(api.HashContents()))
+	}
+
+	web := stacks["web"]
+	if got := strings.Join(web.ComposeFiles, ","); got != "compose.yaml" {
+		t.Errorf("unexpected web compose files %s", got)
+	}
+	if got := strings.Join(web.EnvFiles, ","); got != ".env" {
+		t.Errorf("expected .env to be used for web, got %s", got)
+	}
+}
+
+func TestGoGitComposeReader_StackSettings(t *testing.T) {
+	src := newSourceRepo(t)
+	src.commit("init", map[string]string{
+		"api/docker-compose.yml": "services: {}\n",
+		"api/.docker-cd.yaml":    "drift_policy: flag\nprofiles: [web, worker]\nsync_timeout: 90s\n",
+		"web/docker-compose.yml": "services: {}\n",
+	})
+
+	reader := &git.GoGitComposeReader{}
+	result, err := reader.ReadComposeFiles(context.Background(), src.dir, nil, "master", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stacks := make(map[string]git.ComposeEntry)
+	for _, e := range result.Entries {
+		stacks[e.StackPath] = e
+	}
+	api := stacks["api"]
+	if api.Settings == nil {
+		t.Fatal("expected api settings")
+	}
+	if api.Settings.DriftPolicy != "flag" || strings.Join(api.Settings.Profiles, ",") != "web,worker" {
+		t.Errorf("unexpected settings %+v", api.Settings)
+	}
+	if time.Duration(api.Settings.SyncTimeout) != 90*time.Second {
+		t.Errorf("expected 90s sync timeout, got %s", time.Duration(api.Settings.SyncTimeout))
+	}
+	if len(api.HashContents()) != 2 {
+		t.Errorf("expected settings file to be hashed, got %d inputs", len(api.HashContents()))
+	}
+	if stacks["web"].Settings != nil {
+		t.Error("expected no settings for web")
+	}
+}
+
+func TestGoGitComposeReader_InvalidStackSettingsFails(t *testing.T) {
+	src := newSourceRepo(t)
+	src.commit("init", map[string]string{
+		"api/docker-compose.yml": "services: {}\n",
+		"api/.docker-cd.yaml":    "drift_polcy: flag\n",
+	})
+
+	reader := &git.GoGitComposeReader{}
+	if _, err := reader.ReadComposeFiles(context.Background(), src.dir, nil, "master", "", ""); err == nil {
+		t.Fatal("expected an invalid settings file to fail the read")
+	}
+}
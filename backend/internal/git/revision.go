@@ -0,0 +1,278 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"golang.org/x/mod/semver"
+)
+
+// Ref types reported in Revision.Type and Snapshot.RefType.
+const (
+	RefTypeBranch = "branch"
+	RefTypeTag    = "tag"
+	RefTypeCommit = "commit"
+)
+
+// Revision is a GIT_REVISION resolved against the remote refs.
+type Revision struct {
+	// Name is the full reference name (refs/heads/... or refs/tags/...).
+	// It is empty for commit SHAs.
+	Name plumbing.ReferenceName
+	// Hash is the commit the revision points to. For annotated tags it is the
+	// peeled commit hash when the remote advertises one.
+	Hash plumbing.Hash
+	// Type is one of RefTypeBranch, RefTypeTag or RefTypeCommit.
+	Type string
+	// Constraint is the semver constraint that selected the tag, if any.
+	Constraint string
+}
+
+// Short returns the human-readable ref: branch or tag name, or the commit SHA.
+func (r Revision) Short() string {
+	if r.Type == RefTypeCommit {
+		return r.Hash.String()
+	}
+	return r.Name.Short()
+}
+
+var shaPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// ResolveRevision matches revision against the advertised remote refs.
+// revision may be a branch, a tag, a full reference name, a full 40-character
+// commit SHA, or a semver constraint (e.g. "v2.*", "^1.4.0", ">=1.2.0 <2.0.0")
+// that selects the highest matching release tag.
+func ResolveRevision(refs []*plumbing.Reference, revision string) (Revision, error) {
+	if revision == "" {
+		return Revision{}, fmt.Errorf("revision is empty")
+	}
+
+	// Remotes advertise peeled annotated tags as "refs/tags/<name>^{}".
+	peeled := make(map[plumbing.ReferenceName]plumbing.Hash)
+	for _, ref := range refs {
+		if name := string(ref.Name()); strings.HasSuffix(name, "^{}") {
+			peeled[plumbing.ReferenceName(strings.TrimSuffix(name, "^{}"))] = ref.Hash()
+		}
+	}
+	resolved := func(ref *plumbing.Reference, refType string) Revision {
+		hash := ref.Hash()
+		if h, ok := peeled[ref.Name()]; ok {
+			hash = h
+		}
+		return Revision{Name: ref.Name(), Hash: hash, Type: refType}
+	}
+
+	// Branches take precedence over tags of the same name, as in the original lookup.
+	for _, want := range []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(revision),
+		plumbing.NewTagReferenceName(revision),
+		plumbing.ReferenceName(revision),
+	} {
+		for _, ref := range refs {
+			if ref.Name() != want {
+				continue
+			}
+			switch {
+			case ref.Name().IsBranch():
+				return resolved(ref, RefTypeBranch), nil
+			case ref.Name().IsTag():
+				return resolved(ref, RefTypeTag), nil
+			}
+		}
+	}
+
+	if shaPattern.MatchString(revision) {
+		return Revision{Hash: plumbing.NewHash(revision), Type: RefTypeCommit}, nil
+	}
+
+	constraint, err := parseConstraint(revision)
+	if err != nil {
+		return Revision{}, fmt.Errorf("revision %q not found in remote refs", revision)
+	}
+
+	var best *plumbing.Reference
+	bestVersion := ""
+	for _, ref := range refs {
+		if !ref.Name().IsTag() || strings.HasSuffix(string(ref.Name()), "^{}") {
+			continue
+		}
+		version, ok := canonicalVersion(ref.Name().Short())
+		if !ok || !constraint.matches(version) {
+			continue
+		}
+		if best == nil || semver.Compare(version, bestVersion) > 0 {
+			best, bestVersion = ref, version
+		}
+	}
+	if best == nil {
+		return Revision{}, fmt.Errorf("no tag matches semver constraint %q", revision)
+	}
+
+	rev := resolved(best, RefTypeTag)
+	rev.Constraint = revision
+	return rev, nil
+}
+
+// canonicalVersion returns the canonical semver form of a tag name, accepting
+// tags with or without the leading "v".
+func canonicalVersion(tag string) (string, bool) {
+	if !strings.HasPrefix(tag, "v") {
+		tag = "v" + tag
+	}
+	if !semver.IsValid(tag) {
+		return "", false
+	}
+	return semver.Canonical(tag), true
+}
+
+// constraint is a conjunction of version comparisons. Prerelease versions
+// only match when a comparison names a prerelease explicitly.
+type constraint struct {
+	terms      []term
+	prerelease bool
+}
+
+type term struct {
+	op      string
+	version string
+}
+
+func (c constraint) matches(version string) bool {
+	if semver.Prerelease(version) != "" && !c.prerelease {
+		return false
+	}
+	for _, t := range c.terms {
+		cmp := semver.Compare(version, t.version)
+		var ok bool
+		switch t.op {
+		case "=":
+			ok = cmp == 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parseConstraint parses a space- or comma-separated list of terms. Each term
+// is a wildcard version ("v2.*", "1.4.x", "*"), a caret or tilde range
+// ("^1.4.0", "~1.4.0") or a comparison ("=", ">", ">=", "<", "<=").
+// A plain version without an operator is not a constraint.
+func parseConstraint(s string) (constraint, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(fields) == 0 {
+		return constraint{}, fmt.Errorf("empty constraint")
+	}
+
+	var c constraint
+	for _, f := range fields {
+		terms, err := parseTerm(f)
+		if err != nil {
+			return constraint{}, err
+		}
+		for _, t := range terms {
+			if semver.Prerelease(t.version) != "" {
+				c.prerelease = true
+			}
+		}
+		c.terms = append(c.terms, terms...)
+	}
+	return c, nil
+}
+
+func parseTerm(f string) ([]term, error) {
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if rest, ok := strings.CutPrefix(f, op); ok {
+			v, ok := canonicalVersion(rest)
+			if !ok {
+				return nil, fmt.Errorf("invalid version %q", rest)
+			}
+			return []term{{op: op, version: v}}, nil
+		}
+	}
+
+	if rest, ok := strings.CutPrefix(f, "^"); ok {
+		v, ok := canonicalVersion(rest)
+		if !ok {
+			return nil, fmt.Errorf("invalid version %q", rest)
+		}
+		major, minor, patch := versionParts(v)
+		var upper string
+		switch {
+		case major > 0:
+			upper = fmt.Sprintf("v%d.0.0", major+1)
+		case minor > 0:
+			upper = fmt.Sprintf("v0.%d.0", minor+1)
+		default:
+			upper = fmt.Sprintf("v0.0.%d", patch+1)
+		}
+		return []term{{op: ">=", version: v}, {op: "<", version: upper}}, nil
+	}
+
+	if rest, ok := strings.CutPrefix(f, "~"); ok {
+		v, ok := canonicalVersion(rest)
+		if !ok {
+			return nil, fmt.Errorf("invalid version %q", rest)
+		}
+		major, minor, _ := versionParts(v)
+		return []term{{op: ">=", version: v}, {op: "<", version: fmt.Sprintf("v%d.%d.0", major, minor+1)}}, nil
+	}
+
+	return parseWildcard(f)
+}
+
+// parseWildcard turns "v2.*", "2.1.x" or "*" into a half-open range.
+func parseWildcard(f string) ([]term, error) {
+	parts := strings.Split(strings.TrimPrefix(f, "v"), ".")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid wildcard %q", f)
+	}
+
+	var fixed []int
+	wildcard := false
+	for _, p := range parts {
+		if p == "*" || p == "x" || p == "X" {
+			wildcard = true
+			break
+		}
+		var n int
+		if _, err := fmt.Sscanf(p, "%d", &n); err != nil || fmt.Sprint(n) != p {
+			return nil, fmt.Errorf("invalid wildcard %q", f)
+		}
+		fixed = append(fixed, n)
+	}
+	if !wildcard {
+		return nil, fmt.Errorf("%q is not a constraint", f)
+	}
+
+	switch len(fixed) {
+	case 0:
+		return []term{{op: ">=", version: "v0.0.0"}}, nil
+	case 1:
+		return []term{
+			{op: ">=", version: fmt.Sprintf("v%d.0.0", fixed[0])},
+			{op: "<", version: fmt.Sprintf("v%d.0.0", fixed[0]+1)},
+		}, nil
+	default:
+		return []term{
+			{op: ">=", version: fmt.Sprintf("v%d.%d.0", fixed[0], fixed[1])},
+			{op: "<", version: fmt.Sprintf("v%d.%d.0", fixed[0], fixed[1]+1)},
+		}, nil
+	}
+}
+
+func versionParts(v string) (major, minor, patch int) {
+	_, _ = fmt.Sscanf(strings.TrimPrefix(semver.Canonical(v), "v"), "%d.%d.%d", &major, &minor, &patch)
+	return major, minor, patch
+}
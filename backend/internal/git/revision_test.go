@@ -0,0 +1,121 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/lucasreiners/docker-cd/internal/git"
+)
+
+func refWithHash(name, hash string) *plumbing.Reference {
+	return plumbing.NewReferenceFromStrings(name, hash)
+}
+
+func releaseRefs() []*plumbing.Reference {
+	return []*plumbing.Reference{
+		refWithHash("refs/heads/main", "1111111111111111111111111111111111111111"),
+		refWithHash("refs/tags/v1.9.0", "2222222222222222222222222222222222222222"),
+		refWithHash("refs/tags/v2.0.0", "3333333333333333333333333333333333333333"),
+		refWithHash("refs/tags/v2.1.0", "4444444444444444444444444444444444444444"),
+		refWithHash("refs/tags/v2.1.0^{}", "5555555555555555555555555555555555555555"),
+		refWithHash("refs/tags/v2.2.0-rc.1", "6666666666666666666666666666666666666666"),
+		refWithHash("refs/tags/3.0.0", "7777777777777777777777777777777777777777"),
+		refWithHash("refs/tags/latest", "8888888888888888888888888888888888888888"),
+	}
+}
+
+func TestResolveRevision_Branch(t *testing.T) {
+	rev, err := git.ResolveRevision(releaseRefs(), "main")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rev.Type != git.RefTypeBranch || rev.Short() != "main" {
+		t.Errorf("expected branch main, got %s %s", rev.Type, rev.Short())
+	}
+	if rev.Hash.String() != "1111111111111111111111111111111111111111" {
+		t.Errorf("unexpected hash %s", rev.Hash)
+	}
+}
+
+func TestResolveRevision_AnnotatedTagIsPeeled(t *testing.T) {
+	rev, err := git.ResolveRevision(releaseRefs(), "v2.1.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rev.Type != git.RefTypeTag {
+		t.Errorf("expected tag, got %s", rev.Type)
+	}
+	if rev.Hash.String() != "5555555555555555555555555555555555555555" {
+		t.Errorf("expected peeled commit hash, got %s", rev.Hash)
+	}
+}
+
+func TestResolveRevision_FullRefName(t *testing.T) {
+	rev, err := git.ResolveRevision(releaseRefs(), "refs/tags/latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rev.Type != git.RefTypeTag || rev.Short() != "latest" {
+		t.Errorf("expected tag latest, got %s %s", rev.Type, rev.Short())
+	}
+}
+
+func TestResolveRevision_CommitSHA(t *testing.T) {
+	sha := "abcdefabcdefabcdefabcdefabcdefabcdefabcd"
+	rev, err := git.ResolveRevision(releaseRefs(), sha)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rev.Type != git.RefTypeCommit || rev.Short() != sha {
+		t.Errorf("expected commit %s, got %s %s", sha, rev.Type, rev.Short())
+	}
+}
+
+func TestResolveRevision_SemverConstraints(t *testing.T) {
+	tests := []struct {
+		constraint string
+		want       string
+	}{
+		{"v2.*", "v2.1.0"},
+		{"2.x", "v2.1.0"},
+		{"v2.0.*", "v2.0.0"},
+		{"^2.0.0", "v2.1.0"},
+		{"~2.0.0", "v2.0.0"},
+		{">=1.0.0 <2.0.0", "v1.9.0"},
+		{">=2.2.0-rc.0", "3.0.0"},
+		{"<3.0.0, >=2.2.0-rc.0", "v2.2.0-rc.1"},
+		{"*", "3.0.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			rev, err := git.ResolveRevision(releaseRefs(), tt.constraint)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rev.Type != git.RefTypeTag || rev.Short() != tt.want {
+				t.Errorf("expected tag %s, got %s %s", tt.want, rev.Type, rev.Short())
+			}
+			if rev.Constraint != tt.constraint {
+				t.Errorf("expected constraint %q, got %q", tt.constraint, rev.Constraint)
+			}
+		})
+	}
+}
+
+func TestResolveRevision_ExcludesPrereleaseByDefault(t *testing.T) {
+	rev, err := git.ResolveRevision(releaseRefs(), ">=2.1.0 <3.0.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rev.Short() != "v2.1.0" {
+		t.Errorf("expected v2.1.0, got %s", rev.Short())
+	}
+}
+
+func TestResolveRevision_NotFound(t *testing.T) {
+	for _, revision := range []string{"develop", "v4.*", "^4.0.0", "abc123"} {
+		if _, err := git.ResolveRevision(releaseRefs(), revision); err == nil {
+			t.Errorf("expected error for %q", revision)
+		}
+	}
+}
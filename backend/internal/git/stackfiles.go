@@ -0,0 +1,123 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// envFileName is the env file compose reads from the project directory.
+const envFileName = ".env"
+
+// loadStackFiles fills in the compose and env files of a stack. Like docker
+// compose itself, it honours COMPOSE_FILE (with COMPOSE_PATH_SEPARATOR) and
+// COMPOSE_ENV_FILES from the stack's .env file, so a stack can layer
+// docker-compose.yml with e.g. docker-compose.prod.yml and extra env files.
+// Paths may point outside the stack directory (e.g. "../base.yml").
+func loadStackFiles(root *object.Tree, stackRepoPath string, stackTree *object.Tree, stack *ComposeEntry) error {
+	stack.ComposeFiles = []string{stack.ComposeFile}
+	stack.Files = map[string][]byte{stack.ComposeFile: stack.Content}
+
+	env, err := readTreeFile(stackTree, envFileName)
+	if err != nil {
+		// No .env: a plain single-file stack.
+		return nil
+	}
+	stack.Files[envFileName] = env
+	vars := parseEnv(env)
+
+	if v := vars["COMPOSE_FILE"]; v != "" {
+		sep := vars["COMPOSE_PATH_SEPARATOR"]
+		if sep == "" {
+			sep = ":"
+		}
+		files, err := splitPaths(v, sep)
+		if err != nil {
+			return fmt.Errorf("COMPOSE_FILE: %w", err)
+		}
+		stack.ComposeFiles = files
+	}
+
+	stack.EnvFiles = []string{envFileName}
+	if v := vars["COMPOSE_ENV_FILES"]; v != "" {
+		files, err := splitPaths(v, ",")
+		if err != nil {
+			return fmt.Errorf("COMPOSE_ENV_FILES: %w", err)
+		}
+		stack.EnvFiles = files
+	}
+
+	for _, name := range append(append([]string{}, stack.ComposeFiles...), stack.EnvFiles...) {
+		if _, ok := stack.Files[name]; ok {
+			continue
+		}
+		content, err := readTreeFile(root, path.Join(stackRepoPath, name))
+		if err != nil {
+			return fmt.Errorf("file %q not found: %w", name, err)
+		}
+		stack.Files[name] = content
+	}
+
+	stack.ComposeFile = stack.ComposeFiles[0]
+	stack.Content = stack.Files[stack.ComposeFile]
+	return nil
+}
+
+// splitPaths splits a list of relative paths, rejecting absolute ones.
+func splitPaths(v, sep string) ([]string, error) {
+	var paths []string
+	for _, p := range strings.Split(v, sep) {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if path.IsAbs(p) {
+			return nil, fmt.Errorf("path %q must be relative to the stack directory", p)
+		}
+		paths = append(paths, path.Clean(p))
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no paths in %q", v)
+	}
+	return paths, nil
+}
+
+// parseEnv reads KEY=VALUE lines from an env file, ignoring comments and
+// blank lines, an optional "export " prefix and surrounding quotes.
+func parseEnv(content []byte) map[string]string {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[strings.TrimSpace(key)] = value
+	}
+	return vars
+}
+
+func readTreeFile(tree *object.Tree, name string) ([]byte, error) {
+	file, err := tree.File(name)
+	if err != nil {
+		return nil, err
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
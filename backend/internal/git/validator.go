@@ -2,15 +2,16 @@ package git
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/url"
 	"strings"
 	"time"
 
 	gogit "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/storage/memory"
 )
 
@@ -24,113 +25,140 @@ type ValidationResult struct {
 // RemoteLister abstracts a read-only git remote listing call for testability.
 // Implementations only need read access to the repository (git ls-remote).
 type RemoteLister interface {
-	ListRefs(ctx context.Context, repoURL, token string) ([]*plumbing.Reference, error)
+	ListRefs(ctx context.Context, repoURL string, auth AuthProvider) ([]*plumbing.Reference, error)
 }
 
 // PathChecker verifies that a path exists at a given revision (read-only).
 type PathChecker interface {
-	PathExists(ctx context.Context, repoURL, token, revision, path string) (bool, error)
+	PathExists(ctx context.Context, repoURL string, auth AuthProvider, revision, path string) (bool, error)
 }
 
 // TreeLister counts directories at a given path in the repository tree (read-only).
 type TreeLister interface {
-	CountDirs(ctx context.Context, repoURL, token, revision, path string) (int, error)
+	CountDirs(ctx context.Context, repoURL string, auth AuthProvider, revision, path string) (int, error)
 }
 
 // GoGitRemoteLister implements RemoteLister using go-git.
 // It only requires read access — it calls git ls-remote under the hood.
 type GoGitRemoteLister struct{}
 
-func (g *GoGitRemoteLister) ListRefs(ctx context.Context, repoURL, token string) ([]*plumbing.Reference, error) {
+func (g *GoGitRemoteLister) ListRefs(ctx context.Context, repoURL string, auth AuthProvider) ([]*plumbing.Reference, error) {
+	method, err := authMethod(auth, repoURL)
+	if err != nil {
+		return nil, err
+	}
 	remote := gogit.NewRemote(memory.NewStorage(), &config.RemoteConfig{
 		Name: "origin",
 		URLs: []string{repoURL},
 	})
 	refs, err := remote.ListContext(ctx, &gogit.ListOptions{
-		Auth: &http.BasicAuth{
-			Username: "x-access-token",
-			Password: token,
-		},
+		Auth: method,
 	})
 	return refs, err
 }
 
 // GoGitTreeLister implements TreeLister using go-git.
-// It performs a shallow clone (depth 1, single branch) to memory and inspects
-// the tree to count immediate subdirectories at the given path.
-type GoGitTreeLister struct{}
-
-func (g *GoGitTreeLister) CountDirs(ctx context.Context, repoURL, token, revision, path string) (int, error) {
-	repo, err := gogit.CloneContext(ctx, memory.NewStorage(), nil, &gogit.CloneOptions{
-		URL: repoURL,
-		Auth: &http.BasicAuth{
-			Username: "x-access-token",
-			Password: token,
-		},
-		ReferenceName: plumbing.NewBranchReferenceName(revision),
-		SingleBranch:  true,
-		Depth:         1,
-	})
+// It inspects the tree at the given revision to count immediate subdirectories
+// at the given path, reusing Cache when set and otherwise performing a shallow
+// in-memory clone.
+type GoGitTreeLister struct {
+	Cache *RepoCache
+}
+
+func (g *GoGitTreeLister) CountDirs(ctx context.Context, repoURL string, auth AuthProvider, revision, path string) (int, error) {
+	tree, err := treeAt(ctx, g.Cache, repoURL, auth, revision, path)
 	if err != nil {
-		return 0, fmt.Errorf("shallow clone failed: %w", err)
+		return 0, err
 	}
 
-	ref, err := repo.Head()
+	count := 0
+	for _, entry := range tree.Entries {
+		if entry.Mode.IsFile() {
+			continue
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// GoGitPathChecker implements PathChecker using go-git, reusing Cache when set.
+type GoGitPathChecker struct {
+	Cache *RepoCache
+}
+
+func (g *GoGitPathChecker) PathExists(ctx context.Context, repoURL string, auth AuthProvider, revision, path string) (bool, error) {
+	_, err := treeAt(ctx, g.Cache, repoURL, auth, revision, path)
+	if errors.Is(err, object.ErrDirectoryNotFound) {
+		return false, nil
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to get HEAD: %w", err)
+		return false, err
 	}
+	return true, nil
+}
 
-	commit, err := repo.CommitObject(ref.Hash())
+// treeAt returns the tree at path (relative to the repository root) for revision.
+func treeAt(ctx context.Context, cache *RepoCache, repoURL string, auth AuthProvider, revision, path string) (*object.Tree, error) {
+	commit, _, err := resolveCommit(ctx, cache, repoURL, auth, revision)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get commit: %w", err)
+		return nil, err
 	}
 
 	tree, err := commit.Tree()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get tree: %w", err)
+		return nil, fmt.Errorf("failed to get tree: %w", err)
 	}
 
 	// Navigate to subdirectory if path is set
-	if path != "" {
-		path = strings.Trim(path, "/")
-	}
+	path = strings.Trim(path, "/")
 	if path != "" {
 		tree, err = tree.Tree(path)
 		if err != nil {
-			return 0, fmt.Errorf("path %q not found in tree: %w", path, err)
+			return nil, fmt.Errorf("path %q not found in tree: %w", path, err)
 		}
 	}
-
-	count := 0
-	for _, entry := range tree.Entries {
-		if entry.Mode.IsFile() {
-			continue
-		}
-		count++
-	}
-
-	return count, nil
+	return tree, nil
 }
 
 // Validate performs a read-only check that the repository is reachable with the
-// given token, the revision exists, and the optional deploy directory is present.
-// Only read access is required; no write/push permissions are needed.
+// given credentials, the revision resolves (see ResolveRevision), and the optional
+// deploy directory is present.
+// Both HTTPS and SSH remotes are supported. Only read access is required;
+// no write/push permissions are needed.
 // pathChecker may be nil if deployDir is empty.
-func Validate(ctx context.Context, lister RemoteLister, repoURL, token, revision, deployDir string, pathChecker ...PathChecker) ValidationResult {
+func Validate(ctx context.Context, lister RemoteLister, repoURL string, auth AuthProvider, revision, deployDir string, pathChecker ...PathChecker) ValidationResult {
 	now := time.Now()
 
-	// Validate HTTPS URL
-	u, err := url.Parse(repoURL)
-	if err != nil || !strings.EqualFold(u.Scheme, "https") {
+	// Validate HTTPS or SSH URL
+	ep, err := transport.NewEndpoint(repoURL)
+	if err != nil || (!strings.EqualFold(ep.Protocol, "https") && !strings.EqualFold(ep.Protocol, "ssh")) {
+		return ValidationResult{
+			Success:   false,
+			Error:     &ValidationError{Type: ErrInvalidURL, Message: fmt.Sprintf("repository URL must be HTTPS or SSH, got %q", repoURL)},
+			CheckedAt: now,
+		}
+	}
+
+	// Resolve credentials up front so a missing or unreadable SSH key is
+	// reported as a configuration problem rather than an access failure.
+	if auth == nil {
 		return ValidationResult{
 			Success:   false,
-			Error:     &ValidationError{Type: ErrInvalidURL, Message: fmt.Sprintf("repository URL must be HTTPS, got %q", repoURL)},
+			Error:     &ValidationError{Type: ErrMissingConfig, Message: "no repository credentials configured"},
+			CheckedAt: now,
+		}
+	}
+	if _, err := auth.AuthMethod(repoURL); err != nil {
+		return ValidationResult{
+			Success:   false,
+			Error:     &ValidationError{Type: ErrMissingConfig, Message: "invalid repository credentials", Cause: err},
 			CheckedAt: now,
 		}
 	}
 
 	// List remote refs to verify read access + connectivity (git ls-remote)
-	refs, err := lister.ListRefs(ctx, repoURL, token)
+	refs, err := lister.ListRefs(ctx, repoURL, auth)
 	if err != nil {
 		return ValidationResult{
 			Success:   false,
@@ -139,27 +167,19 @@ func Validate(ctx context.Context, lister RemoteLister, repoURL, token, revision
 		}
 	}
 
-	// Check that the requested revision exists as a branch or tag
-	found := false
-	for _, ref := range refs {
-		name := ref.Name()
-		short := name.Short()
-		if short == revision || string(name) == revision {
-			found = true
-			break
-		}
-	}
-	if !found {
+	// Check that the requested revision exists as a branch, tag, commit SHA
+	// or a semver constraint matching at least one tag
+	if _, err := ResolveRevision(refs, revision); err != nil {
 		return ValidationResult{
 			Success:   false,
-			Error:     &ValidationError{Type: ErrRefNotFound, Message: fmt.Sprintf("revision %q not found in remote refs", revision)},
+			Error:     &ValidationError{Type: ErrRefNotFound, Message: fmt.Sprintf("revision %q not found in remote refs", revision), Cause: err},
 			CheckedAt: now,
 		}
 	}
 
 	// Validate deploy directory if specified
 	if deployDir != "" && len(pathChecker) > 0 && pathChecker[0] != nil {
-		exists, err := pathChecker[0].PathExists(ctx, repoURL, token, revision, deployDir)
+		exists, err := pathChecker[0].PathExists(ctx, repoURL, auth, revision, deployDir)
 		if err != nil {
 			return ValidationResult{
 				Success:   false,
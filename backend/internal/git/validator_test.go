@@ -14,20 +14,22 @@ type stubLister struct {
 	err  error
 }
 
-func (s *stubLister) ListRefs(_ context.Context, _, _ string) ([]*plumbing.Reference, error) {
+func (s *stubLister) ListRefs(_ context.Context, _ string, _ git.AuthProvider) ([]*plumbing.Reference, error) {
 	return s.refs, s.err
 }
 
+var tok = git.Credentials{Token: "tok"}
+
 func makeRef(name string) *plumbing.Reference {
 	return plumbing.NewReferenceFromStrings(name, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
 }
 
 func TestValidate_InvalidURL(t *testing.T) {
 	lister := &stubLister{}
-	result := git.Validate(context.Background(), lister, "git@github.com:org/repo.git", "tok", "main", "")
+	result := git.Validate(context.Background(), lister, "ftp://github.com/org/repo.git", tok, "main", "")
 
 	if result.Success {
-		t.Fatal("expected failure for non-HTTPS URL")
+		t.Fatal("expected failure for non-HTTPS/SSH URL")
 	}
 	if result.Error.Type != git.ErrInvalidURL {
 		t.Errorf("expected ErrInvalidURL, got %d", result.Error.Type)
@@ -36,7 +38,7 @@ func TestValidate_InvalidURL(t *testing.T) {
 
 func TestValidate_AuthFailure(t *testing.T) {
 	lister := &stubLister{err: fmt.Errorf("authentication required")}
-	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", "bad-token", "main", "")
+	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", git.Credentials{Token: "bad-token"}, "main", "")
 
 	if result.Success {
 		t.Fatal("expected failure for auth error")
@@ -52,7 +54,7 @@ func TestValidate_RefNotFound(t *testing.T) {
 			makeRef("refs/heads/main"),
 		},
 	}
-	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", "tok", "develop", "")
+	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", tok, "develop", "")
 
 	if result.Success {
 		t.Fatal("expected failure for missing revision")
@@ -69,7 +71,7 @@ func TestValidate_Success(t *testing.T) {
 			makeRef("refs/heads/develop"),
 		},
 	}
-	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", "tok", "main", "")
+	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", tok, "main", "")
 
 	if !result.Success {
 		t.Fatalf("expected success, got error: %v", result.Error)
@@ -81,7 +83,7 @@ func TestValidate_Success(t *testing.T) {
 
 func TestValidate_HTTPURL(t *testing.T) {
 	lister := &stubLister{}
-	result := git.Validate(context.Background(), lister, "http://github.com/org/repo.git", "tok", "main", "")
+	result := git.Validate(context.Background(), lister, "http://github.com/org/repo.git", tok, "main", "")
 
 	if result.Success {
 		t.Fatal("expected failure for HTTP (non-HTTPS) URL")
@@ -96,7 +98,7 @@ type stubPathChecker struct {
 	err    error
 }
 
-func (s *stubPathChecker) PathExists(_ context.Context, _, _, _, _ string) (bool, error) {
+func (s *stubPathChecker) PathExists(_ context.Context, _ string, _ git.AuthProvider, _, _ string) (bool, error) {
 	return s.exists, s.err
 }
 
@@ -105,7 +107,7 @@ type stubTreeLister struct {
 	err   error
 }
 
-func (s *stubTreeLister) CountDirs(_ context.Context, _, _, _, _ string) (int, error) {
+func (s *stubTreeLister) CountDirs(_ context.Context, _ string, _ git.AuthProvider, _, _ string) (int, error) {
 	return s.count, s.err
 }
 
@@ -114,7 +116,7 @@ func TestValidate_DeployDirExists(t *testing.T) {
 		refs: []*plumbing.Reference{makeRef("refs/heads/main")},
 	}
 	checker := &stubPathChecker{exists: true}
-	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", "tok", "main", "deployments/host-a", checker)
+	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", tok, "main", "deployments/host-a", checker)
 
 	if !result.Success {
 		t.Fatalf("expected success, got error: %v", result.Error)
@@ -126,7 +128,7 @@ func TestValidate_DeployDirNotFound(t *testing.T) {
 		refs: []*plumbing.Reference{makeRef("refs/heads/main")},
 	}
 	checker := &stubPathChecker{exists: false}
-	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", "tok", "main", "nonexistent/dir", checker)
+	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", tok, "main", "nonexistent/dir", checker)
 
 	if result.Success {
 		t.Fatal("expected failure for missing deploy dir")
@@ -141,7 +143,7 @@ func TestValidate_DeployDirCheckError(t *testing.T) {
 		refs: []*plumbing.Reference{makeRef("refs/heads/main")},
 	}
 	checker := &stubPathChecker{err: fmt.Errorf("network error")}
-	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", "tok", "main", "deployments/host-a", checker)
+	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", tok, "main", "deployments/host-a", checker)
 
 	if result.Success {
 		t.Fatal("expected failure for path check error")
@@ -156,7 +158,7 @@ func TestValidate_EmptyDeployDirSkipsCheck(t *testing.T) {
 		refs: []*plumbing.Reference{makeRef("refs/heads/main")},
 	}
 	checker := &stubPathChecker{exists: false}
-	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", "tok", "main", "", checker)
+	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", tok, "main", "", checker)
 
 	if !result.Success {
 		t.Fatalf("expected success with empty deploy dir, got error: %v", result.Error)
@@ -165,7 +167,7 @@ func TestValidate_EmptyDeployDirSkipsCheck(t *testing.T) {
 
 func TestCountDirs_ReturnsCount(t *testing.T) {
 	tl := &stubTreeLister{count: 5}
-	count, err := tl.CountDirs(context.Background(), "https://github.com/org/repo.git", "tok", "main", "")
+	count, err := tl.CountDirs(context.Background(), "https://github.com/org/repo.git", tok, "main", "")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -176,7 +178,7 @@ func TestCountDirs_ReturnsCount(t *testing.T) {
 
 func TestCountDirs_WithSubdir(t *testing.T) {
 	tl := &stubTreeLister{count: 3}
-	count, err := tl.CountDirs(context.Background(), "https://github.com/org/repo.git", "tok", "main", "deploy")
+	count, err := tl.CountDirs(context.Background(), "https://github.com/org/repo.git", tok, "main", "deploy")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -187,8 +189,31 @@ func TestCountDirs_WithSubdir(t *testing.T) {
 
 func TestCountDirs_Error(t *testing.T) {
 	tl := &stubTreeLister{err: fmt.Errorf("clone failed")}
-	_, err := tl.CountDirs(context.Background(), "https://github.com/org/repo.git", "tok", "main", "")
+	_, err := tl.CountDirs(context.Background(), "https://github.com/org/repo.git", tok, "main", "")
 	if err == nil {
 		t.Fatal("expected error")
 	}
 }
+
+func TestValidate_TagCommitAndSemver(t *testing.T) {
+	lister := &stubLister{
+		refs: []*plumbing.Reference{
+			makeRef("refs/heads/main"),
+			makeRef("refs/tags/v1.2.0"),
+		},
+	}
+	for _, revision := range []string{"v1.2.0", "^1.0.0", "0123456789abcdef0123456789abcdef01234567"} {
+		result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", tok, revision, "")
+		if !result.Success {
+			t.Errorf("expected success for %q, got error: %v", revision, result.Error)
+		}
+	}
+
+	result := git.Validate(context.Background(), lister, "https://github.com/org/repo.git", tok, "v2.*", "")
+	if result.Success {
+		t.Fatal("expected failure for unmatched semver constraint")
+	}
+	if result.Error.Type != git.ErrRefNotFound {
+		t.Errorf("expected ErrRefNotFound, got %d", result.Error.Type)
+	}
+}
@@ -0,0 +1,285 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// manifestFile records the files written by the last checkout of a project
+// directory, so files that disappear from Git can be removed without touching
+// data created at runtime (e.g. bind-mounted volumes).
+const manifestFile = ".docker-cd-manifest.json"
+
+// Workspace materialises stack directories from the repository into stable
+// per-project directories below Root. The repository layout is mirrored, so
+// a stack at <deployDir>/apps/api is written to <Root>/<project>/<deployDir>/apps/api,
+// and "../" references from the compose file resolve to checked-out siblings.
+type Workspace struct {
+	Root      string
+	RepoURL   string
+	Auth      AuthProvider
+	Cache     *RepoCache
+	DeployDir string
+
+	mu sync.Mutex
+}
+
+// NewWorkspace creates a Workspace. cache must not be nil: checkouts are
+// always served from the on-disk clone.
+func NewWorkspace(root, repoURL string, auth AuthProvider, cache *RepoCache, deployDir string) *Workspace {
+	return &Workspace{
+		Root:      root,
+		RepoURL:   repoURL,
+		Auth:      auth,
+		Cache:     cache,
+		DeployDir: strings.Trim(deployDir, "/"),
+	}
+}
+
+// Checkout writes the stack directory at revision into the project directory
+// and returns the absolute path of the stack directory. stackFiles are the
+// stack's compose and env files relative to the stack directory; they are
+// checked out even when outside it, together with any "../" paths they reference.
+func (w *Workspace) Checkout(ctx context.Context, project, revision, stackPath string, stackFiles []string) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	rev, err := resolveRemote(ctx, w.RepoURL, w.Auth, revision)
+	if err != nil {
+		return "", err
+	}
+	commit, err := loadCommit(ctx, w.Cache, w.RepoURL, w.Auth, rev)
+	if err != nil {
+		return "", err
+	}
+	root, err := commit.Tree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get tree: %w", err)
+	}
+
+	stackRepoPath := path.Join(w.DeployDir, stackPath)
+	stackTree, err := root.Tree(stackRepoPath)
+	if err != nil {
+		return "", fmt.Errorf("stack %q not found at %s: %w", stackPath, rev.Short(), err)
+	}
+
+	files := make(map[string]*object.File)
+	if err := collectTree(stackTree, stackRepoPath, files); err != nil {
+		return "", err
+	}
+
+	// Pull in stack files and anything they reference outside the stack directory.
+	for _, name := range stackFiles {
+		target := path.Join(stackRepoPath, name)
+		if !inRepo(target) {
+			continue
+		}
+		if err := collectPath(root, target, files); err != nil {
+			return "", err
+		}
+		f, ok := files[target]
+		if !ok {
+			continue
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return "", fmt.Errorf("read %s: %w", name, err)
+		}
+		for _, ref := range parentReferences(content) {
+			if target := path.Join(path.Dir(target), ref); inRepo(target) {
+				if err := collectPath(root, target, files); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+
+	projectDir, err := filepath.Abs(filepath.Join(w.Root, project))
+	if err != nil {
+		return "", err
+	}
+	if err := syncFiles(projectDir, files); err != nil {
+		return "", err
+	}
+	return filepath.Join(projectDir, filepath.FromSlash(stackRepoPath)), nil
+}
+
+// inRepo reports whether a cleaned repository path stays inside the repository
+// and is not the repository root itself.
+func inRepo(p string) bool {
+	return p != "." && p != ".." && !strings.HasPrefix(p, "../")
+}
+
+// parentRefPattern matches relative paths that leave the stack directory,
+// e.g. "../shared/nginx.conf" in a bind mount or env_file entry.
+var parentRefPattern = regexp.MustCompile(`(?:\.\./)+[^\s"':,\]}]*`)
+
+func parentReferences(content string) []string {
+	seen := make(map[string]bool)
+	var refs []string
+	for _, m := range parentRefPattern.FindAllString(content, -1) {
+		m = strings.TrimRight(m, "/")
+		if !seen[m] {
+			seen[m] = true
+			refs = append(refs, m)
+		}
+	}
+	return refs
+}
+
+// collectPath adds the file or directory at p (relative to the repo root) to files.
+// Paths that do not exist in the repository are ignored.
+func collectPath(root *object.Tree, p string, files map[string]*object.File) error {
+	if tree, err := root.Tree(p); err == nil {
+		return collectTree(tree, p, files)
+	}
+	f, err := root.File(p)
+	if errors.Is(err, object.ErrFileNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", p, err)
+	}
+	files[p] = f
+	return nil
+}
+
+func collectTree(tree *object.Tree, prefix string, files map[string]*object.File) error {
+	return tree.Files().ForEach(func(f *object.File) error {
+		files[path.Join(prefix, f.Name)] = f
+		return nil
+	})
+}
+
+// syncFiles writes files below dir and removes files recorded in the previous
+// manifest that are no longer part of the checkout. Untracked files are kept.
+func syncFiles(dir string, files map[string]*object.File) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create work dir: %w", err)
+	}
+
+	previous, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for name, f := range files {
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(name)), f); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	current := make(map[string]bool, len(names))
+	for _, name := range names {
+		current[name] = true
+	}
+	for _, name := range previous {
+		if current[name] {
+			continue
+		}
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove stale file %s: %w", name, err)
+		}
+		removeEmptyParents(dir, filepath.Dir(full))
+	}
+
+	return writeManifest(dir, names)
+}
+
+func writeFile(dest string, f *object.File) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("create dir for %s: %w", f.Name, err)
+	}
+
+	reader, err := f.Reader()
+	if err != nil {
+		return fmt.Errorf("read %s: %w", f.Name, err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", f.Name, err)
+	}
+
+	if f.Mode == filemode.Symlink {
+		if target, err := os.Readlink(dest); err == nil && target == string(content) {
+			return nil
+		}
+		_ = os.Remove(dest)
+		if err := os.Symlink(string(content), dest); err != nil {
+			return fmt.Errorf("create symlink %s: %w", f.Name, err)
+		}
+		return nil
+	}
+
+	perm := os.FileMode(0o644)
+	if f.Mode == filemode.Executable {
+		perm = 0o755
+	}
+
+	if info, err := os.Lstat(dest); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		_ = os.Remove(dest)
+	}
+	// Leave unchanged files alone so their modification times stay stable.
+	if existing, err := os.ReadFile(dest); err == nil && bytes.Equal(existing, content) {
+		return os.Chmod(dest, perm)
+	}
+	if err := os.WriteFile(dest, content, perm); err != nil {
+		return fmt.Errorf("write %s: %w", f.Name, err)
+	}
+	return os.Chmod(dest, perm)
+}
+
+// removeEmptyParents removes now-empty directories between dir and root.
+func removeEmptyParents(root, dir string) {
+	for dir != root && strings.HasPrefix(dir, root) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func readManifest(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	return names, nil
+}
+
+func writeManifest(dir string, names []string) error {
+	data, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifestFile), data, 0o644); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
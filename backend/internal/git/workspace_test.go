@@ -0,0 +1,104 @@
+package git_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lucasreiners/docker-cd/internal/git"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestWorkspace_CheckoutStackDirectory(t *testing.T) {
+	src := newSourceRepo(t)
+	first := src.commit("init", map[string]string{
+		"stacks/api/docker-compose.yml": "services:\n  api:\n    env_file: .env\n    volumes:\n      - ../shared/nginx.conf:/etc/nginx.conf:ro\n      - \"../certs:/certs\"\n",
+		"stacks/api/.env":               "A=1\n",
+		"stacks/api/config/app.toml":    "x = 1\n",
+		"stacks/shared/nginx.conf":      "server {}\n",
+		"stacks/shared/unused.conf":     "unused\n",
+		"stacks/certs/ca.pem":           "pem\n",
+		"stacks/web/docker-compose.yml": "services: {}\n",
+	})
+
+	root := t.TempDir()
+	ws := git.NewWorkspace(root, src.dir, nil, git.NewRepoCache(t.TempDir()), "stacks")
+
+	dir, err := ws.Checkout(context.Background(), "api", first, "api", []string{"docker-compose.yml"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := filepath.Join(root, "api", "stacks", "api"); dir != want {
+		t.Errorf("expected stack dir %s, got %s", want, dir)
+	}
+
+	for _, rel := range []string{"docker-compose.yml", ".env", "config/app.toml", "../shared/nginx.conf", "../certs/ca.pem"} {
+		if _, err := os.Stat(filepath.Join(dir, rel)); err != nil {
+			t.Errorf("expected %s to be checked out: %v", rel, err)
+		}
+	}
+	for _, rel := range []string{"../shared/unused.conf", "../web/docker-compose.yml"} {
+		if _, err := os.Stat(filepath.Join(dir, rel)); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to be checked out", rel)
+		}
+	}
+}
+
+func TestWorkspace_CheckoutKeepsUntrackedFiles(t *testing.T) {
+	src := newSourceRepo(t)
+	first := src.commit("init", map[string]string{
+		"api/docker-compose.yml": "services: {}\n",
+		"api/old.conf":           "old\n",
+		"api/app.conf":           "v1\n",
+	})
+
+	root := t.TempDir()
+	ws := git.NewWorkspace(root, src.dir, nil, git.NewRepoCache(t.TempDir()), "")
+	ctx := context.Background()
+
+	dir, err := ws.Checkout(ctx, "api", first, "api", []string{"docker-compose.yml"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Data written by a running container next to the checked-out files.
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data", "db.sqlite"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	wt, err := src.repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Remove("api/old.conf"); err != nil {
+		t.Fatal(err)
+	}
+	second := src.commit("update", map[string]string{"api/app.conf": "v2\n"})
+
+	dir, err = ws.Checkout(ctx, "api", second, "api", []string{"docker-compose.yml"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := readFile(t, filepath.Join(dir, "app.conf")); got != "v2\n" {
+		t.Errorf("expected updated app.conf, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.conf")); !os.IsNotExist(err) {
+		t.Error("expected file removed from Git to be deleted")
+	}
+	if got := readFile(t, filepath.Join(dir, "data", "db.sqlite")); got != "data" {
+		t.Errorf("expected untracked data to be kept, got %q", got)
+	}
+}
@@ -5,11 +5,14 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lucasreiners/docker-cd/internal/config"
@@ -37,8 +40,13 @@ func RootHandler(runner CommandRunner, cfg config.Config) gin.HandlerFunc {
 		}
 	}
 
+	client, clientErr := docker.NewEngine(cfg.DockerClient, runner, cfg.DockerSocket)
+
 	return func(c *gin.Context) {
-		client := docker.NewClient(runner, cfg.DockerSocket)
+		if clientErr != nil {
+			c.String(http.StatusInternalServerError, clientErr.Error())
+			return
+		}
 		status, err := client.ContainerCount(c.Request.Context())
 		if err != nil {
 			c.String(http.StatusInternalServerError, err.Error())
@@ -120,10 +128,11 @@ func RefreshStatusHandler(store *desiredstate.Store) gin.HandlerFunc {
 	}
 }
 
-// StacksHandler handles GET /api/stacks.
+// StacksHandler handles GET /api/stacks. Stacks pending removal are listed
+// after the desired stacks.
 func StacksHandler(store *desiredstate.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		stacks := store.GetStacks()
+		stacks := store.GetAllStacks()
 		if stacks == nil {
 			stacks = []desiredstate.StackRecord{}
 		}
@@ -150,7 +159,7 @@ func AckHandler(ackStore *reconcile.AckStore, reconciler ReconcileRunner) gin.Ha
 		log.Printf("[info] acknowledged drift for stack %s", req.StackPath)
 
 		// Trigger immediate reconciliation
-		runs := reconciler.Reconcile(c.Request.Context())
+		runs := reconciler.Reconcile(reconcile.WithTrigger(c.Request.Context(), reconcile.TriggerAck))
 
 		result := "acknowledged"
 		for _, run := range runs {
@@ -173,26 +182,397 @@ type ContainerLister interface {
 	GetContainers(ctx context.Context, stackPath string) ([]desiredstate.ContainerInfo, error)
 }
 
-// ContainersHandler handles GET /api/stacks/:path to list containers for a stack.
-func ContainersHandler(lister ContainerLister) gin.HandlerFunc {
+// HistoryReader lists the recorded reconciliation runs of a stack.
+type HistoryReader interface {
+	History(stackPath string, q reconcile.HistoryQuery) (reconcile.HistoryPage, error)
+}
+
+// Page sizes of GET /api/stacks/{path}/-/history.
+const (
+	defaultHistoryPageSize = 20
+	maxHistoryPageSize     = 100
+)
+
+// stackResourceSeparator separates a stack path from the name of one of its
+// sub-resources or actions, e.g. apps/web/-/history.
+const stackResourceSeparator = "/-/"
+
+// splitStackResource splits the wildcard of a per-stack route into the stack
+// path and the sub-resource name. The name follows the last separator and has
+// no slashes, so every stack path, even one ending in a sub-resource name,
+// maps to exactly one URL.
+func splitStackResource(param string) (stackPath, name string, ok bool) {
+	path := strings.TrimPrefix(param, "/")
+	i := strings.LastIndex(path, stackResourceSeparator)
+	if i <= 0 {
+		return "", "", false
+	}
+	stackPath, name = path[:i], path[i+len(stackResourceSeparator):]
+	if name == "" || strings.Contains(name, "/") {
+		return "", "", false
+	}
+	return stackPath, name, true
+}
+
+// StackHandler handles GET /api/stacks/*path. Stack paths contain slashes, so
+// the per-stack endpoints share one wildcard route, with the sub-resource
+// after a /-/ separator: /api/stacks/{path}/-/containers lists a stack's
+// containers and /api/stacks/{path}/-/history its sync history.
+func StackHandler(lister ContainerLister, history HistoryReader) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		stackPath := c.Param("path")
-		if stackPath == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "stack path is required"})
+		stackPath, name, ok := splitStackResource(c.Param("path"))
+		switch {
+		case !ok:
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		case lister != nil && name == "containers":
+			stackContainers(c, lister, stackPath)
+		case history != nil && name == "history":
+			stackHistory(c, history, stackPath)
+		default:
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		}
+	}
+}
+
+// stackContainers lists the containers of a stack.
+func stackContainers(c *gin.Context, lister ContainerLister, stackPath string) {
+	if stackPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "stack path is required"})
+		return
+	}
+
+	containers, err := lister.GetContainers(c.Request.Context(), stackPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if containers == nil {
+		containers = []desiredstate.ContainerInfo{}
+	}
+	c.JSON(http.StatusOK, containers)
+}
+
+// stackHistory returns a page of a stack's sync history, newest first.
+// Query parameters: limit (default 20, at most 100), offset and result
+// (success or failed).
+func stackHistory(c *gin.Context, history HistoryReader, stackPath string) {
+	if stackPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "stack path is required"})
+		return
+	}
+	q := reconcile.HistoryQuery{Result: c.Query("result"), Limit: defaultHistoryPageSize}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxHistoryPageSize)})
 			return
 		}
-		// Strip leading slash from wildcard param
-		stackPath = strings.TrimPrefix(stackPath, "/")
+		q.Limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+			return
+		}
+		q.Offset = n
+	}
 
-		containers, err := lister.GetContainers(c.Request.Context(), stackPath)
+	page, err := history.History(stackPath, q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"stackPath": stackPath,
+		"runs":      page.Runs,
+		"total":     page.Total,
+		"offset":    q.Offset,
+		"limit":     q.Limit,
+	})
+}
+
+// Pinner rolls stacks back to an earlier revision and releases them again.
+type Pinner interface {
+	Rollback(ctx context.Context, stackPath, revision string) (reconcile.ReconciliationRun, error)
+	Unpin(ctx context.Context, stackPath string) ([]reconcile.ReconciliationRun, error)
+}
+
+// rollbackRequest is the JSON body for POST /api/stacks/{path}/-/rollback.
+type rollbackRequest struct {
+	Revision string `json:"revision" binding:"required"`
+}
+
+// Suspender suspends and resumes the reconciliation of stacks.
+type Suspender interface {
+	Suspend(stackPath, by, reason string, expiresAt time.Time) (desiredstate.Suspension, error)
+	Resume(ctx context.Context, stackPath string) (string, error)
+}
+
+// suspendRequest is the JSON body for POST /api/stacks/{path}/-/suspend. The
+// suspension expires at ExpiresAt (RFC3339) or after Duration (e.g. "2h"),
+// if either is set.
+type suspendRequest struct {
+	By        string `json:"by"`
+	Reason    string `json:"reason"`
+	ExpiresAt string `json:"expiresAt"`
+	Duration  string `json:"duration"`
+}
+
+// Syncer queues manual syncs of single stacks.
+type Syncer interface {
+	Sync(ctx context.Context, stackPath string, opts reconcile.SyncOptions) (string, error)
+}
+
+// Remover lists the stacks pending removal and confirms their removal.
+type Remover interface {
+	PendingRemovals() []reconcile.PendingRemoval
+	ConfirmRemoval(ctx context.Context, stackPath string, removeVolumes bool) ([]reconcile.ReconciliationRun, error)
+}
+
+// confirmRemovalRequest is the optional JSON body for POST
+// /api/stacks/{path}/-/confirm-removal.
+type confirmRemovalRequest struct {
+	RemoveVolumes bool `json:"removeVolumes"`
+}
+
+// StackActionHandler handles POST /api/stacks/*path, the manual operations on
+// a stack, named after a /-/ separator like the GET sub-resources:
+// /api/stacks/{path}/-/sync queues a sync of the stack,
+// /api/stacks/{path}/-/rollback deploys it at an earlier revision and pins it
+// there, /api/stacks/{path}/-/unpin releases it, /api/stacks/{path}/-/suspend
+// and /-/resume stop and restart its reconciliation, and
+// /api/stacks/{path}/-/confirm-removal removes a stack pending removal.
+func StackActionHandler(pinner Pinner, suspender Suspender, syncer Syncer, remover Remover) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stackPath, action, ok := splitStackResource(c.Param("path"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+
+		switch {
+		case syncer != nil && action == "sync":
+			syncStack(c, syncer, stackPath)
+		case pinner != nil && action == "rollback":
+			rollbackStack(c, pinner, stackPath)
+		case pinner != nil && action == "unpin":
+			unpinStack(c, pinner, stackPath)
+		case suspender != nil && action == "suspend":
+			suspendStack(c, suspender, stackPath)
+		case suspender != nil && action == "resume":
+			resumeStack(c, suspender, stackPath)
+		case remover != nil && action == "confirm-removal":
+			confirmRemoval(c, remover, stackPath)
+		default:
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		}
+	}
+}
+
+// syncStack queues a sync of a stack and returns its run ID. The optional
+// JSON body sets the force, pull and recreate flags.
+func syncStack(c *gin.Context, syncer Syncer, stackPath string) {
+	var opts reconcile.SyncOptions
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+	}
+
+	runID, err := syncer.Sync(c.Request.Context(), stackPath, opts)
+	if err != nil {
+		c.JSON(stackActionStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":     reconcile.RunQueued,
+		"stack_path": stackPath,
+		"run_id":     runID,
+	})
+}
+
+// rollbackStack deploys a stack at the requested revision and pins it.
+func rollbackStack(c *gin.Context, pinner Pinner, stackPath string) {
+	var req rollbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "revision is required"})
+		return
+	}
+
+	run, err := pinner.Rollback(c.Request.Context(), stackPath, req.Revision)
+	if err != nil {
+		c.JSON(stackActionStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if run.Result != "success" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": run.Error, "run": run})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     desiredstate.StackSyncPinned,
+		"stack_path": stackPath,
+		"run":        run,
+	})
+}
+
+// unpinStack releases a pinned stack and reports the result of its sync.
+func unpinStack(c *gin.Context, pinner Pinner, stackPath string) {
+	runs, err := pinner.Unpin(c.Request.Context(), stackPath)
+	if err != nil {
+		c.JSON(stackActionStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	result := "unpinned"
+	for _, run := range runs {
+		if run.StackPath == stackPath {
+			result = run.Result
+			break
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     result,
+		"stack_path": stackPath,
+	})
+}
+
+// suspendStack suspends the reconciliation of a stack.
+func suspendStack(c *gin.Context, suspender Suspender, stackPath string) {
+	var req suspendRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+	}
+
+	var expiresAt time.Time
+	switch {
+	case req.ExpiresAt != "" && req.Duration != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "set either expiresAt or duration"})
+		return
+	case req.ExpiresAt != "":
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil || !t.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expiresAt must be a future RFC3339 time"})
+			return
+		}
+		expiresAt = t
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "duration must be a positive duration, e.g. 2h"})
+			return
+		}
+		expiresAt = time.Now().Add(d)
+	}
+
+	susp, err := suspender.Suspend(stackPath, req.By, req.Reason, expiresAt)
+	if err != nil {
+		c.JSON(stackActionStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     desiredstate.StackSyncSuspended,
+		"stack_path": stackPath,
+		"suspension": susp,
+	})
+}
+
+// resumeStack lifts a stack's suspension and returns the run ID of the sync
+// it queued, if any.
+func resumeStack(c *gin.Context, suspender Suspender, stackPath string) {
+	runID, err := suspender.Resume(c.Request.Context(), stackPath)
+	if err != nil {
+		c.JSON(stackActionStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if runID == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"status":     "resumed",
+			"stack_path": stackPath,
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":     reconcile.RunQueued,
+		"stack_path": stackPath,
+		"run_id":     runID,
+	})
+}
+
+// confirmRemoval confirms the removal of a stack pending removal and reports
+// the result of the removal. Its volumes are only removed if the body sets
+// removeVolumes.
+func confirmRemoval(c *gin.Context, remover Remover, stackPath string) {
+	var req confirmRemovalRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+	}
+
+	runs, err := remover.ConfirmRemoval(c.Request.Context(), stackPath, req.RemoveVolumes)
+	if err != nil {
+		c.JSON(stackActionStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	result := "confirmed"
+	for _, run := range runs {
+		if run.StackPath == stackPath {
+			result = run.Result
+			break
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":         result,
+		"stack_path":     stackPath,
+		"remove_volumes": req.RemoveVolumes,
+	})
+}
+
+// RemovalsHandler handles GET /api/removals and lists the stacks pending
+// removal.
+func RemovalsHandler(remover Remover) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, remover.PendingRemovals())
+	}
+}
+
+// stackActionStatus maps errors of manual stack operations to HTTP statuses.
+func stackActionStatus(err error) int {
+	switch {
+	case errors.Is(err, reconcile.ErrStackNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, reconcile.ErrReconcileDisabled), errors.Is(err, reconcile.ErrSyncBlocked),
+		errors.Is(err, reconcile.ErrSuspendedBySettings):
+		return http.StatusConflict
+	case errors.Is(err, reconcile.ErrRevisionUnavailable):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// Planner computes what a reconciliation would change without executing it.
+type Planner interface {
+	Plan(ctx context.Context) (*reconcile.Plan, error)
+}
+
+// PlanHandler handles GET /api/plan and returns the reconcile plan.
+func PlanHandler(planner Planner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plan, err := planner.Plan(c.Request.Context())
+		if errors.Is(err, reconcile.ErrNoDesiredState) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		if containers == nil {
-			containers = []desiredstate.ContainerInfo{}
-		}
-		c.JSON(http.StatusOK, containers)
+		c.JSON(http.StatusOK, plan)
 	}
 }
 
@@ -209,7 +589,7 @@ func EventsHandler(broadcaster *desiredstate.Broadcaster, store *desiredstate.St
 		defer broadcaster.Unsubscribe(sub)
 
 		// Send initial snapshot of current stacks
-		stacks := store.GetStacks()
+		stacks := store.GetAllStacks()
 		if stacks == nil {
 			stacks = []desiredstate.StackRecord{}
 		}
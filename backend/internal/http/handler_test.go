@@ -5,11 +5,13 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lucasreiners/docker-cd/internal/config"
@@ -565,3 +567,391 @@ func TestAckHandler_MissingStackPath(t *testing.T) {
 		t.Errorf("expected status 400, got %d", w.Code)
 	}
 }
+
+type stubPlanner struct {
+	stubReconciler
+	plan *reconcile.Plan
+	err  error
+}
+
+func (s *stubPlanner) Plan(_ context.Context) (*reconcile.Plan, error) {
+	return s.plan, s.err
+}
+
+func TestPlanHandler(t *testing.T) {
+	cfg := config.Config{Port: 8080, ProjectName: "Docker-CD", DockerSocket: "/var/run/docker.sock"}
+	planner := &stubPlanner{plan: &reconcile.Plan{Revision: "rev1", Stacks: []reconcile.StackPlan{
+		{Path: "app1", Action: reconcile.PlanActionUpdate, Reason: "compose hash drift",
+			Services: []reconcile.ServiceDiff{{Service: "web", Change: reconcile.ServiceChanged, Fields: []string{"image"}}}},
+	}}}
+
+	gin.SetMode(gin.TestMode)
+	router := handler.NewRouter(&stubRunner{}, cfg, nil, desiredstate.NewStore(), reconcile.NewAckStore(), planner)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/plan", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	for _, want := range []string{`"action":"update"`, `"service":"web"`, `"fields":["image"]`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("response should contain %s, got: %s", want, w.Body.String())
+		}
+	}
+
+	planner.plan, planner.err = nil, reconcile.ErrNoDesiredState
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/plan", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 without desired state, got %d", w.Code)
+	}
+}
+
+type stubStackReconciler struct {
+	stubReconciler
+	history *reconcile.MemoryHistory
+}
+
+func (s *stubStackReconciler) GetContainers(_ context.Context, stackPath string) ([]desiredstate.ContainerInfo, error) {
+	return []desiredstate.ContainerInfo{{Name: stackPath + "-web-1"}}, nil
+}
+
+func (s *stubStackReconciler) History(stackPath string, q reconcile.HistoryQuery) (reconcile.HistoryPage, error) {
+	return s.history.History(stackPath, q)
+}
+
+func TestStackHandler(t *testing.T) {
+	cfg := config.Config{Port: 8080, ProjectName: "Docker-CD", DockerSocket: "/var/run/docker.sock"}
+	rec := &stubStackReconciler{history: reconcile.NewMemoryHistory(0)}
+	for i := 0; i < 25; i++ {
+		result := "success"
+		if i%5 == 0 {
+			result = "failed"
+		}
+		rec.history.RecordRun(reconcile.ReconciliationRun{StackPath: "apps/web", DesiredRevision: fmt.Sprintf("rev%d", i), Result: result})
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := handler.NewRouter(&stubRunner{}, cfg, nil, desiredstate.NewStore(), reconcile.NewAckStore(), rec)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	var page struct {
+		StackPath string                        `json:"stackPath"`
+		Runs      []reconcile.ReconciliationRun `json:"runs"`
+		Total     int                           `json:"total"`
+	}
+	w := get("/api/stacks/apps/web/-/history")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if page.StackPath != "apps/web" || page.Total != 25 || len(page.Runs) != 20 || page.Runs[0].DesiredRevision != "rev24" {
+		t.Errorf("expected the first 20 of 25 runs newest first, got %d/%d", len(page.Runs), page.Total)
+	}
+
+	w = get("/api/stacks/apps/web/-/history?result=failed&limit=2&offset=1")
+	page.Runs = nil
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if page.Total != 5 || len(page.Runs) != 2 || page.Runs[0].DesiredRevision != "rev15" {
+		t.Errorf("unexpected filtered page %s", w.Body.String())
+	}
+
+	if w := get("/api/stacks/apps/web/-/history?limit=1000"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an oversized page, got %d", w.Code)
+	}
+	if w := get("/api/stacks/apps/web/-/containers"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "apps/web-web-1") {
+		t.Errorf("expected containers of apps/web, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := get("/api/stacks/apps/web"); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+	if w := get("/api/stacks"); w.Code != http.StatusOK {
+		t.Errorf("expected the stack list next to the wildcard route, got %d", w.Code)
+	}
+}
+
+func TestStackHandler_PathsNamedLikeSubresources(t *testing.T) {
+	cfg := config.Config{Port: 8080, ProjectName: "Docker-CD", DockerSocket: "/var/run/docker.sock"}
+	rec := &stubStackReconciler{history: reconcile.NewMemoryHistory(0)}
+	for _, path := range []string{"containers", "containers/history", "apps/history", "a/-/b"} {
+		rec.history.RecordRun(reconcile.ReconciliationRun{StackPath: path, DesiredRevision: "rev-" + path, Result: "success"})
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := handler.NewRouter(&stubRunner{}, cfg, nil, desiredstate.NewStore(), reconcile.NewAckStore(), rec)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	for url, stackPath := range map[string]string{
+		"/api/stacks/containers/-/history":         "containers",
+		"/api/stacks/containers/history/-/history": "containers/history",
+		"/api/stacks/apps/history/-/history":       "apps/history",
+		"/api/stacks/a/-/b/-/history":              "a/-/b",
+	} {
+		w := get(url)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"stackPath":"`+stackPath+`"`) || !strings.Contains(w.Body.String(), "rev-"+stackPath) {
+			t.Errorf("GET %s: expected the history of %s, got %d: %s", url, stackPath, w.Code, w.Body.String())
+		}
+	}
+	if w := get("/api/stacks/apps/history/-/containers"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"apps/history-web-1"`) {
+		t.Errorf("expected containers of apps/history, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, url := range []string{"/api/stacks/containers/apps/history", "/api/stacks/-/history", "/api/stacks/apps/-/history/x"} {
+		if w := get(url); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: expected status 404, got %d", url, w.Code)
+		}
+	}
+}
+
+type stubPinner struct {
+	stubReconciler
+	rollbacks []string
+	unpinned  []string
+	err       error
+}
+
+func (s *stubPinner) Rollback(_ context.Context, stackPath, revision string) (reconcile.ReconciliationRun, error) {
+	s.rollbacks = append(s.rollbacks, stackPath+"@"+revision)
+	return reconcile.ReconciliationRun{StackPath: stackPath, DesiredRevision: revision, Result: "success"}, s.err
+}
+
+func (s *stubPinner) Unpin(_ context.Context, stackPath string) ([]reconcile.ReconciliationRun, error) {
+	s.unpinned = append(s.unpinned, stackPath)
+	return []reconcile.ReconciliationRun{{StackPath: stackPath, Result: "success"}}, s.err
+}
+
+func TestStackActionHandler_RollbackAndUnpin(t *testing.T) {
+	cfg := config.Config{Port: 8080, ProjectName: "Docker-CD", DockerSocket: "/var/run/docker.sock"}
+	pinner := &stubPinner{}
+
+	gin.SetMode(gin.TestMode)
+	router := handler.NewRouter(&stubRunner{}, cfg, nil, desiredstate.NewStore(), reconcile.NewAckStore(), pinner)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/api/stacks/apps/web/-/rollback", `{"revision": "abc123"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"pinned"`) {
+		t.Errorf("expected pinned, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(pinner.rollbacks) != 1 || pinner.rollbacks[0] != "apps/web@abc123" {
+		t.Errorf("unexpected rollbacks %v", pinner.rollbacks)
+	}
+	if w := post("/api/stacks/apps/web/-/rollback", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without revision, got %d", w.Code)
+	}
+
+	if w := post("/api/stacks/apps/web/-/unpin", ""); w.Code != http.StatusOK || len(pinner.unpinned) != 1 || pinner.unpinned[0] != "apps/web" {
+		t.Errorf("expected apps/web to be unpinned, got %d: %s", w.Code, w.Body.String())
+	}
+
+	pinner.err = fmt.Errorf("wrapped: %w", reconcile.ErrStackNotFound)
+	if w := post("/api/stacks/nope/-/rollback", `{"revision": "abc123"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown stack, got %d", w.Code)
+	}
+	pinner.err = reconcile.ErrRevisionUnavailable
+	if w := post("/api/stacks/apps/web/-/rollback", `{"revision": "nope"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status 422 for an unknown revision, got %d", w.Code)
+	}
+	if w := post("/api/stacks/apps/web/-/explode", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown action, got %d", w.Code)
+	}
+}
+
+type stubSuspender struct {
+	stubReconciler
+	suspended []desiredstate.Suspension
+	expiresAt time.Time
+	resumed   []string
+}
+
+func (s *stubSuspender) Suspend(stackPath, by, reason string, expiresAt time.Time) (desiredstate.Suspension, error) {
+	if stackPath != "apps/web" {
+		return desiredstate.Suspension{}, reconcile.ErrStackNotFound
+	}
+	susp := desiredstate.Suspension{By: by, Reason: reason, At: "2026-01-01T00:00:00Z"}
+	s.suspended = append(s.suspended, susp)
+	s.expiresAt = expiresAt
+	return susp, nil
+}
+
+func (s *stubSuspender) Resume(_ context.Context, stackPath string) (string, error) {
+	s.resumed = append(s.resumed, stackPath)
+	if stackPath == "apps/frozen" {
+		return "", reconcile.ErrSuspendedBySettings
+	}
+	if stackPath != "apps/web" {
+		return "", nil
+	}
+	return "run-1", nil
+}
+
+func TestStackActionHandler_SuspendAndResume(t *testing.T) {
+	cfg := config.Config{Port: 8080, ProjectName: "Docker-CD", DockerSocket: "/var/run/docker.sock"}
+	suspender := &stubSuspender{}
+
+	gin.SetMode(gin.TestMode)
+	router := handler.NewRouter(&stubRunner{}, cfg, nil, desiredstate.NewStore(), reconcile.NewAckStore(), suspender)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/api/stacks/apps/web/-/suspend", `{"by": "alice", "reason": "migration", "duration": "2h"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"suspended"`) {
+		t.Errorf("expected suspended, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(suspender.suspended) != 1 || suspender.suspended[0].By != "alice" || suspender.suspended[0].Reason != "migration" {
+		t.Errorf("unexpected suspensions %+v", suspender.suspended)
+	}
+	if until := time.Until(suspender.expiresAt); until < time.Hour || until > 2*time.Hour {
+		t.Errorf("expected expiry in 2h, got %s", suspender.expiresAt)
+	}
+
+	if w := post("/api/stacks/apps/web/-/suspend", ""); w.Code != http.StatusOK || !suspender.expiresAt.IsZero() {
+		t.Errorf("expected suspension without body or expiry, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := post("/api/stacks/apps/web/-/suspend", `{"expiresAt": "2000-01-01T00:00:00Z"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a past expiry, got %d", w.Code)
+	}
+	if w := post("/api/stacks/apps/web/-/suspend", `{"duration": "soon"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid duration, got %d", w.Code)
+	}
+	if w := post("/api/stacks/nope/-/suspend", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown stack, got %d", w.Code)
+	}
+
+	w = post("/api/stacks/apps/web/-/resume", "")
+	if w.Code != http.StatusAccepted || len(suspender.resumed) != 1 || !strings.Contains(w.Body.String(), `"run_id":"run-1"`) {
+		t.Errorf("expected apps/web to be resumed with a queued sync, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := post("/api/stacks/apps/db/-/resume", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"resumed"`) {
+		t.Errorf("expected resume without a sync, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := post("/api/stacks/apps/frozen/-/resume", ""); w.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for a stack suspended by its settings, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := post("/api/stacks/apps/web/-/rollback", `{"revision": "abc123"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for rollback without a pinner, got %d", w.Code)
+	}
+}
+
+type stubSyncer struct {
+	stubReconciler
+	syncs []reconcile.SyncOptions
+	err   error
+}
+
+func (s *stubSyncer) Sync(_ context.Context, _ string, opts reconcile.SyncOptions) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	s.syncs = append(s.syncs, opts)
+	return "run1", nil
+}
+
+func TestStackActionHandler_Sync(t *testing.T) {
+	cfg := config.Config{Port: 8080, ProjectName: "Docker-CD", DockerSocket: "/var/run/docker.sock"}
+	syncer := &stubSyncer{}
+
+	gin.SetMode(gin.TestMode)
+	router := handler.NewRouter(&stubRunner{}, cfg, nil, desiredstate.NewStore(), reconcile.NewAckStore(), syncer)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/api/stacks/apps/web/-/sync", "")
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"run_id":"run1"`) {
+		t.Errorf("expected run ID, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := post("/api/stacks/apps/web/-/sync", `{"force": true, "pull": true, "recreate": true}`); w.Code != http.StatusAccepted {
+		t.Errorf("expected status 202, got %d", w.Code)
+	}
+	if len(syncer.syncs) != 2 || syncer.syncs[0] != (reconcile.SyncOptions{}) || syncer.syncs[1] != (reconcile.SyncOptions{Force: true, Pull: true, Recreate: true}) {
+		t.Errorf("unexpected sync options %+v", syncer.syncs)
+	}
+	if w := post("/api/stacks/apps/web/-/sync", `{"force": "yes"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid body, got %d", w.Code)
+	}
+
+	syncer.err = fmt.Errorf("%w: suspended", reconcile.ErrSyncBlocked)
+	if w := post("/api/stacks/apps/web/-/sync", ""); w.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for a suspended stack, got %d", w.Code)
+	}
+}
+
+type stubRemover struct {
+	stubReconciler
+	confirmed map[string]bool
+}
+
+func (s *stubRemover) PendingRemovals() []reconcile.PendingRemoval {
+	return []reconcile.PendingRemoval{{StackPath: "apps/old", Status: desiredstate.StackSyncPendingRemoval, Blocked: "mass removal"}}
+}
+
+func (s *stubRemover) ConfirmRemoval(_ context.Context, stackPath string, removeVolumes bool) ([]reconcile.ReconciliationRun, error) {
+	if stackPath != "apps/old" {
+		return nil, reconcile.ErrNoPendingRemoval
+	}
+	s.confirmed[stackPath] = removeVolumes
+	return []reconcile.ReconciliationRun{{StackPath: stackPath, Result: "success"}}, nil
+}
+
+func TestStackActionHandler_ConfirmRemoval(t *testing.T) {
+	cfg := config.Config{Port: 8080, ProjectName: "Docker-CD", DockerSocket: "/var/run/docker.sock"}
+	remover := &stubRemover{confirmed: make(map[string]bool)}
+
+	gin.SetMode(gin.TestMode)
+	router := handler.NewRouter(&stubRunner{}, cfg, nil, desiredstate.NewStore(), reconcile.NewAckStore(), remover)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/removals", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"pending_removal"`) {
+		t.Errorf("expected pending removals, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = post("/api/stacks/apps/old/-/confirm-removal", `{"removeVolumes": true}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"success"`) || !remover.confirmed["apps/old"] {
+		t.Errorf("expected removal with volumes, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := post("/api/stacks/apps/web/-/confirm-removal", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a stack not pending removal, got %d", w.Code)
+	}
+	if w := post("/api/stacks/apps/old/-/confirm-removal", `{"removeVolumes": "yes"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid body, got %d", w.Code)
+	}
+}
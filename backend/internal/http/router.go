@@ -34,9 +34,25 @@ func NewRouter(runner CommandRunner, cfg config.Config, refreshSvc *refresh.Serv
 	if ackStore != nil && reconciler != nil {
 		r.POST("/api/reconcile/ack", AckHandler(ackStore, reconciler))
 	}
-	// Container listing for individual stacks
-	if lister, ok := reconciler.(ContainerLister); ok {
-		r.GET("/api/stacks/containers/*path", ContainersHandler(lister))
+	// Per-stack container listing and sync history
+	lister, _ := reconciler.(ContainerLister)
+	history, _ := reconciler.(HistoryReader)
+	if lister != nil || history != nil {
+		r.GET("/api/stacks/*path", StackHandler(lister, history))
+	}
+	// Manual per-stack operations
+	pinner, _ := reconciler.(Pinner)
+	suspender, _ := reconciler.(Suspender)
+	syncer, _ := reconciler.(Syncer)
+	remover, _ := reconciler.(Remover)
+	if pinner != nil || suspender != nil || syncer != nil || remover != nil {
+		r.POST("/api/stacks/*path", StackActionHandler(pinner, suspender, syncer, remover))
+	}
+	if remover != nil {
+		r.GET("/api/removals", RemovalsHandler(remover))
+	}
+	if planner, ok := reconciler.(Planner); ok {
+		r.GET("/api/plan", PlanHandler(planner))
 	}
 	if len(broadcaster) > 0 && broadcaster[0] != nil && store != nil {
 		r.GET("/api/events", EventsHandler(broadcaster[0], store))
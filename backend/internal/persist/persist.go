@@ -0,0 +1,354 @@
+// Package persist keeps docker-cd state in an embedded bbolt database under
+// DATA_DIR, so the last desired state, drift acknowledgements, stack
+// suspensions and sync history survive restarts.
+package persist
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+	bolt "go.etcd.io/bbolt"
+)
+
+// FileName is the name of the database file in the data dir.
+const FileName = "docker-cd.db"
+
+// saveDelay collects bursts of store changes (a reconcile updates several
+// fields per stack) into one write.
+const saveDelay = time.Second
+
+var (
+	bucketState   = []byte("state")
+	bucketAcks    = []byte("acks")
+	bucketHistory = []byte("history")
+
+	bucketSuspensions = []byte("suspensions")
+	bucketRemovals    = []byte("removals")
+
+	keySnapshot = []byte("snapshot")
+)
+
+// DB is the persistent store. It implements reconcile.AckPersister,
+// reconcile.SuspensionPersister, reconcile.RemovalPersister and
+// reconcile.HistoryStore.
+type DB struct {
+	db           *bolt.DB
+	historyLimit int
+}
+
+var (
+	_ reconcile.AckPersister        = (*DB)(nil)
+	_ reconcile.SuspensionPersister = (*DB)(nil)
+	_ reconcile.RemovalPersister    = (*DB)(nil)
+	_ reconcile.HistoryStore        = (*DB)(nil)
+)
+
+// Open opens (or creates) the database in dir, keeping at most historyLimit
+// runs per stack (reconcile.DefaultHistoryLimit if not positive).
+func Open(dir string, historyLimit int) (*DB, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, FileName), 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketState, bucketAcks, bucketHistory, bucketSuspensions, bucketRemovals} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initialise database: %w", err)
+	}
+	if historyLimit <= 0 {
+		historyLimit = reconcile.DefaultHistoryLimit
+	}
+	return &DB{db: db, historyLimit: historyLimit}, nil
+}
+
+// Close closes the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// storedSnapshot is the stored form of a snapshot. Stack files and settings
+// are hidden from the snapshot's JSON form, so they are stored next to it.
+type storedSnapshot struct {
+	Snapshot *desiredstate.Snapshot `json:"snapshot"`
+	// Stacks holds the hidden fields of Snapshot.Stacks, in the same order.
+	Stacks []storedStack `json:"stacks"`
+}
+
+type storedStack struct {
+	Content  []byte                      `json:"content,omitempty"`
+	Files    map[string][]byte           `json:"files,omitempty"`
+	Settings *desiredstate.StackSettings `json:"settings,omitempty"`
+}
+
+// SaveSnapshot stores snap, including the stack files and settings, so
+// reconciliation can continue from it after a restart.
+func (d *DB) SaveSnapshot(snap *desiredstate.Snapshot) error {
+	stored := storedSnapshot{Snapshot: snap, Stacks: make([]storedStack, len(snap.Stacks))}
+	for i, st := range snap.Stacks {
+		stored.Stacks[i] = storedStack{Content: st.Content, Files: st.Files, Settings: st.Settings}
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketState).Put(keySnapshot, data)
+	})
+}
+
+// LoadSnapshot returns the stored snapshot, or nil if none was saved.
+func (d *DB) LoadSnapshot() (*desiredstate.Snapshot, error) {
+	var snap *desiredstate.Snapshot
+	err := d.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketState).Get(keySnapshot)
+		if data == nil {
+			return nil
+		}
+		var stored storedSnapshot
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return fmt.Errorf("decode snapshot: %w", err)
+		}
+		if stored.Snapshot == nil || len(stored.Stacks) != len(stored.Snapshot.Stacks) {
+			return fmt.Errorf("decode snapshot: inconsistent stack data")
+		}
+		for i, hidden := range stored.Stacks {
+			st := &stored.Snapshot.Stacks[i]
+			st.Content, st.Files, st.Settings = hidden.Content, hidden.Files, hidden.Settings
+		}
+		snap = stored.Snapshot
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// SyncStore saves the store's snapshot whenever it changes, at most once per
+// second, until ctx is cancelled. Pending changes are saved on cancellation;
+// the returned channel is closed once that final save has finished, so the
+// caller can wait for it before closing the database.
+func (d *DB) SyncStore(ctx context.Context, store *desiredstate.Store, onError func(error)) <-chan struct{} {
+	done := make(chan struct{})
+	changed := make(chan struct{}, 1)
+	store.OnChange(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	go func() {
+		defer close(done)
+		save := func() {
+			if snap := store.Get(); snap != nil {
+				if err := d.SaveSnapshot(snap); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+		timer := time.NewTimer(saveDelay)
+		timer.Stop()
+		pending := false
+		for {
+			select {
+			case <-ctx.Done():
+				select {
+				case <-changed:
+					pending = true
+				default:
+				}
+				if pending {
+					save()
+				}
+				return
+			case <-changed:
+				if !pending {
+					pending = true
+					timer.Reset(saveDelay)
+				}
+			case <-timer.C:
+				pending = false
+				save()
+			}
+		}
+	}()
+	return done
+}
+
+// LoadAcks returns the stack paths with a stored acknowledgement.
+func (d *DB) LoadAcks() ([]string, error) {
+	var paths []string
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketAcks).ForEach(func(k, _ []byte) error {
+			paths = append(paths, string(k))
+			return nil
+		})
+	})
+	return paths, err
+}
+
+// SaveAck stores an acknowledgement with the time it was given.
+func (d *DB) SaveAck(path string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketAcks).Put([]byte(path), []byte(time.Now().UTC().Format(time.RFC3339)))
+	})
+}
+
+// DeleteAck removes a stored acknowledgement.
+func (d *DB) DeleteAck(path string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketAcks).Delete([]byte(path))
+	})
+}
+
+// LoadSuspensions returns the stored suspensions by stack path.
+func (d *DB) LoadSuspensions() (map[string]desiredstate.Suspension, error) {
+	suspensions := make(map[string]desiredstate.Suspension)
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSuspensions).ForEach(func(k, v []byte) error {
+			var s desiredstate.Suspension
+			if err := json.Unmarshal(v, &s); err != nil {
+				return fmt.Errorf("decode suspension of %s: %w", k, err)
+			}
+			suspensions[string(k)] = s
+			return nil
+		})
+	})
+	return suspensions, err
+}
+
+// SaveSuspension stores the suspension of a stack.
+func (d *DB) SaveSuspension(path string, s desiredstate.Suspension) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSuspensions).Put([]byte(path), data)
+	})
+}
+
+// DeleteSuspension removes a stored suspension.
+func (d *DB) DeleteSuspension(path string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSuspensions).Delete([]byte(path))
+	})
+}
+
+// LoadRemovals returns the stored grace period state of stacks pending
+// removal by stack path.
+func (d *DB) LoadRemovals() (map[string]reconcile.RemovalState, error) {
+	removals := make(map[string]reconcile.RemovalState)
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketRemovals).ForEach(func(k, v []byte) error {
+			var st reconcile.RemovalState
+			if err := json.Unmarshal(v, &st); err != nil {
+				return fmt.Errorf("decode pending removal of %s: %w", k, err)
+			}
+			removals[string(k)] = st
+			return nil
+		})
+	})
+	return removals, err
+}
+
+// SaveRemoval stores the grace period state of a stack pending removal.
+func (d *DB) SaveRemoval(path string, st reconcile.RemovalState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketRemovals).Put([]byte(path), data)
+	})
+}
+
+// DeleteRemoval removes the stored state of a stack no longer pending removal.
+func (d *DB) DeleteRemoval(path string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketRemovals).Delete([]byte(path))
+	})
+}
+
+// RecordRun appends run to its stack's history, dropping the oldest runs
+// beyond the history limit.
+func (d *DB) RecordRun(run reconcile.ReconciliationRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(bucketHistory).CreateBucketIfNotExists([]byte(run.StackPath))
+		if err != nil {
+			return err
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := b.Put(sequenceKey(seq), data); err != nil {
+			return err
+		}
+
+		// Keys are big-endian sequence numbers, so they iterate oldest first.
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys = append(keys, k)
+		}
+		for i := 0; i < len(keys)-d.historyLimit; i++ {
+			if err := b.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// History returns a page of the recorded runs of a stack, newest first.
+func (d *DB) History(stackPath string, q reconcile.HistoryQuery) (reconcile.HistoryPage, error) {
+	var runs []reconcile.ReconciliationRun
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketHistory).Bucket([]byte(stackPath))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var run reconcile.ReconciliationRun
+			if err := json.Unmarshal(v, &run); err != nil {
+				return fmt.Errorf("decode run: %w", err)
+			}
+			runs = append(runs, run)
+		}
+		return nil
+	})
+	if err != nil {
+		return reconcile.HistoryPage{}, err
+	}
+	return q.Apply(runs), nil
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
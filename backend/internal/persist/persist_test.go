@@ -0,0 +1,250 @@
+package persist_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/persist"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+func openDB(t *testing.T, dir string, limit int) *persist.DB {
+	t.Helper()
+	db, err := persist.Open(dir, limit)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSnapshotSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	db := openDB(t, dir, 0)
+
+	if snap, err := db.LoadSnapshot(); err != nil || snap != nil {
+		t.Fatalf("expected no snapshot in a new database, got %+v (%v)", snap, err)
+	}
+
+	keep := false
+	want := &desiredstate.Snapshot{
+		Revision:      "abc123",
+		RefreshedAt:   time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		RefreshStatus: desiredstate.RefreshStatusCompleted,
+		Stacks: []desiredstate.StackRecord{{
+			Path:        "app",
+			ComposeFile: "docker-compose.yml",
+			ComposeHash: "h1",
+			Status:      desiredstate.StackSyncSynced,
+			Content:     []byte("services:\n  web:\n    image: nginx\n"),
+			EnvFiles:    []string{".env"},
+			Files:       map[string][]byte{".env": []byte("A=1\n")},
+			Settings:    &desiredstate.StackSettings{Remove: &keep, SyncTimeout: desiredstate.Duration(time.Minute)},
+			Drift:       []desiredstate.DriftReason{{Kind: desiredstate.DriftImage, Service: "web"}},
+		}},
+	}
+	if err := db.SaveSnapshot(want); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	db.Close()
+
+	got, err := openDB(t, dir, 0).LoadSnapshot()
+	if err != nil || got == nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	st := got.Stacks[0]
+	if got.Revision != "abc123" || !got.RefreshedAt.Equal(want.RefreshedAt) || st.Status != desiredstate.StackSyncSynced {
+		t.Errorf("unexpected snapshot %+v", got)
+	}
+	// Stack files and settings are not part of the JSON form but are needed to reconcile.
+	if string(st.Content) != string(want.Stacks[0].Content) || string(st.FileContent(".env")) != "A=1\n" {
+		t.Errorf("stack files not restored: %q %q", st.Content, st.FileContent(".env"))
+	}
+	if st.Settings == nil || st.Settings.Remove == nil || *st.Settings.Remove || st.Settings.SyncTimeout != desiredstate.Duration(time.Minute) {
+		t.Errorf("settings not restored: %+v", st.Settings)
+	}
+	if len(st.Drift) != 1 || st.Drift[0].Service != "web" {
+		t.Errorf("drift not restored: %+v", st.Drift)
+	}
+}
+
+func TestSyncStore(t *testing.T) {
+	db := openDB(t, t.TempDir(), 0)
+	store := desiredstate.NewStore()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db.SyncStore(ctx, store, func(err error) { t.Errorf("save failed: %v", err) })
+
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: []desiredstate.StackRecord{{Path: "app", Status: desiredstate.StackSyncMissing}}})
+	store.UpdateStack("app", func(st *desiredstate.StackRecord) { st.Status = desiredstate.StackSyncSynced })
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		snap, err := db.LoadSnapshot()
+		if err != nil {
+			t.Fatalf("LoadSnapshot: %v", err)
+		}
+		if snap != nil && snap.Stacks[0].Status == desiredstate.StackSyncSynced {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the store to be saved, got %+v", snap)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSyncStore_SavesPendingChangesBeforeDone(t *testing.T) {
+	db := openDB(t, t.TempDir(), 0)
+	store := desiredstate.NewStore()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := db.SyncStore(ctx, store, func(err error) { t.Errorf("save failed: %v", err) })
+
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: []desiredstate.StackRecord{{Path: "app", Status: desiredstate.StackSyncSynced}}})
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("SyncStore did not finish after cancellation")
+	}
+	snap, err := db.LoadSnapshot()
+	if err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	if snap == nil || snap.Revision != "rev1" {
+		t.Errorf("pending change not saved before done, got %+v", snap)
+	}
+}
+
+func TestAcksSurviveReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := persist.Open(dir, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	acks := reconcile.NewAckStore()
+	if err := acks.SetPersister(db); err != nil {
+		t.Fatalf("SetPersister: %v", err)
+	}
+	acks.Acknowledge("app")
+	acks.Acknowledge("db")
+	acks.Clear("db")
+	db.Close()
+
+	restored := reconcile.NewAckStore()
+	if err := restored.SetPersister(openDB(t, dir, 0)); err != nil {
+		t.Fatalf("SetPersister: %v", err)
+	}
+	if !restored.IsAcknowledged("app") || restored.IsAcknowledged("db") {
+		t.Errorf("expected only app to stay acknowledged")
+	}
+}
+
+func TestSuspensionsSurviveReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := persist.Open(dir, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	suspensions := reconcile.NewSuspensionStore()
+	if err := suspensions.SetPersister(db); err != nil {
+		t.Fatalf("SetPersister: %v", err)
+	}
+	suspensions.Suspend("app", desiredstate.Suspension{By: "alice", Reason: "migration", At: "2026-01-01T00:00:00Z"})
+	suspensions.Suspend("db", desiredstate.Suspension{At: "2026-01-01T00:00:00Z"})
+	suspensions.Resume("db")
+	db.Close()
+
+	restored := reconcile.NewSuspensionStore()
+	if err := restored.SetPersister(openDB(t, dir, 0)); err != nil {
+		t.Fatalf("SetPersister: %v", err)
+	}
+	if s, ok := restored.Get("app"); !ok || s.By != "alice" || s.Reason != "migration" {
+		t.Errorf("expected app suspension restored, got %+v (%v)", s, ok)
+	}
+	if _, ok := restored.Get("db"); ok {
+		t.Error("expected db suspension to stay resumed")
+	}
+}
+
+func TestRemovalsSurviveReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := persist.Open(dir, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := db.SaveRemoval("app", reconcile.RemovalState{Since: since, RefreshedAt: since, Refreshes: 2, Confirmed: true, RemoveVolumes: true}); err != nil {
+		t.Fatalf("SaveRemoval: %v", err)
+	}
+	if err := db.SaveRemoval("db", reconcile.RemovalState{Since: since, Refreshes: 1}); err != nil {
+		t.Fatalf("SaveRemoval: %v", err)
+	}
+	if err := db.DeleteRemoval("db"); err != nil {
+		t.Fatalf("DeleteRemoval: %v", err)
+	}
+	db.Close()
+
+	removals, err := openDB(t, dir, 0).LoadRemovals()
+	if err != nil {
+		t.Fatalf("LoadRemovals: %v", err)
+	}
+	st, ok := removals["app"]
+	if len(removals) != 1 || !ok || !st.Since.Equal(since) || !st.RefreshedAt.Equal(since) || st.Refreshes != 2 || !st.Confirmed || !st.RemoveVolumes {
+		t.Errorf("expected only app restored, got %+v", removals)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	db := openDB(t, t.TempDir(), 3)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		run := reconcile.ReconciliationRun{
+			StackPath:       "app",
+			DesiredRevision: fmt.Sprintf("rev%d", i),
+			StartedAt:       start.Add(time.Duration(i) * time.Minute),
+			Result:          "success",
+		}
+		if err := db.RecordRun(run); err != nil {
+			t.Fatalf("RecordRun: %v", err)
+		}
+	}
+	if err := db.RecordRun(reconcile.ReconciliationRun{StackPath: "other", Result: "failed", Error: "boom"}); err != nil {
+		t.Fatalf("RecordRun: %v", err)
+	}
+
+	page, err := db.History("app", reconcile.HistoryQuery{})
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if page.Total != 3 || len(page.Runs) != 3 {
+		t.Fatalf("expected history to be capped at 3 runs, got %d", page.Total)
+	}
+	for i, want := range []string{"rev4", "rev3", "rev2"} {
+		if page.Runs[i].DesiredRevision != want {
+			t.Errorf("run %d: expected %s (newest first), got %s", i, want, page.Runs[i].DesiredRevision)
+		}
+	}
+	if page.Runs[0].StartedAt.IsZero() {
+		t.Error("expected timestamps to be stored")
+	}
+
+	page, _ = db.History("app", reconcile.HistoryQuery{Offset: 1, Limit: 1})
+	if page.Total != 3 || len(page.Runs) != 1 || page.Runs[0].DesiredRevision != "rev3" {
+		t.Errorf("unexpected page: %+v", page)
+	}
+
+	if page, _ := db.History("other", reconcile.HistoryQuery{Result: "failed"}); page.Total != 1 || page.Runs[0].Error != "boom" {
+		t.Errorf("unexpected history for other: %+v", page)
+	}
+	if page, err := db.History("unknown", reconcile.HistoryQuery{}); err != nil || page.Total != 0 || page.Runs == nil {
+		t.Errorf("expected empty history, got %+v (%v)", page, err)
+	}
+}
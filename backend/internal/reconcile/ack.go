@@ -1,11 +1,22 @@
 package reconcile
 
-import "sync"
+import (
+	"log"
+	"sync"
+)
+
+// AckPersister stores acknowledgements so they survive restarts.
+type AckPersister interface {
+	LoadAcks() ([]string, error)
+	SaveAck(path string) error
+	DeleteAck(path string) error
+}
 
 // AckStore tracks operator acknowledgements for stacks under "flag" drift policy.
 type AckStore struct {
-	mu   sync.RWMutex
-	acks map[string]bool
+	mu        sync.RWMutex
+	acks      map[string]bool
+	persister AckPersister
 }
 
 // NewAckStore creates an empty acknowledgement store.
@@ -15,11 +26,32 @@ func NewAckStore() *AckStore {
 	}
 }
 
+// SetPersister restores the acknowledgements saved by p and saves every
+// later change with it.
+func (a *AckStore) SetPersister(p AckPersister) error {
+	paths, err := p.LoadAcks()
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, path := range paths {
+		a.acks[path] = true
+	}
+	a.persister = p
+	return nil
+}
+
 // Acknowledge records an operator acknowledgement for a stack path.
 func (a *AckStore) Acknowledge(path string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	a.acks[path] = true
+	if a.persister != nil {
+		if err := a.persister.SaveAck(path); err != nil {
+			log.Printf("[warn] failed to persist acknowledgement for stack %s: %v", path, err)
+		}
+	}
 }
 
 // IsAcknowledged returns whether a stack path has been acknowledged.
@@ -33,5 +65,13 @@ func (a *AckStore) IsAcknowledged(path string) bool {
 func (a *AckStore) Clear(path string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
+	if !a.acks[path] {
+		return
+	}
 	delete(a.acks, path)
+	if a.persister != nil {
+		if err := a.persister.DeleteAck(path); err != nil {
+			log.Printf("[warn] failed to delete persisted acknowledgement for stack %s: %v", path, err)
+		}
+	}
 }
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -24,31 +26,128 @@ func NewDockerComposeRunner(runner docker.CommandRunner, socket string) *DockerC
 	return &DockerComposeRunner{Runner: runner, Socket: socket}
 }
 
-// ComposeUp runs docker compose up -d with the given project name and compose file.
-// If overrideFile is not empty, it is included as an additional -f argument.
+// ComposeUp runs docker compose up -d with the given project name and compose files,
+// passed as -f arguments in order. Each env file is passed with --env-file.
+// If overrideFile is not empty, it is included as the last -f argument.
 // workDir sets --project-directory so Docker Compose resolves relative paths correctly.
-func (r *DockerComposeRunner) ComposeUp(ctx context.Context, projectName, composeFile, overrideFile, workDir string) error {
+// opts adds --profile flags, up --pull and --force-recreate. Orphaned
+// containers are removed.
+func (r *DockerComposeRunner) ComposeUp(ctx context.Context, projectName string, composeFiles, envFiles []string, overrideFile, workDir string, opts UpOptions) (string, error) {
 	args := docker.HostArgs(r.Socket)
 	args = append(args, "compose", "-p", projectName)
 	if workDir != "" {
 		args = append(args, "--project-directory", workDir)
 	}
-	args = append(args, "-f", composeFile)
+	for _, envFile := range envFiles {
+		args = append(args, "--env-file", envFile)
+	}
+	for _, composeFile := range composeFiles {
+		args = append(args, "-f", composeFile)
+	}
 	if overrideFile != "" {
 		args = append(args, "-f", overrideFile)
 	}
-	args = append(args, "up", "-d")
+	for _, profile := range opts.Profiles {
+		args = append(args, "--profile", profile)
+	}
+	// Remove containers of services dropped from the compose files, which
+	// runtime drift detection reports as unexpected.
+	args = append(args, "up", "-d", "--remove-orphans")
+	if opts.PullPolicy != "" {
+		args = append(args, "--pull", opts.PullPolicy)
+	}
+	if opts.ForceRecreate {
+		args = append(args, "--force-recreate")
+	}
+
+	out, err := r.Runner.Run(ctx, "docker", args...)
+	if err != nil {
+		return string(out), fmt.Errorf("docker compose up failed: %s: %w", string(out), err)
+	}
+	return string(out), nil
+}
+
+// ComposePull pulls the images of the given compose files with docker compose
+// pull --policy. Services that are built locally are skipped. The returned
+// error carries the registry errors from the output, without pull progress.
+func (r *DockerComposeRunner) ComposePull(ctx context.Context, projectName string, composeFiles, envFiles []string, workDir string, opts UpOptions) (string, error) {
+	args := docker.HostArgs(r.Socket)
+	args = append(args, "compose", "-p", projectName)
+	if workDir != "" {
+		args = append(args, "--project-directory", workDir)
+	}
+	for _, envFile := range envFiles {
+		args = append(args, "--env-file", envFile)
+	}
+	for _, composeFile := range composeFiles {
+		args = append(args, "-f", composeFile)
+	}
+	for _, profile := range opts.Profiles {
+		args = append(args, "--profile", profile)
+	}
+	args = append(args, "pull", "--quiet", "--ignore-buildable")
+	if opts.PullPolicy != "" {
+		args = append(args, "--policy", opts.PullPolicy)
+	}
 
 	out, err := r.Runner.Run(ctx, "docker", args...)
 	if err != nil {
-		return fmt.Errorf("docker compose up failed: %s: %w", string(out), err)
+		if msg := pullErrorLines(string(out)); msg != "" {
+			return string(out), fmt.Errorf("%s: %w", msg, err)
+		}
+		return string(out), err
+	}
+	return string(out), nil
+}
+
+// pullErrorLines returns the error lines of docker compose pull output,
+// e.g. "Error response from daemon: manifest for nginx:nope not found",
+// joined with "; ". Progress lines are dropped.
+func pullErrorLines(out string) string {
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		lower := strings.ToLower(line)
+		if strings.Contains(lower, "error") || strings.Contains(lower, "denied") ||
+			strings.Contains(lower, "not found") || strings.Contains(lower, "unauthorized") {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return strings.TrimSpace(out)
 	}
-	return nil
+	return strings.Join(lines, "; ")
+}
+
+// ComposeConfig renders the effective configuration of the given compose
+// files with docker compose config --format json. Nothing is deployed.
+func (r *DockerComposeRunner) ComposeConfig(ctx context.Context, projectName string, composeFiles, envFiles []string, workDir string, profiles []string) ([]byte, error) {
+	args := docker.HostArgs(r.Socket)
+	args = append(args, "compose", "-p", projectName)
+	if workDir != "" {
+		args = append(args, "--project-directory", workDir)
+	}
+	for _, envFile := range envFiles {
+		args = append(args, "--env-file", envFile)
+	}
+	for _, composeFile := range composeFiles {
+		args = append(args, "-f", composeFile)
+	}
+	for _, profile := range profiles {
+		args = append(args, "--profile", profile)
+	}
+	args = append(args, "config", "--format", "json")
+
+	out, err := r.Runner.Run(ctx, "docker", args...)
+	if err != nil {
+		return nil, fmt.Errorf("docker compose config failed: %s: %w", string(out), err)
+	}
+	return out, nil
 }
 
 // ComposeDown runs docker compose down --remove-orphans for the given project.
 // workDir sets --project-directory so Docker Compose resolves relative paths correctly.
-func (r *DockerComposeRunner) ComposeDown(ctx context.Context, projectName, composeFile, workDir string) error {
+func (r *DockerComposeRunner) ComposeDown(ctx context.Context, projectName, composeFile, workDir string, opts DownOptions) (string, error) {
 	args := docker.HostArgs(r.Socket)
 	args = append(args, "compose", "-p", projectName)
 	if workDir != "" {
@@ -58,12 +157,15 @@ func (r *DockerComposeRunner) ComposeDown(ctx context.Context, projectName, comp
 		args = append(args, "-f", composeFile)
 	}
 	args = append(args, "down", "--remove-orphans")
+	if opts.RemoveVolumes {
+		args = append(args, "-v")
+	}
 
 	out, err := r.Runner.Run(ctx, "docker", args...)
 	if err != nil {
-		return fmt.Errorf("docker compose down failed: %s: %w", string(out), err)
+		return string(out), fmt.Errorf("docker compose down failed: %s: %w", string(out), err)
 	}
-	return nil
+	return string(out), nil
 }
 
 // composePsJSON represents the JSON output of docker compose ps --format json.
@@ -74,6 +176,7 @@ type composePsJSON struct {
 	State      string `json:"State"`
 	Health     string `json:"Health"`
 	Image      string `json:"Image"`
+	ExitCode   int    `json:"ExitCode"`
 	Publishers []struct {
 		URL           string `json:"URL"`
 		TargetPort    int    `json:"TargetPort"`
@@ -126,13 +229,14 @@ func (r *DockerComposeRunner) ComposePs(ctx context.Context, projectName string)
 		}
 
 		containers = append(containers, desiredstate.ContainerInfo{
-			ID:      ps.ID[:12], // short ID
-			Name:    ps.Name,
-			Service: ps.Service,
-			State:   ps.State,
-			Health:  health,
-			Image:   ps.Image,
-			Ports:   strings.Join(ports, ", "),
+			ID:       ps.ID[:12], // short ID
+			Name:     ps.Name,
+			Service:  ps.Service,
+			State:    ps.State,
+			Health:   health,
+			Image:    ps.Image,
+			Ports:    strings.Join(ports, ", "),
+			ExitCode: ps.ExitCode,
 		})
 	}
 
@@ -140,14 +244,21 @@ func (r *DockerComposeRunner) ComposePs(ctx context.Context, projectName string)
 }
 
 // generateLabelOverride creates a docker-compose override YAML that adds
-// sync metadata labels to every service in the stack.
-func generateLabelOverride(stackPath, revision, commitMessage, composeHash string, serviceNames []string) string {
+// sync metadata and owner labels to every service in the stack. extra labels
+// are added as-is.
+func generateLabelOverride(stackPath, revision, commitMessage, composeHash string, serviceNames []string, owner Owner, extra map[string]string) string {
 	now := formatNow()
 
 	if len(serviceNames) == 0 {
 		return ""
 	}
 
+	extraKeys := make([]string, 0, len(extra))
+	for key := range extra {
+		extraKeys = append(extraKeys, key)
+	}
+	sort.Strings(extraKeys)
+
 	var b strings.Builder
 	b.WriteString("services:\n")
 	for _, svc := range serviceNames {
@@ -160,6 +271,11 @@ func generateLabelOverride(stackPath, revision, commitMessage, composeHash strin
 		fmt.Fprintf(&b, "      %s: \"%s\"\n", LabelSyncedAt, now)
 		fmt.Fprintf(&b, "      %s: \"%s\"\n", LabelSyncAt, now)
 		fmt.Fprintf(&b, "      %s: \"synced\"\n", LabelSyncStatus)
+		fmt.Fprintf(&b, "      %s: \"%s\"\n", LabelOwnerInstance, escapeYAMLValue(owner.instanceLabel()))
+		fmt.Fprintf(&b, "      %s: \"%s\"\n", LabelOwnerDeployDir, escapeYAMLValue(deployDirLabel(owner.DeployDir)))
+		for _, key := range extraKeys {
+			fmt.Fprintf(&b, "      %s: \"%s\"\n", key, escapeYAMLValue(extra[key]))
+		}
 	}
 
 	return b.String()
@@ -183,28 +299,77 @@ func generateLabelArgs(stackPath, revision, commitMessage, composeHash string) m
 // override file, returning absolute paths and a cleanup function.
 // This ensures docker compose receives absolute file paths regardless of CWD.
 func writeTempComposeDir(composeFileName string, composeContent []byte, overrideContent string) (composeFile, overrideFile string, cleanup func(), err error) {
+	stackDir, overrideFile, cleanup, err := writeTempStackDir(map[string][]byte{composeFileName: composeContent}, overrideContent)
+	if err != nil {
+		return "", "", cleanup, err
+	}
+	return filepath.Join(stackDir, composeFileName), overrideFile, cleanup, nil
+}
+
+// writeTempStackDir writes the stack's files (keyed by path relative to the
+// stack directory) and the override file into a temp directory, returning the
+// absolute stack directory. Paths may start with "../"; the stack directory is
+// nested deep enough that they stay inside the temp directory.
+func writeTempStackDir(files map[string][]byte, overrideContent string) (stackDir, overrideFile string, cleanup func(), err error) {
 	tmpDir, err := os.MkdirTemp("", "docker-cd-compose-*")
 	if err != nil {
 		return "", "", func() {}, fmt.Errorf("create temp dir: %w", err)
 	}
-
-	composeFile = filepath.Join(tmpDir, composeFileName)
-	if err := os.WriteFile(composeFile, composeContent, 0644); err != nil {
+	cleanup = func() {
 		os.RemoveAll(tmpDir)
-		return "", "", func() {}, fmt.Errorf("write compose file: %w", err)
+	}
+
+	// Nest the stack directory below "files" by the deepest "../" so parent
+	// references resolve inside the temp directory, away from the override.
+	stackDir = filepath.Join(tmpDir, "files")
+	depth := 0
+	for name := range files {
+		d := 0
+		for rest := path.Clean(filepath.ToSlash(name)); strings.HasPrefix(rest, "../"); rest = rest[3:] {
+			d++
+		}
+		depth = max(depth, d)
+	}
+	for range depth {
+		stackDir = filepath.Join(stackDir, "stack")
+	}
+
+	for name, content := range files {
+		dest := filepath.Join(stackDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			cleanup()
+			return "", "", func() {}, fmt.Errorf("create dir for %s: %w", name, err)
+		}
+		if err := os.WriteFile(dest, content, 0644); err != nil {
+			cleanup()
+			return "", "", func() {}, fmt.Errorf("write compose file: %w", err)
+		}
 	}
 
 	overrideFile = filepath.Join(tmpDir, "docker-cd-override.yml")
 	if err := os.WriteFile(overrideFile, []byte(overrideContent), 0644); err != nil {
-		os.RemoveAll(tmpDir)
+		cleanup()
 		return "", "", func() {}, fmt.Errorf("write override file: %w", err)
 	}
 
-	cleanup = func() {
+	return stackDir, overrideFile, cleanup, nil
+}
+
+// writeTempOverride writes the label override into its own temp directory,
+// keeping generated files out of the checked-out stack directory.
+func writeTempOverride(overrideContent string) (overrideFile string, cleanup func(), err error) {
+	tmpDir, err := os.MkdirTemp("", "docker-cd-override-*")
+	if err != nil {
+		return "", func() {}, fmt.Errorf("create temp dir: %w", err)
+	}
+
+	overrideFile = filepath.Join(tmpDir, "docker-cd-override.yml")
+	if err := os.WriteFile(overrideFile, []byte(overrideContent), 0644); err != nil {
 		os.RemoveAll(tmpDir)
+		return "", func() {}, fmt.Errorf("write override file: %w", err)
 	}
 
-	return composeFile, overrideFile, cleanup, nil
+	return overrideFile, func() { os.RemoveAll(tmpDir) }, nil
 }
 
 func formatNow() string {
@@ -0,0 +1,287 @@
+package reconcile
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+)
+
+// stackJob is a sync or removal of one stack, run by runJobs once every job
+// listed in after has succeeded.
+type stackJob struct {
+	path string
+	// after holds stack paths that must finish first. Paths without a job in
+	// the same cycle (e.g. stacks already in sync) only hold the job back
+	// while their stored status is not ready, see heldStacks.
+	after []string
+	run   func() ReconciliationRun
+}
+
+// stackLocks serialises the syncs and removals of each stack, so a manual
+// sync or rollback of a stack waits for a cycle syncing it, but not for
+// cycles busy with other stacks.
+type stackLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock locks the stack at path and returns the function unlocking it.
+func (l *stackLocks) lock(path string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sync.Mutex)
+	}
+	m, ok := l.locks[path]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[path] = m
+	}
+	l.mu.Unlock()
+
+	m.Lock()
+	return m.Unlock
+}
+
+// runJobs runs jobs on at most MaxConcurrency workers in dependency order and
+// returns their runs in job order. Independent stacks run in parallel, so a
+// slow or failing stack only occupies its own worker. Jobs whose dependencies
+// did not succeed, or are held back by heldStacks, are skipped and marked
+// failed.
+// The dependency graph between jobs must be acyclic.
+func (r *Reconciler) runJobs(jobs []stackJob) []ReconciliationRun {
+	if len(jobs) == 0 {
+		return nil
+	}
+	workers := r.policy.MaxConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	index := make(map[string]int, len(jobs))
+	for i, j := range jobs {
+		index[j.path] = i
+	}
+	held := r.heldStacks()
+	waiting := make([]int, len(jobs))
+	dependents := make([][]int, len(jobs))
+	// Only this goroutine touches waiting and failedDep.
+	failedDep := make([]string, len(jobs))
+	for i, j := range jobs {
+		for _, dep := range j.after {
+			if k, ok := index[dep]; ok {
+				waiting[i]++
+				dependents[k] = append(dependents[k], i)
+			} else if held[dep] && failedDep[i] == "" {
+				failedDep[i] = dep
+			}
+		}
+	}
+
+	runs := make([]ReconciliationRun, len(jobs))
+	ready := make(chan int, len(jobs))
+	finished := make(chan int, len(jobs))
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ready {
+				unlock := r.stackLocks.lock(jobs[i].path)
+				runs[i] = jobs[i].run()
+				unlock()
+				finished <- i
+			}
+		}()
+	}
+
+	done := 0
+	var complete, start func(i int)
+	complete = func(i int) {
+		done++
+		for _, d := range dependents[i] {
+			if runs[i].Result != "success" && failedDep[d] == "" {
+				failedDep[d] = jobs[i].path
+			}
+			waiting[d]--
+			if waiting[d] == 0 {
+				start(d)
+			}
+		}
+	}
+	start = func(i int) {
+		if failedDep[i] == "" {
+			ready <- i
+			return
+		}
+		runs[i] = r.skipStack(jobs[i].path, failedDep[i])
+		complete(i)
+	}
+
+	for i := range jobs {
+		if waiting[i] == 0 {
+			start(i)
+		}
+	}
+	for done < len(jobs) {
+		complete(<-finished)
+	}
+	close(ready)
+	wg.Wait()
+	return runs
+}
+
+// heldStacks returns the stacks whose stored status holds their dependents
+// back: failed ones, e.g. waiting for their next retry or a new revision
+// (including failed rollbacks of pinned stacks), and suspended ones.
+func (r *Reconciler) heldStacks() map[string]bool {
+	held := make(map[string]bool)
+	for _, st := range r.store.GetStacks() {
+		switch st.Status {
+		case desiredstate.StackSyncFailed, desiredstate.StackSyncPullFailed, desiredstate.StackSyncSuspended:
+			held[st.Path] = true
+		}
+	}
+	return held
+}
+
+// skipStack records that a stack was not reconciled because a dependency
+// failed or is held back, and schedules a retry of the stack so it follows
+// once the dependency recovers.
+func (r *Reconciler) skipStack(path, dependency string) ReconciliationRun {
+	reason := fmt.Sprintf("skipped: dependency %s was not reconciled", dependency)
+	log.Printf("[warn] stack %s %s", path, reason)
+	r.stateManager.UpdateStatus(path, desiredstate.StackSyncFailed, "", truncateError(reason))
+	now := time.Now()
+	run := ReconciliationRun{
+		StackPath:  path,
+		StartedAt:  now,
+		FinishedAt: now,
+		Result:     "skipped",
+		Error:      reason,
+	}
+	if st := findStack(r.store.Get(), path); st != nil {
+		run.DesiredHash = st.ComposeHash
+		attempts, next := r.retries.failed(path, st.ComposeHash)
+		r.stateManager.SetRetry(path, attempts, next)
+	}
+	return run
+}
+
+// desiredDependencies maps every desired stack to the stacks it depends on.
+// Every desired stack is a key, so a missing key means an unknown stack.
+func desiredDependencies(snap *desiredstate.Snapshot) map[string][]string {
+	deps := make(map[string][]string, len(snap.Stacks))
+	for _, st := range snap.Stacks {
+		deps[st.Path] = st.DependsOn
+	}
+	return deps
+}
+
+// removalDependencies returns, for every stack being removed, the removed
+// stacks that depended on it at deploy time and so must be removed first.
+func removalDependencies(drifts []DriftResult, runtime map[string]StackSyncMetadata) map[string][]string {
+	removing := make(map[string]bool)
+	for _, d := range drifts {
+		if d.NeedRemove {
+			removing[d.Path] = true
+		}
+	}
+
+	after := make(map[string][]string)
+	for path := range removing {
+		for _, dep := range runtime[path].DependsOn {
+			if removing[dep] {
+				after[dep] = append(after[dep], path)
+			}
+		}
+	}
+
+	// Runtime labels can come from different revisions; never let a stale
+	// cycle block removal, just drop the ordering between its members.
+	for path := range findCycles(after) {
+		log.Printf("[warn] removal of stack %s is part of a dependency cycle, ignoring its order", path)
+		delete(after, path)
+	}
+	return after
+}
+
+// dependencyError explains why a stack's dependencies cannot be satisfied, or
+// returns "" if they can.
+func dependencyError(path string, deps map[string][]string, cycles map[string]string) string {
+	if cycle, ok := cycles[path]; ok {
+		return "dependency cycle: " + cycle
+	}
+	for _, dep := range deps[path] {
+		if _, ok := deps[dep]; !ok {
+			return fmt.Sprintf("unknown dependency %q", dep)
+		}
+		if _, ok := cycles[dep]; ok {
+			return fmt.Sprintf("dependency %s is part of a dependency cycle", dep)
+		}
+	}
+	return ""
+}
+
+// findCycles returns every node of deps that lies on a cycle, mapped to a
+// description of that cycle (e.g. "a -> b -> a"). Edges to nodes that are not
+// keys of deps are ignored.
+func findCycles(deps map[string][]string) map[string]string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(deps))
+	cycles := make(map[string]string)
+	var stack []string
+
+	var visit func(n string)
+	visit = func(n string) {
+		state[n] = visiting
+		stack = append(stack, n)
+		for _, d := range deps[n] {
+			if _, ok := deps[d]; !ok {
+				continue
+			}
+			switch state[d] {
+			case visiting:
+				start := len(stack) - 1
+				for stack[start] != d {
+					start--
+				}
+				members := stack[start:]
+				desc := strings.Join(append(append([]string{}, members...), d), " -> ")
+				for _, m := range members {
+					if _, ok := cycles[m]; !ok {
+						cycles[m] = desc
+					}
+				}
+			case unvisited:
+				visit(d)
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[n] = visited
+	}
+
+	nodes := make([]string, 0, len(deps))
+	for n := range deps {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+	for _, n := range nodes {
+		if state[n] == unvisited {
+			visit(n)
+		}
+	}
+	return cycles
+}
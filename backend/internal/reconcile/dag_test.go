@@ -0,0 +1,231 @@
+package reconcile_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+// orderComposeRunner records the order of compose up/down calls and fails
+// the projects listed in fail.
+type orderComposeRunner struct {
+	stubComposeRunner
+	mu    sync.Mutex
+	order []string
+	fail  map[string]bool
+}
+
+func (o *orderComposeRunner) record(op, project string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.order = append(o.order, op+":"+project)
+	if o.fail[project] {
+		return fmt.Errorf("%s failed", project)
+	}
+	return nil
+}
+
+func (o *orderComposeRunner) ComposeUp(_ context.Context, projectName string, _, _ []string, _, _ string, _ reconcile.UpOptions) (string, error) {
+	return "", o.record("up", projectName)
+}
+
+func (o *orderComposeRunner) ComposeDown(_ context.Context, projectName, _, _ string, _ reconcile.DownOptions) (string, error) {
+	return "", o.record("down", projectName)
+}
+
+func (o *orderComposeRunner) position(entry string) int {
+	for i, e := range o.order {
+		if e == entry {
+			return i
+		}
+	}
+	return -1
+}
+
+func dependentStacks(deps map[string][]string) []desiredstate.StackRecord {
+	content := []byte("services:\n  web:\n    image: nginx\n")
+	var stacks []desiredstate.StackRecord
+	for _, path := range []string{"app", "postgres", "traefik", "worker"} {
+		d, ok := deps[path]
+		if !ok && deps != nil {
+			continue
+		}
+		stacks = append(stacks, desiredstate.StackRecord{
+			Path: path, ComposeFile: "docker-compose.yml", ComposeHash: "h-" + path,
+			Status: desiredstate.StackSyncMissing, Content: content, DependsOn: d,
+		})
+	}
+	return stacks
+}
+
+func newDependencyReconciler(store *desiredstate.Store, compose reconcile.ComposeRunner, runtime map[string]reconcile.StackSyncMetadata, concurrency int) *reconcile.Reconciler {
+	policy := reconcile.DefaultPolicy()
+	policy.MaxConcurrency = concurrency
+	policy.RemoveEnabled = true
+	inspector := &stubInspector{labels: runtime}
+	return reconcile.NewReconciler(store, policy, compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+}
+
+func TestReconcile_Dependencies_TopologicalOrder(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		t.Run(fmt.Sprintf("concurrency=%d", concurrency), func(t *testing.T) {
+			store := desiredstate.NewStore()
+			store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: dependentStacks(map[string][]string{
+				"app":      {"postgres", "traefik"},
+				"postgres": nil,
+				"traefik":  nil,
+				"worker":   {"app"},
+			})})
+
+			compose := &orderComposeRunner{}
+			r := newDependencyReconciler(store, compose, map[string]reconcile.StackSyncMetadata{}, concurrency)
+			runs := r.Reconcile(context.Background())
+
+			if len(runs) != 4 {
+				t.Fatalf("expected 4 runs, got %d", len(runs))
+			}
+			for _, pair := range [][2]string{{"postgres", "app"}, {"traefik", "app"}, {"app", "worker"}} {
+				if compose.position("up:"+pair[0]) > compose.position("up:"+pair[1]) {
+					t.Errorf("expected %s before %s, got order %v", pair[0], pair[1], compose.order)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcile_Dependencies_SkipDependentsOnFailure(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: dependentStacks(map[string][]string{
+		"app":      {"postgres"},
+		"postgres": nil,
+		"traefik":  nil,
+		"worker":   {"app"},
+	})})
+
+	compose := &orderComposeRunner{fail: map[string]bool{"postgres": true}}
+	r := newDependencyReconciler(store, compose, map[string]reconcile.StackSyncMetadata{}, 2)
+	runs := r.Reconcile(context.Background())
+
+	results := make(map[string]string)
+	for _, run := range runs {
+		results[run.StackPath] = run.Result
+	}
+	want := map[string]string{"postgres": "failed", "app": "skipped", "worker": "skipped", "traefik": "success"}
+	for path, result := range want {
+		if results[path] != result {
+			t.Errorf("stack %s: expected %s, got %q", path, result, results[path])
+		}
+	}
+	if compose.position("up:app") != -1 || compose.position("up:worker") != -1 {
+		t.Errorf("dependents must not be deployed, got order %v", compose.order)
+	}
+	for _, st := range store.GetStacks() {
+		if st.Path == "app" && !strings.Contains(st.LastSyncError, "postgres") {
+			t.Errorf("expected app error to name postgres, got %q", st.LastSyncError)
+		}
+	}
+}
+
+func TestReconcile_Dependencies_HeldByStoredStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		setup func(r *reconcile.Reconciler, store *desiredstate.Store) error
+	}{
+		{"failed health check", func(_ *reconcile.Reconciler, store *desiredstate.Store) error {
+			store.UpdateStack("postgres", func(st *desiredstate.StackRecord) {
+				st.Status = desiredstate.StackSyncFailed
+				st.FailedComposeHash = st.ComposeHash
+			})
+			return nil
+		}},
+		{"suspended", func(r *reconcile.Reconciler, _ *desiredstate.Store) error {
+			_, err := r.Suspend("postgres", "", "", time.Time{})
+			return err
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stacks := dependentStacks(map[string][]string{"app": {"postgres"}, "postgres": nil})
+			store := desiredstate.NewStore()
+			compose := &orderComposeRunner{}
+			// postgres runs an older revision and has no job in the cycle.
+			r := newDependencyReconciler(store, compose, map[string]reconcile.StackSyncMetadata{
+				"postgres": {StackPath: "postgres", DesiredRevision: "rev0", DesiredComposeHash: "h-old"},
+			}, 1)
+			store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: stacks})
+			if err := tc.setup(r, store); err != nil {
+				t.Fatalf("setup: %v", err)
+			}
+
+			runs := r.Reconcile(context.Background())
+			if len(runs) != 1 || runs[0].StackPath != "app" || runs[0].Result != "skipped" {
+				t.Fatalf("expected app to be skipped, got %+v", runs)
+			}
+			if len(compose.order) != 0 {
+				t.Errorf("expected nothing deployed, got %v", compose.order)
+			}
+			for _, st := range store.GetStacks() {
+				if st.Path == "app" && (st.SyncAttempts != 1 || st.NextRetryAt == "" || !strings.Contains(st.LastSyncError, "postgres")) {
+					t.Errorf("expected a retry of app held back by postgres, got %+v", st)
+				}
+			}
+			if _, ok := reconcile.TestNextRetry(r); !ok {
+				t.Error("expected the retry loop to be scheduled")
+			}
+		})
+	}
+}
+
+func TestReconcile_Dependencies_CycleAndUnknown(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: dependentStacks(map[string][]string{
+		"app":      {"worker"},
+		"worker":   {"app"},
+		"postgres": {"mysql"},
+		"traefik":  nil,
+	})})
+
+	compose := &orderComposeRunner{}
+	r := newDependencyReconciler(store, compose, map[string]reconcile.StackSyncMetadata{}, 1)
+	r.Reconcile(context.Background())
+
+	if strings.Join(compose.order, ",") != "up:traefik" {
+		t.Errorf("expected only traefik to deploy, got %v", compose.order)
+	}
+	errs := make(map[string]string)
+	for _, st := range store.GetStacks() {
+		errs[st.Path] = st.LastSyncError
+	}
+	if !strings.Contains(errs["app"], "dependency cycle") || !strings.Contains(errs["worker"], "dependency cycle") {
+		t.Errorf("expected cycle errors, got %v", errs)
+	}
+	if !strings.Contains(errs["postgres"], `unknown dependency "mysql"`) {
+		t.Errorf("expected unknown dependency error, got %q", errs["postgres"])
+	}
+}
+
+func TestReconcile_Dependencies_RemoveInReverseOrder(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: []desiredstate.StackRecord{}})
+
+	runtime := map[string]reconcile.StackSyncMetadata{
+		"app":      {StackPath: "app", DesiredRevision: "r", DesiredComposeHash: "h", DependsOn: []string{"postgres"}},
+		"postgres": {StackPath: "postgres", DesiredRevision: "r", DesiredComposeHash: "h"},
+		"worker":   {StackPath: "worker", DesiredRevision: "r", DesiredComposeHash: "h", DependsOn: []string{"app"}},
+	}
+
+	for i := 0; i < 5; i++ {
+		compose := &orderComposeRunner{}
+		r := newDependencyReconciler(store, compose, runtime, 3)
+		r.Reconcile(context.Background())
+
+		if got := strings.Join(compose.order, ","); got != "down:worker,down:app,down:postgres" {
+			t.Fatalf("expected dependents removed first, got %s", got)
+		}
+	}
+}
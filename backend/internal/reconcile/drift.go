@@ -10,15 +10,16 @@ import (
 
 // DriftDetector compares desired state against runtime state to detect configuration drift.
 type DriftDetector struct {
-	logger    *slog.Logger
-	deployDir string
+	logger *slog.Logger
+	owner  Owner
 }
 
-// NewDriftDetector creates a new drift detector.
-func NewDriftDetector(deployDir string, logger *slog.Logger) *DriftDetector {
+// NewDriftDetector creates a new drift detector. Runtime stacks not owned by
+// owner are ignored.
+func NewDriftDetector(owner Owner, logger *slog.Logger) *DriftDetector {
 	return &DriftDetector{
-		deployDir: deployDir,
-		logger:    logger,
+		owner:  owner,
+		logger: logger,
 	}
 }
 
@@ -28,6 +29,9 @@ type DriftResult struct {
 	NeedSync   bool
 	NeedRemove bool
 	Reason     string
+	// Reasons lists the divergences found: a changed compose hash, or those
+	// found by runtime drift detection.
+	Reasons []desiredstate.DriftReason
 }
 
 // DetectChanges compares desired state against runtime labels and returns drift results.
@@ -39,16 +43,25 @@ func (d *DriftDetector) DetectChanges(
 ) []DriftResult {
 	var results []DriftResult
 
+	// Stacks deployed by another instance or from another deploy dir are
+	// neither synced over nor removed.
+	owned := make(map[string]StackSyncMetadata, len(runtime))
+	for path, rt := range runtime {
+		if !d.owner.Owns(rt) {
+			d.logger.DebugContext(ctx, "ignoring runtime stack owned by another instance",
+				"stack_path", path,
+				"instance", rt.OwnerInstance,
+				"deploy_dir", rt.OwnerDeployDir)
+			continue
+		}
+		owned[path] = rt
+	}
+
 	desiredPaths := make(map[string]bool)
 	for _, stk := range desired {
 		desiredPaths[stk.Path] = true
 
-		// Filter by deploy scope
-		if d.deployDir != "" && !isInDeployScope(stk.Path, d.deployDir) {
-			continue
-		}
-
-		rt, exists := runtime[stk.Path]
+		rt, exists := owned[stk.Path]
 		if !exists {
 			d.logger.DebugContext(ctx, "stack has no runtime metadata",
 				"stack_path", stk.Path)
@@ -80,6 +93,11 @@ func (d *DriftDetector) DetectChanges(
 				Path:     stk.Path,
 				NeedSync: true,
 				Reason:   fmt.Sprintf("compose hash drift: runtime=%s desired=%s", rt.DesiredComposeHash, stk.ComposeHash),
+				Reasons: []desiredstate.DriftReason{{
+					Kind:     desiredstate.DriftComposeHash,
+					Expected: stk.ComposeHash,
+					Actual:   rt.DesiredComposeHash,
+				}},
 			})
 			continue
 		}
@@ -92,22 +110,19 @@ func (d *DriftDetector) DetectChanges(
 		})
 	}
 
-	// Check for stacks that exist in runtime but not in desired state
-	if removeEnabled {
-		for path := range runtime {
-			if !desiredPaths[path] {
-				if d.deployDir != "" && !isInDeployScope(path, d.deployDir) {
-					continue
-				}
-				d.logger.InfoContext(ctx, "stack exists in runtime but not in desired state",
-					"stack_path", path)
-				results = append(results, DriftResult{
-					Path:       path,
-					NeedRemove: true,
-					Reason:     "not in desired state",
-				})
-			}
+	// Check for stacks that exist in runtime but not in desired state. A remove
+	// setting stamped on the containers overrides removeEnabled.
+	for path, rt := range owned {
+		if desiredPaths[path] || !rt.removeAllowed(removeEnabled) {
+			continue
 		}
+		d.logger.InfoContext(ctx, "stack exists in runtime but not in desired state",
+			"stack_path", path)
+		results = append(results, DriftResult{
+			Path:       path,
+			NeedRemove: true,
+			Reason:     "not in desired state",
+		})
 	}
 
 	return results
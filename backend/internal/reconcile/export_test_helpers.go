@@ -1,9 +1,11 @@
 package reconcile
 
+import "time"
+
 // TestGenerateLabelOverride is an exported wrapper around generateLabelOverride
 // for use in integration tests.
 func TestGenerateLabelOverride(stackPath, revision, commitMessage, composeHash string, serviceNames []string) string {
-	return generateLabelOverride(stackPath, revision, commitMessage, composeHash, serviceNames)
+	return generateLabelOverride(stackPath, revision, commitMessage, composeHash, serviceNames, Owner{}, nil)
 }
 
 // TestWriteTempComposeDir is an exported wrapper around writeTempComposeDir
@@ -18,6 +20,12 @@ func TestExtractServiceNames(content []byte) []string {
 	return extractServiceNames(content)
 }
 
+// TestNextRetry returns the earliest retry scheduled by r, or false if none
+// is pending.
+func TestNextRetry(r *Reconciler) (time.Time, bool) {
+	return r.retries.next()
+}
+
 // LabelDesiredCommitMessage re-exports the label key for integration tests.
 const LabelDesiredCommitMessageKey = LabelDesiredCommitMessage
 
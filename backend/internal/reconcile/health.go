@@ -0,0 +1,92 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+)
+
+const (
+	// defaultHealthCheckInterval is how often the health gate polls compose ps.
+	defaultHealthCheckInterval = 2 * time.Second
+	// healthyChecksRequired consecutive healthy polls pass the gate, so a
+	// container caught between restarts of a crash loop does not.
+	healthyChecksRequired = 2
+)
+
+// waitHealthy polls the project's containers until all of them are healthy for
+// healthyChecksRequired consecutive polls, a container fails for good, or
+// timeout elapses.
+func (r *Reconciler) waitHealthy(ctx context.Context, projectName string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	interval := r.healthInterval
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	pending := "no containers reported yet"
+	healthyChecks := 0
+	for {
+		containers, err := r.compose.ComposePs(ctx, projectName)
+		if err == nil {
+			healthy, reason, fatal := checkHealth(containers)
+			if fatal {
+				return errors.New(reason)
+			}
+			if healthy {
+				healthyChecks++
+				if healthyChecks >= healthyChecksRequired {
+					return nil
+				}
+			} else {
+				healthyChecks = 0
+				pending = reason
+			}
+		} else {
+			healthyChecks = 0
+			pending = err.Error()
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("not healthy after %s: %s", timeout, pending)
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkHealth reports whether every container is up and healthy. Containers
+// that exited with code 0 (e.g. one-shot init jobs) count as healthy. fatal is
+// true when waiting longer cannot help, e.g. a container exited with an error.
+func checkHealth(containers []desiredstate.ContainerInfo) (healthy bool, reason string, fatal bool) {
+	if len(containers) == 0 {
+		return false, "no containers running", false
+	}
+	for _, c := range containers {
+		switch c.State {
+		case "running":
+			switch c.Health {
+			case "unhealthy":
+				return false, fmt.Sprintf("container %s is unhealthy", c.Name), false
+			case "starting":
+				return false, fmt.Sprintf("container %s health check is starting", c.Name), false
+			}
+		case "exited":
+			if c.ExitCode != 0 {
+				return false, fmt.Sprintf("container %s exited with code %d", c.Name, c.ExitCode), true
+			}
+		case "dead":
+			return false, fmt.Sprintf("container %s is dead", c.Name), true
+		default:
+			return false, fmt.Sprintf("container %s is %s", c.Name, c.State), false
+		}
+	}
+	return true, "", false
+}
@@ -0,0 +1,143 @@
+package reconcile_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+// healthComposeRunner reports the given containers from compose ps.
+type healthComposeRunner struct {
+	stubComposeRunner
+	containers []desiredstate.ContainerInfo
+}
+
+func (h *healthComposeRunner) ComposePs(_ context.Context, _ string) ([]desiredstate.ContainerInfo, error) {
+	return h.containers, nil
+}
+
+type stubStackLoader struct {
+	stack desiredstate.StackRecord
+	err   error
+	calls []string
+}
+
+func (s *stubStackLoader) LoadStack(_ context.Context, revision, stackPath string) (desiredstate.StackRecord, error) {
+	s.calls = append(s.calls, revision+"|"+stackPath)
+	return s.stack, s.err
+}
+
+func newHealthGatedReconciler(store *desiredstate.Store, compose reconcile.ComposeRunner, runtime map[string]reconcile.StackSyncMetadata, loader reconcile.StackLoader) *reconcile.Reconciler {
+	policy := reconcile.DefaultPolicy()
+	policy.HealthTimeout = 200 * time.Millisecond
+	r := reconcile.NewReconciler(store, policy, compose, &stubInspector{labels: runtime}, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	r.SetHealthCheckInterval(10 * time.Millisecond)
+	if loader != nil {
+		r.SetStackLoader(loader)
+	}
+	return r
+}
+
+func healthGateSnapshot() *desiredstate.Snapshot {
+	return &desiredstate.Snapshot{
+		Revision: "rev2",
+		Stacks: []desiredstate.StackRecord{
+			{Path: "app1", ComposeFile: "docker-compose.yml", ComposeHash: "hash2", Status: desiredstate.StackSyncMissing,
+				Content: []byte("services:\n  web:\n    image: nginx:2\n")},
+		},
+	}
+}
+
+func TestReconcile_HealthGate_Healthy(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(healthGateSnapshot())
+
+	compose := &healthComposeRunner{containers: []desiredstate.ContainerInfo{
+		{Name: "app1-web-1", State: "running", Health: "healthy"},
+		{Name: "app1-init-1", State: "exited", ExitCode: 0},
+	}}
+	r := newHealthGatedReconciler(store, compose, map[string]reconcile.StackSyncMetadata{}, nil)
+	runs := r.Reconcile(context.Background())
+
+	if len(runs) != 1 || runs[0].Result != "success" {
+		t.Fatalf("expected a successful run, got %+v", runs)
+	}
+	if st := store.GetStacks()[0]; st.Status != desiredstate.StackSyncSynced {
+		t.Errorf("expected synced, got %s", st.Status)
+	}
+}
+
+func TestReconcile_HealthGate_RollsBack(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(healthGateSnapshot())
+
+	compose := &healthComposeRunner{containers: []desiredstate.ContainerInfo{
+		{Name: "app1-web-1", State: "exited", ExitCode: 1},
+	}}
+	runtime := map[string]reconcile.StackSyncMetadata{
+		"app1": {StackPath: "app1", DesiredRevision: "rev1", DesiredComposeHash: "hash1", DesiredCommitMessage: "v1"},
+	}
+	loader := &stubStackLoader{stack: desiredstate.StackRecord{
+		Path: "app1", ComposeFile: "docker-compose.yml", ComposeHash: "hash1",
+		Content: []byte("services:\n  web:\n    image: nginx:1\n"),
+	}}
+	r := newHealthGatedReconciler(store, compose, runtime, loader)
+	runs := r.Reconcile(context.Background())
+
+	if len(runs) != 1 || runs[0].Result != "failed" {
+		t.Fatalf("expected a failed run, got %+v", runs)
+	}
+	if !strings.Contains(runs[0].Error, "exited with code 1") || !strings.Contains(runs[0].Error, "rolled back to rev1") {
+		t.Errorf("expected failure and rollback in error, got %q", runs[0].Error)
+	}
+	if len(loader.calls) != 1 || loader.calls[0] != "rev1|app1" {
+		t.Errorf("expected last known good revision to be loaded, got %v", loader.calls)
+	}
+	if len(compose.upCalls) != 2 {
+		t.Fatalf("expected deploy and rollback compose up calls, got %d", len(compose.upCalls))
+	}
+
+	st := store.GetStacks()[0]
+	if st.Status != desiredstate.StackSyncFailed || st.SyncedRevision != "rev1" || st.SyncedComposeHash != "hash1" {
+		t.Errorf("expected failed stack synced at rev1, got %+v", st)
+	}
+	if st.FailedComposeHash != "hash2" || st.RolledBackTo != "rev1" || st.RolledBackAt == "" {
+		t.Errorf("expected rollback to be recorded, got %+v", st)
+	}
+
+	// The failed configuration is not retried until the desired state changes.
+	runs = r.Reconcile(context.Background())
+	if len(runs) != 0 || len(compose.upCalls) != 2 {
+		t.Errorf("expected failed hash not to be redeployed, got %d runs", len(runs))
+	}
+}
+
+func TestReconcile_HealthGate_NoPreviousRevision(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(healthGateSnapshot())
+
+	compose := &healthComposeRunner{containers: []desiredstate.ContainerInfo{
+		{Name: "app1-web-1", State: "restarting"},
+	}}
+	loader := &stubStackLoader{err: fmt.Errorf("must not be called")}
+	r := newHealthGatedReconciler(store, compose, map[string]reconcile.StackSyncMetadata{}, loader)
+	runs := r.Reconcile(context.Background())
+
+	if len(runs) != 1 || runs[0].Result != "failed" {
+		t.Fatalf("expected a failed run, got %+v", runs)
+	}
+	if !strings.Contains(runs[0].Error, "not healthy after") || !strings.Contains(runs[0].Error, "no previous revision") {
+		t.Errorf("unexpected error %q", runs[0].Error)
+	}
+	if len(loader.calls) != 0 || len(compose.upCalls) != 1 {
+		t.Errorf("expected no rollback, got loader calls %v and %d compose up calls", loader.calls, len(compose.upCalls))
+	}
+	if st := store.GetStacks()[0]; st.Status != desiredstate.StackSyncFailed || st.FailedComposeHash != "hash2" {
+		t.Errorf("expected failed stack with failed hash, got %+v", st)
+	}
+}
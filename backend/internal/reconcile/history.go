@@ -0,0 +1,191 @@
+package reconcile
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+)
+
+// Trigger sources of runs started outside a Git refresh. Runs after a
+// refresh record the refresh source: startup, webhook, manual or periodic.
+const (
+	TriggerAck         = "ack"
+	TriggerRetry       = "retry"
+	TriggerDockerEvent = "docker_event"
+	TriggerImageUpdate = "image_update"
+)
+
+// DefaultHistoryLimit is the number of runs kept per stack.
+const DefaultHistoryLimit = 50
+
+// maxRunOutput caps the compose output kept per run. The end is kept,
+// since that is where compose reports errors.
+const maxRunOutput = 64 << 10
+
+type triggerKey struct{}
+
+// WithTrigger returns a context whose reconciliation runs are recorded as
+// started by trigger.
+func WithTrigger(ctx context.Context, trigger string) context.Context {
+	return context.WithValue(ctx, triggerKey{}, trigger)
+}
+
+func triggerFrom(ctx context.Context) string {
+	trigger, _ := ctx.Value(triggerKey{}).(string)
+	return trigger
+}
+
+// HistoryQuery selects a page of a stack's history.
+type HistoryQuery struct {
+	// Result limits the runs to one result, e.g. "failed". Empty matches all.
+	Result string
+	Offset int
+	// Limit is the page size; 0 returns all runs from Offset.
+	Limit int
+}
+
+// HistoryPage is a page of a stack's runs, newest first.
+type HistoryPage struct {
+	Runs []ReconciliationRun `json:"runs"`
+	// Total is the number of runs matching the query across all pages.
+	Total int `json:"total"`
+}
+
+// Apply filters runs (newest first) and returns the requested page.
+func (q HistoryQuery) Apply(runs []ReconciliationRun) HistoryPage {
+	page := HistoryPage{Runs: []ReconciliationRun{}}
+	for _, run := range runs {
+		if q.Result != "" && run.Result != q.Result {
+			continue
+		}
+		if page.Total >= q.Offset && (q.Limit <= 0 || len(page.Runs) < q.Limit) {
+			page.Runs = append(page.Runs, run)
+		}
+		page.Total++
+	}
+	return page
+}
+
+// HistoryStore records finished reconciliation runs per stack.
+type HistoryStore interface {
+	RecordRun(run ReconciliationRun) error
+	History(stackPath string, q HistoryQuery) (HistoryPage, error)
+}
+
+// MemoryHistory keeps the last runs of each stack in memory. It is used
+// when no data dir is configured, so history is lost on restart.
+type MemoryHistory struct {
+	mu    sync.RWMutex
+	limit int
+	runs  map[string][]ReconciliationRun // oldest first
+}
+
+// NewMemoryHistory creates a history keeping at most limit runs per stack
+// (DefaultHistoryLimit if not positive).
+func NewMemoryHistory(limit int) *MemoryHistory {
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	return &MemoryHistory{limit: limit, runs: make(map[string][]ReconciliationRun)}
+}
+
+// RecordRun appends run to its stack's history, dropping the oldest runs
+// beyond the limit.
+func (h *MemoryHistory) RecordRun(run ReconciliationRun) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs := append(h.runs[run.StackPath], run)
+	if len(runs) > h.limit {
+		runs = append([]ReconciliationRun(nil), runs[len(runs)-h.limit:]...)
+	}
+	h.runs[run.StackPath] = runs
+	return nil
+}
+
+// History returns a page of a stack's runs, newest first.
+func (h *MemoryHistory) History(stackPath string, q HistoryQuery) (HistoryPage, error) {
+	h.mu.RLock()
+	stored := h.runs[stackPath]
+	runs := make([]ReconciliationRun, len(stored))
+	for i, run := range stored {
+		runs[len(stored)-1-i] = run
+	}
+	h.mu.RUnlock()
+	return q.Apply(runs), nil
+}
+
+// SetHistory sets where finished syncs and removals are recorded.
+func (r *Reconciler) SetHistory(h HistoryStore) {
+	r.history = h
+}
+
+// SetBroadcaster sets the SSE broadcaster that streams recorded runs.
+func (r *Reconciler) SetBroadcaster(b *desiredstate.Broadcaster) {
+	r.broadcaster = b
+}
+
+// History returns a page of a stack's recorded runs, newest first.
+// Unfinished manual syncs are listed before them.
+func (r *Reconciler) History(stackPath string, q HistoryQuery) (HistoryPage, error) {
+	pending := q.Apply(r.pendingRuns(stackPath))
+	if pending.Total == 0 {
+		return r.recordedHistory(stackPath, q)
+	}
+	if q.Offset >= pending.Total {
+		q.Offset -= pending.Total
+		page, err := r.recordedHistory(stackPath, q)
+		page.Total += pending.Total
+		return page, err
+	}
+	q.Offset = 0
+	if q.Limit > 0 {
+		q.Limit -= len(pending.Runs)
+		if q.Limit == 0 {
+			// The page is full; only the total of recorded runs is needed.
+			page, err := r.recordedHistory(stackPath, HistoryQuery{Result: q.Result, Limit: 1})
+			return HistoryPage{Runs: pending.Runs, Total: page.Total + pending.Total}, err
+		}
+	}
+	page, err := r.recordedHistory(stackPath, q)
+	page.Runs = append(pending.Runs, page.Runs...)
+	page.Total += pending.Total
+	return page, err
+}
+
+func (r *Reconciler) recordedHistory(stackPath string, q HistoryQuery) (HistoryPage, error) {
+	if r.history == nil {
+		return q.Apply(nil), nil
+	}
+	return r.history.History(stackPath, q)
+}
+
+// recordHistory completes runs with their trigger and duration, stores those
+// that synced or removed a stack and streams them to SSE clients. Skipped
+// runs changed nothing and are not kept, unless they are manual syncs whose
+// outcome was requested.
+func (r *Reconciler) recordHistory(ctx context.Context, runs []ReconciliationRun) {
+	for i := range runs {
+		run := &runs[i]
+		if run.Result == "skipped" && run.ID == "" {
+			continue
+		}
+		if run.Trigger == "" {
+			run.Trigger = triggerFrom(ctx)
+		}
+		run.DurationMs = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+		if len(run.Output) > maxRunOutput {
+			run.Output = "..." + run.Output[len(run.Output)-maxRunOutput:]
+		}
+
+		if r.history != nil {
+			if err := r.history.RecordRun(*run); err != nil {
+				log.Printf("[warn] failed to record history for stack %s: %v", run.StackPath, err)
+			}
+		}
+		if r.broadcaster != nil {
+			r.broadcaster.PublishStackHistory(run.StackPath, *run)
+		}
+	}
+}
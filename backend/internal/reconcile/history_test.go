@@ -0,0 +1,108 @@
+package reconcile_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+func TestReconcile_RecordsHistory(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", CommitMessage: "bump nginx", Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h1", Status: desiredstate.StackSyncMissing, Content: []byte("services:\n  web:\n    image: nginx\n")},
+	}})
+	// "gone" was deleted from Git but removal is disabled, so its run is skipped.
+	inspector := &stubInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"gone": {StackPath: "gone", DesiredComposeHash: "old"},
+	}}
+	compose := &stubComposeRunner{upOutput: " Container app-web-1  Started\n"}
+	r := reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	history := reconcile.NewMemoryHistory(0)
+	r.SetHistory(history)
+	broadcaster := desiredstate.NewBroadcaster()
+	sub := broadcaster.Subscribe()
+	defer broadcaster.Unsubscribe(sub)
+	r.SetBroadcaster(broadcaster)
+
+	r.Reconcile(reconcile.WithTrigger(context.Background(), "webhook"))
+
+	page, err := r.History("app", reconcile.HistoryQuery{})
+	if err != nil || page.Total != 1 {
+		t.Fatalf("expected one run for app, got %+v (%v)", page, err)
+	}
+	run := page.Runs[0]
+	if run.Result != "success" || run.Trigger != "webhook" || run.DesiredRevision != "rev1" || run.CommitMessage != "bump nginx" || run.DesiredHash != "h1" {
+		t.Errorf("unexpected run %+v", run)
+	}
+	if run.Output != "Container app-web-1  Started" {
+		t.Errorf("expected compose output, got %q", run.Output)
+	}
+	if page, _ := r.History("gone", reconcile.HistoryQuery{}); page.Total != 0 {
+		t.Errorf("expected skipped runs not to be recorded, got %+v", page.Runs)
+	}
+
+	select {
+	case ev := <-sub.Events:
+		var payload struct {
+			StackPath string                      `json:"stackPath"`
+			Run       reconcile.ReconciliationRun `json:"run"`
+		}
+		if err := json.Unmarshal([]byte(ev.Data), &payload); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		if ev.Type != desiredstate.EventStackHistory || payload.StackPath != "app" || payload.Run.Trigger != "webhook" {
+			t.Errorf("unexpected event %s %s", ev.Type, ev.Data)
+		}
+	default:
+		t.Error("expected the run to be streamed")
+	}
+}
+
+func TestReconcile_RecordsFailureOutput(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h1", Status: desiredstate.StackSyncMissing, Content: []byte("services:\n  web:\n    image: nginx\n")},
+	}})
+	compose := &stubComposeRunner{upOutput: "Error response from daemon: port is already allocated", upErr: fmt.Errorf("exit status 1")}
+	r := reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, &stubInspector{labels: map[string]reconcile.StackSyncMetadata{}}, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	r.SetHistory(reconcile.NewMemoryHistory(0))
+
+	r.Reconcile(context.Background())
+
+	page, _ := r.History("app", reconcile.HistoryQuery{Result: "failed"})
+	if page.Total != 1 {
+		t.Fatalf("expected one failed run, got %+v", page)
+	}
+	if run := page.Runs[0]; !strings.Contains(run.Error, "exit status 1") || !strings.Contains(run.Output, "port is already allocated") {
+		t.Errorf("expected error and output to be recorded, got %+v", run)
+	}
+}
+
+func TestMemoryHistory(t *testing.T) {
+	h := reconcile.NewMemoryHistory(3)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, result := range []string{"success", "failed", "success", "failed", "success"} {
+		h.RecordRun(reconcile.ReconciliationRun{StackPath: "app", DesiredRevision: fmt.Sprintf("rev%d", i), StartedAt: start.Add(time.Duration(i) * time.Minute), Result: result})
+	}
+
+	page, _ := h.History("app", reconcile.HistoryQuery{})
+	if page.Total != 3 || page.Runs[0].DesiredRevision != "rev4" || page.Runs[2].DesiredRevision != "rev2" {
+		t.Errorf("expected the last 3 runs newest first, got %+v", page.Runs)
+	}
+
+	page, _ = h.History("app", reconcile.HistoryQuery{Result: "success", Offset: 1, Limit: 1})
+	if page.Total != 2 || len(page.Runs) != 1 || page.Runs[0].DesiredRevision != "rev2" {
+		t.Errorf("unexpected filtered page %+v", page)
+	}
+
+	page, _ = h.History("app", reconcile.HistoryQuery{Offset: 5})
+	if page.Total != 3 || page.Runs == nil || len(page.Runs) != 0 {
+		t.Errorf("expected an empty page past the end, got %+v", page)
+	}
+}
@@ -0,0 +1,241 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/registry"
+)
+
+// DefaultImageCheckInterval is how often the image watcher checks registries.
+const DefaultImageCheckInterval = time.Hour
+
+// DigestResolver resolves an image reference to its current registry digest.
+type DigestResolver interface {
+	Resolve(ctx context.Context, image string) (string, error)
+}
+
+// ImageDigestReader reads the registry digests recorded for a local image.
+type ImageDigestReader interface {
+	ImageRepoDigests(ctx context.Context, image string) ([]string, error)
+}
+
+// imageUpdateRank orders the image update levels; a tag is updated when the
+// level it floats at ranks at most the stack's allowed level.
+var imageUpdateRank = map[string]int{
+	desiredstate.ImageUpdateDigest: 1,
+	desiredstate.ImageUpdatePatch:  2,
+	desiredstate.ImageUpdateMinor:  3,
+	desiredstate.ImageUpdateMajor:  4,
+}
+
+// ImageWatcher periodically resolves the image tags of opted-in stacks to
+// registry digests and redeploys a stack with fresh pulls when a running
+// container's image no longer matches its tag, e.g. a new nginx:1.27 patch
+// release. Stacks opt in with image_updates in their settings file.
+type ImageWatcher struct {
+	resolver   DigestResolver
+	images     ImageDigestReader
+	reconciler *Reconciler
+	interval   time.Duration
+}
+
+// NewImageWatcher creates a watcher that checks stacks every interval.
+func NewImageWatcher(resolver DigestResolver, images ImageDigestReader, reconciler *Reconciler, interval time.Duration) *ImageWatcher {
+	if interval <= 0 {
+		interval = DefaultImageCheckInterval
+	}
+	return &ImageWatcher{
+		resolver:   resolver,
+		images:     images,
+		reconciler: reconciler,
+		interval:   interval,
+	}
+}
+
+// Run checks stacks every interval until ctx is cancelled.
+func (w *ImageWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check(ctx)
+		}
+	}
+}
+
+// Check runs one pass over all synced, opted-in stacks and updates those with
+// newer images. Stacks that are out of sync with Git are left to the
+// reconciler: their next sync deploys the configured images anyway.
+func (w *ImageWatcher) Check(ctx context.Context) []ReconciliationRun {
+	r := w.reconciler
+	ctx = WithTrigger(ctx, TriggerImageUpdate)
+	snap := r.store.Get()
+	if snap == nil {
+		return nil
+	}
+	runtime, err := r.inspector.GetStackLabels(ctx)
+	if err != nil {
+		log.Printf("[error] image updates: failed to inspect runtime state: %v", err)
+		return nil
+	}
+
+	c := &imageCheck{watcher: w, digests: make(map[string]string), local: make(map[string][]string)}
+	var runs []ReconciliationRun
+	for _, stack := range snap.Stacks {
+		policy := r.policy.ForStack(stack.Settings)
+		if policy.ImageUpdates == "" || policy.Suspended || stack.Status != desiredstate.StackSyncSynced {
+			continue
+		}
+		// Image updates restart containers, so they wait for a sync window.
+		if closed, _ := windowClosed(policy, ""); closed {
+			continue
+		}
+		rt, ok := runtime[stack.Path]
+		if !ok || rt.DesiredComposeHash != stack.ComposeHash {
+			continue
+		}
+		outdated := c.outdatedImages(ctx, stack.Path, policy.ImageUpdates, rt.Containers)
+		if len(outdated) == 0 {
+			continue
+		}
+		log.Printf("[info] stack %s has newer images available: %s", stack.Path, strings.Join(outdated, ", "))
+		runs = append(runs, r.UpdateImages(ctx, stack.Path, outdated))
+	}
+	return runs
+}
+
+// imageCheck caches registry and local lookups for one Check pass, so images
+// shared between services and stacks are resolved once.
+type imageCheck struct {
+	watcher *ImageWatcher
+	digests map[string]string   // image reference → registry digest, "" on error
+	local   map[string][]string // image ID → repo digests
+}
+
+// outdatedImages returns the image references of containers whose registry
+// digest changed, limited to tags allowed by level.
+func (c *imageCheck) outdatedImages(ctx context.Context, stackPath, level string, containers []RuntimeContainer) []string {
+	seen := make(map[string]bool)
+	var outdated []string
+	for _, ct := range containers {
+		if ct.Image == "" || ct.ImageID == "" || seen[ct.Image] {
+			continue
+		}
+		tagLevel, ok := imageTagLevel(ct.Image)
+		if !ok || imageUpdateRank[tagLevel] > imageUpdateRank[level] {
+			continue
+		}
+
+		digest, ok := c.digests[ct.Image]
+		if !ok {
+			var err error
+			if digest, err = c.watcher.resolver.Resolve(ctx, ct.Image); err != nil {
+				log.Printf("[warn] image updates: stack %s: %v", stackPath, err)
+			}
+			c.digests[ct.Image] = digest
+		}
+		repoDigests, ok := c.local[ct.ImageID]
+		if !ok {
+			var err error
+			if repoDigests, err = c.watcher.images.ImageRepoDigests(ctx, ct.ImageID); err != nil {
+				log.Printf("[warn] image updates: stack %s: %v", stackPath, err)
+			}
+			c.local[ct.ImageID] = repoDigests
+		}
+		// Images built locally have no repo digests and are never updated.
+		if digest == "" || len(repoDigests) == 0 {
+			continue
+		}
+
+		seen[ct.Image] = true
+		if !hasRepoDigest(repoDigests, digest) {
+			outdated = append(outdated, ct.Image)
+		}
+	}
+	return outdated
+}
+
+// hasRepoDigest reports whether any repo digest (name@sha256:...) has digest.
+func hasRepoDigest(repoDigests []string, digest string) bool {
+	for _, rd := range repoDigests {
+		if strings.HasSuffix(rd, "@"+digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// imageTagLevel returns the update level a tag floats at: a full version
+// (1.27.3) only changes with rebuilds, 1.27 follows patch releases, 1 follows
+// minor releases and any other tag (latest) follows major releases. A leading
+// v and a variant suffix (1.27-alpine) are ignored. Images pinned by digest
+// never change and report false.
+func imageTagLevel(image string) (string, bool) {
+	ref, err := registry.ParseReference(image)
+	if err != nil || ref.Digest != "" {
+		return "", false
+	}
+	version := strings.TrimPrefix(ref.Tag, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	parts := strings.Split(version, ".")
+	for _, p := range parts {
+		if _, err := strconv.Atoi(p); err != nil {
+			return desiredstate.ImageUpdateMajor, true
+		}
+	}
+	switch len(parts) {
+	case 1:
+		return desiredstate.ImageUpdateMinor, true
+	case 2:
+		return desiredstate.ImageUpdatePatch, true
+	}
+	return desiredstate.ImageUpdateDigest, true
+}
+
+// UpdateImages redeploys a synced stack at its current revision with
+// compose up --pull always, so containers are recreated from newer images.
+func (r *Reconciler) UpdateImages(ctx context.Context, path string, images []string) ReconciliationRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	unlock := r.stackLocks.lock(path)
+	defer unlock()
+
+	now := time.Now()
+	run := ReconciliationRun{StackPath: path, StartedAt: now, FinishedAt: now, Result: "skipped"}
+	snap := r.store.Get()
+	stack := findStack(snap, path)
+	if !r.policy.Enabled || stack == nil || stack.Status != desiredstate.StackSyncSynced {
+		return run
+	}
+	run.DesiredRevision = snap.Revision
+	run.DesiredHash = stack.ComposeHash
+	if r.policy.DryRun {
+		log.Printf("[info] dry-run: would pull and recreate stack %s for %s", path, strings.Join(images, ", "))
+		return run
+	}
+
+	runtime, err := r.inspector.GetStackLabels(ctx)
+	if err != nil {
+		run.Result = "failed"
+		run.Error = fmt.Sprintf("inspect runtime state: %v", err)
+		return run
+	}
+
+	policy := r.policy.ForStack(stack.Settings)
+	policy.PullPolicy = desiredstate.PullPolicyAlways
+	drift := DriftResult{Path: path, NeedSync: true, Reason: "newer image(s) " + strings.Join(images, ", ")}
+	runs := []ReconciliationRun{r.syncStack(ctx, drift, snap, policy, runtime[path])}
+	r.recordHistory(ctx, runs)
+	return runs[0]
+}
@@ -0,0 +1,119 @@
+package reconcile_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+// stubRegistry resolves image references from a fixed map.
+type stubRegistry struct {
+	digests  map[string]string
+	resolved []string
+}
+
+func (s *stubRegistry) Resolve(_ context.Context, image string) (string, error) {
+	s.resolved = append(s.resolved, image)
+	if d, ok := s.digests[image]; ok {
+		return d, nil
+	}
+	return "", errors.New("manifest unknown")
+}
+
+// stubImages returns the repo digests of local images by ID.
+type stubImages map[string][]string
+
+func (s stubImages) ImageRepoDigests(_ context.Context, image string) ([]string, error) {
+	return s[image], nil
+}
+
+func TestImageWatcher_UpdatesOutdatedStacks(t *testing.T) {
+	content := []byte("services:\n  app:\n    image: app\n")
+	stack := func(path, level string) desiredstate.StackRecord {
+		return desiredstate.StackRecord{
+			Path: path, ComposeFile: "docker-compose.yml", ComposeHash: "h-" + path, Content: content,
+			Status: desiredstate.StackSyncSynced, Settings: &desiredstate.StackSettings{ImageUpdates: level},
+		}
+	}
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: []desiredstate.StackRecord{
+		stack("web", desiredstate.ImageUpdatePatch),
+		stack("db", desiredstate.ImageUpdatePatch),
+		stack("cache", ""),
+		stack("api", desiredstate.ImageUpdateMajor),
+	}})
+
+	runtime := func(path string, containers ...reconcile.RuntimeContainer) reconcile.StackSyncMetadata {
+		return reconcile.StackSyncMetadata{StackPath: path, DesiredRevision: "rev1", DesiredComposeHash: "h-" + path, Containers: containers}
+	}
+	inspector := &stubInspector{labels: map[string]reconcile.StackSyncMetadata{
+		// A new 1.27 patch release is out.
+		"web": runtime("web",
+			reconcile.RuntimeContainer{Service: "web", Image: "nginx:1.27", ImageID: "sha256:nginx-old"},
+			reconcile.RuntimeContainer{Service: "web", Image: "nginx:1.27", ImageID: "sha256:nginx-old"}),
+		// postgres:16 follows minor releases, beyond the allowed patch level;
+		// locally built images are never updated.
+		"db": runtime("db",
+			reconcile.RuntimeContainer{Service: "db", Image: "postgres:16", ImageID: "sha256:pg-old"},
+			reconcile.RuntimeContainer{Service: "tools", Image: "db-tools", ImageID: "sha256:local"}),
+		// Not opted in.
+		"cache": runtime("cache", reconcile.RuntimeContainer{Service: "cache", Image: "redis:latest", ImageID: "sha256:redis-old"}),
+		// Up to date.
+		"api": runtime("api", reconcile.RuntimeContainer{Service: "api", Image: "localhost:5000/api", ImageID: "sha256:api"}),
+	}}
+	resolver := &stubRegistry{digests: map[string]string{
+		"nginx:1.27":         "sha256:2222",
+		"postgres:16":        "sha256:3333",
+		"redis:latest":       "sha256:4444",
+		"localhost:5000/api": "sha256:5555",
+	}}
+	images := stubImages{
+		"sha256:nginx-old": {"nginx@sha256:1111"},
+		"sha256:pg-old":    {"postgres@sha256:0000"},
+		"sha256:redis-old": {"redis@sha256:0000"},
+		"sha256:api":       {"localhost:5000/api@sha256:5555"},
+	}
+
+	compose := &stubComposeRunner{}
+	r := reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	runs := reconcile.NewImageWatcher(resolver, images, r, 0).Check(context.Background())
+
+	if len(runs) != 1 || runs[0].StackPath != "web" || runs[0].Result != "success" {
+		t.Fatalf("expected only web to be updated, got %+v", runs)
+	}
+	if len(compose.upCalls) != 1 || compose.upCalls[0].ProjectName != "web" || compose.upCalls[0].Options.PullPolicy != desiredstate.PullPolicyAlways {
+		t.Errorf("expected compose up --pull always for web, got %+v", compose.upCalls)
+	}
+	for _, image := range resolver.resolved {
+		if image == "redis:latest" || image == "postgres:16" {
+			t.Errorf("%s is not eligible for updates and must not be resolved", image)
+		}
+	}
+	if st := store.GetStacks()[0]; st.Status != desiredstate.StackSyncSynced || st.SyncedRevision != "rev1" {
+		t.Errorf("expected web to stay synced at rev1, got %s at %s", st.Status, st.SyncedRevision)
+	}
+}
+
+func TestImageWatcher_SkipsStacksOutOfSync(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: []desiredstate.StackRecord{{
+		Path: "web", ComposeFile: "docker-compose.yml", ComposeHash: "new", Content: []byte("services:\n  web:\n    image: nginx:1.27\n"),
+		Status: desiredstate.StackSyncSynced, Settings: &desiredstate.StackSettings{ImageUpdates: desiredstate.ImageUpdateMajor},
+	}}})
+	inspector := &stubInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"web": {StackPath: "web", DesiredComposeHash: "old", Containers: []reconcile.RuntimeContainer{{Service: "web", Image: "nginx:1.27", ImageID: "sha256:old"}}},
+	}}
+	resolver := &stubRegistry{digests: map[string]string{"nginx:1.27": "sha256:2222"}}
+
+	compose := &stubComposeRunner{}
+	r := reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	if runs := reconcile.NewImageWatcher(resolver, stubImages{"sha256:old": {"nginx@sha256:1111"}}, r, 0).Check(context.Background()); len(runs) != 0 {
+		t.Errorf("stacks awaiting a sync must be left to the reconciler, got %+v", runs)
+	}
+	if len(resolver.resolved) != 0 {
+		t.Errorf("expected no registry lookups, got %v", resolver.resolved)
+	}
+}
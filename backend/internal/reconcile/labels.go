@@ -10,6 +10,16 @@ const (
 	LabelSyncAt               = "com.docker-cd.sync.at"
 	LabelSyncStatus           = "com.docker-cd.sync.status"
 	LabelSyncError            = "com.docker-cd.sync.error"
+	// LabelPolicyRemove records an explicit per-stack remove setting ("true" or
+	// "false"), since the settings file is gone once the stack is deleted from Git.
+	LabelPolicyRemove = "com.docker-cd.policy.remove"
+	// LabelDependsOn records the comma-separated stacks the stack depends on,
+	// so removals can run in reverse dependency order.
+	LabelDependsOn = "com.docker-cd.depends_on"
+	// LabelOwnerInstance and LabelOwnerDeployDir record the instance ID and
+	// Git deploy dir of the instance that deployed the stack (see Owner).
+	LabelOwnerInstance  = "com.docker-cd.owner.instance"
+	LabelOwnerDeployDir = "com.docker-cd.owner.deploy_dir"
 )
 
 // AllLabelKeys returns the full list of label keys used by docker-cd.
@@ -23,5 +33,9 @@ func AllLabelKeys() []string {
 		LabelSyncAt,
 		LabelSyncStatus,
 		LabelSyncError,
+		LabelPolicyRemove,
+		LabelDependsOn,
+		LabelOwnerInstance,
+		LabelOwnerDeployDir,
 	}
 }
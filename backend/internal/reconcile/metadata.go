@@ -2,22 +2,30 @@ package reconcile
 
 import (
 	"context"
+	"strings"
 
 	"github.com/lucasreiners/docker-cd/internal/docker"
 )
 
-// DockerContainerInspector implements ContainerInspector using the Docker CLI.
+// DockerContainerInspector implements ContainerInspector using a Docker engine
+// client (CLI or Engine API).
 type DockerContainerInspector struct {
-	Client *docker.Client
+	Client docker.Engine
+	// Owner filters the containers: those owned by another instance or
+	// deploy dir are ignored. The zero value is the default instance
+	// deploying from the repository root.
+	Owner Owner
 }
 
 // NewDockerContainerInspector creates an inspector that reads container labels.
-func NewDockerContainerInspector(client *docker.Client) *DockerContainerInspector {
+func NewDockerContainerInspector(client docker.Engine) *DockerContainerInspector {
 	return &DockerContainerInspector{Client: client}
 }
 
-// GetStackLabels lists all containers with docker-cd labels and groups them by stack path.
-// For each stack path, it returns the sync metadata from the first container found.
+// GetStackLabels lists all containers with docker-cd labels owned by d.Owner
+// and groups them by stack path. For each stack path, it returns the sync
+// metadata from the first container found and the runtime details of all of
+// the stack's containers.
 func (d *DockerContainerInspector) GetStackLabels(ctx context.Context) (map[string]StackSyncMetadata, error) {
 	containers, err := d.Client.ListContainersWithLabel(ctx, LabelStackPath)
 	if err != nil {
@@ -28,12 +36,26 @@ func (d *DockerContainerInspector) GetStackLabels(ctx context.Context) (map[stri
 
 	for _, c := range containers {
 		stackPath := c.Labels[LabelStackPath]
-		if stackPath == "" {
+		if stackPath == "" || !d.Owner.Owns(MapLabelsToMetadata(c.Labels)) {
 			continue
 		}
 
+		container := RuntimeContainer{
+			Name:          c.ContainerName,
+			Service:       c.Labels[LabelComposeService],
+			Image:         c.Image,
+			ImageID:       c.ImageID,
+			State:         c.State,
+			ExitCode:      c.ExitCode,
+			RestartPolicy: c.RestartPolicy,
+			Env:           c.Env,
+			Ports:         c.Ports,
+		}
+
 		// Use the first container's labels for a stack path
-		if _, exists := result[stackPath]; exists {
+		if meta, exists := result[stackPath]; exists {
+			meta.Containers = append(meta.Containers, container)
+			result[stackPath] = meta
 			continue
 		}
 
@@ -46,6 +68,12 @@ func (d *DockerContainerInspector) GetStackLabels(ctx context.Context) (map[stri
 			LastSyncAt:           c.Labels[LabelSyncAt],
 			SyncStatus:           c.Labels[LabelSyncStatus],
 			SyncError:            c.Labels[LabelSyncError],
+			RemovePolicy:         c.Labels[LabelPolicyRemove],
+			DependsOn:            splitLabelList(c.Labels[LabelDependsOn]),
+			OwnerInstance:        c.Labels[LabelOwnerInstance],
+			OwnerDeployDir:       c.Labels[LabelOwnerDeployDir],
+			ProjectName:          c.Labels[LabelComposeProject],
+			Containers:           []RuntimeContainer{container},
 		}
 	}
 
@@ -63,5 +91,18 @@ func MapLabelsToMetadata(labels map[string]string) StackSyncMetadata {
 		LastSyncAt:           labels[LabelSyncAt],
 		SyncStatus:           labels[LabelSyncStatus],
 		SyncError:            labels[LabelSyncError],
+		RemovePolicy:         labels[LabelPolicyRemove],
+		DependsOn:            splitLabelList(labels[LabelDependsOn]),
+		OwnerInstance:        labels[LabelOwnerInstance],
+		OwnerDeployDir:       labels[LabelOwnerDeployDir],
+		ProjectName:          labels[LabelComposeProject],
+	}
+}
+
+// splitLabelList splits a comma-separated label value, returning nil for "".
+func splitLabelList(v string) []string {
+	if v == "" {
+		return nil
 	}
+	return strings.Split(v, ",")
 }
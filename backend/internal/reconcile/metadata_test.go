@@ -1,6 +1,7 @@
 package reconcile_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/lucasreiners/docker-cd/internal/reconcile"
@@ -92,3 +93,72 @@ func TestMapLabelsToMetadata_GroupsByStack(t *testing.T) {
 		t.Errorf("app2 hash: got %q, want %q", result["app2"].DesiredComposeHash, "hash2")
 	}
 }
+
+func TestOwner_Owns(t *testing.T) {
+	owner := reconcile.Owner{InstanceID: "blue", DeployDir: "apps/"}
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{"same owner", map[string]string{reconcile.LabelOwnerInstance: "blue", reconcile.LabelOwnerDeployDir: "/apps"}, true},
+		{"other instance", map[string]string{reconcile.LabelOwnerInstance: "green", reconcile.LabelOwnerDeployDir: "/apps"}, false},
+		{"other deploy dir", map[string]string{reconcile.LabelOwnerInstance: "blue", reconcile.LabelOwnerDeployDir: "/"}, false},
+		{"unlabeled", map[string]string{}, false},
+	}
+	for _, tt := range tests {
+		if got := owner.Owns(reconcile.MapLabelsToMetadata(tt.labels)); got != tt.want {
+			t.Errorf("%s: Owns = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// The default instance is stamped as "default", so it does not own
+	// containers that only carry a stack path, such as a compose project
+	// started by hand. Unlabeled stacks are only adopted on request, and only
+	// if their compose project is the one the instance would deploy.
+	defaultOwner := reconcile.Owner{DeployDir: "apps"}
+	adopting := reconcile.Owner{DeployDir: "apps", AdoptUnlabeled: true}
+	tests = []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{"default instance", map[string]string{reconcile.LabelStackPath: "web", reconcile.LabelOwnerInstance: "default", reconcile.LabelOwnerDeployDir: "/apps"}, true},
+		{"empty instance label", map[string]string{reconcile.LabelStackPath: "web", reconcile.LabelOwnerInstance: "", reconcile.LabelOwnerDeployDir: "/apps"}, false},
+		{"stack path only", map[string]string{reconcile.LabelStackPath: "web"}, false},
+		{"unlabeled project", map[string]string{reconcile.LabelStackPath: "web", reconcile.LabelComposeProject: "web"}, false},
+	}
+	for _, tt := range tests {
+		if got := defaultOwner.Owns(reconcile.MapLabelsToMetadata(tt.labels)); got != tt.want {
+			t.Errorf("%s: Owns = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	tests = []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{"stack path only", map[string]string{reconcile.LabelStackPath: "web"}, false},
+		{"matching project", map[string]string{reconcile.LabelStackPath: "apps/web", reconcile.LabelComposeProject: "apps-web"}, true},
+		{"other project", map[string]string{reconcile.LabelStackPath: "apps/web", reconcile.LabelComposeProject: "myapp"}, false},
+		{"other instance", map[string]string{reconcile.LabelStackPath: "apps/web", reconcile.LabelComposeProject: "apps-web", reconcile.LabelOwnerInstance: "green", reconcile.LabelOwnerDeployDir: "/apps"}, false},
+	}
+	for _, tt := range tests {
+		if got := adopting.Owns(reconcile.MapLabelsToMetadata(tt.labels)); got != tt.want {
+			t.Errorf("adopting, %s: Owns = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateLabelOverride_StampsOwner(t *testing.T) {
+	override := reconcile.TestGenerateLabelOverride("app", "rev1", "deploy", "hash1", []string{"web"})
+	for _, want := range []string{
+		reconcile.LabelOwnerInstance + `: "default"`,
+		reconcile.LabelOwnerDeployDir + `: "/"`,
+	} {
+		if !strings.Contains(override, want) {
+			t.Errorf("expected override to contain %q, got:\n%s", want, override)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package reconcile
+
+import "strings"
+
+// DefaultInstanceID is stamped as the owner instance of the stacks deployed
+// by the instance without an ID, so its containers can be told apart from
+// containers without owner labels.
+const DefaultInstanceID = "default"
+
+// Owner identifies the docker-cd instance that manages a set of stacks. It is
+// stamped on every container the instance deploys, so several instances can
+// share a Docker host without adopting or removing each other's stacks.
+type Owner struct {
+	// InstanceID tells apart instances on the same host; empty for the
+	// default instance, which is stamped as DefaultInstanceID.
+	InstanceID string
+	// DeployDir is the Git deploy dir the instance reads its stacks from.
+	DeployDir string
+	// ProjectPrefix prefixes the compose project names of the instance's
+	// stacks.
+	ProjectPrefix string
+	// AdoptUnlabeled adopts stacks deployed before the owner labels were
+	// stamped, if their compose project is the one the instance would deploy
+	// them as.
+	AdoptUnlabeled bool
+}
+
+// Owns reports whether o manages the runtime stack described by m: it was
+// deployed by the instance with o's ID from o's deploy dir. Containers
+// without owner labels, such as compose projects started by hand, are only
+// owned when adopted (see AdoptUnlabeled).
+func (o Owner) Owns(m StackSyncMetadata) bool {
+	if m.OwnerInstance == "" {
+		return o.AdoptUnlabeled && m.ProjectName != "" && m.ProjectName == deriveProjectName(o.ProjectPrefix, m.StackPath)
+	}
+	return m.OwnerInstance == o.instanceLabel() && isInDeployScope(m, o.DeployDir)
+}
+
+// instanceLabel is the value of LabelOwnerInstance for o.
+func (o Owner) instanceLabel() string {
+	if o.InstanceID == "" {
+		return DefaultInstanceID
+	}
+	return o.InstanceID
+}
+
+// deployDirLabel is the value of LabelOwnerDeployDir for deployDir. It always
+// starts with a slash, so the repository root ("/") can be told apart from a
+// missing label.
+func deployDirLabel(deployDir string) string {
+	return "/" + strings.Trim(deployDir, "/")
+}
@@ -0,0 +1,116 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+)
+
+// Trigger sources of manual pin operations.
+const (
+	TriggerRollback = "rollback"
+	TriggerUnpin    = "unpin"
+)
+
+var (
+	// ErrStackNotFound is returned for operations on a stack that is not in
+	// the desired state.
+	ErrStackNotFound = errors.New("stack not found in desired state")
+	// ErrReconcileDisabled is returned for manual deployments while
+	// reconciliation is disabled or in dry-run mode.
+	ErrReconcileDisabled = errors.New("reconciliation is disabled or in dry-run mode")
+	// ErrRevisionUnavailable is returned when a stack cannot be loaded at the
+	// requested revision.
+	ErrRevisionUnavailable = errors.New("revision unavailable")
+)
+
+// Rollback deploys a stack as of an earlier revision (a commit SHA from its
+// history) and pins it there: the reconciler leaves pinned stacks alone until
+// they are unpinned or a newer commit changes them in Git. Like a manual
+// sync, it waits only for syncs of the same stack.
+func (r *Reconciler) Rollback(ctx context.Context, path, revision string) (ReconciliationRun, error) {
+	unlock := r.stackLocks.lock(path)
+	defer unlock()
+
+	if !r.policy.Enabled || r.policy.DryRun {
+		return ReconciliationRun{}, ErrReconcileDisabled
+	}
+	if findStack(r.store.Get(), path) == nil {
+		return ReconciliationRun{}, ErrStackNotFound
+	}
+	if r.loader == nil {
+		return ReconciliationRun{}, fmt.Errorf("%w: no stack loader configured", ErrRevisionUnavailable)
+	}
+	target, err := r.loader.LoadStack(ctx, revision, path)
+	if err != nil {
+		return ReconciliationRun{}, fmt.Errorf("%w: %v", ErrRevisionUnavailable, err)
+	}
+
+	run := ReconciliationRun{
+		StackPath:       path,
+		Trigger:         TriggerRollback,
+		DesiredRevision: revision,
+		CommitMessage:   r.historyCommitMessage(path, revision),
+		DesiredHash:     target.ComposeHash,
+		StartedAt:       time.Now(),
+	}
+	log.Printf("[info] rolling back stack %s to %s", path, shortRevision(revision))
+	r.stateManager.UpdateStatus(path, desiredstate.StackSyncSyncing, "", "")
+
+	projectName := deriveProjectName(r.projectNamePrefix(), path)
+	output, err := r.deploy(ctx, projectName, revision, run.CommitMessage, &target, r.policy.ForStack(target.Settings))
+	run.Output = output
+	run.FinishedAt = time.Now()
+	if err != nil {
+		run.Result = "failed"
+		run.Error = err.Error()
+		log.Printf("[error] rollback of stack %s to %s failed: %v", path, shortRevision(revision), err)
+		r.stateManager.UpdateStatus(path, desiredstate.StackSyncFailed, "", truncateError(run.Error))
+	} else {
+		run.Result = "success"
+		log.Printf("[info] stack %s pinned to %s", path, shortRevision(revision))
+		r.stateManager.MarkPinned(path, revision, run.CommitMessage, target.ComposeHash)
+		if r.retries.succeeded(path) {
+			r.stateManager.SetRetry(path, 0, time.Time{})
+		}
+	}
+	r.stateManager.UpdateContainerCounts(ctx, path, projectName)
+
+	runs := []ReconciliationRun{run}
+	r.recordHistory(ctx, runs)
+	return runs[0], nil
+}
+
+// Unpin releases a pinned stack and syncs it back to the desired state. The
+// returned runs are those of the sync, empty if nothing had to change.
+func (r *Reconciler) Unpin(ctx context.Context, path string) ([]ReconciliationRun, error) {
+	stack := findStack(r.store.Get(), path)
+	if stack == nil {
+		return nil, ErrStackNotFound
+	}
+	if stack.PinnedRevision == "" {
+		return nil, nil
+	}
+	log.Printf("[info] unpinning stack %s from %s", path, shortRevision(stack.PinnedRevision))
+	r.stateManager.Unpin(path)
+	return r.CheckStacks(WithTrigger(ctx, TriggerUnpin), []string{path}), nil
+}
+
+// historyCommitMessage returns the commit message recorded for revision in
+// the stack's history, or "".
+func (r *Reconciler) historyCommitMessage(path, revision string) string {
+	page, err := r.History(path, HistoryQuery{})
+	if err != nil {
+		return ""
+	}
+	for _, run := range page.Runs {
+		if run.DesiredRevision == revision && run.CommitMessage != "" {
+			return run.CommitMessage
+		}
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+package reconcile_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+func newPinReconciler(store *desiredstate.Store, compose reconcile.ComposeRunner, inspector reconcile.ContainerInspector, loader reconcile.StackLoader) *reconcile.Reconciler {
+	r := reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	r.SetStackLoader(loader)
+	r.SetHistory(reconcile.NewMemoryHistory(0))
+	return r
+}
+
+func TestRollback_PinsUntilUnpinned(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h2", Status: desiredstate.StackSyncSynced, Content: []byte("services:\n  web:\n    image: nginx:2\n")},
+	}})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"app": {StackPath: "app", DesiredRevision: "rev2", DesiredComposeHash: "h2"},
+	}}
+	loader := &stubStackLoader{stack: desiredstate.StackRecord{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h1", Content: []byte("services:\n  web:\n    image: nginx:1\n")}}
+	compose := &stubComposeRunner{}
+	r := newPinReconciler(store, compose, inspector, loader)
+
+	run, err := r.Rollback(context.Background(), "app", "rev1")
+	if err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if run.Result != "success" || run.Trigger != reconcile.TriggerRollback || run.DesiredRevision != "rev1" || run.DesiredHash != "h1" {
+		t.Errorf("unexpected run %+v", run)
+	}
+	if len(loader.calls) != 1 || loader.calls[0] != "rev1|app" || len(compose.upCalls) != 1 {
+		t.Fatalf("expected rev1 to be loaded and deployed, got loads %v and %d up calls", loader.calls, len(compose.upCalls))
+	}
+	st := store.Get().Stacks[0]
+	if st.Status != desiredstate.StackSyncPinned || st.PinnedRevision != "rev1" || st.SyncedComposeHash != "h1" {
+		t.Errorf("expected stack pinned to rev1, got %+v", st)
+	}
+	if page, _ := r.History("app", reconcile.HistoryQuery{}); page.Total != 1 {
+		t.Errorf("expected the rollback in the history, got %+v", page)
+	}
+
+	// The runtime now runs rev1; the reconciler must not revert it.
+	inspector.labels["app"] = reconcile.StackSyncMetadata{StackPath: "app", DesiredRevision: "rev1", DesiredComposeHash: "h1"}
+	r.Reconcile(context.Background())
+	if len(compose.upCalls) != 1 {
+		t.Errorf("expected pinned stack to be left alone, got %d up calls", len(compose.upCalls))
+	}
+	if plan, _ := r.Plan(context.Background()); plan.Stacks[0].Blocked != "pinned to rev1" {
+		t.Errorf("expected plan to report the pin, got %+v", plan.Stacks[0])
+	}
+
+	runs, err := r.Unpin(context.Background(), "app")
+	if err != nil {
+		t.Fatalf("Unpin: %v", err)
+	}
+	if len(runs) != 1 || runs[0].Result != "success" || runs[0].Trigger != reconcile.TriggerUnpin || len(compose.upCalls) != 2 {
+		t.Errorf("expected unpin to sync the stack back to rev2, got %+v", runs)
+	}
+	if st := store.Get().Stacks[0]; st.PinnedRevision != "" || st.Status != desiredstate.StackSyncSynced || st.SyncedRevision != "rev2" {
+		t.Errorf("expected stack synced to rev2, got %+v", st)
+	}
+}
+
+func TestRollback_NotBlockedByOtherStack(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: []desiredstate.StackRecord{
+		{Path: "slow", ComposeFile: "docker-compose.yml", ComposeHash: "s2", Content: []byte("services:\n  web:\n    image: nginx:2\n")},
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h2", Content: []byte("services:\n  web:\n    image: nginx:2\n")},
+	}})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"slow": {StackPath: "slow", DesiredRevision: "rev1", DesiredComposeHash: "s1"},
+		"app":  {StackPath: "app", DesiredRevision: "rev1", DesiredComposeHash: "h1"},
+	}}
+	loader := &stubStackLoader{stack: desiredstate.StackRecord{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h1", Content: []byte("services:\n  web:\n    image: nginx:1\n")}}
+	compose := &gatedComposeRunner{started: make(chan struct{}), release: make(chan struct{})}
+	policy := reconcile.DefaultPolicy()
+	policy.MaxConcurrency = 1
+	r := reconcile.NewReconciler(store, policy, compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	r.SetStackLoader(loader)
+	r.SetHistory(reconcile.NewMemoryHistory(0))
+
+	cycle := make(chan []reconcile.ReconciliationRun)
+	go func() { cycle <- r.Reconcile(context.Background()) }()
+	<-compose.started
+
+	// The cycle is stuck deploying slow, with app queued behind it; a
+	// rollback of app still runs.
+	done := make(chan reconcile.ReconciliationRun)
+	go func() {
+		run, err := r.Rollback(context.Background(), "app", "rev1")
+		if err != nil {
+			t.Errorf("Rollback: %v", err)
+		}
+		done <- run
+	}()
+	select {
+	case run := <-done:
+		if run.Result != "success" {
+			t.Errorf("expected rollback to succeed while slow is syncing, got %+v", run)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("rollback waited for a cycle busy with another stack")
+	}
+
+	// The cycle planned app's sync before the rollback; it must not undo the pin.
+	close(compose.release)
+	for _, run := range <-cycle {
+		if run.StackPath == "app" && run.Result != "skipped" {
+			t.Errorf("expected the cycle to skip the pinned stack, got %+v", run)
+		}
+	}
+	if st := store.Get().Stacks[1]; st.PinnedRevision != "rev1" || st.SyncedComposeHash != "h1" {
+		t.Errorf("expected app to stay pinned to rev1, got %+v", st)
+	}
+}
+
+func TestRollback_Errors(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h2", Status: desiredstate.StackSyncSynced},
+	}})
+	compose := &stubComposeRunner{}
+	loader := &stubStackLoader{err: errors.New("reference not found")}
+	r := newPinReconciler(store, compose, &dynamicInspector{}, loader)
+
+	if _, err := r.Rollback(context.Background(), "other", "rev1"); !errors.Is(err, reconcile.ErrStackNotFound) {
+		t.Errorf("expected ErrStackNotFound, got %v", err)
+	}
+	if _, err := r.Rollback(context.Background(), "app", "nope"); !errors.Is(err, reconcile.ErrRevisionUnavailable) {
+		t.Errorf("expected ErrRevisionUnavailable, got %v", err)
+	}
+	if len(compose.upCalls) != 0 || store.Get().Stacks[0].Status != desiredstate.StackSyncSynced {
+		t.Error("expected a failed load to leave the stack untouched")
+	}
+}
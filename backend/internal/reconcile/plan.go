@@ -0,0 +1,372 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+)
+
+// ErrNoDesiredState is returned by Plan before the first refresh completed.
+var ErrNoDesiredState = errors.New("no desired state available")
+
+// Plan actions.
+const (
+	PlanActionCreate = "create"
+	PlanActionUpdate = "update"
+	PlanActionRemove = "remove"
+	PlanActionNoop   = "noop"
+)
+
+// Service changes in a plan.
+const (
+	ServiceAdded   = "added"
+	ServiceRemoved = "removed"
+	ServiceChanged = "changed"
+)
+
+// ComposeRenderer renders the effective compose configuration of a project,
+// as docker compose config does. The plan uses it when the ComposeRunner
+// implements it and falls back to merging the raw compose files otherwise.
+type ComposeRenderer interface {
+	ComposeConfig(ctx context.Context, projectName string, composeFiles, envFiles []string, workDir string, profiles []string) ([]byte, error)
+}
+
+// Plan describes what a reconciliation would do, without doing it.
+type Plan struct {
+	Revision    string      `json:"revision"`
+	GeneratedAt time.Time   `json:"generatedAt"`
+	DryRun      bool        `json:"dryRun"`
+	Stacks      []StackPlan `json:"stacks"`
+}
+
+// StackPlan is the planned action for a single stack.
+type StackPlan struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+	// Blocked explains why the action would not be executed under the
+	// current policy, e.g. removal disabled or awaiting acknowledgement.
+	Blocked         string `json:"blocked,omitempty"`
+	DesiredRevision string `json:"desiredRevision,omitempty"`
+	RunningRevision string `json:"runningRevision,omitempty"`
+	// Drift lists the runtime divergences of a stack that is in sync by hash.
+	Drift    []desiredstate.DriftReason `json:"drift,omitempty"`
+	Services []ServiceDiff              `json:"services,omitempty"`
+	// Error is set when the service diff could not be computed.
+	Error string `json:"error,omitempty"`
+}
+
+// ServiceDiff is the change of a single compose service.
+type ServiceDiff struct {
+	Service string `json:"service"`
+	Change  string `json:"change"`
+	// Fields lists the changed top-level service keys, e.g. image or environment.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Plan runs drift detection and reports, per stack, the action a
+// reconciliation would take and the service-level diff between the running
+// and desired compose configuration. Nothing is executed. Removals are listed
+// even when disabled, so the effect of enabling them can be reviewed.
+func (r *Reconciler) Plan(ctx context.Context) (*Plan, error) {
+	snap := r.store.Get()
+	if snap == nil {
+		return nil, ErrNoDesiredState
+	}
+
+	runtime, err := r.inspector.GetStackLabels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("inspect runtime state: %w", err)
+	}
+
+	deps := desiredDependencies(snap)
+	cycles := findCycles(deps)
+
+	plan := &Plan{
+		Revision:    snap.Revision,
+		GeneratedAt: time.Now().UTC(),
+		DryRun:      r.policy.DryRun,
+		Stacks:      []StackPlan{},
+	}
+	drifts := r.detectDrift(ctx, snap, runtime, true, nil)
+	// The mass-removal check only counts the removals Reconcile would run.
+	removals := 0
+	for _, drift := range drifts {
+		if drift.NeedRemove && runtime[drift.Path].removeAllowed(r.policy.RemoveEnabled) {
+			removals++
+		}
+	}
+	inScope := r.runningInScope(runtime)
+
+	for _, drift := range drifts {
+		rt, running := runtime[drift.Path]
+		sp := StackPlan{Path: drift.Path, Reason: drift.Reason, Drift: drift.Reasons, RunningRevision: rt.DesiredRevision}
+
+		switch {
+		case drift.NeedRemove:
+			sp.Action = PlanActionRemove
+			if !rt.removeAllowed(r.policy.RemoveEnabled) {
+				sp.Blocked = "removal disabled"
+			} else if _, suspended := r.suspensions.Get(drift.Path); suspended {
+				sp.Blocked = "suspended"
+			} else if reason := r.removalBlocked(drift.Path, removals, inScope); reason != "" {
+				sp.Blocked = reason
+			} else if closed, next := windowClosed(r.policy, snap.CommitMessage); closed {
+				sp.Blocked = windowBlocked(next)
+			}
+			r.planDiff(ctx, &sp, nil, rt)
+		case drift.NeedSync:
+			stack := findStack(snap, drift.Path)
+			sp.DesiredRevision = snap.Revision
+			sp.Action = PlanActionCreate
+			if running {
+				sp.Action = PlanActionUpdate
+			}
+			sp.Blocked = r.syncBlocked(snap, stack, deps, cycles)
+			r.planDiff(ctx, &sp, stack, rt)
+		default:
+			sp.Action = PlanActionNoop
+			sp.DesiredRevision = snap.Revision
+		}
+		plan.Stacks = append(plan.Stacks, sp)
+	}
+
+	sort.Slice(plan.Stacks, func(i, j int) bool { return plan.Stacks[i].Path < plan.Stacks[j].Path })
+	return plan, nil
+}
+
+// syncBlocked returns why a sync of stack would be skipped by Reconcile, or "".
+func (r *Reconciler) syncBlocked(snap *desiredstate.Snapshot, stack *desiredstate.StackRecord, deps map[string][]string, cycles map[string]string) string {
+	if stack == nil {
+		return "stack not found in desired state"
+	}
+	if stack.PinnedRevision != "" {
+		return "pinned to " + shortRevision(stack.PinnedRevision)
+	}
+	if stack.FailedComposeHash != "" && stack.FailedComposeHash == stack.ComposeHash {
+		return "failed its health check at this configuration"
+	}
+	if due, next := r.retries.due(stack.Path, stack.ComposeHash); !due {
+		return "waiting for retry at " + next.UTC().Format(time.RFC3339)
+	}
+	policy := r.policy.ForStack(stack.Settings)
+	if _, suspended := r.suspension(stack.Path, policy); suspended {
+		return "suspended"
+	}
+	if closed, next := windowClosed(policy, snap.CommitMessage); closed {
+		return windowBlocked(next)
+	}
+	if policy.DriftPolicy == "flag" && !r.ackStore.IsAcknowledged(stack.Path) {
+		return "drift policy is flag, awaiting acknowledgement"
+	}
+	return dependencyError(stack.Path, deps, cycles)
+}
+
+// planDiff fills in the service diff between the running revision described
+// by rt and desired. desired is nil for removals.
+func (r *Reconciler) planDiff(ctx context.Context, sp *StackPlan, desired *desiredstate.StackRecord, rt StackSyncMetadata) {
+	projectName := deriveProjectName(r.projectNamePrefix(), sp.Path)
+
+	var want map[string]map[string]any
+	if desired != nil {
+		var err error
+		want, err = r.renderServices(ctx, projectName, desired)
+		if err != nil {
+			sp.Error = fmt.Sprintf("render desired configuration: %v", err)
+			return
+		}
+	}
+
+	var have map[string]map[string]any
+	if sp.Action != PlanActionCreate {
+		switch {
+		case rt.DesiredRevision == "":
+			sp.Error = "running configuration unknown: no revision label"
+			return
+		case r.loader == nil:
+			sp.Error = "running configuration unknown: stack loader not configured"
+			return
+		}
+		prev, err := r.loader.LoadStack(ctx, rt.DesiredRevision, sp.Path)
+		if err != nil {
+			sp.Error = fmt.Sprintf("load running revision %s: %v", shortRevision(rt.DesiredRevision), err)
+			return
+		}
+		have, err = r.renderServices(ctx, projectName, &prev)
+		if err != nil {
+			sp.Error = fmt.Sprintf("render running configuration: %v", err)
+			return
+		}
+	}
+
+	sp.Services = diffServices(have, want)
+}
+
+// renderServices returns the effective configuration of each service of stack.
+func (r *Reconciler) renderServices(ctx context.Context, projectName string, stack *desiredstate.StackRecord) (map[string]map[string]any, error) {
+	renderer, ok := r.compose.(ComposeRenderer)
+	if !ok {
+		return mergeComposeServices(stack, r.policy.ForStack(stack.Settings).Profiles)
+	}
+
+	composeFiles := stack.AllComposeFiles()
+	files := make(map[string][]byte, len(composeFiles)+len(stack.EnvFiles))
+	for _, name := range append(append([]string{}, composeFiles...), stack.EnvFiles...) {
+		files[name] = stack.FileContent(name)
+	}
+	// Always render from a temp dir: the workspace holds the running checkout.
+	stackDir, _, cleanup, err := writeTempStackDir(files, "")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var composePaths, envPaths []string
+	for _, name := range composeFiles {
+		composePaths = append(composePaths, filepath.Join(stackDir, filepath.FromSlash(name)))
+	}
+	for _, name := range stack.EnvFiles {
+		envPaths = append(envPaths, filepath.Join(stackDir, filepath.FromSlash(name)))
+	}
+
+	out, err := renderer.ComposeConfig(ctx, projectName, composePaths, envPaths, stackDir, r.policy.ForStack(stack.Settings).Profiles)
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Services map[string]map[string]any `json:"services"`
+	}
+	if err := json.Unmarshal(out, &cfg); err != nil {
+		return nil, fmt.Errorf("parse compose config: %w", err)
+	}
+	return cfg.Services, nil
+}
+
+// mergeComposeServices merges the services of the stack's compose files
+// without docker: later files replace top-level keys of earlier ones. Services
+// whose profiles are all inactive are left out, as docker compose config does.
+func mergeComposeServices(stack *desiredstate.StackRecord, profiles []string) (map[string]map[string]any, error) {
+	services := make(map[string]map[string]any)
+	for _, name := range stack.AllComposeFiles() {
+		var doc struct {
+			Services map[string]map[string]any `yaml:"services"`
+		}
+		if err := yaml.Unmarshal(stack.FileContent(name), &doc); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", name, err)
+		}
+		for svc, cfg := range doc.Services {
+			if services[svc] == nil {
+				services[svc] = make(map[string]any)
+			}
+			for key, value := range cfg {
+				services[svc][key] = value
+			}
+		}
+	}
+	for svc, cfg := range services {
+		if !profileActive(cfg["profiles"], profiles) {
+			delete(services, svc)
+		}
+	}
+	return services, nil
+}
+
+// profileActive reports whether a service with the given profiles key is
+// enabled by the active profiles. Services without profiles are always enabled.
+func profileActive(serviceProfiles any, active []string) bool {
+	list, ok := serviceProfiles.([]any)
+	if !ok || len(list) == 0 {
+		return true
+	}
+	for _, p := range list {
+		for _, a := range active {
+			if fmt.Sprint(p) == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// diffServices compares running (have) and desired (want) service configurations.
+func diffServices(have, want map[string]map[string]any) []ServiceDiff {
+	names := make(map[string]bool)
+	for name := range have {
+		names[name] = true
+	}
+	for name := range want {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var diffs []ServiceDiff
+	for _, name := range sorted {
+		old, inOld := have[name]
+		cur, inCur := want[name]
+		switch {
+		case !inOld:
+			diffs = append(diffs, ServiceDiff{Service: name, Change: ServiceAdded})
+		case !inCur:
+			diffs = append(diffs, ServiceDiff{Service: name, Change: ServiceRemoved})
+		default:
+			if fields := changedFields(old, cur); len(fields) > 0 {
+				diffs = append(diffs, ServiceDiff{Service: name, Change: ServiceChanged, Fields: fields})
+			}
+		}
+	}
+	return diffs
+}
+
+// changedFields returns the sorted top-level keys that differ between a and b.
+func changedFields(a, b map[string]any) []string {
+	var fields []string
+	for key, av := range a {
+		if bv, ok := b[key]; !ok || !reflect.DeepEqual(av, bv) {
+			fields = append(fields, key)
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// logPlan writes the non-noop actions of a dry-run plan to the log.
+func logPlan(plan *Plan) {
+	changes := 0
+	for _, sp := range plan.Stacks {
+		if sp.Action == PlanActionNoop {
+			continue
+		}
+		changes++
+		msg := fmt.Sprintf("[info] dry-run: would %s stack %s (%s)", sp.Action, sp.Path, sp.Reason)
+		if sp.Blocked != "" {
+			msg += ", blocked: " + sp.Blocked
+		}
+		for _, svc := range sp.Services {
+			msg += fmt.Sprintf("; %s %s", svc.Service, svc.Change)
+			if len(svc.Fields) > 0 {
+				msg += fmt.Sprintf(" %v", svc.Fields)
+			}
+		}
+		log.Print(msg)
+	}
+	log.Printf("[info] dry-run: %d stack(s) would change, nothing executed", changes)
+}
@@ -0,0 +1,177 @@
+package reconcile_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+// renderComposeRunner renders compose config from the given JSON documents,
+// returned in call order.
+type renderComposeRunner struct {
+	stubComposeRunner
+	configs  []string
+	profiles [][]string
+}
+
+func (r *renderComposeRunner) ComposeConfig(_ context.Context, _ string, _, _ []string, _ string, profiles []string) ([]byte, error) {
+	r.profiles = append(r.profiles, profiles)
+	out := r.configs[0]
+	r.configs = r.configs[1:]
+	return []byte(out), nil
+}
+
+func planSnapshot() *desiredstate.Snapshot {
+	return &desiredstate.Snapshot{
+		Revision: "rev2",
+		Stacks: []desiredstate.StackRecord{
+			{Path: "app1", ComposeFile: "docker-compose.yml", ComposeHash: "hash2",
+				Content: []byte("services:\n  web:\n    image: nginx:2\n    ports: [\"80:80\"]\n")},
+			{Path: "app2", ComposeFile: "docker-compose.yml", ComposeHash: "hash-new",
+				Content: []byte("services:\n  api:\n    image: api:1\n")},
+			{Path: "app4", ComposeFile: "docker-compose.yml", ComposeHash: "hash4",
+				Content: []byte("services:\n  web:\n    image: nginx\n")},
+		},
+	}
+}
+
+func planRuntime() map[string]reconcile.StackSyncMetadata {
+	return map[string]reconcile.StackSyncMetadata{
+		"app1": {StackPath: "app1", DesiredRevision: "rev1", DesiredComposeHash: "hash1"},
+		"app3": {StackPath: "app3", DesiredRevision: "rev1", DesiredComposeHash: "hash3"},
+		"app4": {StackPath: "app4", DesiredRevision: "rev2", DesiredComposeHash: "hash4"},
+	}
+}
+
+func TestPlan_ActionsAndServiceDiff(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(planSnapshot())
+
+	compose := &stubComposeRunner{}
+	r := reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, &stubInspector{labels: planRuntime()}, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	r.SetStackLoader(&stubStackLoader{stack: desiredstate.StackRecord{
+		Path: "app1", ComposeFile: "docker-compose.yml", ComposeHash: "hash1",
+		Content: []byte("services:\n  web:\n    image: nginx:1\n    ports: [\"80:80\"]\n  cache:\n    image: redis\n"),
+	}})
+
+	plan, err := r.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if plan.Revision != "rev2" || len(plan.Stacks) != 4 {
+		t.Fatalf("expected 4 stacks at rev2, got %+v", plan)
+	}
+
+	byPath := make(map[string]reconcile.StackPlan)
+	for _, sp := range plan.Stacks {
+		byPath[sp.Path] = sp
+	}
+
+	app1 := byPath["app1"]
+	if app1.Action != reconcile.PlanActionUpdate || app1.RunningRevision != "rev1" || app1.Blocked != "" {
+		t.Errorf("app1: expected unblocked update from rev1, got %+v", app1)
+	}
+	wantDiff := []reconcile.ServiceDiff{
+		{Service: "cache", Change: reconcile.ServiceRemoved},
+		{Service: "web", Change: reconcile.ServiceChanged, Fields: []string{"image"}},
+	}
+	if !reflect.DeepEqual(app1.Services, wantDiff) {
+		t.Errorf("app1: expected diff %+v, got %+v", wantDiff, app1.Services)
+	}
+
+	app2 := byPath["app2"]
+	if app2.Action != reconcile.PlanActionCreate || len(app2.Services) != 1 || app2.Services[0].Change != reconcile.ServiceAdded {
+		t.Errorf("app2: expected create with added service, got %+v", app2)
+	}
+
+	app3 := byPath["app3"]
+	if app3.Action != reconcile.PlanActionRemove || app3.Blocked != "removal disabled" {
+		t.Errorf("app3: expected blocked removal, got %+v", app3)
+	}
+
+	if app4 := byPath["app4"]; app4.Action != reconcile.PlanActionNoop {
+		t.Errorf("app4: expected noop, got %+v", app4)
+	}
+
+	if len(compose.upCalls) != 0 || len(compose.downCalls) != 0 {
+		t.Errorf("plan must not execute anything, got %d up and %d down calls", len(compose.upCalls), len(compose.downCalls))
+	}
+}
+
+func TestPlan_BlockedByFlagPolicy(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(planSnapshot())
+
+	policy := reconcile.DefaultPolicy()
+	policy.DriftPolicy = "flag"
+	compose := &stubComposeRunner{}
+	r := reconcile.NewReconciler(store, policy, compose, &stubInspector{labels: planRuntime()}, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+
+	plan, err := r.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	for _, sp := range plan.Stacks {
+		if sp.Path != "app1" {
+			continue
+		}
+		if !strings.Contains(sp.Blocked, "awaiting acknowledgement") {
+			t.Errorf("expected flag policy to block app1, got %q", sp.Blocked)
+		}
+		if !strings.Contains(sp.Error, "stack loader not configured") {
+			t.Errorf("expected missing loader to be reported, got %q", sp.Error)
+		}
+	}
+}
+
+func TestPlan_UsesComposeConfig(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: planSnapshot().Stacks[:1]})
+
+	compose := &renderComposeRunner{configs: []string{
+		`{"services":{"web":{"image":"nginx:2","environment":{"A":"1"}}}}`,
+		`{"services":{"web":{"image":"nginx:2","environment":{"A":"0"}}}}`,
+	}}
+	runtime := map[string]reconcile.StackSyncMetadata{"app1": planRuntime()["app1"]}
+	r := reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, &stubInspector{labels: runtime}, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	r.SetStackLoader(&stubStackLoader{stack: desiredstate.StackRecord{Path: "app1", ComposeFile: "docker-compose.yml", Content: []byte("services: {}\n")}})
+
+	plan, err := r.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	want := []reconcile.ServiceDiff{{Service: "web", Change: reconcile.ServiceChanged, Fields: []string{"environment"}}}
+	if len(plan.Stacks) != 1 || !reflect.DeepEqual(plan.Stacks[0].Services, want) {
+		t.Errorf("expected environment change from rendered config, got %+v", plan.Stacks)
+	}
+	if len(compose.profiles) != 2 {
+		t.Errorf("expected desired and running configs to be rendered, got %d renders", len(compose.profiles))
+	}
+}
+
+func TestReconcile_DryRun(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(planSnapshot())
+
+	policy := reconcile.DefaultPolicy()
+	policy.DryRun = true
+	policy.RemoveEnabled = true
+	compose := &stubComposeRunner{}
+	r := reconcile.NewReconciler(store, policy, compose, &stubInspector{labels: planRuntime()}, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+
+	if runs := r.Reconcile(context.Background()); len(runs) != 0 {
+		t.Errorf("expected no runs in dry-run mode, got %+v", runs)
+	}
+	if len(compose.upCalls) != 0 || len(compose.downCalls) != 0 {
+		t.Errorf("dry run must not execute anything, got %d up and %d down calls", len(compose.upCalls), len(compose.downCalls))
+	}
+	for _, st := range store.GetStacks() {
+		if st.Status != "" {
+			t.Errorf("dry run must not change stack status, %s is %s", st.Path, st.Status)
+		}
+	}
+}
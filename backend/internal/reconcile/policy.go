@@ -1,15 +1,65 @@
 package reconcile
 
+import (
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/syncwindow"
+)
+
 // ReconciliationPolicy governs reconciliation behavior.
 type ReconciliationPolicy struct {
 	// Enabled controls whether reconciliation runs at all.
 	Enabled bool
+	// DryRun makes Reconcile log the plan instead of executing it.
+	DryRun bool
 	// RemoveEnabled controls whether stacks removed from desired state are torn down.
 	RemoveEnabled bool
 	// DriftPolicy is "revert" (auto-fix) or "flag" (require acknowledgement).
 	DriftPolicy string
-	// MaxConcurrency is the maximum number of stacks reconciled concurrently (fixed to 1).
+	// MaxConcurrency is the maximum number of stacks synced or removed in parallel.
+	// Values below 1 are treated as 1.
 	MaxConcurrency int
+	// HealthTimeout enables the health gate when positive: a sync only succeeds
+	// once all containers are running and healthy within this time, otherwise
+	// the stack is rolled back to its last synced revision.
+	HealthTimeout time.Duration
+	// RetryBaseDelay is the backoff before the first retry of a failed sync;
+	// it doubles with every further failure up to RetryMaxDelay.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+
+	// PullPolicy is always, missing or never: images are pulled before compose
+	// up accordingly, and never skips the pull phase. Empty means missing.
+	PullPolicy string
+	// SyncWindows restrict when drifted stacks are synced; empty allows any time.
+	SyncWindows []syncwindow.Window
+	// RemovalGracePeriod and RemovalGraceRefreshes hold back the removal of a
+	// stack deleted from Git until it has been missing for that long and from
+	// that many refreshes. Zero values do not hold removals back.
+	RemovalGracePeriod    time.Duration
+	RemovalGraceRefreshes int
+	// RemovalMaxPercent refuses all unconfirmed removals while more than this
+	// percentage of the running stacks would be removed. Zero disables the check.
+	RemovalMaxPercent int
+
+	// The fields below are only set per stack, from its settings file (see ForStack).
+	// HealthTimeout, PullPolicy and SyncWindows above may be overridden per
+	// stack as well.
+
+	// Profiles are passed to compose with --profile.
+	Profiles []string
+	// SyncTimeout bounds a single sync of the stack. Zero means no timeout.
+	SyncTimeout time.Duration
+	// ImageUpdates enables registry digest tracking up to the given level
+	// (desiredstate.ImageUpdateDigest etc.); empty disables it.
+	ImageUpdates string
+	// Suspended stacks are neither synced nor removed.
+	Suspended bool
+
+	// ForceRecreate recreates all containers; it is only set for a single
+	// manual sync.
+	ForceRecreate bool
 }
 
 // DefaultPolicy returns the default reconciliation policy.
@@ -19,5 +69,37 @@ func DefaultPolicy() ReconciliationPolicy {
 		RemoveEnabled:  false,
 		DriftPolicy:    "revert",
 		MaxConcurrency: 1,
+		RetryBaseDelay: DefaultRetryBaseDelay,
+		RetryMaxDelay:  DefaultRetryMaxDelay,
 	}
 }
+
+// StackPolicy returns the per-stack part of the policy.
+func (p ReconciliationPolicy) StackPolicy() desiredstate.StackPolicy {
+	return desiredstate.StackPolicy{
+		DriftPolicy:   p.DriftPolicy,
+		RemoveEnabled: p.RemoveEnabled,
+		Profiles:      p.Profiles,
+		SyncTimeout:   desiredstate.Duration(p.SyncTimeout),
+		HealthTimeout: desiredstate.Duration(p.HealthTimeout),
+		PullPolicy:    p.PullPolicy,
+		ImageUpdates:  p.ImageUpdates,
+		Suspended:     p.Suspended,
+		SyncWindows:   p.SyncWindows,
+	}
+}
+
+// ForStack returns the effective policy for a stack with the given settings.
+func (p ReconciliationPolicy) ForStack(settings *desiredstate.StackSettings) ReconciliationPolicy {
+	sp := settings.Apply(p.StackPolicy())
+	p.DriftPolicy = sp.DriftPolicy
+	p.RemoveEnabled = sp.RemoveEnabled
+	p.Profiles = sp.Profiles
+	p.SyncTimeout = time.Duration(sp.SyncTimeout)
+	p.HealthTimeout = time.Duration(sp.HealthTimeout)
+	p.PullPolicy = sp.PullPolicy
+	p.ImageUpdates = sp.ImageUpdates
+	p.Suspended = sp.Suspended
+	p.SyncWindows = sp.SyncWindows
+	return p
+}
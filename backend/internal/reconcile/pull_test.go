@@ -0,0 +1,121 @@
+package reconcile_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+// pullComposeRunner records pull calls before delegating up to stubComposeRunner.
+type pullComposeRunner struct {
+	stubComposeRunner
+	pullCalls []reconcile.UpOptions
+	pullErr   error
+}
+
+func (p *pullComposeRunner) ComposePull(_ context.Context, _ string, _, _ []string, _ string, opts reconcile.UpOptions) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pullCalls = append(p.pullCalls, opts)
+	return "", p.pullErr
+}
+
+func newPullReconciler(compose reconcile.ComposeRunner, globalPolicy string, settings *desiredstate.StackSettings) (*reconcile.Reconciler, *desiredstate.Store) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: []desiredstate.StackRecord{{
+		Path: "web", ComposeFile: "docker-compose.yml", ComposeHash: "h1", Status: desiredstate.StackSyncMissing,
+		Content: []byte("services:\n  web:\n    image: nginx\n"), Settings: settings,
+	}}})
+	policy := reconcile.DefaultPolicy()
+	policy.PullPolicy = globalPolicy
+	inspector := &stubInspector{labels: map[string]reconcile.StackSyncMetadata{}}
+	r := reconcile.NewReconciler(store, policy, compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	return r, store
+}
+
+func TestReconcile_PullsBeforeUp(t *testing.T) {
+	compose := &pullComposeRunner{}
+	r, _ := newPullReconciler(compose, "", nil)
+
+	if runs := r.Reconcile(context.Background()); len(runs) != 1 || runs[0].Result != "success" {
+		t.Fatalf("expected a successful sync, got %+v", runs)
+	}
+	if len(compose.pullCalls) != 1 || compose.pullCalls[0].PullPolicy != desiredstate.PullPolicyMissing {
+		t.Errorf("expected one pull with policy missing, got %+v", compose.pullCalls)
+	}
+	if len(compose.upCalls) != 1 || compose.upCalls[0].Options.PullPolicy != desiredstate.PullPolicyNever {
+		t.Errorf("expected up --pull never after the pull phase, got %+v", compose.upCalls)
+	}
+}
+
+func TestReconcile_PullPolicyNeverSkipsPull(t *testing.T) {
+	compose := &pullComposeRunner{}
+	r, _ := newPullReconciler(compose, desiredstate.PullPolicyAlways, &desiredstate.StackSettings{PullPolicy: desiredstate.PullPolicyNever})
+
+	r.Reconcile(context.Background())
+	if len(compose.pullCalls) != 0 {
+		t.Errorf("expected no pull with policy never, got %+v", compose.pullCalls)
+	}
+	if len(compose.upCalls) != 1 || compose.upCalls[0].Options.PullPolicy != desiredstate.PullPolicyNever {
+		t.Errorf("expected up --pull never, got %+v", compose.upCalls)
+	}
+}
+
+func TestReconcile_PullFailure(t *testing.T) {
+	registryErr := "Error response from daemon: manifest for registry.example.com/team/" + strings.Repeat("x", 300) + ":1.2 not found: manifest unknown"
+	compose := &pullComposeRunner{pullErr: errors.New(registryErr)}
+	r, store := newPullReconciler(compose, desiredstate.PullPolicyAlways, nil)
+
+	runs := r.Reconcile(context.Background())
+	if len(runs) != 1 || runs[0].Result != "failed" {
+		t.Fatalf("expected a failed sync, got %+v", runs)
+	}
+	if compose.pullCalls[0].PullPolicy != desiredstate.PullPolicyAlways {
+		t.Errorf("expected the global pull policy, got %q", compose.pullCalls[0].PullPolicy)
+	}
+	if len(compose.upCalls) != 0 {
+		t.Errorf("compose up must not run after a failed pull, got %d calls", len(compose.upCalls))
+	}
+	st := store.GetStacks()[0]
+	if st.Status != desiredstate.StackSyncPullFailed {
+		t.Errorf("expected status pull_failed, got %s", st.Status)
+	}
+	if !strings.Contains(st.LastSyncError, "manifest unknown") {
+		t.Errorf("expected the full registry error, got %q", st.LastSyncError)
+	}
+}
+
+// outputRunner fails every command with the given output.
+type outputRunner struct {
+	out  string
+	args []string
+}
+
+func (o *outputRunner) Run(_ context.Context, _ string, args ...string) ([]byte, error) {
+	o.args = args
+	return []byte(o.out), errors.New("exit status 18")
+}
+
+func TestDockerComposeRunner_ComposePull(t *testing.T) {
+	runner := &outputRunner{out: " web Pulling \n db Pulling \n web Error manifest for nginx:nope not found: manifest unknown\n db Pulled \nError response from daemon: manifest for nginx:nope not found\n"}
+	compose := reconcile.NewDockerComposeRunner(runner, "")
+
+	output, err := compose.ComposePull(context.Background(), "web", []string{"/w/docker-compose.yml"}, nil, "/w", reconcile.UpOptions{PullPolicy: "missing", Profiles: []string{"debug"}})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if strings.Contains(err.Error(), "Pulling") || !strings.Contains(err.Error(), "web Error manifest for nginx:nope not found") {
+		t.Errorf("expected only the error lines, got %q", err.Error())
+	}
+	if output != runner.out {
+		t.Errorf("expected the full output to be returned, got %q", output)
+	}
+	args := strings.Join(runner.args, " ")
+	if !strings.Contains(args, "--profile debug pull --quiet --ignore-buildable --policy missing") {
+		t.Errorf("unexpected arguments %q", args)
+	}
+}
@@ -2,8 +2,12 @@ package reconcile
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,15 +17,63 @@ import (
 
 // ComposeRunner abstracts docker compose command execution.
 type ComposeRunner interface {
-	// ComposeUp runs docker compose up -d with the given project name, compose file,
-	// and optional override file for labels.
-	ComposeUp(ctx context.Context, projectName, composeFile, overrideFile, workDir string) error
-	// ComposeDown runs docker compose down --remove-orphans for the given project.
-	ComposeDown(ctx context.Context, projectName, composeFile, workDir string) error
+	// ComposeUp runs docker compose up -d with the given project name, compose files
+	// (in order), env files, and optional override file for labels. It returns
+	// the command output.
+	ComposeUp(ctx context.Context, projectName string, composeFiles, envFiles []string, overrideFile, workDir string, opts UpOptions) (string, error)
+	// ComposeDown runs docker compose down --remove-orphans for the given project
+	// and returns the command output.
+	ComposeDown(ctx context.Context, projectName, composeFile, workDir string, opts DownOptions) (string, error)
 	// ComposePs lists running containers for a compose project.
 	ComposePs(ctx context.Context, projectName string) ([]desiredstate.ContainerInfo, error)
 }
 
+// UpOptions holds per-stack compose up options from the stack's settings.
+type UpOptions struct {
+	// Profiles are enabled with --profile.
+	Profiles []string
+	// PullPolicy is passed as up --pull (or pull --policy); empty uses the compose default.
+	PullPolicy string
+	// ForceRecreate passes --force-recreate to up.
+	ForceRecreate bool
+}
+
+// DownOptions holds compose down options.
+type DownOptions struct {
+	// RemoveVolumes passes -v to down, removing the project's named volumes.
+	RemoveVolumes bool
+}
+
+// ComposePuller is implemented by compose runners that can pull a project's
+// images as a separate step. When available, images are pulled before
+// compose up, so registry errors are reported as pull_failed and the running
+// containers stay untouched until the new images are present.
+type ComposePuller interface {
+	ComposePull(ctx context.Context, projectName string, composeFiles, envFiles []string, workDir string, opts UpOptions) (string, error)
+}
+
+// pullError marks a sync that failed while pulling images.
+type pullError struct {
+	err error
+}
+
+func (e *pullError) Error() string { return "pull failed: " + e.err.Error() }
+func (e *pullError) Unwrap() error { return e.err }
+
+// Workspace materialises a stack's directory from Git on disk, so compose
+// can resolve env files, configs, bind mounts and build contexts.
+type Workspace interface {
+	// Checkout writes the stack directory at revision into a stable per-project
+	// directory and returns the absolute path of the stack directory. stackFiles
+	// are the compose and env files, relative to the stack directory.
+	Checkout(ctx context.Context, project, revision, stackPath string, stackFiles []string) (string, error)
+}
+
+// StackLoader loads the desired state of a single stack at a given revision.
+type StackLoader interface {
+	LoadStack(ctx context.Context, revision, stackPath string) (desiredstate.StackRecord, error)
+}
+
 // ContainerInspector reads runtime container labels.
 type ContainerInspector interface {
 	// GetStackLabels returns sync metadata labels grouped by stack path.
@@ -38,17 +90,51 @@ type StackSyncMetadata struct {
 	LastSyncAt           string
 	SyncStatus           string
 	SyncError            string
+	// RemovePolicy is the stack's explicit remove setting at deploy time:
+	// "true", "false" or empty when the global policy applies.
+	RemovePolicy string
+	// DependsOn lists the stacks this stack depended on at deploy time.
+	DependsOn []string
+	// OwnerInstance and OwnerDeployDir are the owner labels of the stack's
+	// containers, both empty for stacks deployed before they were stamped.
+	OwnerInstance  string
+	OwnerDeployDir string
+	// ProjectName is the compose project of the stack's containers.
+	ProjectName string
+	// Containers are the stack's containers, used for runtime drift detection.
+	// Empty means only the labels are compared.
+	Containers []RuntimeContainer
+}
+
+// removeAllowed reports whether the runtime stack may be removed, given the
+// global RemoveEnabled setting.
+func (m StackSyncMetadata) removeAllowed(global bool) bool {
+	switch m.RemovePolicy {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return global
 }
 
 // ReconciliationRun tracks a single reconciliation attempt.
 type ReconciliationRun struct {
-	StackPath       string
-	DesiredRevision string
-	DesiredHash     string
-	StartedAt       time.Time
-	FinishedAt      time.Time
-	Result          string // "success", "failed", "skipped"
-	Error           string
+	// ID identifies manual syncs, which are queued before they run.
+	ID        string `json:"id,omitempty"`
+	StackPath string `json:"stackPath"`
+	// Trigger is what started the run, e.g. webhook, periodic or retry.
+	Trigger         string    `json:"trigger,omitempty"`
+	DesiredRevision string    `json:"desiredRevision"`
+	CommitMessage   string    `json:"commitMessage,omitempty"`
+	DesiredHash     string    `json:"desiredHash,omitempty"`
+	StartedAt       time.Time `json:"startedAt"`
+	FinishedAt      time.Time `json:"finishedAt"`
+	DurationMs      int64     `json:"durationMs"`
+	Result          string    `json:"result"` // "success", "failed", "skipped"; RunQueued or RunRunning while pending
+	Error           string    `json:"error,omitempty"`
+	// Output is the output of the compose commands the run executed.
+	Output string `json:"output,omitempty"`
 }
 
 // Reconciler compares desired state with runtime state and applies changes.
@@ -62,6 +148,25 @@ type Reconciler struct {
 	deployDir     string
 	driftDetector *DriftDetector
 	stateManager  *StateManager
+	workspace     Workspace
+	loader        StackLoader
+	retries       *retryTracker
+	history       HistoryStore
+	broadcaster   *desiredstate.Broadcaster
+	suspensions   *SuspensionStore
+	windows       *windowTracker
+	removals      *removalTracker
+	stackLocks    stackLocks
+
+	// instance is set by SetOwner; its deploy dir is deployDir.
+	instance Owner
+
+	// pending holds the unfinished manual syncs of each stack, oldest first:
+	// at most one running and one queued behind it.
+	pendingMu sync.Mutex
+	pending   map[string][]ReconciliationRun
+
+	healthInterval time.Duration
 }
 
 // NewReconciler creates a Reconciler.
@@ -84,11 +189,57 @@ func NewReconciler(
 		deployDir:     deployDir,
 		driftDetector: driftDetector,
 		stateManager:  stateManager,
+		retries:       newRetryTracker(policy.RetryBaseDelay, policy.RetryMaxDelay),
+		suspensions:   NewSuspensionStore(),
+		windows:       newWindowTracker(),
+		removals:      newRemovalTracker(),
+		pending:       make(map[string][]ReconciliationRun),
 	}
 }
 
+// SetWorkspace sets the optional workspace used to check out stack directories.
+// Without one, only the compose file is written to a temporary directory.
+func (r *Reconciler) SetWorkspace(w Workspace) {
+	r.workspace = w
+}
+
+// SetStackLoader sets the loader used to roll a stack back to its last known
+// good revision when the health gate fails. Without one, a failed health check
+// only marks the stack failed.
+func (r *Reconciler) SetStackLoader(l StackLoader) {
+	r.loader = l
+}
+
+// SetOwner sets the instance ID stamped on deployed containers, so containers
+// owned by other instances are left alone, the prefix of the compose project
+// names of the stacks and whether unlabeled stacks are adopted. The deploy
+// dir passed to NewReconciler takes precedence over owner.DeployDir.
+func (r *Reconciler) SetOwner(owner Owner) {
+	r.instance = owner
+}
+
+// SetHealthCheckInterval sets how often the health gate polls containers.
+func (r *Reconciler) SetHealthCheckInterval(d time.Duration) {
+	r.healthInterval = d
+}
+
 // Reconcile performs a full reconciliation cycle.
 func (r *Reconciler) Reconcile(ctx context.Context) []ReconciliationRun {
+	return r.reconcile(ctx, nil)
+}
+
+// CheckStacks runs a reconciliation cycle limited to the given stacks, e.g.
+// after Docker reported changes to their containers.
+func (r *Reconciler) CheckStacks(ctx context.Context, paths []string) []ReconciliationRun {
+	only := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		only[p] = true
+	}
+	return r.reconcile(ctx, only)
+}
+
+// reconcile runs a reconciliation cycle. A non-nil only limits it to those stacks.
+func (r *Reconciler) reconcile(ctx context.Context, only map[string]bool) []ReconciliationRun {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -97,6 +248,16 @@ func (r *Reconciler) Reconcile(ctx context.Context) []ReconciliationRun {
 		return nil
 	}
 
+	if r.policy.DryRun {
+		plan, err := r.Plan(ctx)
+		if err != nil {
+			log.Printf("[info] dry-run: %v, skipping", err)
+			return nil
+		}
+		logPlan(plan)
+		return nil
+	}
+
 	snap := r.store.Get()
 	if snap == nil {
 		log.Printf("[info] no desired state available, skipping reconciliation")
@@ -114,12 +275,13 @@ func (r *Reconciler) Reconcile(ctx context.Context) []ReconciliationRun {
 		log.Printf("[debug]   runtime stack: %s", path)
 	}
 
-	drifts := r.driftDetector.DetectChanges(ctx, snap.Stacks, runtime, r.policy.RemoveEnabled)
+	drifts := r.detectDrift(ctx, snap, runtime, r.policy.RemoveEnabled, only)
+	r.dropRetries(drifts, snap, only)
 
 	// For stacks that are in sync at runtime but have a stale store status
 	// (e.g. "missing" after a fresh startup), correct the store from runtime metadata.
 	for _, drift := range drifts {
-		if drift.NeedSync || drift.NeedRemove {
+		if drift.NeedSync || drift.NeedRemove || (only != nil && !only[drift.Path]) {
 			continue
 		}
 		rt, ok := runtime[drift.Path]
@@ -127,11 +289,17 @@ func (r *Reconciler) Reconcile(ctx context.Context) []ReconciliationRun {
 			continue
 		}
 		// Find the corresponding store record
-		for _, st := range snap.Stacks {
-			if st.Path == drift.Path && st.Status != desiredstate.StackSyncSynced {
+		if st := findStack(snap, drift.Path); st != nil && st.PinnedRevision == "" {
+			if susp, suspended := r.suspension(st.Path, r.policy.ForStack(st.Settings)); suspended {
+				r.markSuspended(st, susp)
+				if len(st.Drift) > 0 {
+					r.stateManager.SetDrift(drift.Path, nil)
+				}
+			} else if st.Status != desiredstate.StackSyncSynced {
 				log.Printf("[info] correcting store status for in-sync stack %s (%s → synced)", drift.Path, st.Status)
 				r.stateManager.MarkSynced(drift.Path, rt.DesiredRevision, rt.DesiredCommitMessage, rt.DesiredComposeHash, rt.SyncedAt)
-				break
+			} else if len(st.Drift) > 0 {
+				r.stateManager.SetDrift(drift.Path, nil)
 			}
 		}
 		// Always refresh container counts for in-sync stacks
@@ -139,38 +307,174 @@ func (r *Reconciler) Reconcile(ctx context.Context) []ReconciliationRun {
 		r.stateManager.UpdateContainerCounts(ctx, drift.Path, projectName)
 	}
 
-	var runs []ReconciliationRun
+	// Decide what to do sequentially, then run the syncs and removals on the
+	// worker pool in dependency order.
+	deps := desiredDependencies(snap)
+	cycles := findCycles(deps)
+	removeOrder := removalDependencies(drifts, runtime)
+	removalHolds := r.trackRemovals(ctx, drifts, snap, runtime)
+
+	var jobs []stackJob
 
 	for _, drift := range drifts {
-		if !drift.NeedSync && !drift.NeedRemove {
+		if !drift.NeedSync && !drift.NeedRemove || (only != nil && !only[drift.Path]) {
+			continue
+		}
+
+		// Pinned stacks run an earlier revision on purpose.
+		if st := findStack(snap, drift.Path); st != nil && st.PinnedRevision != "" {
+			log.Printf("[info] stack %s is pinned to %s, skipping", drift.Path, shortRevision(st.PinnedRevision))
+			r.clearRetry(drift.Path)
+			continue
+		}
+
+		if len(drift.Reasons) > 0 {
+			r.stateManager.SetDrift(drift.Path, drift.Reasons)
+		}
+
+		// Suspended stacks keep reporting drift but are neither synced nor
+		// removed.
+		stack := findStack(snap, drift.Path)
+		var settings *desiredstate.StackSettings
+		if stack != nil {
+			settings = stack.Settings
+		}
+		policy := r.policy.ForStack(settings)
+		if susp, suspended := r.suspension(drift.Path, policy); suspended {
+			log.Printf("[info] stack %s is suspended, skipping", drift.Path)
+			if stack != nil {
+				r.markSuspended(stack, susp)
+			}
+			r.clearRetry(drift.Path)
 			continue
 		}
 
 		if drift.NeedRemove {
-			run := r.removeStack(ctx, drift, snap)
-			runs = append(runs, run)
+			if removalHolds[drift.Path] != "" {
+				continue
+			}
+			if closed, next := windowClosed(r.policy, snap.CommitMessage); closed {
+				r.deferToWindow(nil, drift.Path, next)
+				continue
+			}
+			rt := runtime[drift.Path]
+			jobs = append(jobs, stackJob{
+				path:  drift.Path,
+				after: removeOrder[drift.Path],
+				run: func() ReconciliationRun {
+					return r.removeStack(ctx, drift, snap, rt)
+				},
+			})
+			continue
+		}
+
+		if stack != nil && stack.FailedComposeHash != "" && stack.FailedComposeHash == stack.ComposeHash {
+			log.Printf("[info] stack %s failed its health check at this configuration, waiting for a new revision", drift.Path)
+			continue
+		}
+		if stack != nil {
+			if due, next := r.retries.due(drift.Path, stack.ComposeHash); !due {
+				log.Printf("[info] stack %s failed to sync, next retry at %s", drift.Path, next.Format(time.RFC3339))
+				continue
+			}
+		}
+
+		if closed, next := windowClosed(policy, snap.CommitMessage); closed {
+			r.deferToWindow(stack, drift.Path, next)
+			r.clearRetry(drift.Path)
 			continue
 		}
+		r.windows.clear(drift.Path)
 
 		// Check drift policy
-		if r.policy.DriftPolicy == "flag" {
+		if policy.DriftPolicy == "flag" {
 			if !r.ackStore.IsAcknowledged(drift.Path) {
 				log.Printf("[info] stack %s has drift but policy is 'flag' and not acknowledged, skipping", drift.Path)
 				r.stateManager.UpdateStatus(drift.Path, desiredstate.StackSyncFailed, "", "drift detected, awaiting acknowledgement")
+				r.clearRetry(drift.Path)
 				continue
 			}
 			// Clear acknowledgement after use
 			r.ackStore.Clear(drift.Path)
 		}
 
-		run := r.syncStack(ctx, drift, snap)
-		runs = append(runs, run)
+		// Stacks whose dependencies cannot be satisfied fail without running
+		// compose; their dependents are then skipped by runJobs.
+		if reason := dependencyError(drift.Path, deps, cycles); reason != "" {
+			jobs = append(jobs, stackJob{
+				path: drift.Path,
+				run: func() ReconciliationRun {
+					return r.failStack(drift.Path, snap.Revision, reason)
+				},
+			})
+			continue
+		}
+
+		rt := runtime[drift.Path]
+		jobs = append(jobs, stackJob{
+			path:  drift.Path,
+			after: deps[drift.Path],
+			run: func() ReconciliationRun {
+				// A rollback may have pinned the stack since the cycle started.
+				if st := findStack(r.store.Get(), drift.Path); st != nil && st.PinnedRevision != "" {
+					return r.skipPinned(drift.Path, st.PinnedRevision)
+				}
+				run := r.syncStack(ctx, drift, snap, policy, rt)
+				r.recordAttempt(run)
+				return run
+			},
+		})
 	}
 
+	runs := r.runJobs(jobs)
+	r.recordHistory(ctx, runs)
 	return runs
 }
 
-func (r *Reconciler) syncStack(ctx context.Context, drift DriftResult, snap *desiredstate.Snapshot) ReconciliationRun {
+// markSuspended sets a suspended stack's status unless it is already set.
+func (r *Reconciler) markSuspended(st *desiredstate.StackRecord, susp *desiredstate.Suspension) {
+	if st.Status == desiredstate.StackSyncSuspended && reflect.DeepEqual(st.Suspension, susp) {
+		return
+	}
+	r.stateManager.MarkSuspended(st.Path, susp)
+}
+
+// recordAttempt updates the retry backoff of a stack after a sync. Syncs that
+// failed their health check are not retried: the failed hash is skipped until
+// the desired state changes.
+func (r *Reconciler) recordAttempt(run ReconciliationRun) {
+	if run.Result == "success" {
+		r.retries.succeeded(run.StackPath)
+		return
+	}
+	if run.Result != "failed" || run.DesiredHash == "" {
+		return
+	}
+	if st := findStack(r.store.Get(), run.StackPath); st != nil && st.FailedComposeHash == run.DesiredHash {
+		if r.retries.succeeded(run.StackPath) {
+			r.stateManager.SetRetry(run.StackPath, 0, time.Time{})
+		}
+		return
+	}
+	attempts, next := r.retries.failed(run.StackPath, run.DesiredHash)
+	log.Printf("[warn] stack %s failed %d time(s), retrying at %s", run.StackPath, attempts, next.Format(time.RFC3339))
+	r.stateManager.SetRetry(run.StackPath, attempts, next)
+}
+
+// findStack returns the stack at path in snap, or nil.
+func findStack(snap *desiredstate.Snapshot, path string) *desiredstate.StackRecord {
+	if snap == nil {
+		return nil
+	}
+	for i := range snap.Stacks {
+		if snap.Stacks[i].Path == path {
+			return &snap.Stacks[i]
+		}
+	}
+	return nil
+}
+
+func (r *Reconciler) syncStack(ctx context.Context, drift DriftResult, snap *desiredstate.Snapshot, policy ReconciliationPolicy, rt StackSyncMetadata) ReconciliationRun {
 	run := ReconciliationRun{
 		StackPath:       drift.Path,
 		DesiredRevision: snap.Revision,
@@ -178,13 +482,7 @@ func (r *Reconciler) syncStack(ctx context.Context, drift DriftResult, snap *des
 	}
 
 	// Find the stack record to get compose file and hash
-	var stack *desiredstate.StackRecord
-	for i := range snap.Stacks {
-		if snap.Stacks[i].Path == drift.Path {
-			stack = &snap.Stacks[i]
-			break
-		}
-	}
+	stack := findStack(snap, drift.Path)
 	if stack == nil {
 		run.Result = "failed"
 		run.Error = "stack not found in desired state"
@@ -201,41 +499,39 @@ func (r *Reconciler) syncStack(ctx context.Context, drift DriftResult, snap *des
 
 	// Derive project name
 	projectName := deriveProjectName(r.projectNamePrefix(), drift.Path)
-
-	// Generate override file with labels applied to each service
 	commitMessage := r.getCommitMessage(snap)
-	serviceNames := extractServiceNames(stack.Content)
-	if len(serviceNames) == 0 {
-		log.Printf("[warn] no service names extracted from compose file for stack %s — labels will not be applied", drift.Path)
-	}
-	overrideContent := generateLabelOverride(drift.Path, snap.Revision, commitMessage, stack.ComposeHash, serviceNames)
+	run.CommitMessage = commitMessage
 
-	// Write compose file and override to temp directory so docker compose
-	// can find them regardless of the process's working directory.
-	composeFile, overrideFile, cleanup, err := writeTempComposeDir(stack.ComposeFile, stack.Content, overrideContent)
-	if err != nil {
-		run.Result = "failed"
-		run.Error = fmt.Sprintf("failed to write compose files: %v", err)
-		run.FinishedAt = time.Now()
-		r.stateManager.UpdateStatus(drift.Path, desiredstate.StackSyncFailed, "", run.Error)
-		return run
+	syncCtx := ctx
+	if policy.SyncTimeout > 0 {
+		var cancel context.CancelFunc
+		syncCtx, cancel = context.WithTimeout(ctx, policy.SyncTimeout)
+		defer cancel()
 	}
-	defer cleanup()
 
-	// Run docker compose up
-	// workDir is set to the stack path so Docker Compose resolves relative
-	// volume mounts and build contexts correctly.
-	workDir := drift.Path
-	err = r.compose.ComposeUp(ctx, projectName, composeFile, overrideFile, workDir)
+	output, err := r.deploy(syncCtx, projectName, snap.Revision, commitMessage, stack, policy)
+	run.Output = output
 	if err != nil {
 		run.Result = "failed"
-		run.Error = fmt.Sprintf("compose up failed: %v", err)
+		run.Error = err.Error()
 		run.FinishedAt = time.Now()
 		log.Printf("[error] reconcile failed for stack %s: %v", drift.Path, err)
+		var pullErr *pullError
+		if errors.As(err, &pullErr) {
+			r.stateManager.UpdateStatus(drift.Path, desiredstate.StackSyncPullFailed, "", truncatePullError(run.Error))
+			return run
+		}
 		r.stateManager.UpdateStatus(drift.Path, desiredstate.StackSyncFailed, "", truncateError(run.Error))
 		return run
 	}
 
+	if policy.HealthTimeout > 0 {
+		if err := r.waitHealthy(syncCtx, projectName, policy.HealthTimeout); err != nil {
+			// Roll back with the parent context: the sync timeout may be what failed.
+			return r.rollback(ctx, run, snap.Revision, stack, rt, fmt.Errorf("health check failed: %w", err))
+		}
+	}
+
 	run.Result = "success"
 	run.FinishedAt = time.Now()
 	log.Printf("[info] reconcile succeeded for stack %s", drift.Path)
@@ -250,20 +546,239 @@ func (r *Reconciler) syncStack(ctx context.Context, drift DriftResult, snap *des
 	return run
 }
 
-func (r *Reconciler) removeStack(ctx context.Context, drift DriftResult, snap *desiredstate.Snapshot) ReconciliationRun {
+// deploy writes the stack's files for revision and runs compose up with the
+// sync metadata labels applied to every service. It returns the output of the
+// compose commands.
+func (r *Reconciler) deploy(ctx context.Context, projectName, revision, commitMessage string, stack *desiredstate.StackRecord, policy ReconciliationPolicy) (string, error) {
+	// Generate override file with labels applied to each service
+	serviceNames := stackServiceNames(stack)
+	if len(serviceNames) == 0 {
+		log.Printf("[warn] no service names extracted from compose file for stack %s — labels will not be applied", stack.Path)
+	}
+	extraLabels := make(map[string]string)
+	if stack.Settings != nil && stack.Settings.Remove != nil {
+		extraLabels[LabelPolicyRemove] = strconv.FormatBool(*stack.Settings.Remove)
+	}
+	if len(stack.DependsOn) > 0 {
+		extraLabels[LabelDependsOn] = strings.Join(stack.DependsOn, ",")
+	}
+	overrideContent := generateLabelOverride(stack.Path, revision, commitMessage, stack.ComposeHash, serviceNames, r.owner(), extraLabels)
+
+	files, err := r.prepareComposeFiles(ctx, projectName, revision, stack, overrideContent)
+	if err != nil {
+		return "", fmt.Errorf("failed to write compose files: %w", err)
+	}
+	defer files.cleanup()
+
+	// Pull first, so a registry failure leaves the running containers alone
+	// and up only has to recreate them.
+	opts := UpOptions{Profiles: policy.Profiles, PullPolicy: policy.PullPolicy, ForceRecreate: policy.ForceRecreate}
+	var pullOutput string
+	if puller, ok := r.compose.(ComposePuller); ok && opts.PullPolicy != desiredstate.PullPolicyNever {
+		if opts.PullPolicy == "" {
+			opts.PullPolicy = desiredstate.PullPolicyMissing
+		}
+		out, err := puller.ComposePull(ctx, projectName, files.composeFiles, files.envFiles, files.workDir, opts)
+		if err != nil {
+			return joinOutput(out), &pullError{err: err}
+		}
+		pullOutput = out
+		opts.PullPolicy = desiredstate.PullPolicyNever
+	}
+
+	// Run docker compose up with the stack directory as project directory so
+	// relative volume mounts, env files and build contexts resolve correctly.
+	out, err := r.compose.ComposeUp(ctx, projectName, files.composeFiles, files.envFiles, files.overrideFile, files.workDir, opts)
+	if err != nil {
+		return joinOutput(pullOutput, out), fmt.Errorf("compose up failed: %w", err)
+	}
+	return joinOutput(pullOutput, out), nil
+}
+
+// joinOutput joins the non-empty outputs of consecutive compose commands.
+func joinOutput(outputs ...string) string {
+	var parts []string
+	for _, out := range outputs {
+		if out = strings.TrimSpace(out); out != "" {
+			parts = append(parts, out)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// rollback redeploys the revision recorded in the runtime labels (the last
+// known good state) after the new revision failed its health check. The failed
+// hash is recorded so it is not deployed again until the desired state changes.
+func (r *Reconciler) rollback(ctx context.Context, run ReconciliationRun, revision string, stack *desiredstate.StackRecord, rt StackSyncMetadata, healthErr error) ReconciliationRun {
+	run.Result = "failed"
+	projectName := deriveProjectName(r.projectNamePrefix(), stack.Path)
+	log.Printf("[error] stack %s: %v", stack.Path, healthErr)
+
+	reason := healthErr.Error()
+	switch {
+	case r.loader == nil:
+		reason += "; rollback not configured"
+	case rt.DesiredRevision == "" || rt.DesiredComposeHash == "":
+		reason += "; no previous revision to roll back to"
+	case rt.DesiredComposeHash == stack.ComposeHash:
+		reason += "; previous revision has the same configuration"
+	default:
+		output, err := r.redeploy(ctx, projectName, stack.Path, rt)
+		run.Output = joinOutput(run.Output, output)
+		if err == nil {
+			log.Printf("[info] stack %s rolled back to %s", stack.Path, shortRevision(rt.DesiredRevision))
+			run.Error = fmt.Sprintf("%s; rolled back to %s", reason, shortRevision(rt.DesiredRevision))
+			run.FinishedAt = time.Now()
+			r.stateManager.MarkRolledBack(stack.Path, revision, stack.ComposeHash, rt, truncateError(run.Error))
+			r.stateManager.UpdateContainerCounts(ctx, stack.Path, projectName)
+			return run
+		}
+		log.Printf("[error] rollback of stack %s to %s failed: %v", stack.Path, shortRevision(rt.DesiredRevision), err)
+		reason = fmt.Sprintf("%s; rollback to %s failed: %v", reason, shortRevision(rt.DesiredRevision), err)
+	}
+
+	run.Error = reason
+	run.FinishedAt = time.Now()
+	r.stateManager.MarkHealthFailed(stack.Path, stack.ComposeHash, truncateError(reason))
+	r.stateManager.UpdateContainerCounts(ctx, stack.Path, projectName)
+	return run
+}
+
+// redeploy deploys the stack revision described by runtime labels.
+func (r *Reconciler) redeploy(ctx context.Context, projectName, stackPath string, rt StackSyncMetadata) (string, error) {
+	prev, err := r.loader.LoadStack(ctx, rt.DesiredRevision, stackPath)
+	if err != nil {
+		return "", fmt.Errorf("load revision: %w", err)
+	}
+	return r.deploy(ctx, projectName, rt.DesiredRevision, rt.DesiredCommitMessage, &prev, r.policy.ForStack(prev.Settings))
+}
+
+// shortRevision abbreviates a commit SHA for messages.
+func shortRevision(rev string) string {
+	if len(rev) > 12 {
+		return rev[:12]
+	}
+	return rev
+}
+
+// composeInvocation holds the absolute paths passed to docker compose.
+type composeInvocation struct {
+	composeFiles []string
+	envFiles     []string
+	overrideFile string
+	workDir      string
+	cleanup      func()
+}
+
+// prepareComposeFiles writes the stack's files to disk. With a workspace the
+// whole stack directory is checked out; otherwise only the compose and env
+// files are written to a temporary directory.
+func (r *Reconciler) prepareComposeFiles(ctx context.Context, projectName, revision string, stack *desiredstate.StackRecord, overrideContent string) (composeInvocation, error) {
+	composeFiles := stack.AllComposeFiles()
+	inv := composeInvocation{cleanup: func() {}}
+
+	if r.workspace == nil {
+		files := make(map[string][]byte, len(composeFiles)+len(stack.EnvFiles))
+		for _, name := range append(append([]string{}, composeFiles...), stack.EnvFiles...) {
+			files[name] = stack.FileContent(name)
+		}
+		stackDir, overrideFile, cleanup, err := writeTempStackDir(files, overrideContent)
+		if err != nil {
+			return inv, err
+		}
+		inv.workDir, inv.overrideFile, inv.cleanup = stackDir, overrideFile, cleanup
+	} else {
+		stackFiles := append(append([]string{}, composeFiles...), stack.EnvFiles...)
+		workDir, err := r.workspace.Checkout(ctx, projectName, revision, stack.Path, stackFiles)
+		if err != nil {
+			return inv, fmt.Errorf("checkout stack: %w", err)
+		}
+		overrideFile, cleanup, err := writeTempOverride(overrideContent)
+		if err != nil {
+			return inv, err
+		}
+		inv.workDir, inv.overrideFile, inv.cleanup = workDir, overrideFile, cleanup
+	}
+
+	for _, name := range composeFiles {
+		inv.composeFiles = append(inv.composeFiles, filepath.Join(inv.workDir, filepath.FromSlash(name)))
+	}
+	for _, name := range stack.EnvFiles {
+		inv.envFiles = append(inv.envFiles, filepath.Join(inv.workDir, filepath.FromSlash(name)))
+	}
+	return inv, nil
+}
+
+// stackServiceNames returns the service names declared across all of the
+// stack's compose files, so the label override covers services defined in
+// any layer.
+func stackServiceNames(stack *desiredstate.StackRecord) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, file := range stack.AllComposeFiles() {
+		for _, name := range extractServiceNames(stack.FileContent(file)) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// failStack marks a stack as failed without running compose, e.g. when its
+// dependencies cannot be satisfied.
+func (r *Reconciler) failStack(path, revision, reason string) ReconciliationRun {
+	now := time.Now()
+	log.Printf("[warn] not syncing stack %s: %s", path, reason)
+	r.stateManager.UpdateStatus(path, desiredstate.StackSyncFailed, "", truncateError(reason))
+	return ReconciliationRun{
+		StackPath:       path,
+		DesiredRevision: revision,
+		StartedAt:       now,
+		FinishedAt:      now,
+		Result:          "failed",
+		Error:           reason,
+	}
+}
+
+// skipPinned records that a stack planned for sync was pinned by a rollback
+// before its sync started.
+func (r *Reconciler) skipPinned(path, revision string) ReconciliationRun {
+	now := time.Now()
+	reason := "pinned to " + shortRevision(revision)
+	log.Printf("[info] stack %s was %s while waiting to sync, skipping", path, reason)
+	return ReconciliationRun{
+		StackPath:  path,
+		StartedAt:  now,
+		FinishedAt: now,
+		Result:     "skipped",
+		Error:      reason,
+	}
+}
+
+func (r *Reconciler) removeStack(ctx context.Context, drift DriftResult, snap *desiredstate.Snapshot, rt StackSyncMetadata) ReconciliationRun {
 	run := ReconciliationRun{
 		StackPath:       drift.Path,
 		DesiredRevision: snap.Revision,
+		CommitMessage:   r.getCommitMessage(snap),
 		StartedAt:       time.Now(),
 	}
 
-	if !r.policy.RemoveEnabled {
+	if !rt.removeAllowed(r.policy.RemoveEnabled) {
 		run.Result = "skipped"
 		run.FinishedAt = time.Now()
 		return run
 	}
 
-	log.Printf("[info] removing stack %s (reason: %s)", drift.Path, drift.Reason)
+	// Volumes are only removed when an operator confirmed the removal with them.
+	removal := r.removals.get(drift.Path)
+	opts := DownOptions{RemoveVolumes: removal.Confirmed && removal.RemoveVolumes}
+	if opts.RemoveVolumes {
+		log.Printf("[info] removing stack %s and its volumes (reason: %s)", drift.Path, drift.Reason)
+	} else {
+		log.Printf("[info] removing stack %s (reason: %s)", drift.Path, drift.Reason)
+	}
 
 	r.stateManager.UpdateStatus(drift.Path, desiredstate.StackSyncDeleting, "", "")
 
@@ -271,7 +786,8 @@ func (r *Reconciler) removeStack(ctx context.Context, drift DriftResult, snap *d
 
 	// For removal, we only need the project name — no compose file or workDir required.
 	// docker compose -p <project> down --remove-orphans is sufficient.
-	err := r.compose.ComposeDown(ctx, projectName, "", "")
+	output, err := r.compose.ComposeDown(ctx, projectName, "", "", opts)
+	run.Output = joinOutput(output)
 	if err != nil {
 		run.Result = "failed"
 		run.Error = fmt.Sprintf("compose down failed: %v", err)
@@ -284,15 +800,21 @@ func (r *Reconciler) removeStack(ctx context.Context, drift DriftResult, snap *d
 	run.Result = "success"
 	run.FinishedAt = time.Now()
 	log.Printf("[info] removal succeeded for stack %s", drift.Path)
-
-	// Mark stack as missing after removal
-	r.stateManager.UpdateStatus(drift.Path, desiredstate.StackSyncMissing, "", "")
+	r.removals.removed(drift.Path)
+	r.stateManager.ClearPendingRemoval(drift.Path, "removed")
 
 	return run
 }
 
 func (r *Reconciler) projectNamePrefix() string {
-	return ""
+	return r.instance.ProjectPrefix
+}
+
+// owner returns the owner stamped on the stacks this reconciler deploys.
+func (r *Reconciler) owner() Owner {
+	owner := r.instance
+	owner.DeployDir = r.deployDir
+	return owner
 }
 
 // GetContainers returns container details for a stack.
@@ -319,15 +841,10 @@ func deriveProjectName(prefix, stackPath string) string {
 	return prefix + "-" + sanitized
 }
 
-// isInDeployScope checks if a stack path is within the configured deploy directory.
-func isInDeployScope(stackPath, deployDir string) bool {
-	if deployDir == "" {
-		return true
-	}
-	// Stack paths are relative to deploy dir, so they are always in scope
-	// when provided from the desired state. This function filters out
-	// runtime stacks that might not belong to the deploy scope.
-	return true
+// isInDeployScope reports whether a runtime stack was deployed from deployDir.
+// Stacks without the deploy dir label are not; see Owner.AdoptUnlabeled.
+func isInDeployScope(rt StackSyncMetadata, deployDir string) bool {
+	return rt.OwnerDeployDir == deployDirLabel(deployDir)
 }
 
 // truncateError truncates an error message to a reasonable length.
@@ -338,3 +855,13 @@ func truncateError(s string) string {
 	}
 	return s[:maxLen]
 }
+
+// truncatePullError truncates a pull error, keeping enough room for the
+// registry errors of several images.
+func truncatePullError(s string) string {
+	const maxLen = 2048
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen]
+}
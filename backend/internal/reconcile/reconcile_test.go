@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,36 +17,50 @@ import (
 // --- Stubs ---
 
 type stubComposeRunner struct {
+	mu        sync.Mutex
 	upCalls   []composeCall
 	downCalls []composeCall
 	upErr     error
+	upOutput  string
 	downErr   error
 }
 
 type composeCall struct {
 	ProjectName  string
 	ComposeFile  string
+	ComposeFiles []string
+	EnvFiles     []string
 	OverrideFile string
 	WorkDir      string
+	Options      reconcile.UpOptions
+	Down         reconcile.DownOptions
 }
 
-func (s *stubComposeRunner) ComposeUp(_ context.Context, projectName, composeFile, overrideFile, workDir string) error {
+func (s *stubComposeRunner) ComposeUp(_ context.Context, projectName string, composeFiles, envFiles []string, overrideFile, workDir string, opts reconcile.UpOptions) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.upCalls = append(s.upCalls, composeCall{
 		ProjectName:  projectName,
-		ComposeFile:  composeFile,
+		ComposeFile:  composeFiles[0],
+		ComposeFiles: composeFiles,
+		EnvFiles:     envFiles,
 		OverrideFile: overrideFile,
 		WorkDir:      workDir,
+		Options:      opts,
 	})
-	return s.upErr
+	return s.upOutput, s.upErr
 }
 
-func (s *stubComposeRunner) ComposeDown(_ context.Context, projectName, composeFile, workDir string) error {
+func (s *stubComposeRunner) ComposeDown(_ context.Context, projectName, composeFile, workDir string, opts reconcile.DownOptions) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.downCalls = append(s.downCalls, composeCall{
 		ProjectName: projectName,
 		ComposeFile: composeFile,
 		WorkDir:     workDir,
+		Down:        opts,
 	})
-	return s.downErr
+	return "", s.downErr
 }
 
 func (s *stubComposeRunner) ComposePs(_ context.Context, _ string) ([]desiredstate.ContainerInfo, error) {
@@ -56,7 +73,7 @@ type stubInspector struct {
 }
 
 func (s *stubInspector) GetStackLabels(_ context.Context) (map[string]reconcile.StackSyncMetadata, error) {
-	return s.labels, s.err
+	return ownedByDefault(s.labels), s.err
 }
 
 type dynamicInspector struct {
@@ -64,16 +81,39 @@ type dynamicInspector struct {
 }
 
 func (d *dynamicInspector) GetStackLabels(_ context.Context) (map[string]reconcile.StackSyncMetadata, error) {
-	if d.labels == nil {
-		return map[string]reconcile.StackSyncMetadata{}, nil
-	}
-	return d.labels, nil
+	return ownedByDefault(d.labels), nil
+}
+
+type stubWorkspace struct {
+	dir   string
+	err   error
+	calls []string
+}
+
+func (s *stubWorkspace) Checkout(_ context.Context, project, revision, stackPath string, stackFiles []string) (string, error) {
+	s.calls = append(s.calls, project+"|"+revision+"|"+stackPath+"|"+strings.Join(stackFiles, ","))
+	return s.dir, s.err
 }
 
 // --- Test Helpers ---
 
+// ownedByDefault returns a copy of runtime with the owner labels of the
+// default instance, deploying from the repository root, stamped on the stacks
+// that carry none.
+func ownedByDefault(runtime map[string]reconcile.StackSyncMetadata) map[string]reconcile.StackSyncMetadata {
+	owned := make(map[string]reconcile.StackSyncMetadata, len(runtime))
+	for path, m := range runtime {
+		if m.OwnerInstance == "" && m.OwnerDeployDir == "" {
+			m.OwnerInstance = reconcile.DefaultInstanceID
+			m.OwnerDeployDir = "/"
+		}
+		owned[path] = m
+	}
+	return owned
+}
+
 func newTestDriftDetector(deployDir string) *reconcile.DriftDetector {
-	return reconcile.NewDriftDetector(deployDir, slog.Default())
+	return reconcile.NewDriftDetector(reconcile.Owner{DeployDir: deployDir}, slog.Default())
 }
 
 func newTestStateManager(store *desiredstate.Store, compose reconcile.ComposeRunner) *reconcile.StateManager {
@@ -92,7 +132,7 @@ func TestDetectDrift_NoRuntime_NeedsSync(t *testing.T) {
 	runtime := map[string]reconcile.StackSyncMetadata{}
 
 	dd := newTestDriftDetector("")
-	drifts := dd.DetectChanges(context.Background(), desired, runtime, false)
+	drifts := dd.DetectChanges(context.Background(), desired, ownedByDefault(runtime), false)
 
 	if len(drifts) != 1 {
 		t.Fatalf("expected 1 drift result, got %d", len(drifts))
@@ -117,7 +157,7 @@ func TestDetectDrift_MissingMetadata_NeedsSync(t *testing.T) {
 	}
 
 	dd := newTestDriftDetector("")
-	drifts := dd.DetectChanges(context.Background(), desired, runtime, false)
+	drifts := dd.DetectChanges(context.Background(), desired, ownedByDefault(runtime), false)
 
 	if len(drifts) != 1 {
 		t.Fatalf("expected 1 drift result, got %d", len(drifts))
@@ -139,7 +179,7 @@ func TestDetectDrift_RevisionDriftIgnored(t *testing.T) {
 	}
 
 	dd := newTestDriftDetector("")
-	drifts := dd.DetectChanges(context.Background(), desired, runtime, false)
+	drifts := dd.DetectChanges(context.Background(), desired, ownedByDefault(runtime), false)
 
 	if len(drifts) != 1 {
 		t.Fatalf("expected 1 drift result, got %d", len(drifts))
@@ -164,7 +204,7 @@ func TestDetectDrift_ComposeHashDrift(t *testing.T) {
 	}
 
 	dd := newTestDriftDetector("")
-	drifts := dd.DetectChanges(context.Background(), desired, runtime, false)
+	drifts := dd.DetectChanges(context.Background(), desired, ownedByDefault(runtime), false)
 
 	if len(drifts) != 1 {
 		t.Fatalf("expected 1 drift result, got %d", len(drifts))
@@ -186,7 +226,7 @@ func TestDetectDrift_InSync(t *testing.T) {
 	}
 
 	dd := newTestDriftDetector("")
-	drifts := dd.DetectChanges(context.Background(), desired, runtime, false)
+	drifts := dd.DetectChanges(context.Background(), desired, ownedByDefault(runtime), false)
 
 	if len(drifts) != 1 {
 		t.Fatalf("expected 1 drift result, got %d", len(drifts))
@@ -209,7 +249,7 @@ func TestDetectDrift_RemovalDetected(t *testing.T) {
 	}
 
 	dd := newTestDriftDetector("")
-	drifts := dd.DetectChanges(context.Background(), desired, runtime, true)
+	drifts := dd.DetectChanges(context.Background(), desired, ownedByDefault(runtime), true)
 
 	if len(drifts) != 1 {
 		t.Fatalf("expected 1 drift result, got %d", len(drifts))
@@ -229,13 +269,73 @@ func TestDetectDrift_RemovalDisabled(t *testing.T) {
 	}
 
 	dd := newTestDriftDetector("")
-	drifts := dd.DetectChanges(context.Background(), desired, runtime, false)
+	drifts := dd.DetectChanges(context.Background(), desired, ownedByDefault(runtime), false)
 
 	if len(drifts) != 0 {
 		t.Errorf("expected 0 drift results with removal disabled, got %d", len(drifts))
 	}
 }
 
+func TestDetectDrift_IgnoresOtherOwners(t *testing.T) {
+	desired := []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "hash1"},
+	}
+	runtime := map[string]reconcile.StackSyncMetadata{
+		// Same path, deployed by another instance: not ours to compare.
+		"app":       {StackPath: "app", DesiredRevision: "rev1", DesiredComposeHash: "hash1", OwnerInstance: "blue", OwnerDeployDir: "/apps"},
+		"other-dir": {StackPath: "other-dir", DesiredRevision: "rev1", DesiredComposeHash: "hash2", OwnerInstance: "default", OwnerDeployDir: "/infra"},
+		"mine":      {StackPath: "mine", DesiredRevision: "rev1", DesiredComposeHash: "hash3", OwnerInstance: "default", OwnerDeployDir: "/apps"},
+		// A compose project started by hand that carries our stack label.
+		"hand-started": {StackPath: "hand-started", DesiredRevision: "rev1", DesiredComposeHash: "hash4", ProjectName: "myproject"},
+		// Deployed before owner labels were stamped.
+		"legacy": {StackPath: "legacy", DesiredRevision: "rev1", DesiredComposeHash: "hash5", ProjectName: "legacy"},
+	}
+
+	detect := func(owner reconcile.Owner) map[string]reconcile.DriftResult {
+		byPath := make(map[string]reconcile.DriftResult)
+		for _, d := range reconcile.NewDriftDetector(owner, slog.Default()).DetectChanges(context.Background(), desired, runtime, true) {
+			byPath[d.Path] = d
+		}
+		return byPath
+	}
+
+	byPath := detect(reconcile.Owner{DeployDir: "apps"})
+	if len(byPath) != 2 || !byPath["app"].NeedSync || !byPath["mine"].NeedRemove {
+		t.Errorf("expected app to need a sync and only mine to be removed, got %+v", byPath)
+	}
+	byPath = detect(reconcile.Owner{DeployDir: "apps", AdoptUnlabeled: true})
+	if len(byPath) != 3 || !byPath["mine"].NeedRemove || !byPath["legacy"].NeedRemove {
+		t.Errorf("expected only the unlabeled stack with a matching project to be adopted, got %+v", byPath)
+	}
+}
+
+func TestReconcile_InstancePrefixesProjects(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{
+		Revision: "rev1",
+		Stacks: []desiredstate.StackRecord{
+			{Path: "apps/web", ComposeFile: "docker-compose.yml", ComposeHash: "hash1", Status: desiredstate.StackSyncMissing, Content: []byte("services:\n  web:\n    image: nginx\n")},
+		},
+	})
+	policy := reconcile.DefaultPolicy()
+	policy.RemoveEnabled = true
+
+	compose := &stubComposeRunner{}
+	inspector := &stubInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"old": {StackPath: "old", DesiredRevision: "rev0", DesiredComposeHash: "hash0", OwnerInstance: "green"},
+	}}
+	r := reconcile.NewReconciler(store, policy, compose, inspector, reconcile.NewAckStore(), "", reconcile.NewDriftDetector(reconcile.Owner{InstanceID: "blue"}, slog.Default()), newTestStateManager(store, compose))
+	r.SetOwner(reconcile.Owner{InstanceID: "blue", ProjectPrefix: "blue"})
+	r.Reconcile(context.Background())
+
+	if len(compose.upCalls) != 1 || compose.upCalls[0].ProjectName != "blue-apps-web" {
+		t.Errorf("expected project blue-apps-web, got %+v", compose.upCalls)
+	}
+	if len(compose.downCalls) != 0 {
+		t.Errorf("expected stack of another instance to be kept, got %+v", compose.downCalls)
+	}
+}
+
 // --- T012/T030: Reconcile cycle tests ---
 
 func TestReconcile_DriftedStack_Synced(t *testing.T) {
@@ -285,6 +385,120 @@ func TestReconcile_DriftedStack_Synced(t *testing.T) {
 	}
 }
 
+func TestReconcile_Workspace_UsesCheckedOutStackDir(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{
+		Revision:      "rev1",
+		RefreshStatus: desiredstate.RefreshStatusCompleted,
+		Stacks: []desiredstate.StackRecord{
+			{Path: "infra/proxy", ComposeFile: "compose.yaml", ComposeHash: "hash1", Status: desiredstate.StackSyncMissing, Content: []byte("services:\n  web:\n    image: nginx\n")},
+		},
+	})
+
+	compose := &stubComposeRunner{}
+	inspector := &stubInspector{labels: map[string]reconcile.StackSyncMetadata{}}
+	workspace := &stubWorkspace{dir: "/srv/docker-cd/infra-proxy/infra/proxy"}
+
+	r := reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	r.SetWorkspace(workspace)
+	runs := r.Reconcile(context.Background())
+
+	if len(runs) != 1 || runs[0].Result != "success" {
+		t.Fatalf("expected 1 successful run, got %+v", runs)
+	}
+	if len(workspace.calls) != 1 || workspace.calls[0] != "infra-proxy|rev1|infra/proxy|compose.yaml" {
+		t.Errorf("unexpected checkout calls %v", workspace.calls)
+	}
+	call := compose.upCalls[0]
+	if call.ComposeFile != "/srv/docker-cd/infra-proxy/infra/proxy/compose.yaml" {
+		t.Errorf("expected checked-out compose file, got %q", call.ComposeFile)
+	}
+	if call.WorkDir != workspace.dir {
+		t.Errorf("expected work dir %q, got %q", workspace.dir, call.WorkDir)
+	}
+	if call.OverrideFile == "" || strings.HasPrefix(call.OverrideFile, workspace.dir) {
+		t.Errorf("expected override outside the stack dir, got %q", call.OverrideFile)
+	}
+}
+
+func TestReconcile_MultiFileStack_PassesFilesInOrder(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{
+		Revision:      "rev1",
+		RefreshStatus: desiredstate.RefreshStatusCompleted,
+		Stacks: []desiredstate.StackRecord{
+			{
+				Path:         "app1",
+				ComposeFile:  "docker-compose.yml",
+				ComposeFiles: []string{"docker-compose.yml", "docker-compose.prod.yml", "../base.yml"},
+				EnvFiles:     []string{".env"},
+				ComposeHash:  "hash1",
+				Status:       desiredstate.StackSyncMissing,
+				Content:      []byte("services:\n  web:\n    image: nginx\n"),
+				Files: map[string][]byte{
+					"docker-compose.yml":      []byte("services:\n  web:\n    image: nginx\n"),
+					"docker-compose.prod.yml": []byte("services:\n  web:\n    restart: always\n"),
+					"../base.yml":             []byte("services:\n  db:\n    image: postgres\n"),
+					".env":                    []byte("TAG=1\n"),
+				},
+			},
+		},
+	})
+
+	compose := &stubComposeRunner{}
+	inspector := &stubInspector{labels: map[string]reconcile.StackSyncMetadata{}}
+
+	r := reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	runs := r.Reconcile(context.Background())
+
+	if len(runs) != 1 || runs[0].Result != "success" {
+		t.Fatalf("expected 1 successful run, got %+v", runs)
+	}
+	call := compose.upCalls[0]
+	want := []string{
+		filepath.Join(call.WorkDir, "docker-compose.yml"),
+		filepath.Join(call.WorkDir, "docker-compose.prod.yml"),
+		filepath.Join(filepath.Dir(call.WorkDir), "base.yml"),
+	}
+	if strings.Join(call.ComposeFiles, ",") != strings.Join(want, ",") {
+		t.Errorf("expected compose files %v, got %v", want, call.ComposeFiles)
+	}
+	if len(call.EnvFiles) != 1 || call.EnvFiles[0] != filepath.Join(call.WorkDir, ".env") {
+		t.Errorf("unexpected env files %v", call.EnvFiles)
+	}
+	if strings.HasPrefix(call.OverrideFile, call.WorkDir) {
+		t.Errorf("expected override outside the stack dir, got %q", call.OverrideFile)
+	}
+}
+
+func TestReconcile_Workspace_CheckoutFailure(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{
+		Revision:      "rev1",
+		RefreshStatus: desiredstate.RefreshStatusCompleted,
+		Stacks: []desiredstate.StackRecord{
+			{Path: "app1", ComposeFile: "docker-compose.yml", ComposeHash: "hash1", Status: desiredstate.StackSyncMissing, Content: []byte("services:\n  web:\n    image: nginx\n")},
+		},
+	})
+
+	compose := &stubComposeRunner{}
+	inspector := &stubInspector{labels: map[string]reconcile.StackSyncMetadata{}}
+
+	r := reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	r.SetWorkspace(&stubWorkspace{err: fmt.Errorf("fetch failed")})
+	runs := r.Reconcile(context.Background())
+
+	if len(runs) != 1 || runs[0].Result != "failed" {
+		t.Fatalf("expected 1 failed run, got %+v", runs)
+	}
+	if len(compose.upCalls) != 0 {
+		t.Errorf("expected no compose up after failed checkout, got %d", len(compose.upCalls))
+	}
+	if snap := store.Get(); snap.Stacks[0].Status != desiredstate.StackSyncFailed {
+		t.Errorf("expected failed status, got %q", snap.Stacks[0].Status)
+	}
+}
+
 func TestReconcile_AlreadySynced_NoOp(t *testing.T) {
 	store := desiredstate.NewStore()
 	store.Set(&desiredstate.Snapshot{
@@ -498,6 +712,80 @@ func TestReconcile_ConcurrencyMutex(t *testing.T) {
 	}
 }
 
+// slowComposeRunner blocks compose up for the "slow" project until every
+// other project has been brought up, and fails the "broken" project.
+type slowComposeRunner struct {
+	stubComposeRunner
+	others  sync.WaitGroup
+	timeout time.Duration
+}
+
+func (s *slowComposeRunner) ComposeUp(ctx context.Context, projectName string, composeFiles, envFiles []string, overrideFile, workDir string, opts reconcile.UpOptions) (string, error) {
+	_, _ = s.stubComposeRunner.ComposeUp(ctx, projectName, composeFiles, envFiles, overrideFile, workDir, opts)
+	switch projectName {
+	case "slow":
+		done := make(chan struct{})
+		go func() { s.others.Wait(); close(done) }()
+		select {
+		case <-done:
+			return "", nil
+		case <-time.After(s.timeout):
+			return "", fmt.Errorf("other stacks were blocked behind the slow stack")
+		}
+	case "broken":
+		s.others.Done()
+		return "", fmt.Errorf("image pull failed")
+	default:
+		s.others.Done()
+		return "", nil
+	}
+}
+
+func TestReconcile_WorkerPool_SlowStackDoesNotBlockOthers(t *testing.T) {
+	store := desiredstate.NewStore()
+	composeContent := []byte("services:\n  web:\n    image: nginx\n")
+	var stacks []desiredstate.StackRecord
+	for _, path := range []string{"slow", "app1", "broken", "app2"} {
+		stacks = append(stacks, desiredstate.StackRecord{Path: path, ComposeFile: "docker-compose.yml", ComposeHash: "h-" + path, Status: desiredstate.StackSyncMissing, Content: composeContent})
+	}
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: stacks})
+
+	compose := &slowComposeRunner{timeout: 2 * time.Second}
+	compose.others.Add(3)
+	inspector := &stubInspector{labels: map[string]reconcile.StackSyncMetadata{}}
+
+	policy := reconcile.DefaultPolicy()
+	policy.MaxConcurrency = 2
+
+	r := reconcile.NewReconciler(store, policy, compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	runs := r.Reconcile(context.Background())
+
+	if len(runs) != 4 {
+		t.Fatalf("expected 4 runs, got %d", len(runs))
+	}
+	results := make(map[string]string)
+	for _, run := range runs {
+		results[run.StackPath] = run.Result
+	}
+	want := map[string]string{"slow": "success", "app1": "success", "broken": "failed", "app2": "success"}
+	for path, result := range want {
+		if results[path] != result {
+			t.Errorf("stack %s: expected %s, got %s", path, result, results[path])
+		}
+	}
+
+	// Every concurrent status update must have landed in the store.
+	for _, st := range store.GetStacks() {
+		wantStatus := desiredstate.StackSyncSynced
+		if st.Path == "broken" {
+			wantStatus = desiredstate.StackSyncFailed
+		}
+		if st.Status != wantStatus {
+			t.Errorf("stack %s: expected status %s, got %s", st.Path, wantStatus, st.Status)
+		}
+	}
+}
+
 func TestReconcile_CachePreservedOnFailure(t *testing.T) {
 	store := desiredstate.NewStore()
 	composeContent := []byte("services:\n  web:\n    image: nginx\n")
@@ -713,3 +1001,84 @@ func TestReconcile_NoOp_MultipleStacksInSync(t *testing.T) {
 		t.Errorf("expected 0 compose down calls, got %d", len(compose.downCalls))
 	}
 }
+
+// --- Per-stack settings tests ---
+
+func TestReconcile_StackSettings_OverrideGlobalPolicy(t *testing.T) {
+	store := desiredstate.NewStore()
+	composeContent := []byte("services:\n  web:\n    image: nginx\n")
+	protect := false
+	store.Set(&desiredstate.Snapshot{
+		Revision: "rev1",
+		Stacks: []desiredstate.StackRecord{
+			{Path: "app1", ComposeFile: "docker-compose.yml", ComposeHash: "hash1", Status: desiredstate.StackSyncMissing, Content: composeContent,
+				Settings: &desiredstate.StackSettings{Profiles: []string{"web"}, PullPolicy: "always", Remove: &protect}},
+			{Path: "app2", ComposeFile: "docker-compose.yml", ComposeHash: "hash2", Status: desiredstate.StackSyncMissing, Content: composeContent,
+				Settings: &desiredstate.StackSettings{DriftPolicy: "flag"}},
+			{Path: "app3", ComposeFile: "docker-compose.yml", ComposeHash: "hash3", Status: desiredstate.StackSyncMissing, Content: composeContent,
+				Settings: &desiredstate.StackSettings{Suspended: true}},
+		},
+	})
+
+	compose := &stubComposeRunner{}
+	inspector := &stubInspector{labels: map[string]reconcile.StackSyncMetadata{}}
+
+	r := reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	runs := r.Reconcile(context.Background())
+
+	if len(runs) != 1 || runs[0].StackPath != "app1" {
+		t.Fatalf("expected only app1 to sync (app2 flagged, app3 suspended), got %+v", runs)
+	}
+	opts := compose.upCalls[0].Options
+	if strings.Join(opts.Profiles, ",") != "web" || opts.PullPolicy != "always" {
+		t.Errorf("expected profiles and pull policy from settings, got %+v", opts)
+	}
+}
+
+func TestReconcile_RemoveLabelOverridesGlobalPolicy(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: []desiredstate.StackRecord{}})
+
+	policy := reconcile.DefaultPolicy()
+	policy.RemoveEnabled = true
+
+	compose := &stubComposeRunner{}
+	inspector := &stubInspector{
+		labels: map[string]reconcile.StackSyncMetadata{
+			"protected": {StackPath: "protected", DesiredRevision: "rev0", DesiredComposeHash: "h", RemovePolicy: "false"},
+			"removable": {StackPath: "removable", DesiredRevision: "rev0", DesiredComposeHash: "h"},
+		},
+	}
+
+	r := reconcile.NewReconciler(store, policy, compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	runs := r.Reconcile(context.Background())
+
+	if len(runs) != 1 || runs[0].StackPath != "removable" {
+		t.Fatalf("expected only the unprotected stack to be removed, got %+v", runs)
+	}
+	if len(compose.downCalls) != 1 || compose.downCalls[0].ProjectName != "removable" {
+		t.Errorf("unexpected compose down calls: %+v", compose.downCalls)
+	}
+}
+
+func TestReconciliationPolicy_ForStack(t *testing.T) {
+	keep := false
+	settings := &desiredstate.StackSettings{
+		DriftPolicy: "flag",
+		Remove:      &keep,
+		SyncTimeout: desiredstate.Duration(2 * time.Minute),
+	}
+	base := reconcile.DefaultPolicy()
+	base.RemoveEnabled = true
+
+	got := base.ForStack(settings)
+	if got.DriftPolicy != "flag" || got.RemoveEnabled || got.SyncTimeout != 2*time.Minute {
+		t.Errorf("settings not applied: %+v", got)
+	}
+	if !got.Enabled || got.MaxConcurrency != 1 {
+		t.Errorf("global fields must be kept: %+v", got)
+	}
+	if nilGot := base.ForStack(nil); nilGot.DriftPolicy != "revert" || !nilGot.RemoveEnabled {
+		t.Errorf("nil settings must keep the global policy: %+v", nilGot)
+	}
+}
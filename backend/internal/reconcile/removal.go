@@ -0,0 +1,303 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+)
+
+// TriggerConfirmRemoval is the trigger source of removals run after an
+// operator confirmed them.
+const TriggerConfirmRemoval = "confirm_removal"
+
+// ErrNoPendingRemoval is returned when confirming the removal of a stack that
+// is not pending removal.
+var ErrNoPendingRemoval = fmt.Errorf("%w: no pending removal", ErrStackNotFound)
+
+// PendingRemoval is a running stack that was deleted from Git and has not
+// been removed yet. Times are RFC3339.
+type PendingRemoval struct {
+	StackPath string                       `json:"stackPath"`
+	Status    desiredstate.StackSyncStatus `json:"status"`
+	// Since is when a reconcile first found the stack deleted from Git.
+	Since string `json:"since"`
+	// Refreshes counts the Git refreshes that found it deleted since then.
+	Refreshes int `json:"refreshes"`
+	// RemoveAt is when the grace period ends, empty without one.
+	RemoveAt string `json:"removeAt,omitempty"`
+	// Confirmed removals skip the grace period and the mass-removal check.
+	Confirmed bool `json:"confirmed,omitempty"`
+	// RemoveVolumes is set when the confirmation opted in to removing the
+	// stack's named volumes.
+	RemoveVolumes bool `json:"removeVolumes,omitempty"`
+	// Blocked is why the last reconcile held the removal back.
+	Blocked string `json:"blocked,omitempty"`
+}
+
+// RemovalState is the grace period state of one stack deleted from Git.
+type RemovalState struct {
+	// Since is when a reconcile first found the stack deleted from Git.
+	Since time.Time `json:"since"`
+	// RefreshedAt is the time of the last refresh that found it deleted.
+	RefreshedAt time.Time `json:"refreshedAt"`
+	Refreshes   int       `json:"refreshes"`
+	Confirmed   bool      `json:"confirmed,omitempty"`
+	// RemoveVolumes is set when the confirmation opted in to removing the
+	// stack's named volumes.
+	RemoveVolumes bool `json:"removeVolumes,omitempty"`
+
+	// blocked is recomputed by every reconcile and not persisted.
+	blocked string
+}
+
+// RemovalPersister stores the grace period state of stacks pending removal
+// so it survives restarts.
+type RemovalPersister interface {
+	LoadRemovals() (map[string]RemovalState, error)
+	SaveRemoval(path string, st RemovalState) error
+	DeleteRemoval(path string) error
+}
+
+// removalTracker remembers since when stacks deleted from Git have been
+// pending removal. Without a persister it is kept in memory and the grace
+// period starts over after a restart.
+type removalTracker struct {
+	mu        sync.Mutex
+	stacks    map[string]*RemovalState
+	now       func() time.Time
+	persister RemovalPersister
+}
+
+func newRemovalTracker() *removalTracker {
+	return &removalTracker{stacks: make(map[string]*RemovalState), now: time.Now}
+}
+
+// setPersister restores the state saved by p and saves every later change
+// with it.
+func (t *removalTracker) setPersister(p RemovalPersister) error {
+	saved, err := p.LoadRemovals()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for path, st := range saved {
+		t.stacks[path] = &st
+	}
+	t.persister = p
+	return nil
+}
+
+// observe records the stacks a reconcile found deleted from Git, with the
+// time of the refresh it saw. Stacks no longer deleted are forgotten and
+// returned.
+func (t *removalTracker) observe(paths []string, refreshedAt time.Time) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		seen[path] = true
+		st, ok := t.stacks[path]
+		if !ok {
+			st = &RemovalState{Since: t.now(), RefreshedAt: refreshedAt, Refreshes: 1}
+			t.stacks[path] = st
+			t.saveLocked(path, st)
+			continue
+		}
+		if !refreshedAt.Equal(st.RefreshedAt) {
+			st.RefreshedAt = refreshedAt
+			st.Refreshes++
+			t.saveLocked(path, st)
+		}
+	}
+	var forgotten []string
+	for path := range t.stacks {
+		if !seen[path] {
+			t.deleteLocked(path)
+			forgotten = append(forgotten, path)
+		}
+	}
+	return forgotten
+}
+
+// get returns a copy of the state of path. Untracked stacks are reported as
+// found deleted just now.
+func (t *removalTracker) get(path string) RemovalState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if st, ok := t.stacks[path]; ok {
+		return *st
+	}
+	return RemovalState{Since: t.now(), Refreshes: 1}
+}
+
+// confirm confirms the removal of a pending stack. It reports false if the
+// stack is not pending removal.
+func (t *removalTracker) confirm(path string, volumes bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.stacks[path]
+	if !ok {
+		return false
+	}
+	st.Confirmed = true
+	st.RemoveVolumes = volumes
+	t.saveLocked(path, st)
+	return true
+}
+
+// setBlocked records why the removal of path was held back; "" clears it.
+func (t *removalTracker) setBlocked(path, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if st, ok := t.stacks[path]; ok {
+		st.blocked = reason
+	}
+}
+
+// removed forgets a stack after its removal.
+func (t *removalTracker) removed(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.stacks[path]; ok {
+		t.deleteLocked(path)
+	}
+}
+
+func (t *removalTracker) saveLocked(path string, st *RemovalState) {
+	if t.persister != nil {
+		if err := t.persister.SaveRemoval(path, *st); err != nil {
+			log.Printf("[warn] failed to persist pending removal of stack %s: %v", path, err)
+		}
+	}
+}
+
+func (t *removalTracker) deleteLocked(path string) {
+	delete(t.stacks, path)
+	if t.persister != nil {
+		if err := t.persister.DeleteRemoval(path); err != nil {
+			log.Printf("[warn] failed to delete persisted pending removal of stack %s: %v", path, err)
+		}
+	}
+}
+
+// list returns the pending removals sorted by path.
+func (t *removalTracker) list(grace time.Duration) []PendingRemoval {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	removals := make([]PendingRemoval, 0, len(t.stacks))
+	for path, st := range t.stacks {
+		pr := PendingRemoval{
+			StackPath:     path,
+			Status:        desiredstate.StackSyncPendingRemoval,
+			Since:         st.Since.UTC().Format(time.RFC3339),
+			Refreshes:     st.Refreshes,
+			Confirmed:     st.Confirmed,
+			RemoveVolumes: st.RemoveVolumes,
+			Blocked:       st.blocked,
+		}
+		if grace > 0 {
+			pr.RemoveAt = st.Since.Add(grace).UTC().Format(time.RFC3339)
+		}
+		removals = append(removals, pr)
+	}
+	sort.Slice(removals, func(i, j int) bool { return removals[i].StackPath < removals[j].StackPath })
+	return removals
+}
+
+// removalBlocked returns why the removal of path is held back, or "".
+// pending is the number of stacks deleted from Git and running the number of
+// running stacks owned by this instance, for the mass-removal check.
+func (r *Reconciler) removalBlocked(path string, pending, running int) string {
+	st := r.removals.get(path)
+	if st.Confirmed {
+		return ""
+	}
+	if grace := r.policy.RemovalGracePeriod; grace > 0 {
+		if removeAt := st.Since.Add(grace); r.removals.now().Before(removeAt) {
+			return "pending removal until " + removeAt.UTC().Format(time.RFC3339)
+		}
+	}
+	if n := r.policy.RemovalGraceRefreshes; st.Refreshes < n {
+		return fmt.Sprintf("pending removal, deleted in %d of %d refreshes", st.Refreshes, n)
+	}
+	if limit := r.policy.RemovalMaxPercent; limit > 0 && pending*100 > limit*running {
+		return fmt.Sprintf("mass removal: %d of %d stacks deleted from Git, more than %d%%", pending, running, limit)
+	}
+	return ""
+}
+
+// runningInScope counts the running stacks owned by this instance.
+func (r *Reconciler) runningInScope(runtime map[string]StackSyncMetadata) int {
+	n := 0
+	for _, rt := range runtime {
+		if r.owner().Owns(rt) {
+			n++
+		}
+	}
+	return n
+}
+
+// trackRemovals updates the grace period state of the stacks drifts remove
+// and returns why each of them is held back ("" to remove it now). Stacks
+// held back are listed with the status pending_removal until they are
+// removed or restored in Git.
+func (r *Reconciler) trackRemovals(ctx context.Context, drifts []DriftResult, snap *desiredstate.Snapshot, runtime map[string]StackSyncMetadata) map[string]string {
+	var paths []string
+	for _, drift := range drifts {
+		if drift.NeedRemove {
+			paths = append(paths, drift.Path)
+		}
+	}
+	for _, path := range r.removals.observe(paths, snap.RefreshedAt) {
+		r.stateManager.ClearPendingRemoval(path, "no longer deleted from Git")
+	}
+
+	running := r.runningInScope(runtime)
+	blocked := make(map[string]string, len(paths))
+	for _, path := range paths {
+		reason := r.removalBlocked(path, len(paths), running)
+		if reason != "" && reason != r.removals.get(path).blocked {
+			log.Printf("[info] removal of stack %s held back: %s", path, reason)
+		}
+		r.removals.setBlocked(path, reason)
+		blocked[path] = reason
+		if reason != "" {
+			r.stateManager.MarkPendingRemoval(path, runtime[path], reason)
+			r.stateManager.UpdateContainerCounts(ctx, path, deriveProjectName(r.projectNamePrefix(), path))
+		}
+	}
+	return blocked
+}
+
+// SetRemovalPersister restores the grace period state saved by p and
+// persists later changes with it.
+func (r *Reconciler) SetRemovalPersister(p RemovalPersister) error {
+	return r.removals.setPersister(p)
+}
+
+// PendingRemovals lists the stacks deleted from Git that are still running
+// because their removal is held back or has not run yet.
+func (r *Reconciler) PendingRemovals() []PendingRemoval {
+	return r.removals.list(r.policy.RemovalGracePeriod)
+}
+
+// ConfirmRemoval confirms the removal of a stack pending removal and removes
+// it right away, skipping its grace period and the mass-removal check. Its
+// named volumes are removed as well if removeVolumes is set. The returned
+// runs are those of the removal.
+func (r *Reconciler) ConfirmRemoval(ctx context.Context, path string, removeVolumes bool) ([]ReconciliationRun, error) {
+	if !r.policy.Enabled || r.policy.DryRun {
+		return nil, ErrReconcileDisabled
+	}
+	if !r.removals.confirm(path, removeVolumes) {
+		return nil, ErrNoPendingRemoval
+	}
+	log.Printf("[info] removal of stack %s confirmed (volumes: %v)", path, removeVolumes)
+	return r.CheckStacks(WithTrigger(ctx, TriggerConfirmRemoval), []string{path}), nil
+}
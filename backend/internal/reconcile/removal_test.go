@@ -0,0 +1,195 @@
+package reconcile_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+func newRemovalReconciler(store *desiredstate.Store, compose reconcile.ComposeRunner, inspector reconcile.ContainerInspector, policy reconcile.ReconciliationPolicy) *reconcile.Reconciler {
+	policy.RemoveEnabled = true
+	r := reconcile.NewReconciler(store, policy, compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	r.SetHistory(reconcile.NewMemoryHistory(0))
+	return r
+}
+
+func TestRemoval_WaitsForGraceRefreshes(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", RefreshedAt: time.Unix(100, 0)})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"old": {StackPath: "old", DesiredRevision: "rev1", DesiredComposeHash: "h1"},
+	}}
+	compose := &stubComposeRunner{}
+	policy := reconcile.DefaultPolicy()
+	policy.RemovalGraceRefreshes = 2
+	r := newRemovalReconciler(store, compose, inspector, policy)
+
+	// Reconciles without a new refresh do not count.
+	r.Reconcile(context.Background())
+	r.Reconcile(context.Background())
+	if len(compose.downCalls) != 0 {
+		t.Fatalf("expected removal held back, got %d down calls", len(compose.downCalls))
+	}
+	pending := r.PendingRemovals()
+	if len(pending) != 1 || pending[0].Status != desiredstate.StackSyncPendingRemoval || pending[0].Refreshes != 1 || !strings.HasPrefix(pending[0].Blocked, "pending removal") {
+		t.Fatalf("unexpected pending removals %+v", pending)
+	}
+	if plan, _ := r.Plan(context.Background()); plan.Stacks[0].Action != reconcile.PlanActionRemove || !strings.HasPrefix(plan.Stacks[0].Blocked, "pending removal") {
+		t.Errorf("expected plan to report the removal as pending, got %+v", plan.Stacks[0])
+	}
+	stacks := store.GetAllStacks()
+	if len(stacks) != 1 || stacks[0].Path != "old" || stacks[0].Status != desiredstate.StackSyncPendingRemoval ||
+		stacks[0].SyncedRevision != "rev1" || !strings.HasPrefix(stacks[0].LastSyncError, "pending removal") {
+		t.Fatalf("expected the stack listed pending removal, got %+v", stacks)
+	}
+
+	store.MarkRefreshed(time.Unix(200, 0))
+	runs := r.Reconcile(context.Background())
+	if len(runs) != 1 || runs[0].Result != "success" || len(compose.downCalls) != 1 {
+		t.Fatalf("expected removal after the second refresh, got %+v", runs)
+	}
+	if compose.downCalls[0].Down.RemoveVolumes {
+		t.Error("expected volumes kept without confirmation")
+	}
+	if pending := r.PendingRemovals(); len(pending) != 0 {
+		t.Errorf("expected no pending removals after removal, got %+v", pending)
+	}
+	if stacks := store.GetAllStacks(); len(stacks) != 0 {
+		t.Errorf("expected removed stack no longer listed, got %+v", stacks)
+	}
+}
+
+// memoryRemovalPersister stands in for the database across a restart.
+type memoryRemovalPersister struct {
+	removals map[string]reconcile.RemovalState
+}
+
+func (p *memoryRemovalPersister) LoadRemovals() (map[string]reconcile.RemovalState, error) {
+	saved := make(map[string]reconcile.RemovalState, len(p.removals))
+	for path, st := range p.removals {
+		saved[path] = st
+	}
+	return saved, nil
+}
+
+func (p *memoryRemovalPersister) SaveRemoval(path string, st reconcile.RemovalState) error {
+	p.removals[path] = st
+	return nil
+}
+
+func (p *memoryRemovalPersister) DeleteRemoval(path string) error {
+	delete(p.removals, path)
+	return nil
+}
+
+func TestRemoval_GraceRefreshesSurviveRestart(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", RefreshedAt: time.Unix(100, 0)})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"old": {StackPath: "old", DesiredRevision: "rev1", DesiredComposeHash: "h1"},
+	}}
+	compose := &stubComposeRunner{}
+	policy := reconcile.DefaultPolicy()
+	policy.RemovalGraceRefreshes = 2
+	persister := &memoryRemovalPersister{removals: make(map[string]reconcile.RemovalState)}
+
+	r := newRemovalReconciler(store, compose, inspector, policy)
+	if err := r.SetRemovalPersister(persister); err != nil {
+		t.Fatalf("SetRemovalPersister: %v", err)
+	}
+	r.Reconcile(context.Background())
+	if len(compose.downCalls) != 0 || persister.removals["old"].Refreshes != 1 {
+		t.Fatalf("expected removal held back and persisted, got %d down calls, %+v", len(compose.downCalls), persister.removals)
+	}
+
+	// After a restart, the refresh seen before still counts.
+	restarted := newRemovalReconciler(store, compose, inspector, policy)
+	if err := restarted.SetRemovalPersister(persister); err != nil {
+		t.Fatalf("SetRemovalPersister: %v", err)
+	}
+	store.MarkRefreshed(time.Unix(200, 0))
+	runs := restarted.Reconcile(context.Background())
+	if len(runs) != 1 || runs[0].Result != "success" || len(compose.downCalls) != 1 {
+		t.Fatalf("expected removal after the second refresh, got %+v", runs)
+	}
+	if len(persister.removals) != 0 {
+		t.Errorf("expected persisted state deleted after removal, got %+v", persister.removals)
+	}
+}
+
+func TestRemoval_GracePeriodForgetsRestoredStack(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2"})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"app": {StackPath: "app", DesiredRevision: "rev1", DesiredComposeHash: "h1"},
+	}}
+	compose := &stubComposeRunner{}
+	policy := reconcile.DefaultPolicy()
+	policy.RemovalGracePeriod = time.Hour
+	r := newRemovalReconciler(store, compose, inspector, policy)
+
+	r.Reconcile(context.Background())
+	pending := r.PendingRemovals()
+	if len(pending) != 1 || pending[0].RemoveAt == "" || !strings.HasPrefix(pending[0].Blocked, "pending removal until") {
+		t.Fatalf("unexpected pending removals %+v", pending)
+	}
+
+	// The stack is restored in Git before the grace period ends.
+	store.Set(&desiredstate.Snapshot{Revision: "rev3", Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h1", Status: desiredstate.StackSyncSynced},
+	}})
+	r.Reconcile(context.Background())
+	if len(compose.downCalls) != 0 || len(r.PendingRemovals()) != 0 {
+		t.Errorf("expected restored stack to be kept and forgotten, got %d down calls, %+v", len(compose.downCalls), r.PendingRemovals())
+	}
+	if stacks := store.GetAllStacks(); len(stacks) != 1 || stacks[0].Status == desiredstate.StackSyncPendingRemoval {
+		t.Errorf("expected restored stack listed once as desired, got %+v", stacks)
+	}
+}
+
+func TestRemoval_MassRemovalNeedsConfirmation(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: []desiredstate.StackRecord{
+		{Path: "keep", ComposeFile: "docker-compose.yml", ComposeHash: "h1", Status: desiredstate.StackSyncSynced},
+	}})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"keep":  {StackPath: "keep", DesiredRevision: "rev1", DesiredComposeHash: "h1"},
+		"old-a": {StackPath: "old-a", DesiredRevision: "rev1", DesiredComposeHash: "ha"},
+		"old-b": {StackPath: "old-b", DesiredRevision: "rev1", DesiredComposeHash: "hb"},
+	}}
+	compose := &stubComposeRunner{}
+	policy := reconcile.DefaultPolicy()
+	policy.RemovalMaxPercent = 50
+	r := newRemovalReconciler(store, compose, inspector, policy)
+
+	r.Reconcile(context.Background())
+	if len(compose.downCalls) != 0 {
+		t.Fatalf("expected mass removal refused, got %d down calls", len(compose.downCalls))
+	}
+	pending := r.PendingRemovals()
+	if len(pending) != 2 || pending[0].StackPath != "old-a" || !strings.HasPrefix(pending[0].Blocked, "mass removal: 2 of 3") {
+		t.Fatalf("unexpected pending removals %+v", pending)
+	}
+
+	if _, err := r.ConfirmRemoval(context.Background(), "keep", false); !errors.Is(err, reconcile.ErrStackNotFound) {
+		t.Errorf("expected ErrStackNotFound for a stack not pending removal, got %v", err)
+	}
+	runs, err := r.ConfirmRemoval(context.Background(), "old-a", true)
+	if err != nil {
+		t.Fatalf("ConfirmRemoval: %v", err)
+	}
+	if len(runs) != 1 || runs[0].StackPath != "old-a" || runs[0].Result != "success" || runs[0].Trigger != reconcile.TriggerConfirmRemoval {
+		t.Fatalf("expected confirmed removal of old-a, got %+v", runs)
+	}
+	if len(compose.downCalls) != 1 || compose.downCalls[0].ProjectName != "old-a" || !compose.downCalls[0].Down.RemoveVolumes {
+		t.Errorf("expected old-a removed with its volumes, got %+v", compose.downCalls)
+	}
+	if pending := r.PendingRemovals(); len(pending) != 1 || pending[0].StackPath != "old-b" {
+		t.Errorf("expected old-b still pending, got %+v", pending)
+	}
+}
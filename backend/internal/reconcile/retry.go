@@ -0,0 +1,197 @@
+package reconcile
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+)
+
+const (
+	// DefaultRetryBaseDelay is the delay before the first retry of a failed stack.
+	DefaultRetryBaseDelay = 10 * time.Second
+	// DefaultRetryMaxDelay caps the exponential backoff.
+	DefaultRetryMaxDelay = 10 * time.Minute
+	// retryJitter spreads retries by up to ±20% so stacks that failed together
+	// (e.g. during a registry outage) do not retry in lockstep.
+	retryJitter = 0.2
+)
+
+// retryState is the backoff state of one failed stack.
+type retryState struct {
+	// hash is the desired compose hash that failed; a new hash starts over.
+	hash      string
+	attempts  int
+	nextRetry time.Time
+}
+
+// retryTracker keeps per-stack retry state and wakes the retry loop when a
+// retry is scheduled.
+type retryTracker struct {
+	mu     sync.Mutex
+	base   time.Duration
+	max    time.Duration
+	stacks map[string]*retryState
+	wake   chan struct{}
+	now    func() time.Time
+}
+
+func newRetryTracker(base, max time.Duration) *retryTracker {
+	if base <= 0 {
+		base = DefaultRetryBaseDelay
+	}
+	if max < base {
+		max = base
+	}
+	return &retryTracker{
+		base:   base,
+		max:    max,
+		stacks: make(map[string]*retryState),
+		wake:   make(chan struct{}, 1),
+		now:    time.Now,
+	}
+}
+
+// due reports whether the stack may be synced now. Stacks without a failure,
+// or whose desired hash changed since the failure, are always due.
+func (t *retryTracker) due(path, hash string) (bool, time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.stacks[path]
+	if !ok || st.hash != hash {
+		return true, time.Time{}
+	}
+	return !t.now().Before(st.nextRetry), st.nextRetry
+}
+
+// failed records a failed attempt and returns the attempt count and next retry time.
+func (t *retryTracker) failed(path, hash string) (int, time.Time) {
+	t.mu.Lock()
+	st, ok := t.stacks[path]
+	if !ok || st.hash != hash {
+		st = &retryState{hash: hash}
+		t.stacks[path] = st
+	}
+	st.attempts++
+	st.nextRetry = t.now().Add(t.backoff(st.attempts))
+	attempts, next := st.attempts, st.nextRetry
+	t.mu.Unlock()
+
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+	return attempts, next
+}
+
+// succeeded clears the retry state of a stack. It reports whether there was any.
+func (t *retryTracker) succeeded(path string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.stacks[path]
+	delete(t.stacks, path)
+	return ok
+}
+
+// retain forgets the retry state of the stacks keep rejects and returns
+// their paths.
+func (t *retryTracker) retain(keep func(path string) bool) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var dropped []string
+	for path := range t.stacks {
+		if !keep(path) {
+			delete(t.stacks, path)
+			dropped = append(dropped, path)
+		}
+	}
+	return dropped
+}
+
+// next returns the earliest scheduled retry, or false if none is pending.
+func (t *retryTracker) next() (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var earliest time.Time
+	for _, st := range t.stacks {
+		if earliest.IsZero() || st.nextRetry.Before(earliest) {
+			earliest = st.nextRetry
+		}
+	}
+	return earliest, !earliest.IsZero()
+}
+
+// backoff returns base * 2^(attempts-1), capped at max, with jitter.
+func (t *retryTracker) backoff(attempts int) time.Duration {
+	d := t.base
+	for i := 1; i < attempts && d < t.max; i++ {
+		d *= 2
+	}
+	if d > t.max {
+		d = t.max
+	}
+	jitter := 1 + retryJitter*(2*rand.Float64()-1)
+	return time.Duration(float64(d) * jitter)
+}
+
+// dropRetries forgets the retry state of the stacks a cycle no longer has to
+// sync, e.g. because they were deleted from Git or are back in sync. Their
+// past retry time would otherwise keep waking the retry loop. A non-nil only
+// limits it to those stacks.
+func (r *Reconciler) dropRetries(drifts []DriftResult, snap *desiredstate.Snapshot, only map[string]bool) {
+	needSync := make(map[string]bool, len(drifts))
+	for _, drift := range drifts {
+		if drift.NeedSync && findStack(snap, drift.Path) != nil {
+			needSync[drift.Path] = true
+		}
+	}
+	dropped := r.retries.retain(func(path string) bool {
+		return needSync[path] || (only != nil && !only[path])
+	})
+	for _, path := range dropped {
+		r.stateManager.SetRetry(path, 0, time.Time{})
+	}
+}
+
+// clearRetry forgets the retry state of a stack a cycle skipped, e.g.
+// because it is pinned or suspended, so the retry loop does not wake for it.
+func (r *Reconciler) clearRetry(path string) {
+	if r.retries.succeeded(path) {
+		r.stateManager.SetRetry(path, 0, time.Time{})
+	}
+}
+
+// RunRetries retries failed stacks when their backoff expires, independently
+// of Git refreshes. Retry cycles are at least the base delay apart. It blocks
+// until ctx is cancelled.
+func (r *Reconciler) RunRetries(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	var lastRetry time.Time
+	for {
+		if next, ok := r.retries.next(); ok {
+			// A cycle that aborted early, e.g. because the Docker daemon was
+			// unreachable, leaves its retries due.
+			if earliest := lastRetry.Add(r.retries.base); next.Before(earliest) {
+				next = earliest
+			}
+			timer.Reset(time.Until(next))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.retries.wake:
+			timer.Stop()
+		case <-timer.C:
+			lastRetry = time.Now()
+			log.Printf("[info] retrying failed stacks")
+			r.Reconcile(WithTrigger(ctx, TriggerRetry))
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package reconcile_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+// flakyComposeRunner fails the first failures compose up calls.
+type flakyComposeRunner struct {
+	stubComposeRunner
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (f *flakyComposeRunner) ComposeUp(_ context.Context, _ string, _, _ []string, _, _ string, _ reconcile.UpOptions) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return "", errors.New("registry unavailable")
+	}
+	return "", nil
+}
+
+func (f *flakyComposeRunner) upCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func newRetryReconciler(store *desiredstate.Store, compose reconcile.ComposeRunner, base time.Duration) *reconcile.Reconciler {
+	policy := reconcile.DefaultPolicy()
+	policy.RetryBaseDelay = base
+	policy.RetryMaxDelay = 4 * base
+	return reconcile.NewReconciler(store, policy, compose, &stubInspector{labels: map[string]reconcile.StackSyncMetadata{}}, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+}
+
+func retrySnapshot(hash string) *desiredstate.Snapshot {
+	return &desiredstate.Snapshot{
+		Revision: "rev1",
+		Stacks: []desiredstate.StackRecord{
+			{Path: "app1", ComposeFile: "docker-compose.yml", ComposeHash: hash, Status: desiredstate.StackSyncMissing,
+				Content: []byte("services:\n  web:\n    image: nginx\n")},
+		},
+	}
+}
+
+func TestReconcile_Retry_Backoff(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(retrySnapshot("hash1"))
+
+	compose := &flakyComposeRunner{failures: 2}
+	r := newRetryReconciler(store, compose, time.Hour)
+
+	runs := r.Reconcile(context.Background())
+	if len(runs) != 1 || runs[0].Result != "failed" {
+		t.Fatalf("expected a failed run, got %+v", runs)
+	}
+	st := store.GetStacks()[0]
+	if st.SyncAttempts != 1 || st.NextRetryAt == "" {
+		t.Fatalf("expected retry state after failure, got attempts=%d next=%q", st.SyncAttempts, st.NextRetryAt)
+	}
+	next, err := time.Parse(time.RFC3339, st.NextRetryAt)
+	if err != nil {
+		t.Fatalf("invalid nextRetryAt %q: %v", st.NextRetryAt, err)
+	}
+	if d := time.Until(next); d < 40*time.Minute || d > 80*time.Minute {
+		t.Errorf("expected first retry after about 1h, got %s", d)
+	}
+
+	// Not due yet: the stack is left alone.
+	runs = r.Reconcile(context.Background())
+	if len(runs) != 0 || compose.upCount() != 1 {
+		t.Errorf("expected no retry before backoff expires, got %d runs and %d compose up calls", len(runs), compose.upCount())
+	}
+
+	// A new desired hash is deployed right away and starts a new backoff.
+	store.Set(retrySnapshot("hash2"))
+	runs = r.Reconcile(context.Background())
+	if len(runs) != 1 || compose.upCount() != 2 {
+		t.Fatalf("expected new hash to be synced immediately, got %d runs", len(runs))
+	}
+	if st := store.GetStacks()[0]; st.SyncAttempts != 1 {
+		t.Errorf("expected attempts to restart for the new hash, got %d", st.SyncAttempts)
+	}
+}
+
+func TestReconcile_Retry_ClearedOnSuccess(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(retrySnapshot("hash1"))
+
+	compose := &flakyComposeRunner{failures: 1}
+	r := newRetryReconciler(store, compose, 10*time.Millisecond)
+
+	r.Reconcile(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	runs := r.Reconcile(context.Background())
+
+	if len(runs) != 1 || runs[0].Result != "success" {
+		t.Fatalf("expected retry to succeed, got %+v", runs)
+	}
+	st := store.GetStacks()[0]
+	if st.Status != desiredstate.StackSyncSynced || st.SyncAttempts != 0 || st.NextRetryAt != "" {
+		t.Errorf("expected retry state to be cleared, got %+v", st)
+	}
+}
+
+func TestReconcile_Retry_ClearedWhenSuspended(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(retrySnapshot("hash1"))
+
+	compose := &flakyComposeRunner{failures: 1}
+	r := newRetryReconciler(store, compose, 10*time.Millisecond)
+
+	r.Reconcile(context.Background())
+	if _, ok := reconcile.TestNextRetry(r); !ok {
+		t.Fatal("expected a retry after the failed sync")
+	}
+	if _, err := r.Suspend("app1", "alice", "incident", time.Time{}); err != nil {
+		t.Fatalf("Suspend: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// The due retry is skipped; it must not wake the retry loop again.
+	if runs := r.Reconcile(context.Background()); len(runs) != 0 {
+		t.Fatalf("expected suspended stack to be skipped, got %+v", runs)
+	}
+	if next, ok := reconcile.TestNextRetry(r); ok {
+		t.Errorf("expected no pending retry, got one at %s", next)
+	}
+	if st := store.GetStacks()[0]; st.SyncAttempts != 0 || st.NextRetryAt != "" {
+		t.Errorf("expected retry state cleared, got attempts=%d next=%q", st.SyncAttempts, st.NextRetryAt)
+	}
+}
+
+func TestReconcile_Retry_ClearedWhenStackDeleted(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(retrySnapshot("hash1"))
+
+	compose := &flakyComposeRunner{failures: 1}
+	r := newRetryReconciler(store, compose, 10*time.Millisecond)
+
+	r.Reconcile(context.Background())
+	store.Set(&desiredstate.Snapshot{Revision: "rev2"})
+	r.Reconcile(context.Background())
+	if next, ok := reconcile.TestNextRetry(r); ok {
+		t.Errorf("expected no pending retry for a deleted stack, got one at %s", next)
+	}
+}
+
+// countingInspector counts GetStackLabels calls and fails them once failing
+// is set.
+type countingInspector struct {
+	calls   atomic.Int32
+	failing atomic.Bool
+}
+
+func (c *countingInspector) GetStackLabels(_ context.Context) (map[string]reconcile.StackSyncMetadata, error) {
+	c.calls.Add(1)
+	if c.failing.Load() {
+		return nil, errors.New("docker daemon unreachable")
+	}
+	return map[string]reconcile.StackSyncMetadata{}, nil
+}
+
+func TestReconciler_RunRetries_PausesWhenCycleAborts(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(retrySnapshot("hash1"))
+
+	compose := &flakyComposeRunner{failures: 1}
+	inspector := &countingInspector{}
+	policy := reconcile.DefaultPolicy()
+	policy.RetryBaseDelay = 50 * time.Millisecond
+	r := reconcile.NewReconciler(store, policy, compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+
+	r.Reconcile(context.Background())
+	inspector.failing.Store(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go r.RunRetries(ctx)
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+
+	// The failed retry cycles leave the retry due; they must not run back to back.
+	if n := inspector.calls.Load(); n > 10 {
+		t.Errorf("expected retry cycles to be paced, got %d inspections in 300ms", n)
+	}
+}
+
+func TestReconciler_RunRetries(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(retrySnapshot("hash1"))
+
+	compose := &flakyComposeRunner{failures: 2}
+	r := newRetryReconciler(store, compose, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.RunRetries(ctx)
+
+	r.Reconcile(ctx)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if st := store.GetStacks()[0]; st.Status == desiredstate.StackSyncSynced {
+			if compose.upCount() != 3 {
+				t.Errorf("expected 3 compose up calls, got %d", compose.upCount())
+			}
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("stack was not retried to success, %d compose up calls", compose.upCount())
+}
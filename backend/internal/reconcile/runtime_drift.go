@@ -0,0 +1,294 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+)
+
+// LabelComposeService is set by docker compose to the container's service name.
+const LabelComposeService = "com.docker.compose.service"
+
+// LabelComposeProject is set by docker compose to the container's project name.
+const LabelComposeProject = "com.docker.compose.project"
+
+// RuntimeContainer is a container of a deployed stack as inspected at runtime.
+type RuntimeContainer struct {
+	Name    string
+	Service string
+	Image   string
+	// ImageID is the local image the container runs, used to compare it with
+	// the registry (see ImageWatcher).
+	ImageID       string
+	State         string
+	ExitCode      int
+	RestartPolicy string
+	Env           []string
+	// Ports lists published ports as "hostPort:containerPort/protocol".
+	Ports []string
+}
+
+// serviceSpec is the part of a rendered compose service that is compared
+// against its running containers.
+type serviceSpec struct {
+	Image    string
+	Replicas int
+	Env      map[string]string
+	Ports    []string
+}
+
+// DetectRuntimeDrift compares a stack's containers against its rendered
+// desired services (as returned by docker compose config) and returns every
+// divergence: missing or unexpected services, image, state, replica count,
+// environment and published ports.
+func (d *DriftDetector) DetectRuntimeDrift(ctx context.Context, stackPath string, services map[string]map[string]any, containers []RuntimeContainer) []desiredstate.DriftReason {
+	specs := make(map[string]serviceSpec, len(services))
+	for name, svc := range services {
+		specs[name] = newServiceSpec(svc)
+	}
+
+	byService := make(map[string][]RuntimeContainer)
+	for _, c := range containers {
+		if c.Service != "" {
+			byService[c.Service] = append(byService[c.Service], c)
+		}
+	}
+
+	var reasons []desiredstate.DriftReason
+	for _, name := range sortedKeys(specs) {
+		reasons = append(reasons, compareService(name, specs[name], byService[name])...)
+	}
+	for _, name := range sortedKeys(byService) {
+		if _, ok := specs[name]; !ok {
+			reasons = append(reasons, desiredstate.DriftReason{Kind: desiredstate.DriftServiceUnexpected, Service: name})
+		}
+	}
+
+	if len(reasons) > 0 {
+		d.logger.InfoContext(ctx, "stack containers diverge from desired configuration",
+			"stack_path", stackPath,
+			"reasons", len(reasons),
+			"first", reasons[0].String())
+	}
+	return reasons
+}
+
+// compareService compares one desired service with its containers.
+func compareService(name string, spec serviceSpec, containers []RuntimeContainer) []desiredstate.DriftReason {
+	if len(containers) == 0 {
+		if spec.Replicas == 0 {
+			return nil
+		}
+		return []desiredstate.DriftReason{{Kind: desiredstate.DriftServiceMissing, Service: name}}
+	}
+
+	var reasons []desiredstate.DriftReason
+	if len(containers) != spec.Replicas {
+		reasons = append(reasons, desiredstate.DriftReason{
+			Kind: desiredstate.DriftReplicas, Service: name,
+			Expected: strconv.Itoa(spec.Replicas), Actual: strconv.Itoa(len(containers)),
+		})
+	}
+
+	for _, c := range containers {
+		if spec.Image != "" && c.Image != spec.Image {
+			reasons = append(reasons, desiredstate.DriftReason{
+				Kind: desiredstate.DriftImage, Service: name, Container: c.Name,
+				Expected: spec.Image, Actual: c.Image,
+			})
+		}
+		if !stateOK(c) {
+			actual := c.State
+			if c.State == "exited" {
+				actual = fmt.Sprintf("exited (code %d)", c.ExitCode)
+			}
+			reasons = append(reasons, desiredstate.DriftReason{
+				Kind: desiredstate.DriftState, Service: name, Container: c.Name,
+				Expected: "running", Actual: actual,
+			})
+		}
+		// Only the names of differing variables are reported: values may be secrets.
+		env := envMap(c.Env)
+		for _, key := range sortedKeys(spec.Env) {
+			actual, ok := env[key]
+			switch {
+			case !ok:
+				reasons = append(reasons, desiredstate.DriftReason{
+					Kind: desiredstate.DriftEnv, Service: name, Container: c.Name, Expected: key, Actual: "unset",
+				})
+			case actual != spec.Env[key]:
+				reasons = append(reasons, desiredstate.DriftReason{
+					Kind: desiredstate.DriftEnv, Service: name, Container: c.Name, Expected: key, Actual: "different value",
+				})
+			}
+		}
+		if spec.Ports != nil {
+			actual := append([]string(nil), c.Ports...)
+			sort.Strings(actual)
+			if strings.Join(actual, ",") != strings.Join(spec.Ports, ",") {
+				reasons = append(reasons, desiredstate.DriftReason{
+					Kind: desiredstate.DriftPorts, Service: name, Container: c.Name,
+					Expected: strings.Join(spec.Ports, ","), Actual: strings.Join(actual, ","),
+				})
+			}
+		}
+	}
+	return reasons
+}
+
+// stateOK reports whether a container is in an acceptable state: running,
+// restarting under its restart policy, or a one-shot container that exited
+// successfully and is not meant to be restarted.
+func stateOK(c RuntimeContainer) bool {
+	switch c.State {
+	case "running", "restarting":
+		return true
+	case "exited":
+		return c.ExitCode == 0 && (c.RestartPolicy == "" || c.RestartPolicy == "no" || c.RestartPolicy == "on-failure")
+	}
+	return false
+}
+
+// newServiceSpec extracts the compared fields from a rendered service. It
+// accepts both the docker compose config JSON form and raw compose YAML.
+func newServiceSpec(svc map[string]any) serviceSpec {
+	spec := serviceSpec{Replicas: 1, Env: make(map[string]string)}
+	spec.Image, _ = svc["image"].(string)
+
+	if n, ok := toInt(svc["scale"]); ok {
+		spec.Replicas = n
+	}
+	if deploy, ok := svc["deploy"].(map[string]any); ok {
+		if n, ok := toInt(deploy["replicas"]); ok {
+			spec.Replicas = n
+		}
+	}
+
+	switch env := svc["environment"].(type) {
+	case map[string]any:
+		for k, v := range env {
+			if v != nil {
+				spec.Env[k] = fmt.Sprint(v)
+			}
+		}
+	case []any:
+		for _, item := range env {
+			if k, v, ok := strings.Cut(fmt.Sprint(item), "="); ok {
+				spec.Env[k] = v
+			}
+		}
+	}
+
+	if ports, ok := svc["ports"].([]any); ok {
+		spec.Ports = []string{}
+		for _, p := range ports {
+			if port := publishedPort(p); port != "" {
+				spec.Ports = append(spec.Ports, port)
+			}
+		}
+		sort.Strings(spec.Ports)
+	}
+	return spec
+}
+
+// publishedPort normalises a compose port entry to "published:target/protocol".
+// Entries without a published port, or with port ranges, return "".
+func publishedPort(p any) string {
+	var published, target, protocol string
+	switch v := p.(type) {
+	case map[string]any:
+		published = fmt.Sprint(v["published"])
+		target = fmt.Sprint(v["target"])
+		protocol, _ = v["protocol"].(string)
+		if v["published"] == nil {
+			return ""
+		}
+	default:
+		spec := fmt.Sprint(v)
+		spec, protocol, _ = strings.Cut(spec, "/")
+		parts := strings.Split(spec, ":")
+		if len(parts) < 2 {
+			return ""
+		}
+		published, target = parts[len(parts)-2], parts[len(parts)-1]
+	}
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	if published == "" || strings.Contains(published, "-") || strings.Contains(target, "-") {
+		return ""
+	}
+	return published + ":" + target + "/" + protocol
+}
+
+func toInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case float64:
+		return int(n), true
+	case string:
+		i, err := strconv.Atoi(n)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func envMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		m[k] = v
+	}
+	return m
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// detectDrift runs label-based drift detection and then compares the
+// containers of every stack that is in sync by hash against its rendered
+// desired configuration, so changes made by hand (docker stop, docker rm,
+// a different image tag) are re-synced as well. A non-nil only limits the
+// container comparison to those stacks.
+func (r *Reconciler) detectDrift(ctx context.Context, snap *desiredstate.Snapshot, runtime map[string]StackSyncMetadata, removeEnabled bool, only map[string]bool) []DriftResult {
+	drifts := r.driftDetector.DetectChanges(ctx, snap.Stacks, runtime, removeEnabled)
+	for i, drift := range drifts {
+		if drift.NeedSync || drift.NeedRemove || (only != nil && !only[drift.Path]) {
+			continue
+		}
+		rt := runtime[drift.Path]
+		stack := findStack(snap, drift.Path)
+		if stack == nil || len(rt.Containers) == 0 {
+			continue
+		}
+		services, err := r.renderServices(ctx, deriveProjectName(r.projectNamePrefix(), drift.Path), stack)
+		if err != nil {
+			log.Printf("[warn] runtime drift check skipped for stack %s: %v", drift.Path, err)
+			continue
+		}
+		reasons := r.driftDetector.DetectRuntimeDrift(ctx, drift.Path, services, rt.Containers)
+		if len(reasons) == 0 {
+			continue
+		}
+		summary := make([]string, 0, len(reasons))
+		for _, reason := range reasons {
+			summary = append(summary, reason.String())
+		}
+		drifts[i].NeedSync = true
+		drifts[i].Reasons = reasons
+		drifts[i].Reason = "runtime drift: " + strings.Join(summary, "; ")
+	}
+	return drifts
+}
@@ -0,0 +1,139 @@
+package reconcile_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+func renderedServices() map[string]map[string]any {
+	return map[string]map[string]any{
+		"web": {
+			"image":       "nginx:2",
+			"environment": map[string]any{"MODE": "prod", "UNSET": nil},
+			"ports":       []any{map[string]any{"target": float64(80), "published": "8080", "protocol": "tcp"}},
+		},
+		"worker": {
+			"image":  "worker:1",
+			"deploy": map[string]any{"replicas": float64(2)},
+		},
+		"init": {"image": "busybox"},
+	}
+}
+
+func healthyContainers() []reconcile.RuntimeContainer {
+	return []reconcile.RuntimeContainer{
+		{Name: "app-web-1", Service: "web", Image: "nginx:2", State: "running", Env: []string{"PATH=/bin", "MODE=prod"}, Ports: []string{"8080:80/tcp"}},
+		{Name: "app-worker-1", Service: "worker", Image: "worker:1", State: "running"},
+		{Name: "app-worker-2", Service: "worker", Image: "worker:1", State: "restarting"},
+		{Name: "app-init-1", Service: "init", Image: "busybox", State: "exited", ExitCode: 0, RestartPolicy: "no"},
+	}
+}
+
+func TestDetectRuntimeDrift_InSync(t *testing.T) {
+	d := newTestDriftDetector("")
+	if reasons := d.DetectRuntimeDrift(context.Background(), "app", renderedServices(), healthyContainers()); len(reasons) != 0 {
+		t.Errorf("expected no drift, got %v", reasons)
+	}
+}
+
+func TestDetectRuntimeDrift_Divergences(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func([]reconcile.RuntimeContainer) []reconcile.RuntimeContainer
+		want   desiredstate.DriftReason
+	}{
+		{"image tag changed by hand", func(c []reconcile.RuntimeContainer) []reconcile.RuntimeContainer {
+			c[0].Image = "nginx:1"
+			return c
+		}, desiredstate.DriftReason{Kind: desiredstate.DriftImage, Service: "web", Container: "app-web-1", Expected: "nginx:2", Actual: "nginx:1"}},
+		{"docker stop", func(c []reconcile.RuntimeContainer) []reconcile.RuntimeContainer {
+			c[0].State, c[0].ExitCode, c[0].RestartPolicy = "exited", 0, "always"
+			return c
+		}, desiredstate.DriftReason{Kind: desiredstate.DriftState, Service: "web", Container: "app-web-1", Expected: "running", Actual: "exited (code 0)"}},
+		{"docker rm of a whole service", func(c []reconcile.RuntimeContainer) []reconcile.RuntimeContainer {
+			return c[1:]
+		}, desiredstate.DriftReason{Kind: desiredstate.DriftServiceMissing, Service: "web"}},
+		{"replica removed", func(c []reconcile.RuntimeContainer) []reconcile.RuntimeContainer {
+			return append(c[:2], c[3:]...)
+		}, desiredstate.DriftReason{Kind: desiredstate.DriftReplicas, Service: "worker", Expected: "2", Actual: "1"}},
+		{"env changed", func(c []reconcile.RuntimeContainer) []reconcile.RuntimeContainer {
+			c[0].Env = []string{"MODE=debug"}
+			return c
+		}, desiredstate.DriftReason{Kind: desiredstate.DriftEnv, Service: "web", Container: "app-web-1", Expected: "MODE", Actual: "different value"}},
+		{"port changed", func(c []reconcile.RuntimeContainer) []reconcile.RuntimeContainer {
+			c[0].Ports = []string{"9090:80/tcp"}
+			return c
+		}, desiredstate.DriftReason{Kind: desiredstate.DriftPorts, Service: "web", Container: "app-web-1", Expected: "8080:80/tcp", Actual: "9090:80/tcp"}},
+		{"unexpected service", func(c []reconcile.RuntimeContainer) []reconcile.RuntimeContainer {
+			return append(c, reconcile.RuntimeContainer{Name: "app-debug-1", Service: "debug", State: "running"})
+		}, desiredstate.DriftReason{Kind: desiredstate.DriftServiceUnexpected, Service: "debug"}},
+	}
+
+	d := newTestDriftDetector("")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reasons := d.DetectRuntimeDrift(context.Background(), "app", renderedServices(), tt.mutate(healthyContainers()))
+			if len(reasons) != 1 || reasons[0] != tt.want {
+				t.Errorf("expected [%+v], got %+v", tt.want, reasons)
+			}
+		})
+	}
+}
+
+func TestReconcile_RuntimeDrift_Resyncs(t *testing.T) {
+	content := []byte("services:\n  web:\n    image: nginx:2\n    environment:\n      - MODE=prod\n    ports:\n      - \"8080:80\"\n")
+	newStore := func() *desiredstate.Store {
+		store := desiredstate.NewStore()
+		store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: []desiredstate.StackRecord{
+			{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "hash1", Status: desiredstate.StackSyncSynced, Content: content},
+		}})
+		return store
+	}
+	runtime := func(c reconcile.RuntimeContainer) map[string]reconcile.StackSyncMetadata {
+		return map[string]reconcile.StackSyncMetadata{
+			"app": {StackPath: "app", DesiredRevision: "rev1", DesiredComposeHash: "hash1", Containers: []reconcile.RuntimeContainer{c}},
+		}
+	}
+	running := reconcile.RuntimeContainer{Name: "app-web-1", Service: "web", Image: "nginx:2", State: "running", Env: []string{"MODE=prod"}, Ports: []string{"8080:80/tcp"}}
+
+	// Containers matching the desired config are left alone.
+	store := newStore()
+	compose := &stubComposeRunner{}
+	r := reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, &stubInspector{labels: runtime(running)}, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	if runs := r.Reconcile(context.Background()); len(runs) != 0 {
+		t.Fatalf("expected no sync without runtime drift, got %+v", runs)
+	}
+
+	// A container switched to another image by hand is re-synced.
+	store = newStore()
+	compose = &stubComposeRunner{}
+	drifted := running
+	drifted.Image = "nginx:1"
+	r = reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, &stubInspector{labels: runtime(drifted)}, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	runs := r.Reconcile(context.Background())
+	if len(runs) != 1 || runs[0].Result != "success" || len(compose.upCalls) != 1 {
+		t.Fatalf("expected runtime drift to be re-synced, got %+v", runs)
+	}
+
+	// With the flag policy the drift is recorded on the stack instead.
+	store = newStore()
+	compose = &stubComposeRunner{}
+	policy := reconcile.DefaultPolicy()
+	policy.DriftPolicy = "flag"
+	r = reconcile.NewReconciler(store, policy, compose, &stubInspector{labels: runtime(drifted)}, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	r.Reconcile(context.Background())
+	st := store.GetStacks()[0]
+	if len(st.Drift) != 1 || st.Drift[0].Kind != desiredstate.DriftImage {
+		t.Fatalf("expected image drift on stack record, got %+v", st.Drift)
+	}
+	if !strings.Contains(st.Drift[0].String(), "expected nginx:2, got nginx:1") {
+		t.Errorf("unexpected drift description %q", st.Drift[0].String())
+	}
+	if len(compose.upCalls) != 0 {
+		t.Errorf("flagged drift must not be synced, got %d compose up calls", len(compose.upCalls))
+	}
+}
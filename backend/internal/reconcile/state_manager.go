@@ -33,90 +33,299 @@ func NewStateManager(
 }
 
 // UpdateStatus updates the sync status of a stack.
+// Updates are applied atomically in the store, so it is safe to call
+// concurrently for different stacks.
 func (sm *StateManager) UpdateStatus(path string, status desiredstate.StackSyncStatus, syncedAt, syncError string) {
-	snap := sm.store.Get()
-	if snap == nil {
-		sm.logger.Warn("cannot update status, store snapshot is nil", "stack_path", path)
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, found := sm.store.UpdateStack(path, func(st *desiredstate.StackRecord) {
+		st.Status = status
+		st.LastSyncAt = now
+		st.LastSyncStatus = string(status)
+		if syncError != "" {
+			st.LastSyncError = syncError
+		}
+		st.NextWindowAt = ""
+	})
+	if !found {
+		sm.logger.Warn("cannot update status, stack not in store", "stack_path", path)
+		return
+	}
+
+	sm.logger.Info("stack status updated",
+		"stack_path", path,
+		"status", status)
+
+	// Publish domain event
+	if sm.eventBus != nil {
+		sm.eventBus.Publish(context.Background(),
+			events.NewStackStatusChangedEvent(path, status, syncError))
+	}
+}
+
+// MarkSynced marks a stack as successfully synced with the given metadata.
+func (sm *StateManager) MarkSynced(path, revision, commitMessage, composeHash, syncedAt string) {
+	_, found := sm.store.UpdateStack(path, func(st *desiredstate.StackRecord) {
+		st.Status = desiredstate.StackSyncSynced
+		st.NextWindowAt = ""
+		st.SyncedRevision = revision
+		st.SyncedCommitMessage = commitMessage
+		st.SyncedComposeHash = composeHash
+		st.SyncedAt = syncedAt
+		st.LastSyncAt = syncedAt
+		st.LastSyncStatus = string(desiredstate.StackSyncSynced)
+		st.LastSyncError = ""
+		st.SyncAttempts = 0
+		st.NextRetryAt = ""
+		st.Drift = nil
+	})
+	if !found {
+		sm.logger.Warn("stack not found when marking synced", "stack_path", path)
 		return
 	}
 
+	sm.logger.Debug("stack marked as synced",
+		"stack_path", path,
+		"revision", revision)
+
+	// Publish domain event
+	if sm.eventBus != nil {
+		sm.eventBus.Publish(context.Background(),
+			events.NewStackSyncedEvent(path, revision, composeHash, commitMessage))
+	}
+}
+
+// MarkRolledBack records that a sync of failedHash at failedRevision failed its
+// health check and the stack was redeployed at the revision described by rt.
+// The stack is left failed, with the rollback revision as its synced state.
+func (sm *StateManager) MarkRolledBack(path, failedRevision, failedHash string, rt StackSyncMetadata, syncError string) {
 	now := time.Now().UTC().Format(time.RFC3339)
-	var updated *desiredstate.StackRecord
-
-	for i := range snap.Stacks {
-		if snap.Stacks[i].Path == path {
-			snap.Stacks[i].Status = status
-			snap.Stacks[i].LastSyncAt = now
-			snap.Stacks[i].LastSyncStatus = string(status)
-			if syncError != "" {
-				snap.Stacks[i].LastSyncError = syncError
-			}
-			updated = &snap.Stacks[i]
-			break
-		}
+	_, found := sm.store.UpdateStack(path, func(st *desiredstate.StackRecord) {
+		st.Status = desiredstate.StackSyncFailed
+		st.SyncedRevision = rt.DesiredRevision
+		st.SyncedCommitMessage = rt.DesiredCommitMessage
+		st.SyncedComposeHash = rt.DesiredComposeHash
+		st.SyncedAt = now
+		st.LastSyncAt = now
+		st.LastSyncStatus = string(desiredstate.StackSyncFailed)
+		st.LastSyncError = syncError
+		st.FailedComposeHash = failedHash
+		st.RolledBackTo = rt.DesiredRevision
+		st.RolledBackAt = now
+	})
+	if !found {
+		sm.logger.Warn("stack not found when marking rolled back", "stack_path", path)
+		return
 	}
 
-	sm.store.Set(snap)
+	sm.logger.Info("stack rolled back",
+		"stack_path", path,
+		"failed_revision", failedRevision,
+		"rollback_revision", rt.DesiredRevision)
 
-	if updated != nil {
-		sm.logger.Info("stack status updated",
-			"stack_path", path,
-			"status", status)
+	if sm.eventBus != nil {
+		sm.eventBus.Publish(context.Background(),
+			events.NewStackRolledBackEvent(path, failedRevision, failedHash, rt.DesiredRevision, syncError))
+		sm.eventBus.Publish(context.Background(),
+			events.NewStackStatusChangedEvent(path, desiredstate.StackSyncFailed, syncError))
+	}
+}
 
-		// Publish domain event
-		if sm.eventBus != nil {
-			sm.eventBus.Publish(context.Background(),
-				events.NewStackStatusChangedEvent(path, status, syncError))
-		}
+// MarkPinned records that a stack was rolled back to revision by an operator
+// and is pinned there.
+func (sm *StateManager) MarkPinned(path, revision, commitMessage, composeHash string) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, found := sm.store.UpdateStack(path, func(st *desiredstate.StackRecord) {
+		st.Status = desiredstate.StackSyncPinned
+		st.PinnedRevision = revision
+		st.PinnedAt = now
+		st.SyncedRevision = revision
+		st.SyncedCommitMessage = commitMessage
+		st.SyncedComposeHash = composeHash
+		st.SyncedAt = now
+		st.LastSyncAt = now
+		st.LastSyncStatus = string(desiredstate.StackSyncPinned)
+		st.LastSyncError = ""
+		st.SyncAttempts = 0
+		st.NextRetryAt = ""
+		st.Drift = nil
+	})
+	if !found {
+		sm.logger.Warn("stack not found when marking pinned", "stack_path", path)
+		return
+	}
+
+	sm.logger.Info("stack pinned",
+		"stack_path", path,
+		"revision", revision)
+
+	if sm.eventBus != nil {
+		sm.eventBus.Publish(context.Background(),
+			events.NewStackStatusChangedEvent(path, desiredstate.StackSyncPinned, ""))
 	}
 }
 
-// MarkSynced marks a stack as successfully synced with the given metadata.
-func (sm *StateManager) MarkSynced(path, revision, commitMessage, composeHash, syncedAt string) {
-	snap := sm.store.Get()
-	if snap == nil {
-		sm.logger.Warn("cannot mark synced, store snapshot is nil", "stack_path", path)
+// Unpin releases a pinned stack. It is marked missing until the next
+// reconcile syncs it to the desired state.
+func (sm *StateManager) Unpin(path string) {
+	_, found := sm.store.UpdateStack(path, func(st *desiredstate.StackRecord) {
+		st.PinnedRevision = ""
+		st.PinnedAt = ""
+	})
+	if !found {
+		sm.logger.Warn("stack not found when unpinning", "stack_path", path)
 		return
 	}
+	sm.UpdateStatus(path, desiredstate.StackSyncMissing, "", "")
+}
 
-	found := false
-	var updated *desiredstate.StackRecord
-
-	for i := range snap.Stacks {
-		if snap.Stacks[i].Path == path {
-			snap.Stacks[i].Status = desiredstate.StackSyncSynced
-			snap.Stacks[i].SyncedRevision = revision
-			snap.Stacks[i].SyncedCommitMessage = commitMessage
-			snap.Stacks[i].SyncedComposeHash = composeHash
-			snap.Stacks[i].SyncedAt = syncedAt
-			snap.Stacks[i].LastSyncAt = syncedAt
-			snap.Stacks[i].LastSyncStatus = string(desiredstate.StackSyncSynced)
-			snap.Stacks[i].LastSyncError = ""
-			found = true
-			updated = &snap.Stacks[i]
-			break
-		}
+// MarkSuspended marks a stack suspended. susp is nil for stacks suspended by
+// their settings file.
+func (sm *StateManager) MarkSuspended(path string, susp *desiredstate.Suspension) {
+	_, found := sm.store.UpdateStack(path, func(st *desiredstate.StackRecord) {
+		st.Status = desiredstate.StackSyncSuspended
+		st.Suspension = susp
+	})
+	if !found {
+		sm.logger.Warn("stack not found when marking suspended", "stack_path", path)
+		return
 	}
 
+	sm.logger.Info("stack suspended", "stack_path", path)
+
+	if sm.eventBus != nil {
+		sm.eventBus.Publish(context.Background(),
+			events.NewStackStatusChangedEvent(path, desiredstate.StackSyncSuspended, ""))
+	}
+}
+
+// MarkPendingWindow marks a drifted stack deferred until its next sync window
+// opens at nextWindowAt (RFC3339, empty if unknown).
+func (sm *StateManager) MarkPendingWindow(path, nextWindowAt string) {
+	_, found := sm.store.UpdateStack(path, func(st *desiredstate.StackRecord) {
+		st.Status = desiredstate.StackSyncPendingWindow
+		st.NextWindowAt = nextWindowAt
+	})
 	if !found {
-		sm.logger.Warn("stack not found when marking synced",
-			"stack_path", path,
-			"total_stacks", len(snap.Stacks))
-	} else {
-		sm.logger.Debug("stack marked as synced",
-			"stack_path", path,
-			"revision", revision)
+		sm.logger.Warn("stack not found when marking pending window", "stack_path", path)
+		return
 	}
 
-	sm.store.Set(snap)
+	sm.logger.Info("stack pending sync window",
+		"stack_path", path,
+		"next_window_at", nextWindowAt)
 
-	if updated != nil {
-		// Publish domain event
-		if sm.eventBus != nil {
-			sm.eventBus.Publish(context.Background(),
-				events.NewStackSyncedEvent(path, revision, composeHash, commitMessage))
+	if sm.eventBus != nil {
+		sm.eventBus.Publish(context.Background(),
+			events.NewStackStatusChangedEvent(path, desiredstate.StackSyncPendingWindow, ""))
+	}
+}
+
+// Resume lifts a stack's suspension. It is marked missing until the next
+// reconcile syncs it to the desired state.
+func (sm *StateManager) Resume(path string) {
+	_, found := sm.store.UpdateStack(path, func(st *desiredstate.StackRecord) {
+		st.Suspension = nil
+	})
+	if !found {
+		sm.logger.Warn("stack not found when resuming", "stack_path", path)
+		return
+	}
+	sm.UpdateStatus(path, desiredstate.StackSyncMissing, "", "")
+}
+
+// MarkHealthFailed marks a stack failed after its health check failed and no
+// rollback was possible. failedHash is not deployed again until it changes.
+func (sm *StateManager) MarkHealthFailed(path, failedHash, syncError string) {
+	_, found := sm.store.UpdateStack(path, func(st *desiredstate.StackRecord) {
+		st.FailedComposeHash = failedHash
+	})
+	if !found {
+		sm.logger.Warn("stack not found when marking health failure", "stack_path", path)
+		return
+	}
+	sm.UpdateStatus(path, desiredstate.StackSyncFailed, "", syncError)
+}
+
+// MarkPendingRemoval lists a stack deleted from Git whose removal is held
+// back with the status pending_removal, the revision it runs from rt and the
+// reason it is held back as its error.
+func (sm *StateManager) MarkPendingRemoval(path string, rt StackSyncMetadata, blocked string) {
+	rec, found := sm.store.GetStack(path)
+	if found && rec.Status == desiredstate.StackSyncPendingRemoval && rec.LastSyncError == blocked {
+		return
+	}
+	if !found {
+		rec = desiredstate.StackRecord{
+			Path:                path,
+			SyncedRevision:      rt.DesiredRevision,
+			SyncedCommitMessage: rt.DesiredCommitMessage,
+			SyncedComposeHash:   rt.DesiredComposeHash,
+			SyncedAt:            rt.SyncedAt,
+			DependsOn:           rt.DependsOn,
 		}
 	}
+	rec.Status = desiredstate.StackSyncPendingRemoval
+	rec.LastSyncStatus = string(desiredstate.StackSyncPendingRemoval)
+	rec.LastSyncError = blocked
+	sm.store.SetRemoval(rec)
+
+	sm.logger.Info("stack pending removal",
+		"stack_path", path,
+		"blocked", blocked)
+
+	if sm.eventBus != nil {
+		sm.eventBus.Publish(context.Background(),
+			events.NewStackStatusChangedEvent(path, desiredstate.StackSyncPendingRemoval, blocked))
+	}
+}
+
+// ClearPendingRemoval stops listing a stack pending removal, once it was
+// removed or restored in Git.
+func (sm *StateManager) ClearPendingRemoval(path, reason string) {
+	if !sm.store.DeleteRemoval(path) {
+		return
+	}
+	sm.logger.Info("stack no longer pending removal",
+		"stack_path", path,
+		"reason", reason)
+
+	if sm.eventBus != nil {
+		sm.eventBus.Publish(context.Background(),
+			events.NewStackRemovedEvent(path, reason))
+	}
+}
+
+// SetDrift records the runtime drift found for a stack; nil clears it.
+func (sm *StateManager) SetDrift(path string, reasons []desiredstate.DriftReason) {
+	_, found := sm.store.UpdateStack(path, func(st *desiredstate.StackRecord) {
+		st.Drift = reasons
+	})
+	if !found {
+		sm.logger.Warn("stack not found when setting drift", "stack_path", path)
+	}
+}
+
+// SetRetry records the number of failed sync attempts of a stack and when it
+// is retried next. A zero nextRetry clears the retry state.
+func (sm *StateManager) SetRetry(path string, attempts int, nextRetry time.Time) {
+	next := ""
+	if !nextRetry.IsZero() {
+		next = nextRetry.UTC().Format(time.RFC3339)
+	}
+	_, found := sm.store.UpdateStack(path, func(st *desiredstate.StackRecord) {
+		st.SyncAttempts = attempts
+		st.NextRetryAt = next
+	})
+	if !found {
+		sm.logger.Warn("stack not found when setting retry state", "stack_path", path)
+		return
+	}
+	if attempts > 0 {
+		sm.logger.Info("stack sync retry scheduled",
+			"stack_path", path,
+			"attempts", attempts,
+			"next_retry_at", next)
+	}
 }
 
 // UpdateContainerCounts queries container status for a stack and updates the store.
@@ -136,24 +345,12 @@ func (sm *StateManager) UpdateContainerCounts(ctx context.Context, stackPath, pr
 		}
 	}
 
-	snap := sm.store.Get()
-	if snap == nil {
-		return
-	}
-
-	var updated *desiredstate.StackRecord
-	for i := range snap.Stacks {
-		if snap.Stacks[i].Path == stackPath {
-			snap.Stacks[i].ContainersRunning = running
-			snap.Stacks[i].ContainersTotal = len(containers)
-			updated = &snap.Stacks[i]
-			break
-		}
-	}
-
-	sm.store.Set(snap)
+	_, found := sm.store.UpdateStack(stackPath, func(st *desiredstate.StackRecord) {
+		st.ContainersRunning = running
+		st.ContainersTotal = len(containers)
+	})
 
-	if updated != nil {
+	if found {
 		sm.logger.Debug("container counts updated",
 			"stack_path", stackPath,
 			"running", running,
@@ -0,0 +1,160 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+)
+
+// TriggerResume is the trigger source of the sync after a stack is resumed.
+const TriggerResume = "resume"
+
+// ErrSuspendedBySettings is returned when resuming a stack suspended by its
+// settings file, which only a commit can lift.
+var ErrSuspendedBySettings = errors.New("stack is suspended by its settings file")
+
+// SuspensionPersister stores suspensions so they survive restarts.
+type SuspensionPersister interface {
+	LoadSuspensions() (map[string]desiredstate.Suspension, error)
+	SaveSuspension(path string, s desiredstate.Suspension) error
+	DeleteSuspension(path string) error
+}
+
+// SuspensionStore tracks the stacks an operator has suspended. Expired
+// suspensions are dropped when they are next looked up.
+type SuspensionStore struct {
+	mu          sync.Mutex
+	suspensions map[string]desiredstate.Suspension
+	persister   SuspensionPersister
+}
+
+// NewSuspensionStore creates an empty suspension store.
+func NewSuspensionStore() *SuspensionStore {
+	return &SuspensionStore{suspensions: make(map[string]desiredstate.Suspension)}
+}
+
+// SetPersister restores the suspensions saved by p and saves every later
+// change with it.
+func (s *SuspensionStore) SetPersister(p SuspensionPersister) error {
+	saved, err := p.LoadSuspensions()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path, susp := range saved {
+		s.suspensions[path] = susp
+	}
+	s.persister = p
+	return nil
+}
+
+// Suspend records a suspension for a stack path, replacing any earlier one.
+func (s *SuspensionStore) Suspend(path string, susp desiredstate.Suspension) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.suspensions[path] = susp
+	if s.persister != nil {
+		if err := s.persister.SaveSuspension(path, susp); err != nil {
+			log.Printf("[warn] failed to persist suspension of stack %s: %v", path, err)
+		}
+	}
+}
+
+// Get returns the active suspension of a stack path.
+func (s *SuspensionStore) Get(path string) (desiredstate.Suspension, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	susp, ok := s.suspensions[path]
+	if ok && susp.Expired(time.Now()) {
+		log.Printf("[info] suspension of stack %s expired", path)
+		s.deleteLocked(path)
+		return desiredstate.Suspension{}, false
+	}
+	return susp, ok
+}
+
+// Resume removes the suspension of a stack path. It reports whether the
+// stack was suspended.
+func (s *SuspensionStore) Resume(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.suspensions[path]; !ok {
+		return false
+	}
+	s.deleteLocked(path)
+	return true
+}
+
+func (s *SuspensionStore) deleteLocked(path string) {
+	delete(s.suspensions, path)
+	if s.persister != nil {
+		if err := s.persister.DeleteSuspension(path); err != nil {
+			log.Printf("[warn] failed to delete persisted suspension of stack %s: %v", path, err)
+		}
+	}
+}
+
+// SetSuspensionPersister restores the suspensions saved by p and persists
+// later suspensions with it.
+func (r *Reconciler) SetSuspensionPersister(p SuspensionPersister) error {
+	return r.suspensions.SetPersister(p)
+}
+
+// Suspend stops reconciling a stack: it is neither synced nor removed, but
+// its drift is still reported. A zero expiresAt suspends it until resumed.
+// It does not wait for a running reconcile, which checks each stack's
+// suspension before syncing it.
+func (r *Reconciler) Suspend(path, by, reason string, expiresAt time.Time) (desiredstate.Suspension, error) {
+	if findStack(r.store.Get(), path) == nil {
+		return desiredstate.Suspension{}, ErrStackNotFound
+	}
+	susp := desiredstate.Suspension{
+		By:     by,
+		Reason: reason,
+		At:     time.Now().UTC().Format(time.RFC3339),
+	}
+	if !expiresAt.IsZero() {
+		susp.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	}
+	log.Printf("[info] suspending stack %s", path)
+	r.suspensions.Suspend(path, susp)
+	r.stateManager.MarkSuspended(path, &susp)
+	return susp, nil
+}
+
+// Resume lifts a stack's suspension and queues a sync back to the desired
+// state, like Sync. It returns the run ID of the sync, empty if the stack was
+// not suspended or cannot be synced, e.g. because reconciliation is disabled.
+// Stacks suspended by their settings file return ErrSuspendedBySettings.
+func (r *Reconciler) Resume(ctx context.Context, path string) (string, error) {
+	stack := findStack(r.store.Get(), path)
+	if stack == nil {
+		return "", ErrStackNotFound
+	}
+	if r.policy.ForStack(stack.Settings).Suspended {
+		return "", ErrSuspendedBySettings
+	}
+	if !r.suspensions.Resume(path) && stack.Status != desiredstate.StackSyncSuspended {
+		return "", nil
+	}
+	log.Printf("[info] resuming stack %s", path)
+	r.stateManager.Resume(path)
+	if !r.policy.Enabled || r.policy.DryRun || r.manualSyncBlocked(stack) != nil {
+		return "", nil
+	}
+	return r.queueSync(ctx, path, TriggerResume, SyncOptions{}), nil
+}
+
+// suspension returns the suspension of the stack at path, whether set by an
+// operator or by the stack's settings file.
+func (r *Reconciler) suspension(path string, policy ReconciliationPolicy) (*desiredstate.Suspension, bool) {
+	if susp, ok := r.suspensions.Get(path); ok {
+		return &susp, true
+	}
+	return nil, policy.Suspended
+}
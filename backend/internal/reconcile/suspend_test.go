@@ -0,0 +1,152 @@
+package reconcile_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+func TestSuspend_SkipsSyncUntilResumed(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h2", Status: desiredstate.StackSyncSynced, Content: []byte("services:\n  web:\n    image: nginx:2\n")},
+	}})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"app": {StackPath: "app", DesiredRevision: "rev1", DesiredComposeHash: "h1"},
+	}}
+	compose := &stubComposeRunner{}
+	r := newPinReconciler(store, compose, inspector, nil)
+
+	if _, err := r.Suspend("other", "", "", time.Time{}); !errors.Is(err, reconcile.ErrStackNotFound) {
+		t.Errorf("expected ErrStackNotFound, got %v", err)
+	}
+	susp, err := r.Suspend("app", "alice", "database migration", time.Time{})
+	if err != nil {
+		t.Fatalf("Suspend: %v", err)
+	}
+	if susp.By != "alice" || susp.Reason != "database migration" || susp.At == "" || susp.ExpiresAt != "" {
+		t.Errorf("unexpected suspension %+v", susp)
+	}
+
+	r.Reconcile(context.Background())
+	if len(compose.upCalls) != 0 {
+		t.Errorf("expected suspended stack not to be synced, got %d up calls", len(compose.upCalls))
+	}
+	st := store.Get().Stacks[0]
+	if st.Status != desiredstate.StackSyncSuspended || st.Suspension == nil || st.Suspension.By != "alice" {
+		t.Errorf("expected stack suspended by alice, got %+v", st)
+	}
+	if len(st.Drift) != 1 || st.Drift[0].Kind != desiredstate.DriftComposeHash || st.Drift[0].Expected != "h2" || st.Drift[0].Actual != "h1" {
+		t.Errorf("expected the compose hash drift recorded on the suspended stack, got %+v", st.Drift)
+	}
+	if plan, _ := r.Plan(context.Background()); plan.Stacks[0].Action != reconcile.PlanActionUpdate || plan.Stacks[0].Blocked != "suspended" {
+		t.Errorf("expected plan to report the pending update as suspended, got %+v", plan.Stacks[0])
+	}
+
+	id, err := r.Resume(context.Background(), "app")
+	if err != nil || id == "" {
+		t.Fatalf("Resume: %q, %v", id, err)
+	}
+	if run := waitForRun(t, r, "app", id); run.Result != "success" || run.Trigger != reconcile.TriggerResume || len(compose.upCalls) != 1 {
+		t.Errorf("expected resume to sync the stack, got %+v", run)
+	}
+	if st := store.Get().Stacks[0]; st.Status != desiredstate.StackSyncSynced || st.Suspension != nil {
+		t.Errorf("expected stack synced after resume, got %+v", st)
+	}
+}
+
+func TestSuspend_NotBlockedByRunningCycle(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: []desiredstate.StackRecord{
+		{Path: "slow", ComposeFile: "docker-compose.yml", ComposeHash: "s2", Content: []byte("services:\n  web:\n    image: nginx:2\n")},
+	}})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"slow": {StackPath: "slow", DesiredRevision: "rev1", DesiredComposeHash: "s1"},
+	}}
+	compose := &gatedComposeRunner{started: make(chan struct{}), release: make(chan struct{})}
+	r := newPinReconciler(store, compose, inspector, nil)
+
+	cycle := make(chan struct{})
+	go func() { r.Reconcile(context.Background()); close(cycle) }()
+	<-compose.started
+	defer func() { close(compose.release); <-cycle }()
+
+	suspended := make(chan error, 1)
+	go func() {
+		_, err := r.Suspend("slow", "alice", "incident", time.Time{})
+		suspended <- err
+	}()
+	select {
+	case err := <-suspended:
+		if err != nil {
+			t.Fatalf("Suspend: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Suspend waited for the running reconcile")
+	}
+	if st := store.Get().Stacks[0]; st.Status != desiredstate.StackSyncSuspended {
+		t.Errorf("expected stack suspended right away, got %s", st.Status)
+	}
+}
+
+func TestSuspend_InSyncStackStaysSuspended(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h1", Status: desiredstate.StackSyncSynced},
+	}})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"app": {StackPath: "app", DesiredRevision: "rev1", DesiredComposeHash: "h1"},
+	}}
+	r := newPinReconciler(store, &stubComposeRunner{}, inspector, nil)
+
+	if _, err := r.Suspend("app", "", "", time.Time{}); err != nil {
+		t.Fatalf("Suspend: %v", err)
+	}
+	r.Reconcile(context.Background())
+	if st := store.Get().Stacks[0]; st.Status != desiredstate.StackSyncSuspended {
+		t.Errorf("expected in-sync stack to stay suspended, got %q", st.Status)
+	}
+}
+
+func TestResume_SuspendedBySettings(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h2", Settings: &desiredstate.StackSettings{Suspended: true}},
+	}})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"app": {StackPath: "app", DesiredRevision: "rev1", DesiredComposeHash: "h1"},
+	}}
+	compose := &stubComposeRunner{}
+	r := newPinReconciler(store, compose, inspector, nil)
+
+	r.Reconcile(context.Background())
+	if st := store.Get().Stacks[0]; st.Status != desiredstate.StackSyncSuspended || len(st.Drift) != 1 || len(compose.upCalls) != 0 {
+		t.Fatalf("expected a suspended stack with drift and no sync, got %+v", st)
+	}
+	if _, err := r.Resume(context.Background(), "app"); !errors.Is(err, reconcile.ErrSuspendedBySettings) {
+		t.Errorf("expected ErrSuspendedBySettings, got %v", err)
+	}
+	if st := store.Get().Stacks[0]; st.Status != desiredstate.StackSyncSuspended {
+		t.Errorf("expected stack to stay suspended, got %q", st.Status)
+	}
+}
+
+func TestSuspensionStore_Expiry(t *testing.T) {
+	s := reconcile.NewSuspensionStore()
+	s.Suspend("app", desiredstate.Suspension{At: "2026-01-01T00:00:00Z", ExpiresAt: time.Now().Add(-time.Second).UTC().Format(time.RFC3339)})
+	s.Suspend("db", desiredstate.Suspension{At: "2026-01-01T00:00:00Z", ExpiresAt: time.Now().Add(time.Hour).UTC().Format(time.RFC3339)})
+
+	if _, ok := s.Get("app"); ok {
+		t.Error("expected expired suspension to be dropped")
+	}
+	if _, ok := s.Get("db"); !ok {
+		t.Error("expected unexpired suspension to stay")
+	}
+	if s.Resume("app") {
+		t.Error("expected expired suspension to be gone")
+	}
+}
@@ -0,0 +1,231 @@
+package reconcile
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+)
+
+// TriggerSync is the trigger source of manual per-stack syncs.
+const TriggerSync = "sync"
+
+// Results of manual syncs that have not finished yet. They are streamed and
+// listed at the top of the stack's history, but never recorded.
+const (
+	RunQueued  = "queued"
+	RunRunning = "running"
+)
+
+// ErrSyncBlocked is returned for manual syncs of pinned or suspended stacks.
+var ErrSyncBlocked = errors.New("stack cannot be synced")
+
+// SyncOptions are the flags of a manual sync.
+type SyncOptions struct {
+	// Force syncs the stack even if it is in sync, failed its health check at
+	// this configuration or awaits acknowledgement under the flag drift policy.
+	Force bool `json:"force"`
+	// Pull pulls every image, even those present locally.
+	Pull bool `json:"pull"`
+	// Recreate recreates containers even if their configuration is unchanged.
+	Recreate bool `json:"recreate"`
+	// OverrideWindow syncs the stack outside its sync windows.
+	OverrideWindow bool `json:"overrideWindow"`
+}
+
+// Sync queues a sync of a single stack and returns its run ID right away.
+// The run is streamed over SSE and recorded in the stack's history under
+// that ID. While a sync of the stack is queued, further requests return
+// its ID instead of queuing another one.
+func (r *Reconciler) Sync(ctx context.Context, path string, opts SyncOptions) (string, error) {
+	if !r.policy.Enabled || r.policy.DryRun {
+		return "", ErrReconcileDisabled
+	}
+	stack := findStack(r.store.Get(), path)
+	if stack == nil {
+		return "", ErrStackNotFound
+	}
+	if err := r.manualSyncBlocked(stack); err != nil {
+		return "", err
+	}
+	return r.queueSync(ctx, path, TriggerSync, opts), nil
+}
+
+// queueSync queues a sync of the stack at path with the given trigger and
+// returns its run ID, or the ID of a sync of the stack that is already queued.
+func (r *Reconciler) queueSync(ctx context.Context, path, trigger string, opts SyncOptions) string {
+	r.pendingMu.Lock()
+	for _, run := range r.pending[path] {
+		if run.Result == RunQueued {
+			r.pendingMu.Unlock()
+			return run.ID
+		}
+	}
+	run := ReconciliationRun{ID: newRunID(), StackPath: path, Trigger: trigger, Result: RunQueued, StartedAt: time.Now()}
+	r.pending[path] = append(r.pending[path], run)
+	r.pendingMu.Unlock()
+	r.publishPending(run)
+
+	log.Printf("[info] %s %s of stack %s queued", trigger, run.ID, path)
+	go r.runSync(context.WithoutCancel(ctx), run, opts)
+	return run.ID
+}
+
+// runSync runs a queued manual sync once no other sync of the stack is
+// running. Syncs of other stacks, and reconcile cycles busy with them, do not
+// hold it up.
+func (r *Reconciler) runSync(ctx context.Context, queued ReconciliationRun, opts SyncOptions) {
+	unlock := r.stackLocks.lock(queued.StackPath)
+	defer unlock()
+
+	running := queued
+	running.Result = RunRunning
+	r.setPending(running)
+	r.publishPending(running)
+
+	run := r.syncOne(ctx, queued.StackPath, opts)
+	run.ID = queued.ID
+	run.Trigger = queued.Trigger
+	if run.StartedAt.IsZero() {
+		run.StartedAt = time.Now()
+	}
+	if run.FinishedAt.IsZero() {
+		run.FinishedAt = time.Now()
+	}
+
+	r.setPending(run)
+	r.recordHistory(ctx, []ReconciliationRun{run})
+	log.Printf("[info] %s %s of stack %s finished: %s", run.Trigger, run.ID, run.StackPath, run.Result)
+}
+
+// syncOne syncs a single stack for a manual sync. It is called with the
+// stack's lock held.
+func (r *Reconciler) syncOne(ctx context.Context, path string, opts SyncOptions) ReconciliationRun {
+	run := ReconciliationRun{StackPath: path, StartedAt: time.Now()}
+	fail := func(result, reason string) ReconciliationRun {
+		run.Result = result
+		run.Error = reason
+		run.FinishedAt = time.Now()
+		return run
+	}
+
+	snap := r.store.Get()
+	stack := findStack(snap, path)
+	if stack == nil {
+		return fail("failed", ErrStackNotFound.Error())
+	}
+	run.DesiredRevision = snap.Revision
+	run.DesiredHash = stack.ComposeHash
+	if err := r.manualSyncBlocked(stack); err != nil {
+		return fail("skipped", err.Error())
+	}
+
+	runtime, err := r.inspector.GetStackLabels(ctx)
+	if err != nil {
+		return fail("failed", fmt.Sprintf("inspect runtime state: %v", err))
+	}
+
+	drift := DriftResult{Path: path, NeedSync: true, Reason: "manual sync"}
+	for _, d := range r.detectDrift(ctx, snap, runtime, false, map[string]bool{path: true}) {
+		if d.Path == path && (d.NeedSync || !opts.Force) {
+			drift = d
+		}
+	}
+	if !drift.NeedSync {
+		return fail("skipped", "already in sync")
+	}
+	if len(drift.Reasons) > 0 {
+		r.stateManager.SetDrift(path, drift.Reasons)
+	}
+
+	policy := r.policy.ForStack(stack.Settings)
+	if !opts.OverrideWindow {
+		if closed, next := windowClosed(policy, snap.CommitMessage); closed {
+			return fail("skipped", windowBlocked(next))
+		}
+	}
+	if !opts.Force {
+		if stack.FailedComposeHash != "" && stack.FailedComposeHash == stack.ComposeHash {
+			return fail("skipped", "failed its health check at this configuration")
+		}
+		if policy.DriftPolicy == "flag" && !r.ackStore.IsAcknowledged(path) {
+			return fail("skipped", "drift policy is flag, awaiting acknowledgement")
+		}
+	}
+	r.ackStore.Clear(path)
+
+	deps := desiredDependencies(snap)
+	if reason := dependencyError(path, deps, findCycles(deps)); reason != "" {
+		return r.failStack(path, snap.Revision, reason)
+	}
+
+	if opts.Pull {
+		policy.PullPolicy = desiredstate.PullPolicyAlways
+	}
+	policy.ForceRecreate = opts.Recreate
+	run = r.syncStack(ctx, drift, snap, policy, runtime[path])
+	r.recordAttempt(run)
+	return run
+}
+
+// manualSyncBlocked returns an error if stack may not be synced manually.
+func (r *Reconciler) manualSyncBlocked(stack *desiredstate.StackRecord) error {
+	if stack.PinnedRevision != "" {
+		return fmt.Errorf("%w: pinned to %s", ErrSyncBlocked, shortRevision(stack.PinnedRevision))
+	}
+	if _, suspended := r.suspension(stack.Path, r.policy.ForStack(stack.Settings)); suspended {
+		return fmt.Errorf("%w: suspended", ErrSyncBlocked)
+	}
+	return nil
+}
+
+// publishPending streams the state of an unfinished manual sync.
+func (r *Reconciler) publishPending(run ReconciliationRun) {
+	if r.broadcaster != nil {
+		r.broadcaster.PublishStackHistory(run.StackPath, run)
+	}
+}
+
+// setPending replaces the unfinished manual sync with the ID of run, or
+// drops it once run has finished. Other syncs of the stack are left alone,
+// such as one queued while run was running.
+func (r *Reconciler) setPending(run ReconciliationRun) {
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+	runs := r.pending[run.StackPath][:0]
+	for _, p := range r.pending[run.StackPath] {
+		if p.ID != run.ID {
+			runs = append(runs, p)
+		} else if run.Result == RunQueued || run.Result == RunRunning {
+			runs = append(runs, run)
+		}
+	}
+	if len(runs) == 0 {
+		delete(r.pending, run.StackPath)
+		return
+	}
+	r.pending[run.StackPath] = runs
+}
+
+// pendingRuns returns the unfinished manual syncs of a stack, newest first.
+func (r *Reconciler) pendingRuns(path string) []ReconciliationRun {
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+	stored := r.pending[path]
+	runs := make([]ReconciliationRun, len(stored))
+	for i, run := range stored {
+		runs[len(stored)-1-i] = run
+	}
+	return runs
+}
+
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,189 @@
+package reconcile_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+// waitForRun polls the history of path until the run with id has finished.
+func waitForRun(t *testing.T, r *reconcile.Reconciler, path, id string) reconcile.ReconciliationRun {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		page, _ := r.History(path, reconcile.HistoryQuery{})
+		for _, run := range page.Runs {
+			if run.ID == id && run.Result != reconcile.RunQueued && run.Result != reconcile.RunRunning {
+				return run
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for run %s", id)
+	return reconcile.ReconciliationRun{}
+}
+
+func TestSync_QueuesSingleStack(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h2", Content: []byte("services:\n  web:\n    image: nginx:2\n")},
+		{Path: "other", ComposeFile: "docker-compose.yml", ComposeHash: "o2", Content: []byte("services:\n  db:\n    image: postgres\n")},
+	}})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"app":   {StackPath: "app", DesiredRevision: "rev1", DesiredComposeHash: "h1"},
+		"other": {StackPath: "other", DesiredRevision: "rev1", DesiredComposeHash: "o1"},
+	}}
+	compose := &stubComposeRunner{}
+	r := newPinReconciler(store, compose, inspector, nil)
+
+	id, err := r.Sync(context.Background(), "app", reconcile.SyncOptions{})
+	if err != nil || id == "" {
+		t.Fatalf("Sync: %q, %v", id, err)
+	}
+	run := waitForRun(t, r, "app", id)
+	if run.Result != "success" || run.Trigger != reconcile.TriggerSync {
+		t.Errorf("unexpected run %+v", run)
+	}
+	if len(compose.upCalls) != 1 || compose.upCalls[0].ProjectName != "app" {
+		t.Fatalf("expected only app to be synced, got %+v", compose.upCalls)
+	}
+
+	// In sync: a plain sync is skipped, a forced one redeploys.
+	inspector.labels["app"] = reconcile.StackSyncMetadata{StackPath: "app", DesiredRevision: "rev2", DesiredComposeHash: "h2"}
+	id, _ = r.Sync(context.Background(), "app", reconcile.SyncOptions{})
+	if run := waitForRun(t, r, "app", id); run.Result != "skipped" || run.Error != "already in sync" {
+		t.Errorf("expected in-sync stack to be skipped, got %+v", run)
+	}
+	id, _ = r.Sync(context.Background(), "app", reconcile.SyncOptions{Force: true, Pull: true, Recreate: true})
+	if run := waitForRun(t, r, "app", id); run.Result != "success" {
+		t.Errorf("expected forced sync to succeed, got %+v", run)
+	}
+	if len(compose.upCalls) != 2 {
+		t.Fatalf("expected a second up call, got %d", len(compose.upCalls))
+	}
+	if opts := compose.upCalls[1].Options; !opts.ForceRecreate || opts.PullPolicy != desiredstate.PullPolicyAlways {
+		t.Errorf("expected pull and recreate flags, got %+v", opts)
+	}
+}
+
+// gatedComposeRunner blocks compose up for the "slow" project until release
+// is closed, signalling started once it first blocks.
+type gatedComposeRunner struct {
+	stubComposeRunner
+	started chan struct{}
+	release chan struct{}
+}
+
+func (g *gatedComposeRunner) ComposeUp(ctx context.Context, projectName string, composeFiles, envFiles []string, overrideFile, workDir string, opts reconcile.UpOptions) (string, error) {
+	out, err := g.stubComposeRunner.ComposeUp(ctx, projectName, composeFiles, envFiles, overrideFile, workDir, opts)
+	if projectName == "slow" {
+		select {
+		case <-g.started:
+		default:
+			close(g.started)
+		}
+		<-g.release
+	}
+	return out, err
+}
+
+func TestSync_NotBlockedByOtherStack(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: []desiredstate.StackRecord{
+		{Path: "slow", ComposeFile: "docker-compose.yml", ComposeHash: "s2", Content: []byte("services:\n  web:\n    image: nginx:2\n")},
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h2", Content: []byte("services:\n  web:\n    image: nginx:2\n")},
+	}})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"slow": {StackPath: "slow", DesiredRevision: "rev1", DesiredComposeHash: "s1"},
+		"app":  {StackPath: "app", DesiredRevision: "rev2", DesiredComposeHash: "h2"},
+	}}
+	compose := &gatedComposeRunner{started: make(chan struct{}), release: make(chan struct{})}
+	r := newPinReconciler(store, compose, inspector, nil)
+
+	cycle := make(chan []reconcile.ReconciliationRun)
+	go func() { cycle <- r.Reconcile(context.Background()) }()
+	<-compose.started
+
+	// The cycle is stuck deploying slow; a manual sync of app still runs.
+	id, err := r.Sync(context.Background(), "app", reconcile.SyncOptions{Force: true})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if run := waitForRun(t, r, "app", id); run.Result != "success" {
+		t.Errorf("expected manual sync to succeed while slow is syncing, got %+v", run)
+	}
+
+	close(compose.release)
+	if runs := <-cycle; len(runs) != 1 || runs[0].StackPath != "slow" || runs[0].Result != "success" {
+		t.Errorf("expected the cycle to sync slow, got %+v", runs)
+	}
+}
+
+func TestSync_QueuedWhileRunning(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: []desiredstate.StackRecord{
+		{Path: "slow", ComposeFile: "docker-compose.yml", ComposeHash: "s2", Content: []byte("services:\n  web:\n    image: nginx:2\n")},
+	}})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"slow": {StackPath: "slow", DesiredRevision: "rev1", DesiredComposeHash: "s1"},
+	}}
+	compose := &gatedComposeRunner{started: make(chan struct{}), release: make(chan struct{})}
+	r := newPinReconciler(store, compose, inspector, nil)
+
+	first, err := r.Sync(context.Background(), "slow", reconcile.SyncOptions{Force: true})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	<-compose.started
+	second, err := r.Sync(context.Background(), "slow", reconcile.SyncOptions{Force: true})
+	if err != nil || second == first {
+		t.Fatalf("expected a second sync queued behind the running one, got %q, %v", second, err)
+	}
+
+	page, _ := r.History("slow", reconcile.HistoryQuery{})
+	if len(page.Runs) != 2 || page.Total != 2 ||
+		page.Runs[0].ID != second || page.Runs[0].Result != reconcile.RunQueued ||
+		page.Runs[1].ID != first || page.Runs[1].Result != reconcile.RunRunning {
+		t.Fatalf("expected the queued and the running sync in history, got %+v", page)
+	}
+	if page, _ := r.History("slow", reconcile.HistoryQuery{Offset: 1, Limit: 1}); len(page.Runs) != 1 || page.Runs[0].ID != first || page.Total != 2 {
+		t.Errorf("expected the running sync on the second page, got %+v", page)
+	}
+
+	close(compose.release)
+	if run := waitForRun(t, r, "slow", first); run.Result != "success" {
+		t.Errorf("expected the first sync to succeed, got %+v", run)
+	}
+	if run := waitForRun(t, r, "slow", second); run.Result != "success" {
+		t.Errorf("expected the queued sync to run after the first, got %+v", run)
+	}
+}
+
+func TestSync_Errors(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h2"},
+	}})
+	r := newPinReconciler(store, &stubComposeRunner{}, &dynamicInspector{}, nil)
+
+	if _, err := r.Sync(context.Background(), "nope", reconcile.SyncOptions{}); !errors.Is(err, reconcile.ErrStackNotFound) {
+		t.Errorf("expected ErrStackNotFound, got %v", err)
+	}
+	if _, err := r.Suspend("app", "", "", time.Time{}); err != nil {
+		t.Fatalf("Suspend: %v", err)
+	}
+	if _, err := r.Sync(context.Background(), "app", reconcile.SyncOptions{Force: true}); !errors.Is(err, reconcile.ErrSyncBlocked) {
+		t.Errorf("expected ErrSyncBlocked for a suspended stack, got %v", err)
+	}
+
+	policy := reconcile.DefaultPolicy()
+	policy.DryRun = true
+	dry := reconcile.NewReconciler(store, policy, &stubComposeRunner{}, &dynamicInspector{}, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, &stubComposeRunner{}))
+	if _, err := dry.Sync(context.Background(), "app", reconcile.SyncOptions{}); !errors.Is(err, reconcile.ErrReconcileDisabled) {
+		t.Errorf("expected ErrReconcileDisabled in dry-run mode, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package reconcile
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/docker"
+)
+
+// WatchedActions are the container events that can mean a managed stack
+// drifted from its desired state.
+var WatchedActions = []string{"die", "stop", "destroy", "rename"}
+
+const (
+	// defaultWatchDebounce collects bursts of events (a docker compose down
+	// emits several per container) into one drift check per stack.
+	defaultWatchDebounce = 2 * time.Second
+	// Reconnects back off from watchReconnectMin to watchReconnectMax; the
+	// delay resets once a stream stayed up for watchStableAfter.
+	watchReconnectMin = time.Second
+	watchReconnectMax = 30 * time.Second
+	watchStableAfter  = time.Minute
+)
+
+// EventSource streams container events for containers with a label key.
+type EventSource interface {
+	StreamEvents(ctx context.Context, labelKey string, actions []string, fn func(docker.ContainerEvent)) error
+}
+
+// RuntimeWatcher turns Docker container events for managed stacks into
+// immediate container count updates and debounced per-stack drift checks, so
+// runtime drift is handled without waiting for a Git refresh.
+type RuntimeWatcher struct {
+	source     EventSource
+	reconciler *Reconciler
+	debounce   time.Duration
+	reconnect  time.Duration
+}
+
+// NewRuntimeWatcher creates a watcher that checks stacks with reconciler.
+func NewRuntimeWatcher(source EventSource, reconciler *Reconciler) *RuntimeWatcher {
+	return &RuntimeWatcher{
+		source:     source,
+		reconciler: reconciler,
+		debounce:   defaultWatchDebounce,
+		reconnect:  watchReconnectMin,
+	}
+}
+
+// SetDebounce sets how long the watcher waits for further events before checking stacks.
+func (w *RuntimeWatcher) SetDebounce(d time.Duration) {
+	w.debounce = d
+}
+
+// Run watches Docker events until ctx is cancelled. After a reconnect, events
+// may have been missed, so all stacks are checked.
+func (w *RuntimeWatcher) Run(ctx context.Context) {
+	events := make(chan docker.ContainerEvent, 64)
+	reconnected := make(chan struct{}, 1)
+	go w.stream(ctx, events, reconnected)
+
+	pending := make(map[string]bool)
+	all := false
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-events:
+			path := ev.Labels[LabelStackPath]
+			if path == "" || !w.reconciler.owner().Owns(MapLabelsToMetadata(ev.Labels)) {
+				continue
+			}
+			log.Printf("[debug] docker event %s for container %s of stack %s", ev.Action, ev.ContainerName, path)
+			projectName := deriveProjectName(w.reconciler.projectNamePrefix(), path)
+			w.reconciler.stateManager.UpdateContainerCounts(ctx, path, projectName)
+			pending[path] = true
+			timer.Reset(w.debounce)
+		case <-reconnected:
+			all = true
+			timer.Reset(w.debounce)
+		case <-timer.C:
+			if all {
+				log.Printf("[info] docker events reconnected, checking all stacks for drift")
+				w.reconciler.Reconcile(WithTrigger(ctx, TriggerDockerEvent))
+			} else {
+				paths := make([]string, 0, len(pending))
+				for path := range pending {
+					paths = append(paths, path)
+				}
+				log.Printf("[info] docker events: checking %d stack(s) for drift", len(paths))
+				w.reconciler.CheckStacks(WithTrigger(ctx, TriggerDockerEvent), paths)
+			}
+			pending = make(map[string]bool)
+			all = false
+		}
+	}
+}
+
+// stream follows the event stream, reconnecting with backoff when it ends.
+func (w *RuntimeWatcher) stream(ctx context.Context, events chan<- docker.ContainerEvent, reconnected chan<- struct{}) {
+	delay := w.reconnect
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			select {
+			case reconnected <- struct{}{}:
+			default:
+			}
+		}
+
+		started := time.Now()
+		err := w.source.StreamEvents(ctx, LabelStackPath, WatchedActions, func(ev docker.ContainerEvent) {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > watchStableAfter {
+			delay = w.reconnect
+		}
+		log.Printf("[warn] docker events stream ended: %v, reconnecting in %s", err, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, watchReconnectMax)
+	}
+}
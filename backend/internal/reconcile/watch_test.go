@@ -0,0 +1,106 @@
+package reconcile_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/docker"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+)
+
+// stubEventSource emits events on the first stream and fails every stream.
+type stubEventSource struct {
+	mu      sync.Mutex
+	events  []docker.ContainerEvent
+	streams int
+}
+
+func (s *stubEventSource) StreamEvents(_ context.Context, labelKey string, _ []string, fn func(docker.ContainerEvent)) error {
+	s.mu.Lock()
+	s.streams++
+	first := s.streams == 1
+	s.mu.Unlock()
+	if labelKey != reconcile.LabelStackPath {
+		return errors.New("unexpected label filter " + labelKey)
+	}
+	if first {
+		for _, ev := range s.events {
+			fn(ev)
+		}
+	}
+	return errors.New("daemon restarted")
+}
+
+// psComposeRunner reports one running container per project.
+type psComposeRunner struct {
+	stubComposeRunner
+}
+
+func (p *psComposeRunner) ComposePs(_ context.Context, projectName string) ([]desiredstate.ContainerInfo, error) {
+	return []desiredstate.ContainerInfo{{Name: projectName + "-web-1", State: "running"}}, nil
+}
+
+func (p *psComposeRunner) upProjects() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	projects := make(map[string]int)
+	for _, c := range p.upCalls {
+		projects[c.ProjectName]++
+	}
+	return projects
+}
+
+func TestRuntimeWatcher_ChecksStacksFromEvents(t *testing.T) {
+	content := []byte("services:\n  web:\n    image: nginx\n")
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev1", Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h1", Status: desiredstate.StackSyncSynced, Content: content},
+		{Path: "other", ComposeFile: "docker-compose.yml", ComposeHash: "h2", Status: desiredstate.StackSyncSynced, Content: content},
+	}})
+
+	// Both stacks lost their containers; only app is reported by an event.
+	compose := &psComposeRunner{}
+	r := reconcile.NewReconciler(store, reconcile.DefaultPolicy(), compose, &stubInspector{labels: map[string]reconcile.StackSyncMetadata{}}, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	labels := map[string]string{reconcile.LabelStackPath: "app", reconcile.LabelOwnerInstance: reconcile.DefaultInstanceID, reconcile.LabelOwnerDeployDir: "/"}
+	source := &stubEventSource{events: []docker.ContainerEvent{
+		{Action: "die", ContainerName: "app-web-1", Labels: labels},
+		{Action: "destroy", ContainerName: "app-web-1", Labels: labels},
+		{Action: "die", ContainerName: "unmanaged"},
+		// Carries our stack label but was started by hand.
+		{Action: "die", ContainerName: "other-web-1", Labels: map[string]string{reconcile.LabelStackPath: "other"}},
+	}}
+	w := reconcile.NewRuntimeWatcher(source, r)
+	w.SetDebounce(20 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	waitFor("app to be re-synced", func() bool { return compose.upProjects()["app"] == 1 })
+	if n := compose.upProjects()["other"]; n != 0 {
+		t.Errorf("stacks without events must not be checked before a reconnect, got %d syncs of other", n)
+	}
+	for _, st := range store.GetStacks() {
+		if st.Path == "app" && st.ContainersRunning != 1 {
+			t.Errorf("expected container counts to be updated from the event, got %d running", st.ContainersRunning)
+		}
+	}
+
+	// Events may have been missed while disconnected, so all stacks are checked.
+	waitFor("all stacks to be checked after reconnecting", func() bool { return compose.upProjects()["other"] == 1 })
+}
@@ -0,0 +1,144 @@
+package reconcile
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/syncwindow"
+)
+
+// TriggerSyncWindow is the trigger source of syncs deferred until a sync
+// window opened.
+const TriggerSyncWindow = "sync_window"
+
+// windowTracker remembers when the stacks deferred by their sync windows may
+// be synced, and wakes the window loop when that changes.
+type windowTracker struct {
+	mu       sync.Mutex
+	deferred map[string]time.Time
+	wake     chan struct{}
+}
+
+func newWindowTracker() *windowTracker {
+	return &windowTracker{deferred: make(map[string]time.Time), wake: make(chan struct{}, 1)}
+}
+
+// deferUntil records that path is deferred until next.
+func (t *windowTracker) deferUntil(path string, next time.Time) {
+	t.mu.Lock()
+	changed := !t.deferred[path].Equal(next)
+	t.deferred[path] = next
+	t.mu.Unlock()
+
+	if changed {
+		select {
+		case t.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// clear forgets a deferred stack.
+func (t *windowTracker) clear(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.deferred, path)
+}
+
+// next returns the earliest time a deferred stack may be synced, or false
+// if no stack is deferred.
+func (t *windowTracker) next() (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var earliest time.Time
+	for _, next := range t.deferred {
+		if earliest.IsZero() || next.Before(earliest) {
+			earliest = next
+		}
+	}
+	return earliest, !earliest.IsZero()
+}
+
+// due removes and returns the deferred stacks whose window has opened.
+func (t *windowTracker) due(now time.Time) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var paths []string
+	for path, next := range t.deferred {
+		if !now.Before(next) {
+			paths = append(paths, path)
+			delete(t.deferred, path)
+		}
+	}
+	return paths
+}
+
+// windowClosed reports whether the sync windows of policy defer a sync now,
+// and when they open next (zero if not within a year). Commits whose message
+// carries the bypass trailer are synced regardless.
+func windowClosed(policy ReconciliationPolicy, commitMessage string) (bool, time.Time) {
+	if len(policy.SyncWindows) == 0 || syncwindow.Bypassed(commitMessage) {
+		return false, time.Time{}
+	}
+	open, next := syncwindow.Open(policy.SyncWindows, time.Now())
+	return !open, next
+}
+
+// windowBlocked describes a sync deferred until next.
+func windowBlocked(next time.Time) string {
+	if next.IsZero() {
+		return "outside sync window"
+	}
+	return "outside sync window until " + next.UTC().Format(time.RFC3339)
+}
+
+// deferToWindow marks a drifted stack pending its next sync window. Stacks
+// removed from Git have no record and are only tracked.
+func (r *Reconciler) deferToWindow(stack *desiredstate.StackRecord, path string, next time.Time) {
+	if next.IsZero() {
+		log.Printf("[info] stack %s is outside its sync windows, which do not open within a year", path)
+	} else {
+		log.Printf("[info] stack %s is outside its sync windows, deferring until %s", path, next.Format(time.RFC3339))
+		r.windows.deferUntil(path, next)
+	}
+	if stack == nil {
+		return
+	}
+	nextAt := ""
+	if !next.IsZero() {
+		nextAt = next.UTC().Format(time.RFC3339)
+	}
+	if stack.Status != desiredstate.StackSyncPendingWindow || stack.NextWindowAt != nextAt {
+		r.stateManager.MarkPendingWindow(path, nextAt)
+	}
+}
+
+// RunSyncWindows syncs the stacks deferred by their sync windows when the
+// windows open, independently of Git refreshes. It blocks until ctx is
+// cancelled.
+func (r *Reconciler) RunSyncWindows(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		if next, ok := r.windows.next(); ok {
+			timer.Reset(time.Until(next))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.windows.wake:
+			timer.Stop()
+		case <-timer.C:
+			if paths := r.windows.due(time.Now()); len(paths) > 0 {
+				log.Printf("[info] sync window opened for %d stack(s)", len(paths))
+				r.CheckStacks(WithTrigger(ctx, TriggerSyncWindow), paths)
+			}
+		}
+	}
+}
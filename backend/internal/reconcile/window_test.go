@@ -0,0 +1,83 @@
+package reconcile_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/desiredstate"
+	"github.com/lucasreiners/docker-cd/internal/reconcile"
+	"github.com/lucasreiners/docker-cd/internal/syncwindow"
+)
+
+// laterWindow is a daily allow window that opens in one to two hours.
+func laterWindow() []syncwindow.Window {
+	hour := time.Now().UTC().Add(2 * time.Hour).Hour()
+	return []syncwindow.Window{{Kind: "allow", Schedule: fmt.Sprintf("0 %d * * *", hour), Duration: "1h", TimeZone: "UTC"}}
+}
+
+func newWindowReconciler(store *desiredstate.Store, compose reconcile.ComposeRunner, inspector reconcile.ContainerInspector) *reconcile.Reconciler {
+	policy := reconcile.DefaultPolicy()
+	policy.SyncWindows = laterWindow()
+	r := reconcile.NewReconciler(store, policy, compose, inspector, reconcile.NewAckStore(), "", newTestDriftDetector(""), newTestStateManager(store, compose))
+	r.SetHistory(reconcile.NewMemoryHistory(0))
+	return r
+}
+
+func TestReconcile_DefersOutsideSyncWindow(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", CommitMessage: "Bump nginx", Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h2", Content: []byte("services:\n  web:\n    image: nginx:2\n")},
+	}})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"app": {StackPath: "app", DesiredRevision: "rev1", DesiredComposeHash: "h1"},
+	}}
+	compose := &stubComposeRunner{}
+	r := newWindowReconciler(store, compose, inspector)
+
+	r.Reconcile(context.Background())
+	if len(compose.upCalls) != 0 {
+		t.Fatalf("expected sync deferred, got %d up calls", len(compose.upCalls))
+	}
+	st := store.Get().Stacks[0]
+	if st.Status != desiredstate.StackSyncPendingWindow || st.NextWindowAt == "" {
+		t.Errorf("expected pending_window with next window, got %q/%q", st.Status, st.NextWindowAt)
+	}
+	if plan, _ := r.Plan(context.Background()); plan.Stacks[0].Blocked != "outside sync window until "+st.NextWindowAt {
+		t.Errorf("expected plan to report the window, got %q", plan.Stacks[0].Blocked)
+	}
+
+	// An urgent commit bypasses the window.
+	snap := store.Get()
+	snap.CommitMessage = "Fix outage\n\nSync-Window: bypass"
+	store.Set(snap)
+	r.Reconcile(context.Background())
+	if len(compose.upCalls) != 1 {
+		t.Fatalf("expected bypass trailer to sync, got %d up calls", len(compose.upCalls))
+	}
+	if st := store.Get().Stacks[0]; st.Status != desiredstate.StackSyncSynced || st.NextWindowAt != "" {
+		t.Errorf("expected synced without next window, got %q/%q", st.Status, st.NextWindowAt)
+	}
+}
+
+func TestSync_OverrideWindow(t *testing.T) {
+	store := desiredstate.NewStore()
+	store.Set(&desiredstate.Snapshot{Revision: "rev2", Stacks: []desiredstate.StackRecord{
+		{Path: "app", ComposeFile: "docker-compose.yml", ComposeHash: "h2", Content: []byte("services:\n  web:\n    image: nginx:2\n")},
+	}})
+	inspector := &dynamicInspector{labels: map[string]reconcile.StackSyncMetadata{
+		"app": {StackPath: "app", DesiredRevision: "rev1", DesiredComposeHash: "h1"},
+	}}
+	compose := &stubComposeRunner{}
+	r := newWindowReconciler(store, compose, inspector)
+
+	id, _ := r.Sync(context.Background(), "app", reconcile.SyncOptions{})
+	if run := waitForRun(t, r, "app", id); run.Result != "skipped" || len(compose.upCalls) != 0 {
+		t.Errorf("expected manual sync to respect the window, got %+v", run)
+	}
+	id, _ = r.Sync(context.Background(), "app", reconcile.SyncOptions{OverrideWindow: true})
+	if run := waitForRun(t, r, "app", id); run.Result != "success" || len(compose.upCalls) != 1 {
+		t.Errorf("expected override to sync, got %+v", run)
+	}
+}
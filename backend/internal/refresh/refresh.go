@@ -10,8 +10,9 @@ import (
 	"github.com/lucasreiners/docker-cd/internal/git"
 )
 
-// ReconcileFunc is a callback invoked after each successful refresh to trigger reconciliation.
-type ReconcileFunc func(ctx context.Context)
+// ReconcileFunc is a callback invoked after each successful refresh to trigger
+// reconciliation. source is what triggered the refresh.
+type ReconcileFunc func(ctx context.Context, source TriggerSource)
 
 // Service orchestrates desired-state refreshes from Git.
 type Service struct {
@@ -19,6 +20,7 @@ type Service struct {
 	store       *desiredstate.Store
 	queue       *Queue
 	reader      git.ComposeReader
+	auth        git.AuthProvider
 	reconcileF  ReconcileFunc
 	broadcaster *desiredstate.Broadcaster
 }
@@ -30,6 +32,7 @@ func NewService(cfg config.Config, store *desiredstate.Store, queue *Queue, read
 		store:  store,
 		queue:  queue,
 		reader: reader,
+		auth:   git.NewCredentials(cfg),
 	}
 }
 
@@ -103,12 +106,19 @@ func (s *Service) doRefresh(ctx context.Context, trigger Trigger) {
 		s.broadcaster.PublishRefreshStatus(s.store.GetRefreshStatus())
 	}
 
-	entries, commitHash, commitMessage, err := s.reader.ReadComposeFiles(
+	// Pass the current revision so an unchanged repository skips the tree walk.
+	knownRevision := ""
+	if current := s.store.GetRefreshStatus(); current != nil {
+		knownRevision = current.Revision
+	}
+
+	result, err := s.reader.ReadComposeFiles(
 		ctx,
 		s.cfg.GitRepoURL,
-		s.cfg.GitAccessToken,
+		s.auth,
 		s.cfg.GitRevision,
 		s.cfg.GitDeployDir,
+		knownRevision,
 	)
 
 	if err != nil {
@@ -121,41 +131,56 @@ func (s *Service) doRefresh(ctx context.Context, trigger Trigger) {
 		return
 	}
 
-	newStacks := s.buildStacksPreservingStatus(entries)
-
-	snap := &desiredstate.Snapshot{
-		Revision:      commitHash,
-		CommitMessage: commitMessage,
-		Ref:           s.cfg.GitRevision,
-		RefType:       "branch",
-		RefreshedAt:   time.Now(),
-		RefreshStatus: desiredstate.RefreshStatusCompleted,
-		RefreshError:  "",
-		Stacks:        newStacks,
+	if result.Unchanged {
+		s.store.MarkRefreshed(time.Now())
+		log.Printf("[info] refresh completed: revision %s unchanged", truncate(result.Commit, 12))
+		if s.broadcaster != nil {
+			s.broadcaster.PublishRefreshStatus(s.store.GetRefreshStatus())
+		}
+		s.reconcile(ctx, trigger.Source)
+		s.queue.Done()
+		return
 	}
 
-	s.store.Set(snap)
-	log.Printf("[info] refresh completed: %d stacks at %s", len(newStacks), truncate(commitHash, 12))
+	// Build the new stacks under the store lock, so status updates from
+	// manual syncs running meanwhile are carried over instead of lost
+	s.store.Replace(func(prev []desiredstate.StackRecord) *desiredstate.Snapshot {
+		return &desiredstate.Snapshot{
+			Revision:      result.Commit,
+			CommitMessage: result.CommitMessage,
+			Ref:           result.Ref,
+			RefType:       result.RefType,
+			RefreshedAt:   time.Now(),
+			RefreshStatus: desiredstate.RefreshStatusCompleted,
+			RefreshError:  "",
+			Stacks:        s.buildStacksPreservingStatus(prev, result.Entries),
+		}
+	})
+	newStacks := s.store.GetStacks()
+	log.Printf("[info] refresh completed: %d stacks at %s", len(newStacks), truncate(result.Commit, 12))
 
 	// Publish SSE events for connected frontends
 	if s.broadcaster != nil {
-		s.broadcaster.PublishStackSnapshot(newStacks)
+		s.broadcaster.PublishStackSnapshot(s.store.GetAllStacks())
 		s.broadcaster.PublishRefreshStatus(s.store.GetRefreshStatus())
 	}
 
-	// Trigger reconciliation after successful refresh (FR-001, FR-002)
+	s.reconcile(ctx, trigger.Source)
+	s.queue.Done()
+}
+
+// reconcile triggers reconciliation after a successful refresh (FR-001, FR-002).
+// It also runs when the revision is unchanged so runtime drift is still corrected.
+func (s *Service) reconcile(ctx context.Context, source TriggerSource) {
 	if s.reconcileF != nil {
 		log.Printf("[info] triggering reconciliation after refresh")
-		s.reconcileF(ctx)
+		s.reconcileF(ctx, source)
 	}
-
-	s.queue.Done()
 }
 
 // buildStacksPreservingStatus creates StackRecords from Git entries,
-// preserving the sync status of stacks that already exist with the same hash.
-func (s *Service) buildStacksPreservingStatus(entries []git.ComposeEntry) []desiredstate.StackRecord {
-	existingStacks := s.store.GetStacks()
+// preserving the sync status of existingStacks with the same hash.
+func (s *Service) buildStacksPreservingStatus(existingStacks []desiredstate.StackRecord, entries []git.ComposeEntry) []desiredstate.StackRecord {
 	existing := make(map[string]desiredstate.StackRecord, len(existingStacks))
 	for _, st := range existingStacks {
 		existing[st.Path] = st
@@ -163,10 +188,10 @@ func (s *Service) buildStacksPreservingStatus(entries []git.ComposeEntry) []desi
 
 	newStacks := make([]desiredstate.StackRecord, 0, len(entries))
 	for _, e := range entries {
-		hash := desiredstate.ComposeHash(e.Content)
+		rec := e.Record()
+		hash := rec.ComposeHash
 
 		status := desiredstate.StackSyncMissing
-		rec := desiredstate.StackRecord{}
 		if prev, ok := existing[e.StackPath]; ok && prev.ComposeHash == hash {
 			status = prev.Status
 			log.Printf("[debug] buildStacksPreservingStatus: stack=%s status=%s (preserved, hash match)", e.StackPath, status)
@@ -178,17 +203,24 @@ func (s *Service) buildStacksPreservingStatus(entries []git.ComposeEntry) []desi
 			rec.LastSyncAt = prev.LastSyncAt
 			rec.LastSyncStatus = prev.LastSyncStatus
 			rec.LastSyncError = prev.LastSyncError
+			rec.FailedComposeHash = prev.FailedComposeHash
+			rec.RolledBackTo = prev.RolledBackTo
+			rec.RolledBackAt = prev.RolledBackAt
+			rec.PinnedRevision = prev.PinnedRevision
+			rec.PinnedAt = prev.PinnedAt
+			rec.Suspension = prev.Suspension
+			rec.NextWindowAt = prev.NextWindowAt
+			rec.Drift = prev.Drift
+			rec.SyncAttempts = prev.SyncAttempts
+			rec.NextRetryAt = prev.NextRetryAt
 		} else if prev, ok := existing[e.StackPath]; ok {
 			log.Printf("[debug] buildStacksPreservingStatus: stack=%s status=missing (hash changed: prev=%s new=%s)", e.StackPath, truncate(prev.ComposeHash, 12), truncate(hash, 12))
 		} else {
 			log.Printf("[debug] buildStacksPreservingStatus: stack=%s status=missing (new stack)", e.StackPath)
 		}
 
-		rec.Path = e.StackPath
-		rec.ComposeFile = e.ComposeFile
-		rec.ComposeHash = hash
 		rec.Status = status
-		rec.Content = e.Content
+		rec.Policy = e.Settings.Apply(s.basePolicy())
 
 		newStacks = append(newStacks, rec)
 	}
@@ -196,6 +228,18 @@ func (s *Service) buildStacksPreservingStatus(entries []git.ComposeEntry) []desi
 	return newStacks
 }
 
+// basePolicy is the stack policy from the global configuration, before any
+// per-stack settings are applied.
+func (s *Service) basePolicy() desiredstate.StackPolicy {
+	return desiredstate.StackPolicy{
+		DriftPolicy:   s.cfg.DriftPolicy,
+		RemoveEnabled: s.cfg.ReconcileRemoveEnabled,
+		HealthTimeout: desiredstate.Duration(s.cfg.SyncHealthTimeout),
+		PullPolicy:    s.cfg.PullPolicy,
+		SyncWindows:   s.cfg.SyncWindows,
+	}
+}
+
 func truncate(s string, n int) string {
 	if len(s) <= n {
 		return s
@@ -2,6 +2,7 @@ package refresh_test
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -19,9 +20,15 @@ type mockComposeReader struct {
 	calls         int
 }
 
-func (m *mockComposeReader) ReadComposeFiles(_ context.Context, _, _, _, _ string) ([]git.ComposeEntry, string, string, error) {
+func (m *mockComposeReader) ReadComposeFiles(_ context.Context, _ string, _ git.AuthProvider, _, _, knownRevision string) (git.ReadResult, error) {
 	m.calls++
-	return m.entries, m.commit, m.commitMessage, m.err
+	if m.err != nil {
+		return git.ReadResult{}, m.err
+	}
+	if knownRevision != "" && knownRevision == m.commit {
+		return git.ReadResult{Commit: m.commit, Unchanged: true}, nil
+	}
+	return git.ReadResult{Entries: m.entries, Commit: m.commit, CommitMessage: m.commitMessage}, nil
 }
 
 func TestService_StartupRefresh(t *testing.T) {
@@ -144,7 +151,8 @@ func TestService_PreserveSyncStatus(t *testing.T) {
 	snap.Stacks[0].Status = desiredstate.StackSyncSynced
 	store.Set(snap)
 
-	// Trigger another refresh (same content, same hash)
+	// Trigger another refresh on a new commit (same content, same hash)
+	reader.commit = "commit2"
 	svc.RequestRefresh(refresh.TriggerManual)
 	time.Sleep(500 * time.Millisecond)
 
@@ -161,6 +169,56 @@ func TestService_PreserveSyncStatus(t *testing.T) {
 	}
 }
 
+func TestService_UnchangedRevision(t *testing.T) {
+	reader := &mockComposeReader{
+		entries: []git.ComposeEntry{
+			{StackPath: "app1", ComposeFile: "docker-compose.yml", Content: []byte("v1")},
+		},
+		commit: "commit1",
+	}
+
+	store := desiredstate.NewStore()
+	queue := refresh.NewQueue()
+	cfg := config.Config{
+		GitRepoURL:     "https://github.com/org/repo.git",
+		GitAccessToken: "tok",
+		GitRevision:    "main",
+	}
+
+	svc := refresh.NewService(cfg, store, queue, reader)
+	var reconciles atomic.Int32
+	svc.SetReconcileFunc(func(context.Context, refresh.TriggerSource) { reconciles.Add(1) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	go svc.Start(ctx)
+
+	// Wait for startup refresh
+	time.Sleep(500 * time.Millisecond)
+	first := store.Get()
+	if first == nil {
+		t.Fatal("expected non-nil snapshot")
+	}
+
+	svc.RequestRefresh(refresh.TriggerManual)
+	time.Sleep(500 * time.Millisecond)
+
+	snap := store.Get()
+	if snap.RefreshStatus != desiredstate.RefreshStatusCompleted {
+		t.Errorf("expected completed status, got %q", snap.RefreshStatus)
+	}
+	if snap.Revision != "commit1" || len(snap.Stacks) != 1 {
+		t.Errorf("expected revision and stacks kept, got %q / %d", snap.Revision, len(snap.Stacks))
+	}
+	if !snap.RefreshedAt.After(first.RefreshedAt) {
+		t.Error("expected refreshedAt to advance on unchanged refresh")
+	}
+	if got := reconciles.Load(); got != 2 {
+		t.Errorf("expected reconcile after both refreshes, got %d", got)
+	}
+}
+
 func TestService_RefreshFailure(t *testing.T) {
 	reader := &mockComposeReader{
 		err: context.DeadlineExceeded,
@@ -195,3 +253,80 @@ func TestService_RefreshFailure(t *testing.T) {
 		t.Error("expected non-empty refresh error")
 	}
 }
+
+func TestService_EffectiveStackPolicy(t *testing.T) {
+	reader := &mockComposeReader{
+		entries: []git.ComposeEntry{
+			{StackPath: "app1", ComposeFile: "docker-compose.yml", Content: []byte("v1"),
+				Settings: &desiredstate.StackSettings{DriftPolicy: "flag", Profiles: []string{"web"}}},
+			{StackPath: "app2", ComposeFile: "docker-compose.yml", Content: []byte("v1")},
+		},
+		commit: "commit1",
+	}
+
+	store := desiredstate.NewStore()
+	cfg := config.Config{
+		GitRepoURL:             "https://github.com/org/repo.git",
+		GitRevision:            "main",
+		DriftPolicy:            config.DriftPolicyRevert,
+		ReconcileRemoveEnabled: true,
+		PullPolicy:             desiredstate.PullPolicyAlways,
+	}
+	svc := refresh.NewService(cfg, store, refresh.NewQueue(), reader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go svc.Start(ctx)
+
+	for store.Get() == nil {
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for refresh")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	stacks := store.GetStacks()
+	if p := stacks[0].Policy; p.DriftPolicy != "flag" || !p.RemoveEnabled || len(p.Profiles) != 1 {
+		t.Errorf("expected settings applied over global config, got %+v", p)
+	}
+	if p := stacks[1].Policy; p.DriftPolicy != "revert" || !p.RemoveEnabled || p.PullPolicy != desiredstate.PullPolicyAlways {
+		t.Errorf("expected global policy, got %+v", p)
+	}
+}
+
+func TestService_PinReleasedWhenStackChanges(t *testing.T) {
+	reader := &mockComposeReader{
+		entries: []git.ComposeEntry{{StackPath: "app1", ComposeFile: "docker-compose.yml", Content: []byte("services: {}")}},
+		commit:  "commit1",
+	}
+	store := desiredstate.NewStore()
+	cfg := config.Config{GitRepoURL: "https://github.com/org/repo.git", GitAccessToken: "tok", GitRevision: "main"}
+	svc := refresh.NewService(cfg, store, refresh.NewQueue(), reader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go svc.Start(ctx)
+	time.Sleep(500 * time.Millisecond)
+
+	store.UpdateStack("app1", func(st *desiredstate.StackRecord) {
+		st.Status = desiredstate.StackSyncPinned
+		st.PinnedRevision = "commit0"
+	})
+
+	// A commit that does not touch the stack keeps the pin.
+	reader.commit = "commit2"
+	svc.RequestRefresh(refresh.TriggerManual)
+	time.Sleep(500 * time.Millisecond)
+	if st := store.Get().Stacks[0]; st.Status != desiredstate.StackSyncPinned || st.PinnedRevision != "commit0" {
+		t.Fatalf("expected pin preserved, got %q/%q", st.Status, st.PinnedRevision)
+	}
+
+	reader.commit = "commit3"
+	reader.entries[0].Content = []byte("services:\n  web: {}")
+	svc.RequestRefresh(refresh.TriggerManual)
+	time.Sleep(500 * time.Millisecond)
+	if st := store.Get().Stacks[0]; st.Status != desiredstate.StackSyncMissing || st.PinnedRevision != "" {
+		t.Errorf("expected pin released by the change, got %q/%q", st.Status, st.PinnedRevision)
+	}
+}
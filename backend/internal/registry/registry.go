@@ -0,0 +1,311 @@
+// Package registry resolves image tags to manifest digests using the
+// OCI distribution (Docker Registry v2) API.
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Docker Hub names as used in image references and by its registry API.
+const (
+	dockerHubDomain   = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+// defaultTokenLifetime is how long a bearer token is cached when the token
+// server does not say, as in the distribution token spec.
+const defaultTokenLifetime = 60 * time.Second
+
+// manifestAccept lists the manifest media types a registry may return for a tag.
+// Index types come first so a multi-arch tag resolves to the digest docker
+// records in an image's RepoDigests.
+var manifestAccept = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Reference is a parsed image reference such as nginx:1.27 or
+// registry.example.com:5000/team/app@sha256:....
+type Reference struct {
+	// Domain is the registry host as written in the reference, docker.io by default.
+	Domain string
+	// Repository is the repository path, with library/ added for official Docker Hub images.
+	Repository string
+	// Tag defaults to latest when neither a tag nor a digest is given.
+	Tag    string
+	Digest string
+}
+
+// ParseReference parses an image reference using the docker CLI's
+// normalisation rules.
+func ParseReference(image string) (Reference, error) {
+	var ref Reference
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.Digest = name[:i], name[i+1:]
+		if !strings.HasPrefix(ref.Digest, "sha256:") {
+			return Reference{}, fmt.Errorf("invalid image reference %q: unsupported digest", image)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+	}
+	if name == "" || ref.Tag == "" && strings.HasSuffix(image, ":") {
+		return Reference{}, fmt.Errorf("invalid image reference %q", image)
+	}
+
+	ref.Domain = dockerHubDomain
+	if i := strings.Index(name, "/"); i >= 0 {
+		first := name[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			ref.Domain, name = first, name[i+1:]
+		}
+	}
+	if ref.Domain == dockerHubDomain && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	if name != strings.ToLower(name) {
+		return Reference{}, fmt.Errorf("invalid image reference %q: repository must be lowercase", image)
+	}
+	ref.Repository = name
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref, nil
+}
+
+// Client resolves image references against their registries. Only anonymous
+// (public) pulls are supported; Docker Hub style bearer token challenges are
+// answered without credentials.
+type Client struct {
+	http *http.Client
+	// insecure holds registry hosts reached over plain HTTP.
+	insecure map[string]bool
+
+	mu     sync.Mutex
+	tokens map[string]cachedToken // realm + scope → bearer token
+}
+
+// cachedToken is a bearer token and when it expires.
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// NewClient creates a registry client. insecure lists registry hosts
+// (host[:port] as written in image references) that are reached over plain
+// HTTP, e.g. a local registry.
+func NewClient(insecure []string) *Client {
+	c := &Client{
+		http:     &http.Client{Timeout: 30 * time.Second},
+		insecure: make(map[string]bool, len(insecure)),
+		tokens:   make(map[string]cachedToken),
+	}
+	for _, host := range insecure {
+		c.insecure[host] = true
+	}
+	return c
+}
+
+// Resolve returns the current manifest digest of image's tag. References
+// pinned by digest resolve to that digest without contacting the registry.
+func (c *Client) Resolve(ctx context.Context, image string) (string, error) {
+	ref, err := ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+
+	host := ref.Domain
+	if host == dockerHubDomain {
+		host = dockerHubRegistry
+	}
+	scheme := "https"
+	if c.insecure[ref.Domain] {
+		scheme = "http"
+	}
+	manifestURL := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, host, ref.Repository, ref.Tag)
+
+	// HEAD requests do not count against Docker Hub pull rate limits; fall
+	// back to GET for registries that do not return the digest header.
+	digest, err := c.manifestDigest(ctx, http.MethodHead, manifestURL, ref.Repository)
+	if err == nil && digest == "" {
+		digest, err = c.manifestDigest(ctx, http.MethodGet, manifestURL, ref.Repository)
+	}
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", image, err)
+	}
+	return digest, nil
+}
+
+// manifestDigest requests a manifest, answering one bearer token challenge,
+// and returns its digest from the Docker-Content-Digest header or, for GET
+// requests without one, the hash of the body.
+func (c *Client) manifestDigest(ctx context.Context, method, manifestURL, repository string) (string, error) {
+	resp, err := c.manifestRequest(ctx, method, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if resp, err = c.authorizedRequest(ctx, method, manifestURL, challenge, repository); err != nil {
+			return "", err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry returned %s", resp.Status)
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	if method == http.MethodHead {
+		return "", nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func (c *Client) manifestRequest(ctx context.Context, method, manifestURL, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestAccept, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.http.Do(req)
+}
+
+// authorizedRequest repeats a manifest request with a token answering
+// challenge. A cached token the registry rejects, e.g. because it was revoked
+// before it expired, is replaced with a fresh one.
+func (c *Client) authorizedRequest(ctx context.Context, method, manifestURL, challenge, repository string) (*http.Response, error) {
+	token, cached, err := c.token(ctx, challenge, repository, true)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.manifestRequest(ctx, method, manifestURL, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !cached {
+		return resp, err
+	}
+	resp.Body.Close()
+	if token, _, err = c.token(ctx, challenge, repository, false); err != nil {
+		return nil, err
+	}
+	return c.manifestRequest(ctx, method, manifestURL, token)
+}
+
+// token fetches an anonymous pull token for repository from the realm named
+// in a Bearer WWW-Authenticate challenge. Tokens are cached per realm and
+// scope until they expire; useCache false fetches a new one. cached reports
+// whether the token came from the cache.
+func (c *Client) token(ctx context.Context, challenge, repository string, useCache bool) (token string, cached bool, err error) {
+	scheme, params := parseChallenge(challenge)
+	if !strings.EqualFold(scheme, "bearer") || params["realm"] == "" {
+		return "", false, fmt.Errorf("registry requires authentication (%s)", strings.TrimSpace(challenge))
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + repository + ":pull"
+	}
+	key := params["realm"] + " " + scope
+
+	if useCache {
+		c.mu.Lock()
+		entry, ok := c.tokens[key]
+		c.mu.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			return entry.token, true, nil
+		}
+	}
+
+	query := url.Values{}
+	query.Set("scope", scope)
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", false, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", false, fmt.Errorf("fetch registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("fetch registry token: %s", resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		IssuedAt    string `json:"issued_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", false, fmt.Errorf("fetch registry token: %w", err)
+	}
+	token = body.Token
+	if token == "" {
+		token = body.AccessToken
+	}
+	if token == "" {
+		return "", false, fmt.Errorf("fetch registry token: empty token")
+	}
+
+	issued, lifetime := time.Now(), defaultTokenLifetime
+	if t, err := time.Parse(time.RFC3339, body.IssuedAt); err == nil {
+		issued = t
+	}
+	if body.ExpiresIn > 0 {
+		lifetime = time.Duration(body.ExpiresIn) * time.Second
+	}
+
+	c.mu.Lock()
+	c.tokens[key] = cachedToken{token: token, expires: issued.Add(lifetime)}
+	c.mu.Unlock()
+	return token, false, nil
+}
+
+// parseChallenge splits a WWW-Authenticate header such as
+// `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`
+// into its scheme and parameters.
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, ", "), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key != "" {
+			params[strings.ToLower(strings.TrimSpace(key))] = value
+		}
+	}
+	return scheme, params
+}
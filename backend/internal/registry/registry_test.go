@@ -0,0 +1,200 @@
+package registry_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/registry"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		image string
+		want  registry.Reference
+	}{
+		{"nginx", registry.Reference{Domain: "docker.io", Repository: "library/nginx", Tag: "latest"}},
+		{"nginx:1.27", registry.Reference{Domain: "docker.io", Repository: "library/nginx", Tag: "1.27"}},
+		{"grafana/grafana:10.4.1", registry.Reference{Domain: "docker.io", Repository: "grafana/grafana", Tag: "10.4.1"}},
+		{"localhost:5000/app", registry.Reference{Domain: "localhost:5000", Repository: "app", Tag: "latest"}},
+		{"ghcr.io/org/team/app:v2", registry.Reference{Domain: "ghcr.io", Repository: "org/team/app", Tag: "v2"}},
+		{"redis:7@sha256:abc", registry.Reference{Domain: "docker.io", Repository: "library/redis", Tag: "7", Digest: "sha256:abc"}},
+	}
+	for _, tt := range tests {
+		got, err := registry.ParseReference(tt.image)
+		if err != nil {
+			t.Errorf("ParseReference(%q): %v", tt.image, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseReference(%q) = %+v, want %+v", tt.image, got, tt.want)
+		}
+	}
+
+	for _, image := range []string{"", "nginx:", "Nginx:1", "app@md5:abc"} {
+		if _, err := registry.ParseReference(image); err == nil {
+			t.Errorf("expected %q to be rejected", image)
+		}
+	}
+}
+
+// fakeRegistry serves manifests for app:1.2 and, when token is set, requires
+// a bearer token obtained from its /token endpoint.
+func fakeRegistry(t *testing.T, digest, token string, withHeader bool) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var tokenRequests atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenRequests.Add(1)
+			if r.URL.Query().Get("scope") != "repository:app:pull" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `{"token":%q}`, token)
+			return
+		}
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake",scope="repository:app:pull"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/app/manifests/1.2" {
+			http.NotFound(w, r)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+			http.Error(w, "missing accept header", http.StatusBadRequest)
+			return
+		}
+		if withHeader {
+			w.Header().Set("Docker-Content-Digest", digest)
+		}
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, "{}")
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &tokenRequests
+}
+
+func TestClient_Resolve(t *testing.T) {
+	srv, _ := fakeRegistry(t, "sha256:1111", "", true)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	client := registry.NewClient([]string{host})
+
+	digest, err := client.Resolve(context.Background(), host+"/app:1.2")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if digest != "sha256:1111" {
+		t.Errorf("expected sha256:1111, got %s", digest)
+	}
+
+	if _, err := client.Resolve(context.Background(), host+"/app:9.9"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected not found error for unknown tag, got %v", err)
+	}
+	if digest, err := client.Resolve(context.Background(), host+"/app@sha256:2222"); err != nil || digest != "sha256:2222" {
+		t.Errorf("expected pinned digest without a lookup, got %q (%v)", digest, err)
+	}
+}
+
+func TestClient_ResolveWithToken(t *testing.T) {
+	srv, tokenRequests := fakeRegistry(t, "sha256:1111", "secret", true)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	client := registry.NewClient([]string{host})
+
+	for i := 0; i < 2; i++ {
+		digest, err := client.Resolve(context.Background(), host+"/app:1.2")
+		if err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+		if digest != "sha256:1111" {
+			t.Errorf("expected sha256:1111, got %s", digest)
+		}
+	}
+	if n := tokenRequests.Load(); n != 1 {
+		t.Errorf("expected the token to be cached, got %d token requests", n)
+	}
+}
+
+func TestClient_ResolveWithoutDigestHeader(t *testing.T) {
+	srv, _ := fakeRegistry(t, "", "", false)
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	digest, err := registry.NewClient([]string{host}).Resolve(context.Background(), host+"/app:1.2")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	// sha256 of the manifest body "{}".
+	if digest != "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a" {
+		t.Errorf("expected digest of the manifest body, got %s", digest)
+	}
+}
+
+// rotatingRegistry serves app:1.2 to holders of the token it issued last.
+// Each token request issues a new token, valid for expiresIn seconds from
+// issuedAt; revoke makes it reject the tokens issued so far.
+func rotatingRegistry(t *testing.T, expiresIn int, issuedAt time.Time) (srv *httptest.Server, tokenRequests *atomic.Int32, revoke func()) {
+	t.Helper()
+	tokenRequests = new(atomic.Int32)
+	var valid atomic.Int32
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			n := tokenRequests.Add(1)
+			valid.Store(n)
+			fmt.Fprintf(w, `{"token":"token-%d","expires_in":%d,"issued_at":%q}`, n, expiresIn, issuedAt.Format(time.RFC3339))
+			return
+		}
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", valid.Load()) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake",scope="repository:app:pull"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:1111")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, tokenRequests, func() { valid.Store(0) }
+}
+
+func TestClient_ResolveRefreshesRejectedToken(t *testing.T) {
+	srv, tokenRequests, revoke := rotatingRegistry(t, 300, time.Now())
+	host := strings.TrimPrefix(srv.URL, "http://")
+	client := registry.NewClient([]string{host})
+
+	if _, err := client.Resolve(context.Background(), host+"/app:1.2"); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	revoke()
+	digest, err := client.Resolve(context.Background(), host+"/app:1.2")
+	if err != nil {
+		t.Fatalf("expected a fresh token after the cached one was rejected, got %v", err)
+	}
+	if digest != "sha256:1111" {
+		t.Errorf("expected sha256:1111, got %s", digest)
+	}
+	if n := tokenRequests.Load(); n != 2 {
+		t.Errorf("expected 2 token requests, got %d", n)
+	}
+}
+
+func TestClient_ResolveRefreshesExpiredToken(t *testing.T) {
+	srv, tokenRequests, _ := rotatingRegistry(t, 300, time.Now().Add(-time.Hour))
+	host := strings.TrimPrefix(srv.URL, "http://")
+	client := registry.NewClient([]string{host})
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Resolve(context.Background(), host+"/app:1.2"); err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+	}
+	// The expired token is not sent: each lookup fetches a new one.
+	if n := tokenRequests.Load(); n != 2 {
+		t.Errorf("expected expired tokens not to be reused, got %d token requests", n)
+	}
+}
@@ -0,0 +1,176 @@
+// Package syncwindow evaluates sync windows: cron schedules that allow or
+// deny syncs for a duration after each start.
+package syncwindow
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window kinds.
+const (
+	KindAllow = "allow"
+	KindDeny  = "deny"
+)
+
+// BypassTrailer is the commit message trailer that lets a commit be synced
+// outside the sync windows, e.g. "Sync-Window: bypass".
+const BypassTrailer = "Sync-Window"
+
+// maxSteps bounds the search for the next open time through overlapping
+// windows.
+const maxSteps = 1000
+
+// Window opens (allow) or closes (deny) syncs for Duration after every start
+// of Schedule, a five-field cron expression evaluated in TimeZone (an IANA
+// name; empty is the local time zone).
+type Window struct {
+	Kind     string `yaml:"kind" json:"kind"`
+	Schedule string `yaml:"schedule" json:"schedule"`
+	Duration string `yaml:"duration" json:"duration"`
+	TimeZone string `yaml:"timezone" json:"timezone,omitempty"`
+}
+
+// compiled is a validated window.
+type compiled struct {
+	allow    bool
+	sched    schedule
+	duration time.Duration
+	loc      *time.Location
+}
+
+func (w Window) compile() (compiled, error) {
+	var c compiled
+	switch w.Kind {
+	case KindAllow:
+		c.allow = true
+	case KindDeny:
+	default:
+		return c, fmt.Errorf("invalid kind %q (must be allow or deny)", w.Kind)
+	}
+	var err error
+	if c.sched, err = parseSchedule(w.Schedule); err != nil {
+		return c, err
+	}
+	if c.duration, err = time.ParseDuration(w.Duration); err != nil || c.duration <= 0 {
+		return c, fmt.Errorf("invalid duration %q (must be positive, e.g. 3h)", w.Duration)
+	}
+	c.loc = time.Local
+	if w.TimeZone != "" {
+		if c.loc, err = time.LoadLocation(w.TimeZone); err != nil {
+			return c, fmt.Errorf("invalid timezone %q: %w", w.TimeZone, err)
+		}
+	}
+	return c, nil
+}
+
+// Validate reports whether w is a valid window.
+func (w Window) Validate() error {
+	_, err := w.compile()
+	return err
+}
+
+// active returns the start of the window's occurrence containing t, if any.
+func (c compiled) active(t time.Time) (time.Time, bool) {
+	start := c.sched.next(t.Add(-c.duration), c.loc)
+	if start.IsZero() || start.After(t) {
+		return time.Time{}, false
+	}
+	return start, true
+}
+
+// ParseList parses windows written as "kind minute hour dom month dow
+// duration [timezone]", separated by semicolons, e.g.
+// "allow 0 2 * * * 3h Europe/Berlin; deny 0 0 24-26 12 * 24h".
+func ParseList(s string) ([]Window, error) {
+	var windows []Window
+	for _, entry := range strings.Split(s, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 7 && len(fields) != 8 {
+			return nil, fmt.Errorf("sync window %q must be \"kind minute hour dom month dow duration [timezone]\"", strings.TrimSpace(entry))
+		}
+		w := Window{Kind: fields[0], Schedule: strings.Join(fields[1:6], " "), Duration: fields[6]}
+		if len(fields) == 8 {
+			w.TimeZone = fields[7]
+		}
+		if err := w.Validate(); err != nil {
+			return nil, fmt.Errorf("sync window %q: %w", strings.TrimSpace(entry), err)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// Open reports whether windows allow a sync at t: no deny window is active
+// and, if there are allow windows, one of them is. Without windows syncs are
+// always allowed. When closed, next is when the windows open again, or zero
+// if they do not open within a year. Invalid windows are ignored.
+func Open(windows []Window, t time.Time) (open bool, next time.Time) {
+	var cs []compiled
+	hasAllow := false
+	for _, w := range windows {
+		c, err := w.compile()
+		if err != nil {
+			continue
+		}
+		cs = append(cs, c)
+		hasAllow = hasAllow || c.allow
+	}
+
+	for step := 0; step < maxSteps; step++ {
+		allowed := !hasAllow
+		var candidate time.Time
+		consider := func(c time.Time) {
+			if !c.IsZero() && (candidate.IsZero() || c.Before(candidate)) {
+				candidate = c
+			}
+		}
+		denied := false
+		for _, c := range cs {
+			start, active := c.active(t)
+			switch {
+			case c.allow && active:
+				allowed = true
+			case c.allow:
+				consider(c.sched.next(t, c.loc))
+			case active:
+				denied = true
+				consider(start.Add(c.duration))
+			}
+		}
+		if allowed && !denied {
+			return step == 0, t
+		}
+		if candidate.IsZero() {
+			return false, time.Time{}
+		}
+		t = candidate
+	}
+	return false, time.Time{}
+}
+
+// Bypassed reports whether a commit message carries the bypass trailer with
+// a true value ("bypass", "true" or "yes") in its last paragraph.
+func Bypassed(commitMessage string) bool {
+	paragraphs := strings.Split(strings.TrimSpace(commitMessage), "\n\n")
+	if len(paragraphs) < 2 {
+		return false
+	}
+	scanner := bufio.NewScanner(strings.NewReader(paragraphs[len(paragraphs)-1]))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), BypassTrailer) {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "bypass", "true", "yes":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package syncwindow_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lucasreiners/docker-cd/internal/syncwindow"
+)
+
+func at(t *testing.T, s string) time.Time {
+	t.Helper()
+	v, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestOpen(t *testing.T) {
+	nightly := syncwindow.Window{Kind: "allow", Schedule: "0 2 * * *", Duration: "3h", TimeZone: "UTC"}
+	friday := syncwindow.Window{Kind: "deny", Schedule: "0 0 * * 5", Duration: "24h", TimeZone: "UTC"}
+
+	tests := []struct {
+		name     string
+		windows  []syncwindow.Window
+		now      string
+		wantOpen bool
+		wantNext string
+	}{
+		{"no windows", nil, "2026-03-04T12:00:00Z", true, "2026-03-04T12:00:00Z"},
+		{"inside allow", []syncwindow.Window{nightly}, "2026-03-04T03:30:00Z", true, "2026-03-04T03:30:00Z"},
+		{"before allow", []syncwindow.Window{nightly}, "2026-03-04T12:00:00Z", false, "2026-03-05T02:00:00Z"},
+		{"allow end is exclusive", []syncwindow.Window{nightly}, "2026-03-04T05:00:00Z", false, "2026-03-05T02:00:00Z"},
+		{"deny only", []syncwindow.Window{friday}, "2026-03-06T10:00:00Z", false, "2026-03-07T00:00:00Z"},
+		{"deny over allow", []syncwindow.Window{nightly, friday}, "2026-03-06T03:00:00Z", false, "2026-03-07T02:00:00Z"},
+		{"outside deny", []syncwindow.Window{friday}, "2026-03-05T10:00:00Z", true, "2026-03-05T10:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			open, next := syncwindow.Open(tt.windows, at(t, tt.now))
+			if open != tt.wantOpen || !next.Equal(at(t, tt.wantNext)) {
+				t.Errorf("got open=%v next=%s, want open=%v next=%s", open, next.UTC().Format(time.RFC3339), tt.wantOpen, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestOpen_TimeZone(t *testing.T) {
+	berlin := syncwindow.Window{Kind: "allow", Schedule: "0 2 * * *", Duration: "3h", TimeZone: "Europe/Berlin"}
+	// 02:00 in Berlin is 01:00 UTC in winter.
+	if open, _ := syncwindow.Open([]syncwindow.Window{berlin}, at(t, "2026-01-10T01:30:00Z")); !open {
+		t.Error("expected window open at 02:30 Berlin time")
+	}
+	if _, next := syncwindow.Open([]syncwindow.Window{berlin}, at(t, "2026-01-10T12:00:00Z")); !next.Equal(at(t, "2026-01-11T01:00:00Z")) {
+		t.Errorf("unexpected next open %s", next)
+	}
+}
+
+func TestParseList(t *testing.T) {
+	windows, err := syncwindow.ParseList("allow 0 2 * * 1-5 3h Europe/Berlin; deny */15 0 24-26 12 * 1h;")
+	if err != nil {
+		t.Fatalf("ParseList: %v", err)
+	}
+	want := []syncwindow.Window{
+		{Kind: "allow", Schedule: "0 2 * * 1-5", Duration: "3h", TimeZone: "Europe/Berlin"},
+		{Kind: "deny", Schedule: "*/15 0 24-26 12 *", Duration: "1h"},
+	}
+	if len(windows) != len(want) || windows[0] != want[0] || windows[1] != want[1] {
+		t.Errorf("got %+v, want %+v", windows, want)
+	}
+
+	for _, bad := range []string{
+		"open 0 2 * * * 3h",
+		"allow 0 2 * * 3h",
+		"allow 60 2 * * * 3h",
+		"allow 0 2 * * * -1h",
+		"allow 0 2 * * * 3h Mars/Base",
+		"allow 0 2-1 * * * 3h",
+	} {
+		if _, err := syncwindow.ParseList(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestBypassed(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{"Fix login\n\nSync-Window: bypass", true},
+		{"Fix login\n\nDetails here.\n\nReviewed-by: bob\nsync-window: true", true},
+		{"Fix login\n\nSync-Window: no", false},
+		{"Sync-Window: bypass", false},
+		{"Fix login\n\nSync-Window: bypass\n\nSigned-off-by: alice", false},
+	}
+	for _, tt := range tests {
+		if got := syncwindow.Bypassed(tt.msg); got != tt.want {
+			t.Errorf("Bypassed(%q) = %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
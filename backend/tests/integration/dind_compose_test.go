@@ -39,7 +39,7 @@ func TestDinD_ComposeUp_WritesFilesAndApplies(t *testing.T) {
 		t.Errorf("compose path should be absolute, got %q", composeFile)
 	}
 
-	err = composeRunner.ComposeUp(context.Background(), "mystack", composeFile, overrideFile, filepath.Dir(composeFile))
+	err = composeRunner.ComposeUp(context.Background(), "mystack", []string{composeFile}, nil, overrideFile, filepath.Dir(composeFile), reconcile.UpOptions{})
 	if err != nil {
 		t.Fatalf("compose up failed: %v", err)
 	}
@@ -87,13 +87,13 @@ func TestDinD_ComposeDown_RemovesContainers(t *testing.T) {
 	}
 	defer cleanup()
 
-	err = composeRunner.ComposeUp(context.Background(), "downstack", composeFile, overrideFile, filepath.Dir(composeFile))
+	err = composeRunner.ComposeUp(context.Background(), "downstack", []string{composeFile}, nil, overrideFile, filepath.Dir(composeFile), reconcile.UpOptions{})
 	if err != nil {
 		t.Fatalf("compose up failed: %v", err)
 	}
 	waitForContainers(t, runner, 1, 15*time.Second)
 
-	err = composeRunner.ComposeDown(context.Background(), "downstack", composeFile, filepath.Dir(composeFile))
+	err = composeRunner.ComposeDown(context.Background(), "downstack", composeFile, filepath.Dir(composeFile), reconcile.DownOptions{})
 	if err != nil {
 		t.Fatalf("compose down failed: %v", err)
 	}
@@ -225,6 +225,8 @@ func TestDinD_GetStackLabels_GroupsByStack(t *testing.T) {
 			"--label", fmt.Sprintf("%s=hash1", reconcile.LabelDesiredComposeHash),
 			"--label", fmt.Sprintf("%s=test deploy", reconcile.LabelDesiredCommitMessage),
 			"--label", fmt.Sprintf("%s=synced", reconcile.LabelSyncStatus),
+			"--label", fmt.Sprintf("%s=%s", reconcile.LabelOwnerInstance, reconcile.DefaultInstanceID),
+			"--label", fmt.Sprintf("%s=/", reconcile.LabelOwnerDeployDir),
 			"nginx:alpine",
 		)
 		if err != nil {
@@ -263,6 +265,8 @@ func TestDinD_GetStackLabels_MultipleStacks(t *testing.T) {
 			"--label", fmt.Sprintf("%s=%s", reconcile.LabelStackPath, stack),
 			"--label", fmt.Sprintf("%s=rev1", reconcile.LabelDesiredRevision),
 			"--label", fmt.Sprintf("%s=hash1", reconcile.LabelDesiredComposeHash),
+			"--label", fmt.Sprintf("%s=%s", reconcile.LabelOwnerInstance, reconcile.DefaultInstanceID),
+			"--label", fmt.Sprintf("%s=/", reconcile.LabelOwnerDeployDir),
 			"nginx:alpine",
 		)
 		if err != nil {
@@ -366,7 +370,7 @@ func TestDinD_LabelRoundTrip(t *testing.T) {
 	defer cleanup()
 
 	composeRunner := reconcile.NewDockerComposeRunner(runner, env.DockerHost)
-	err = composeRunner.ComposeUp(context.Background(), "labelrt", composeFile, overrideFile, filepath.Dir(composeFile))
+	err = composeRunner.ComposeUp(context.Background(), "labelrt", []string{composeFile}, nil, overrideFile, filepath.Dir(composeFile), reconcile.UpOptions{})
 	if err != nil {
 		t.Fatalf("compose up failed: %v", err)
 	}
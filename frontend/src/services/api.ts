@@ -6,7 +6,7 @@ export interface StackRecord {
   path: string
   composeFile: string
   composeHash: string
-  status: 'missing' | 'syncing' | 'synced' | 'deleting' | 'failed'
+  status: 'missing' | 'syncing' | 'synced' | 'deleting' | 'failed' | 'pull_failed' | 'pinned' | 'suspended' | 'pending_window' | 'pending_removal'
   containersRunning?: number
   containersTotal?: number
   syncedRevision?: string
@@ -16,6 +16,17 @@ export interface StackRecord {
   lastSyncAt?: string
   lastSyncStatus?: string
   lastSyncError?: string
+  pinnedRevision?: string
+  pinnedAt?: string
+  suspension?: Suspension
+  nextWindowAt?: string
+}
+
+export interface Suspension {
+  by?: string
+  reason?: string
+  at: string
+  expiresAt?: string
 }
 
 export interface ContainerInfo {
@@ -78,7 +89,7 @@ export function getEventsURL(): string {
 }
 
 export async function fetchContainers(stackPath: string): Promise<ContainerInfo[]> {
-  const res = await fetch(`${getBaseURL()}/api/stacks/containers/${stackPath}`)
+  const res = await fetch(`${getBaseURL()}/api/stacks/${stackPath}/-/containers`)
   if (!res.ok) {
     throw new Error(`Failed to fetch containers: ${res.status}`)
   }
@@ -50,7 +50,9 @@ export const useStacksStore = defineStore('stacks', () => {
       deleting: 0,
     }
     for (const s of stacks.value) {
-      counts[s.status] = (counts[s.status] ?? 0) + 1
+      // Pull failures are counted as failed.
+      const status = s.status === 'pull_failed' ? 'failed' : s.status
+      counts[status] = (counts[status] ?? 0) + 1
     }
     return counts
   })